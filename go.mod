@@ -4,6 +4,7 @@ go 1.12
 
 require (
 	github.com/docker/docker v1.4.2-0.20180531152204-71cd53e4a197
+	github.com/docker/docker-credential-helpers v0.6.3
 	github.com/evanphx/json-patch v4.2.0+incompatible // indirect
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/google/btree v1.0.0 // indirect
@@ -23,7 +24,7 @@ require (
 	golang.org/x/tools v0.0.0-20190926165942-a8d5d34286bd
 	gopkg.in/yaml.v2 v2.2.2
 	k8s.io/apimachinery v0.0.0-20180904193909-def12e63c512
-	k8s.io/client-go v8.0.0+incompatible // indirect
+	k8s.io/client-go v8.0.0+incompatible
 	k8s.io/kubernetes v1.11.10
 	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+// annotated wraps a v1.Image, adding annotations to its manifest.
+type annotated struct {
+	v1.Image
+	annotations map[string]string
+}
+
+// annotated implements v1.Image
+var _ v1.Image = (*annotated)(nil)
+
+// annotate returns a v1.Image whose manifest carries the provided annotations
+// in addition to any that the manifest of img already has.
+func annotate(img v1.Image, annotations map[string]string) v1.Image {
+	return &annotated{
+		Image:       img,
+		annotations: annotations,
+	}
+}
+
+// Manifest implements v1.Image
+func (a *annotated) Manifest() (*v1.Manifest, error) {
+	m, err := a.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+	if m.Annotations == nil {
+		m.Annotations = make(map[string]string, len(a.annotations))
+	}
+	for k, v := range a.annotations {
+		m.Annotations[k] = v
+	}
+	return m, nil
+}
+
+// RawManifest implements v1.Image
+func (a *annotated) RawManifest() ([]byte, error) {
+	m, err := a.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// Digest implements v1.Image
+func (a *annotated) Digest() (v1.Hash, error) {
+	return partial.Digest(a)
+}
+
+// Size implements v1.Image
+func (a *annotated) Size() (int64, error) {
+	b, err := a.RawManifest()
+	if err != nil {
+		return -1, err
+	}
+	return int64(len(b)), nil
+}
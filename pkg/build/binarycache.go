@@ -0,0 +1,182 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// binaryCache keeps the binaries that "go build" produces in a directory,
+// keyed on the hash of everything that goes into them, so that building the
+// same inputs again, even from another invocation, doesn't run "go build".
+type binaryCache struct {
+	dir string
+	// hash hashes the inputs of building an import path for a platform
+	// with a config, e.g. sourceHash.
+	hash func(string, v1.Platform, buildConfig) (string, error)
+
+	m sync.Mutex
+	// goVersions memoizes the versions of the go commands we build with.
+	goVersions map[string]string
+}
+
+// key returns the key of the binary of building s for platform with config:
+// a hash of its inputs, of how "go build" is run, and of the go command's
+// version and environment.
+func (bc *binaryCache) key(s string, platform v1.Platform, config buildConfig) (string, error) {
+	inputs, err := bc.hash(s, platform, config)
+	if err != nil {
+		return "", err
+	}
+	version, err := bc.goVersion(config.goCommand())
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "inputs %s\n", inputs)
+	fmt.Fprintf(h, "platform %s/%s/%s\n", platform.OS, platform.Architecture, platform.Variant)
+	fmt.Fprintf(h, "version %s\n", version)
+	fmt.Fprintf(h, "args %q\n", buildArgs(s, "out", config))
+	fmt.Fprintf(h, "env %q\n", config.env)
+	// The toolchain reads its settings, such as GOFLAGS or GOAMD64, from
+	// the environment too.
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "GO") || strings.HasPrefix(kv, "CGO_") {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	fmt.Fprintf(h, "environ %q\n", env)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goVersion returns the output of "go version" for goBinary.
+func (bc *binaryCache) goVersion(goBinary string) (string, error) {
+	bc.m.Lock()
+	defer bc.m.Unlock()
+	if v, ok := bc.goVersions[goBinary]; ok {
+		return v, nil
+	}
+	out, err := exec.Command(goBinary, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s version: %v", goBinary, err)
+	}
+	if bc.goVersions == nil {
+		bc.goVersions = make(map[string]string)
+	}
+	bc.goVersions[goBinary] = strings.TrimSpace(string(out))
+	return bc.goVersions[goBinary], nil
+}
+
+// get copies the binary cached under key into a new directory within
+// tempDir, as "go build" would have output it.
+func (bc *binaryCache) get(key, tempDir string) (string, error) {
+	cached, err := os.Open(filepath.Join(bc.dir, key))
+	if err != nil {
+		return "", err
+	}
+	defer cached.Close()
+	tmpDir, err := ioutil.TempDir(tempDir, "ko")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(tmpDir, "out")
+	if err := copyBinary(file, cached); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	return file, nil
+}
+
+// put caches the binary in file under key.  It's copied into place under
+// another name first, so that concurrent builds never see part of it.
+func (bc *binaryCache) put(key, file string) error {
+	if err := os.MkdirAll(bc.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tmp, err := ioutil.TempFile(bc.dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := copyBinary(tmp.Name(), f); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(bc.dir, key))
+}
+
+// copyBinary writes the contents of r to the executable file path.
+func copyBinary(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// buildCached builds s for platform, reusing the binary of a previous build
+// of the same inputs if we keep a cache of them.
+func (gb *gobuild) buildCached(s string, platform v1.Platform) (string, error) {
+	if gb.binaryCache == nil {
+		return gb.buildWithRetries(s, platform)
+	}
+	config := gb.buildConfig()
+	key, err := gb.binaryCache.key(s, platform, config)
+	if err != nil {
+		// Leave it to the build to report what's wrong with s.
+		log.Printf("Not caching the binary of %s: %v", s, err)
+		return gb.buildWithRetries(s, platform)
+	}
+	file, err := gb.binaryCache.get(key, config.tempDir)
+	if err == nil {
+		log.Printf("Using the cached binary of %s", s)
+		return file, nil
+	}
+	if !os.IsNotExist(err) {
+		log.Printf("Unable to use the cached binary of %s: %v", s, err)
+	}
+	file, err = gb.buildWithRetries(s, platform)
+	if err != nil {
+		return "", err
+	}
+	if err := gb.binaryCache.put(key, file); err != nil {
+		log.Printf("Unable to cache the binary of %s: %v", s, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestGoBuildBinaryCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-binaries")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko", "test")
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	hash := "1"
+	builds := 0
+	// Each build is by a new builder, as each invocation of ko makes its own.
+	build := func(opts ...Option) v1.Image {
+		opts = append(opts,
+			WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+			WithPlatform(platform),
+			withBinaryCache(dir, func(string, v1.Platform, buildConfig) (string, error) { return hash, nil }),
+			withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+				builds++
+				return writeTempFile(s, p, c)
+			}),
+		)
+		ng, err := NewGo(opts...)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		img, err := ng.Build(importpath)
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+		return img
+	}
+
+	first := build()
+	if builds != 1 {
+		t.Fatalf("ran go build %d times, want 1", builds)
+	}
+	// Building the same inputs again skips go build, for the same image.
+	if got, want := digest(t, build()), digest(t, first); got != want {
+		t.Errorf("Build() = %v from the cache, want %v", got, want)
+	}
+	if builds != 1 {
+		t.Errorf("ran go build %d times for the same inputs, want 1", builds)
+	}
+
+	// Building differently, or changed inputs, runs go build again.
+	build(WithDisabledOptimizations())
+	if builds != 2 {
+		t.Errorf("ran go build %d times after changing the build flags, want 2", builds)
+	}
+	hash = "2"
+	build()
+	if builds != 3 {
+		t.Errorf("ran go build %d times after changing the inputs, want 3", builds)
+	}
+}
+
+func TestBinaryCacheOptionErrors(t *testing.T) {
+	if _, err := NewGo(WithBaseImages(nil), WithBinaryCache("")); err == nil {
+		t.Error("NewGo(WithBinaryCache(\"\")) = nil, want error")
+	}
+}
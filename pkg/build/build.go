@@ -15,6 +15,8 @@
 package build
 
 import (
+	"fmt"
+
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
@@ -29,3 +31,39 @@ type Interface interface {
 	// Build turns the given importpath reference into a v1.Image containing the Go binary.
 	Build(string) (v1.Image, error)
 }
+
+// PlatformInterface is implemented by builders that can also build an
+// importpath reference for a specific platform.
+type PlatformInterface interface {
+	Interface
+
+	// BuildPlatform turns the given importpath reference into a v1.Image
+	// containing the Go binary built for the given platform.
+	BuildPlatform(string, v1.Platform) (v1.Image, error)
+}
+
+// InputHasher is implemented by builders that can hash the inputs of building
+// an importpath reference, as they build it, e.g. to key cached builds on.
+type InputHasher interface {
+	// InputHash returns a hash of the inputs of building the given
+	// importpath reference, which changes whenever they do.
+	InputHash(string) (string, error)
+}
+
+// BuildPlatform builds ip for platform with b, if b supports that.
+func BuildPlatform(b Interface, ip string, platform v1.Platform) (v1.Image, error) {
+	pb, ok := b.(PlatformInterface)
+	if !ok {
+		return nil, fmt.Errorf("cannot build %s for %s, the builder doesn't support choosing a platform", ip, platformString(platform))
+	}
+	return pb.BuildPlatform(ip, platform)
+}
+
+// platformString formats platform as os/arch[/variant].
+func platformString(platform v1.Platform) string {
+	s := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		s += "/" + platform.Variant
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// buildpacks is a placeholder for a build.Interface implementation backed by
+// Cloud Native Buildpacks.  It doesn't support building anything yet, but
+// allows the plumbing for selecting a builder to be exercised.
+type buildpacks struct{}
+
+// buildpacks implements Interface
+var _ Interface = (*buildpacks)(nil)
+
+// NewBuildpacks returns a build.Interface implementation that will build
+// references using Cloud Native Buildpacks.
+func NewBuildpacks() (Interface, error) {
+	return &buildpacks{}, nil
+}
+
+// IsSupportedReference implements build.Interface
+//
+// No references are supported yet.
+func (b *buildpacks) IsSupportedReference(string) bool {
+	return false
+}
+
+// Build implements build.Interface
+func (b *buildpacks) Build(s string) (v1.Image, error) {
+	return nil, fmt.Errorf("building %q with buildpacks is not implemented", s)
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestBuildpacksUnsupported(t *testing.T) {
+	bp, err := NewBuildpacks()
+	if err != nil {
+		t.Fatalf("NewBuildpacks() = %v", err)
+	}
+
+	importpath := "github.com/google/ko/cmd/ko"
+	if bp.IsSupportedReference(importpath) {
+		t.Errorf("IsSupportedReference(%q) = true, want false", importpath)
+	}
+	if img, err := bp.Build(importpath); err == nil {
+		t.Errorf("Build(%q) = %v, want error", importpath, img)
+	}
+}
+
+// Each of the builders we can select between must compose with the wrappers
+// we put around them.
+func TestBuilderConformance(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	gb, err := NewGo(WithBaseImages(func(string) (v1.Image, error) { return base, nil }))
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	rb, cleanup := newRemoteForTest(t, gb)
+	defer cleanup()
+
+	for _, test := range []struct {
+		name    string
+		builder func() (Interface, error)
+	}{{
+		name: "go",
+		builder: func() (Interface, error) {
+			return NewGo(WithBaseImages(func(string) (v1.Image, error) { return base, nil }))
+		},
+	}, {
+		name:    "buildpacks",
+		builder: NewBuildpacks,
+	}, {
+		name: "remote",
+		builder: func() (Interface, error) {
+			return rb, nil
+		},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			inner, err := test.builder()
+			if err != nil {
+				t.Fatalf("builder() = %v", err)
+			}
+			cb, err := NewCaching(NewLimiter(inner, 1))
+			if err != nil {
+				t.Fatalf("NewCaching() = %v", err)
+			}
+
+			ip := "github.com/google/ko/pkg/nonexistent"
+			if got, want := cb.IsSupportedReference(ip), inner.IsSupportedReference(ip); got != want {
+				t.Errorf("IsSupportedReference(%q) = %v, want %v", ip, got, want)
+			}
+			if _, err := cb.Build(ip); err == nil {
+				t.Errorf("Build(%q) = nil, want error", ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// shells are the shells we look for in base images for --debug-entrypoint,
+// in order of preference.  /busybox/sh is where the distroless debug images
+// keep theirs.
+var shells = []string{"/bin/sh", "/bin/bash", "/busybox/sh"}
+
+// findShell returns the path of a shell in the base image, which may be a
+// regular file or a link, or an error if it has none.
+func findShell(base v1.Image) (string, error) {
+	layers, err := base.Layers()
+	if err != nil {
+		return "", err
+	}
+	found := make(map[string]bool)
+	for _, layer := range layers {
+		if err := shellsInLayer(layer, found); err != nil {
+			return "", err
+		}
+	}
+	for _, shell := range shells {
+		if found[shell] {
+			return shell, nil
+		}
+	}
+	return "", errors.New("the base image has no shell to use as the entrypoint, looked for " + strings.Join(shells, ", "))
+}
+
+// shellsInLayer updates found with the shells that the layer adds, or
+// removes with whiteouts.
+func shellsInLayer(layer v1.Layer, found map[string]bool) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		dir, base := path.Split(name)
+		if strings.HasPrefix(base, ".wh.") {
+			delete(found, path.Join(dir, strings.TrimPrefix(base, ".wh.")))
+			continue
+		}
+		for _, shell := range shells {
+			if name == shell {
+				found[shell] = header.Typeflag != tar.TypeDir
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// withFiles returns base with a layer holding empty files at paths.
+func withFiles(t *testing.T, base v1.Image, paths ...string) v1.Image {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, p := range paths {
+		if err := tw.WriteHeader(&tar.Header{Name: p, Typeflag: tar.TypeReg, Mode: 0755}); err != nil {
+			t.Fatalf("WriteHeader() = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("LayerFromOpener() = %v", err)
+	}
+	img, err := mutate.AppendLayers(base, layer)
+	if err != nil {
+		t.Fatalf("AppendLayers() = %v", err)
+	}
+	return img
+}
+
+func TestGoBuildDebugEntrypoint(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		base    v1.Image
+		want    string
+		wantErr bool
+	}{{
+		desc: "sh",
+		base: withFiles(t, img, "bin/bash", "bin/sh"),
+		want: "/bin/sh",
+	}, {
+		desc: "busybox",
+		base: withFiles(t, img, "busybox/sh"),
+		want: "/busybox/sh",
+	}, {
+		desc: "removed",
+		base: withFiles(t, withFiles(t, img, "bin/sh", "bin/bash"), "bin/.wh.sh"),
+		want: "/bin/bash",
+	}, {
+		desc:    "no shell",
+		base:    img,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithDebugEntrypoint(),
+				WithBaseImages(func(string) (v1.Image, error) { return test.base, nil }),
+				withBuilder(writeTempFile),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			if diff := cmp.Diff([]string{test.want}, cfg.Config.Entrypoint); diff != "" {
+				t.Errorf("Entrypoint; (-want +got) = %v", diff)
+			}
+			found := false
+			for _, entry := range cfg.Config.Env {
+				if entry == "KO_APP_PATH=/ko-app/test" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Env = %v, want KO_APP_PATH=/ko-app/test", cfg.Config.Env)
+			}
+		})
+	}
+}
@@ -18,15 +18,20 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	gb "go/build"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -35,20 +40,96 @@ import (
 )
 
 const (
-	appDir             = "/ko-app"
+	defaultAppDir      = "/ko-app"
 	defaultAppFilename = "ko-app"
+
+	defaultKoDataEnvName = "KO_DATA_PATH"
 )
 
+// RaceLabel is the label set to "true" on images whose binaries were built
+// with the race detector.
+const RaceLabel = "dev.ko.race"
+
+// SourceHashLabel is the label set, with WithSourceHash, to the hash of the
+// source that images were built from.
+const SourceHashLabel = "dev.ko.source-hash"
+
 // GetBase takes an importpath and returns a base v1.Image.
 type GetBase func(string) (v1.Image, error)
-type builder func(string, v1.Platform, bool) (string, error)
+
+// GetPlatformBase is like GetBase, but for building the import path for the
+// given platform.
+type GetPlatformBase func(string, v1.Platform) (v1.Image, error)
+
+// VerifyBase takes an importpath and the base v1.Image it is to be built on,
+// and returns an error if the base may not be used, e.g. it isn't signed.
+type VerifyBase func(string, v1.Image) error
+
+// PreBuildHook takes an importpath and runs before it is built, e.g. to
+// generate code, failing the build if it returns an error.
+type PreBuildHook func(context.Context, string) error
+type builder func(string, v1.Platform, buildConfig) (string, error)
+
+// buildConfig holds the settings for an invocation of "go build".
+type buildConfig struct {
+	disableOptimizations bool
+	// env holds additional environment variables, which take precedence
+	// over our own environment.
+	env []string
+	// tempDir is the directory to write build output under, or "" for the
+	// default temporary directory.
+	tempDir string
+	// modMode is passed as -mod to "go build", unless it is "".
+	modMode string
+	// goBinary is the go command to run, or "" for the one on PATH.
+	goBinary string
+	// race builds with the race detector, which requires cgo.
+	race bool
+	// buildVCS is passed as -buildvcs to "go build", unless it is "".
+	buildVCS string
+	// logDir is the directory to write the output of "go build" to, in a
+	// file per import path, or "" to only log it when the build fails.
+	logDir string
+}
 
 type gobuild struct {
 	getBase              GetBase
+	getPlatformBase      GetPlatformBase
+	verifyBase           VerifyBase
 	creationTime         v1.Time
 	build                builder
 	disableOptimizations bool
 	mod                  *modInfo
+	annotations          map[string]string
+	platform             *v1.Platform
+	caCerts              string
+	bundles              map[string][]string
+	tempDir              string
+	validateBinaries     bool
+	stopSignal           string
+	appDir               string
+	modMode              string
+	version              string
+	debugEntrypoint      bool
+	healthcheck          *v1.HealthConfig
+	goCache              string
+	goBinary             string
+	race                 bool
+	defaultArgs          []string
+	checkLicense         bool
+	extraHosts           map[string]string
+	buildVCS             string
+	maxImageSize         int64
+	buildLogDir          string
+	koDataEnvName        string
+	sourceHash           func(string, v1.Platform, buildConfig) (string, error)
+	preBuildHooks        []PreBuildHook
+	buildRetries         int
+	scratchBase          bool
+	owner                layerOwner
+	entrypointWrapper    string
+	binaryCache          *binaryCache
+	entrypoints          map[string]string
 }
 
 // Option is a functional option for NewGo.
@@ -56,22 +137,98 @@ type Option func(*gobuildOpener) error
 
 type gobuildOpener struct {
 	getBase              GetBase
+	getPlatformBase      GetPlatformBase
+	verifyBase           VerifyBase
 	creationTime         v1.Time
 	build                builder
 	disableOptimizations bool
 	mod                  *modInfo
+	annotations          map[string]string
+	platform             *v1.Platform
+	caCerts              string
+	bundles              map[string][]string
+	tempDir              string
+	validateBinaries     bool
+	stopSignal           string
+	appDir               string
+	modMode              string
+	version              string
+	debugEntrypoint      bool
+	healthcheck          *v1.HealthConfig
+	goCache              string
+	goBinary             string
+	race                 bool
+	defaultArgs          []string
+	checkLicense         bool
+	extraHosts           map[string]string
+	buildVCS             string
+	maxImageSize         int64
+	buildLogDir          string
+	koDataEnvName        string
+	sourceHash           func(string, v1.Platform, buildConfig) (string, error)
+	preBuildHooks        []PreBuildHook
+	buildRetries         int
+	scratchBase          bool
+	owner                layerOwner
+	entrypointWrapper    string
+	binaryCache          *binaryCache
+	entrypoints          map[string]string
 }
 
 func (gbo *gobuildOpener) Open() (Interface, error) {
+	if gbo.scratchBase {
+		if gbo.race {
+			return nil, errors.New("binaries built with the race detector use cgo, so they can't run on a scratch base")
+		}
+		gbo.getBase = scratchBase
+		gbo.getPlatformBase = nil
+		// The empty base doesn't say what it's for, and only Linux
+		// binaries can run on it, whatever the host is.
+		if gbo.platform == nil {
+			gbo.platform = &v1.Platform{OS: "linux", Architecture: runtime.GOARCH}
+		}
+	}
 	if gbo.getBase == nil {
 		return nil, errors.New("a way of providing base images must be specified, see build.WithBaseImages")
 	}
 	return &gobuild{
 		getBase:              gbo.getBase,
+		getPlatformBase:      gbo.getPlatformBase,
+		verifyBase:           gbo.verifyBase,
 		creationTime:         gbo.creationTime,
 		build:                gbo.build,
 		disableOptimizations: gbo.disableOptimizations,
 		mod:                  gbo.mod,
+		annotations:          gbo.annotations,
+		platform:             gbo.platform,
+		caCerts:              gbo.caCerts,
+		bundles:              gbo.bundles,
+		tempDir:              gbo.tempDir,
+		validateBinaries:     gbo.validateBinaries,
+		stopSignal:           gbo.stopSignal,
+		appDir:               gbo.appDir,
+		modMode:              gbo.modMode,
+		version:              gbo.version,
+		debugEntrypoint:      gbo.debugEntrypoint,
+		healthcheck:          gbo.healthcheck,
+		goCache:              gbo.goCache,
+		goBinary:             gbo.goBinary,
+		race:                 gbo.race,
+		defaultArgs:          gbo.defaultArgs,
+		checkLicense:         gbo.checkLicense,
+		extraHosts:           gbo.extraHosts,
+		buildVCS:             gbo.buildVCS,
+		maxImageSize:         gbo.maxImageSize,
+		buildLogDir:          gbo.buildLogDir,
+		koDataEnvName:        gbo.koDataEnvName,
+		sourceHash:           gbo.sourceHash,
+		preBuildHooks:        gbo.preBuildHooks,
+		buildRetries:         gbo.buildRetries,
+		scratchBase:          gbo.scratchBase,
+		owner:                gbo.owner,
+		entrypointWrapper:    gbo.entrypointWrapper,
+		binaryCache:          gbo.binaryCache,
+		entrypoints:          gbo.entrypoints,
 	}, nil
 }
 
@@ -102,8 +259,10 @@ func moduleInfo() *modInfo {
 //  2. containerizes the binary on a suitable base,
 func NewGo(options ...Option) (Interface, error) {
 	gbo := &gobuildOpener{
-		build: build,
-		mod:   moduleInfo(),
+		build:         build,
+		mod:           moduleInfo(),
+		appDir:        defaultAppDir,
+		koDataEnvName: defaultKoDataEnvName,
 	}
 
 	for _, option := range options {
@@ -147,63 +306,185 @@ func (g *gobuild) importPackage(s string) (*gb.Package, error) {
 	return nil, moduleErr
 }
 
-func build(ip string, platform v1.Platform, disableOptimizations bool) (string, error) {
-	tmpDir, err := ioutil.TempDir("", "ko")
+func build(ip string, platform v1.Platform, config buildConfig) (string, error) {
+	tmpDir, err := ioutil.TempDir(config.tempDir, "ko")
 	if err != nil {
 		return "", err
 	}
 	file := filepath.Join(tmpDir, "out")
 
-	args := make([]string, 0, 6)
-	args = append(args, "build")
-	if disableOptimizations {
-		// Disable optimizations (-N) and inlining (-l).
-		args = append(args, "-gcflags", "all=-N -l")
-	}
-	args = append(args, "-o", file)
-	args = append(args, ip)
-	cmd := exec.Command("go", args...)
-
-	// Last one wins
-	defaultEnv := []string{
-		"CGO_ENABLED=0",
-		"GOOS=" + platform.OS,
-		"GOARCH=" + platform.Architecture,
-	}
-	cmd.Env = append(defaultEnv, os.Environ()...)
+	cmd := exec.Command(config.goCommand(), buildArgs(ip, file, config)...)
+	cmd.Env = buildEnv(platform, config)
 
 	var output bytes.Buffer
 	cmd.Stderr = &output
 	cmd.Stdout = &output
 
 	log.Printf("Building %s", ip)
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	if config.logDir != "" {
+		if lerr := writeBuildLog(config.logDir, ip, output.Bytes()); lerr != nil {
+			if err == nil {
+				os.RemoveAll(tmpDir)
+				return "", lerr
+			}
+			log.Printf("Unable to write the build log of %s: %v", ip, lerr)
+		}
+	}
+	if err != nil {
 		os.RemoveAll(tmpDir)
 		log.Printf("Unexpected error running \"go build\": %v\n%v", err, output.String())
-		return "", err
+		return "", &buildOutputError{err: err, output: output.String()}
 	}
 	return file, nil
 }
 
-func appFilename(importpath string) string {
+// goCommand returns the go command that config builds with.
+func (config buildConfig) goCommand() string {
+	if config.goBinary != "" {
+		return config.goBinary
+	}
+	return "go"
+}
+
+// buildEnv returns the environment to run the go command in to build for
+// platform with config.
+func buildEnv(platform v1.Platform, config buildConfig) []string {
+	// Last one wins
+	cgo := "CGO_ENABLED=0"
+	if config.race {
+		cgo = "CGO_ENABLED=1"
+	}
+	defaultEnv := []string{
+		cgo,
+		"GOOS=" + platform.OS,
+		"GOARCH=" + platform.Architecture,
+	}
+	env := append(defaultEnv, os.Environ()...)
+	return append(env, config.env...)
+}
+
+// buildLogPath returns the path within dir to write the build log of ip to.
+// Import paths can't climb out of dir, even relative ones.
+func buildLogPath(dir, ip string) string {
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+ip), "/"))+".log")
+}
+
+// writeBuildLog writes output, the output of building ip, to its log in dir.
+func writeBuildLog(dir, ip string, output []byte) error {
+	file := buildLogPath(dir, ip)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, output, 0644)
+}
+
+// buildArgs returns the arguments to "go build" ip into file.
+func buildArgs(ip, file string, config buildConfig) []string {
+	args := make([]string, 0, 8)
+	args = append(args, "build")
+	if config.disableOptimizations {
+		// Disable optimizations (-N) and inlining (-l).
+		args = append(args, "-gcflags", "all=-N -l")
+	}
+	if config.race {
+		args = append(args, "-race")
+	}
+	if config.modMode != "" {
+		args = append(args, "-mod="+config.modMode)
+	}
+	if config.buildVCS != "" {
+		args = append(args, "-buildvcs="+config.buildVCS)
+	}
+	args = append(args, "-o", file)
+	return append(args, ip)
+}
+
+// buildConfig returns the settings to pass to our builder.
+func (g *gobuild) buildConfig() buildConfig {
+	config := buildConfig{
+		disableOptimizations: g.disableOptimizations,
+		tempDir:              g.tempDir,
+		modMode:              g.modMode,
+		goBinary:             g.goBinary,
+		race:                 g.race,
+		buildVCS:             g.buildVCS,
+		logDir:               g.buildLogDir,
+	}
+	if config.modMode == "" && g.vendored() {
+		config.modMode = "vendor"
+	}
+	if g.caCerts != "" {
+		// Trust the bundle when fetching modules over https, either
+		// directly or via git.
+		config.env = append(config.env,
+			"SSL_CERT_FILE="+g.caCerts,
+			"GIT_SSL_CAINFO="+g.caCerts)
+	}
+	if g.goCache != "" {
+		config.env = append(config.env, "GOCACHE="+g.goCache)
+	}
+	if len(g.extraHosts) > 0 {
+		config.env = append(config.env, extraHostsEnv(g.extraHosts)...)
+	}
+	if g.scratchBase {
+		// Nothing on the base for cgo's binaries to link against, whatever
+		// our environment says.
+		config.env = append(config.env, "CGO_ENABLED=0")
+	}
+	return config
+}
+
+// vendored reports whether we're building a module with a vendor directory,
+// which "go build" should use instead of fetching modules, unless GOFLAGS
+// already says what to do.
+func (g *gobuild) vendored() bool {
+	if g.mod == nil || strings.Contains(os.Getenv("GOFLAGS"), "-mod=") {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(g.mod.Dir, "vendor"))
+	return err == nil && fi.IsDir()
+}
+
+// appFilename returns the name to give the binary built from importpath in
+// images for goos, where Windows requires an .exe extension.
+func appFilename(importpath, goos string) string {
 	base := filepath.Base(importpath)
 
 	// If we fail to determine a good name from the importpath then use a
 	// safe default.
 	if base == "." || base == string(filepath.Separator) {
-		return defaultAppFilename
+		base = defaultAppFilename
 	}
 
+	if isWindows(goos) {
+		return base + ".exe"
+	}
 	return base
 }
 
-func tarAddDirectories(tw *tar.Writer, dir string) error {
+// containerPath returns the path that containers for goos see the
+// absolute image path p at.
+func containerPath(p, goos string) string {
+	if isWindows(goos) {
+		return windowsPath(p)
+	}
+	return p
+}
+
+// layerOwner is the user and group that own the entries of the layers that
+// we write.
+type layerOwner struct {
+	uid, gid int
+}
+
+func tarAddDirectories(tw *tar.Writer, dir string, owner layerOwner) error {
 	if dir == "." || dir == string(filepath.Separator) {
 		return nil
 	}
 
 	// Write parent directories first
-	if err := tarAddDirectories(tw, filepath.Dir(dir)); err != nil {
+	if err := tarAddDirectories(tw, filepath.Dir(dir), owner); err != nil {
 		return err
 	}
 
@@ -215,6 +496,8 @@ func tarAddDirectories(tw *tar.Writer, dir string) error {
 		// under which it was created. Additionally, windows can only set 0222,
 		// 0444, or 0666, none of which are executable.
 		Mode: 0555,
+		Uid:  owner.uid,
+		Gid:  owner.gid,
 	}); err != nil {
 		return err
 	}
@@ -222,7 +505,8 @@ func tarAddDirectories(tw *tar.Writer, dir string) error {
 	return nil
 }
 
-func tarBinary(name, binary string) (*bytes.Buffer, error) {
+// tarBinary writes binary to a layer at name, laid out for goos.
+func tarBinary(name, binary, goos string, owner layerOwner) (*bytes.Buffer, error) {
 	buf := bytes.NewBuffer(nil)
 	// Compress this before calling tarball.LayerFromOpener, since it eagerly
 	// calculates digests and diffids. This prevents us from double compressing
@@ -234,8 +518,12 @@ func tarBinary(name, binary string) (*bytes.Buffer, error) {
 	tw := tar.NewWriter(gw)
 	defer tw.Close()
 
+	if isWindows(goos) {
+		name = windowsLayerPath(name)
+	}
+
 	// write the parent directories to the tarball archive
-	if err := tarAddDirectories(tw, filepath.Dir(name)); err != nil {
+	if err := tarAddDirectories(tw, filepath.Dir(name), owner); err != nil {
 		return nil, err
 	}
 
@@ -256,6 +544,11 @@ func tarBinary(name, binary string) (*bytes.Buffer, error) {
 		// under which it was created. Additionally, windows can only set 0222,
 		// 0444, or 0666, none of which are executable.
 		Mode: 0555,
+		Uid:  owner.uid,
+		Gid:  owner.gid,
+	}
+	if isWindows(goos) {
+		header.PAXRecords = map[string]string{"MSWINDOWS.rawsd": userOwnerAndGroupSID}
 	}
 	// write the header to the tarball archive
 	if err := tw.WriteHeader(header); err != nil {
@@ -265,6 +558,12 @@ func tarBinary(name, binary string) (*bytes.Buffer, error) {
 	if _, err := io.Copy(tw, file); err != nil {
 		return nil, err
 	}
+	if isWindows(goos) {
+		// This sorts after Files/, keeping the entries in order.
+		if err := tarAddWindowsHives(tw); err != nil {
+			return nil, err
+		}
+	}
 
 	return buf, nil
 }
@@ -280,21 +579,61 @@ func (g *gobuild) kodataPath(s string) (string, error) {
 // Where kodata lives in the image.
 const kodataRoot = "/var/run/ko"
 
+// kodataMode returns the mode to give a file from kodata in the image.  Only
+// whether the file is executable is kept, so that this isn't sensitive to
+// the umask under which it was created.  Windows can only set 0222, 0444,
+// or 0666, none of which are executable, so there we keep making every file
+// executable.
+func kodataMode(info os.FileInfo) int64 {
+	if runtime.GOOS == "windows" {
+		return 0555
+	}
+	if info.Mode()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
 // walkRecursive performs a filepath.Walk of the given root directory adding it
 // to the provided tar.Writer with root -> chroot.  All symlinks are dereferenced,
 // which is what leads to recursion when we encounter a directory symlink.
-func walkRecursive(tw *tar.Writer, root, chroot string) error {
+// Entries are written sorted by their name in the layer, so that the layer
+// doesn't depend on the order in which the filesystem lists directories.
+func walkRecursive(tw *tar.Writer, root, chroot string, owner layerOwner) error {
+	entries := make(map[string]kodataEntry)
+	if err := collectRecursive(entries, root, chroot); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeKodataEntry(tw, name, entries[name], owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kodataEntry is a file or directory to write to the kodata layer.
+type kodataEntry struct {
+	// path is where the file is on disk, with symlinks resolved.  It is ""
+	// for directories.
+	path string
+	info os.FileInfo
+}
+
+// collectRecursive records the entries of walkRecursive in entries, keyed by
+// their name in the layer.
+func collectRecursive(entries map[string]kodataEntry, root, chroot string) error {
 	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if path == root {
 			// Add an entry for the root directory of our walk.
-			return tw.WriteHeader(&tar.Header{
-				Name:     chroot,
-				Typeflag: tar.TypeDir,
-				// Use a fixed Mode, so that this isn't sensitive to the directory and umask
-				// under which it was created. Additionally, windows can only set 0222,
-				// 0444, or 0666, none of which are executable.
-				Mode: 0555,
-			})
+			entries[chroot] = kodataEntry{}
+			return nil
 		}
 		if err != nil {
 			return err
@@ -317,34 +656,54 @@ func walkRecursive(tw *tar.Writer, root, chroot string) error {
 		}
 		// Skip other directories.
 		if info.Mode().IsDir() {
-			return walkRecursive(tw, path, newPath)
+			return collectRecursive(entries, path, newPath)
 		}
 
-		// Open the file to copy it into the tarball.
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
+		entries[newPath] = kodataEntry{path: path, info: info}
+		return nil
+	})
+}
 
-		// Copy the file into the image tarball.
-		if err := tw.WriteHeader(&tar.Header{
-			Name:     newPath,
-			Size:     info.Size(),
-			Typeflag: tar.TypeReg,
+// writeKodataEntry writes e to the kodata layer as name.
+func writeKodataEntry(tw *tar.Writer, name string, e kodataEntry, owner layerOwner) error {
+	if e.path == "" {
+		return tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeDir,
 			// Use a fixed Mode, so that this isn't sensitive to the directory and umask
 			// under which it was created. Additionally, windows can only set 0222,
 			// 0444, or 0666, none of which are executable.
 			Mode: 0555,
-		}); err != nil {
-			return err
-		}
-		_, err = io.Copy(tw, file)
+			Uid:  owner.uid,
+			Gid:  owner.gid,
+		})
+	}
+
+	// Open the file to copy it into the tarball.
+	file, err := os.Open(e.path)
+	if err != nil {
 		return err
-	})
+	}
+	defer file.Close()
+
+	// Copy the file into the image tarball.
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Size:     e.info.Size(),
+		Typeflag: tar.TypeReg,
+		Mode:     kodataMode(e.info),
+		Uid:      owner.uid,
+		Gid:      owner.gid,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
 }
 
-func (g *gobuild) tarKoData(importpath string) (*bytes.Buffer, error) {
+// tarKoData writes the kodata directory of importpath to a layer at
+// kodataRoot, laid out for goos.
+func (g *gobuild) tarKoData(importpath, goos string) (*bytes.Buffer, error) {
 	buf := bytes.NewBuffer(nil)
 	// Compress this before calling tarball.LayerFromOpener, since it eagerly
 	// calculates digests and diffids. This prevents us from double compressing
@@ -361,7 +720,54 @@ func (g *gobuild) tarKoData(importpath string) (*bytes.Buffer, error) {
 		return nil, err
 	}
 
-	return buf, walkRecursive(tw, root, kodataRoot)
+	if !isWindows(goos) {
+		return buf, walkRecursive(tw, root, kodataRoot, g.owner)
+	}
+	chroot := windowsLayerPath(kodataRoot)
+	if err := tarAddDirectories(tw, filepath.Dir(chroot), g.owner); err != nil {
+		return nil, err
+	}
+	if err := walkRecursive(tw, root, chroot, g.owner); err != nil {
+		return nil, err
+	}
+	// This sorts after Files/, keeping the entries in order.
+	return buf, tarAddWindowsHives(tw)
+}
+
+// history returns the history entry for a layer we add for importpath.
+// It records the version of ko and the configured creation time, rather
+// than the current time, so that the image stays reproducible.
+func (gb *gobuild) history(importpath, comment string) v1.History {
+	createdBy := "ko build"
+	if gb.version != "" {
+		createdBy += " " + gb.version
+	}
+	return v1.History{
+		Author:    "ko",
+		Created:   gb.creationTime,
+		CreatedBy: createdBy,
+		Comment:   comment + " (" + importpath + ")",
+	}
+}
+
+// binaryLayer constructs a layer holding the binary built from importpath
+// at appPath, for images for goos.
+func (gb *gobuild) binaryLayer(appPath, binary, importpath, goos string) (mutate.Addendum, error) {
+	binaryLayerBuf, err := tarBinary(appPath, binary, goos, gb.owner)
+	if err != nil {
+		return mutate.Addendum{}, err
+	}
+	binaryLayerBytes := binaryLayerBuf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewBuffer(binaryLayerBytes)), nil
+	})
+	if err != nil {
+		return mutate.Addendum{}, err
+	}
+	return mutate.Addendum{
+		Layer:   layer,
+		History: gb.history(importpath, "go build output, at "+containerPath(appPath, goos)),
+	}, nil
 }
 
 // Build implements build.Interface
@@ -371,6 +777,49 @@ func (gb *gobuild) Build(s string) (v1.Image, error) {
 	if err != nil {
 		return nil, err
 	}
+	return gb.buildOn(s, base, gb.platform)
+}
+
+// InputHash implements build.InputHasher
+//
+// Builds without a target platform are for that of their base image, which
+// isn't known without fetching it, so their inputs are those for the host.
+func (gb *gobuild) InputHash(s string) (string, error) {
+	platform := v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	if gb.platform != nil {
+		platform = *gb.platform
+	}
+	return inputHash("", s, platform, gb.buildConfig())
+}
+
+// BuildPlatform implements build.PlatformInterface
+func (gb *gobuild) BuildPlatform(s string, platform v1.Platform) (v1.Image, error) {
+	var base v1.Image
+	var err error
+	if gb.getPlatformBase != nil {
+		base, err = gb.getPlatformBase(s, platform)
+	} else {
+		base, err = gb.getBase(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gb.buildOn(s, base, &platform)
+}
+
+// buildOn builds the import path s into an image on top of base, for target
+// or, when that is nil, for the platform of base.
+func (gb *gobuild) buildOn(s string, base v1.Image, target *v1.Platform) (v1.Image, error) {
+	if gb.verifyBase != nil {
+		if err := gb.verifyBase(s, base); err != nil {
+			return nil, fmt.Errorf("verifying base image for %s: %v", s, err)
+		}
+	}
+	if gb.checkLicense {
+		if err := checkLicense(s, base); err != nil {
+			return nil, err
+		}
+	}
 	cf, err := base.ConfigFile()
 	if err != nil {
 		return nil, err
@@ -378,18 +827,54 @@ func (gb *gobuild) Build(s string) (v1.Image, error) {
 	platform := v1.Platform{
 		OS:           cf.OS,
 		Architecture: cf.Architecture,
+		OSVersion:    cf.OSVersion,
+	}
+	if target != nil {
+		platform = *target
+		// Windows images can only run on hosts of the same version, which
+		// the base image already targets.
+		if platform.OSVersion == "" && platform.OS == cf.OS {
+			platform.OSVersion = cf.OSVersion
+		}
+	}
+	// Windows binaries can't run on other bases, nor others on Windows bases.
+	if cf.OS != "" && isWindows(cf.OS) != isWindows(platform.OS) {
+		return nil, fmt.Errorf("cannot build %s for %s on its base image, which is for %s", s, platform.OS, cf.OS)
+	}
+	// When neither we nor the base image say otherwise, target the host.
+	if platform.OS == "" {
+		platform.OS = runtime.GOOS
+	}
+	if platform.Architecture == "" {
+		platform.Architecture = runtime.GOARCH
+	}
+
+	for _, hook := range gb.preBuildHooks {
+		if err := hook(context.TODO(), s); err != nil {
+			return nil, fmt.Errorf("pre-build hook for %s: %v", s, err)
+		}
 	}
 
 	// Do the build into a temporary file.
-	file, err := gb.build(s, platform, gb.disableOptimizations)
+	file, err := gb.buildCached(s, platform)
 	if err != nil {
 		return nil, err
 	}
 	defer os.RemoveAll(filepath.Dir(file))
+	if gb.validateBinaries {
+		if err := validateBinary(s, file, platform); err != nil {
+			return nil, err
+		}
+	}
+	if gb.scratchBase {
+		if err := checkStatic(s, file, platform); err != nil {
+			return nil, err
+		}
+	}
 
 	var layers []mutate.Addendum
 	// Create a layer from the kodata directory under this import path.
-	dataLayerBuf, err := gb.tarKoData(s)
+	dataLayerBuf, err := gb.tarKoData(s, platform.OS)
 	if err != nil {
 		return nil, err
 	}
@@ -401,36 +886,70 @@ func (gb *gobuild) Build(s string) (v1.Image, error) {
 		return nil, err
 	}
 	layers = append(layers, mutate.Addendum{
-		Layer: dataLayer,
-		History: v1.History{
-			Author:    "ko",
-			CreatedBy: "ko publish " + s,
-			Comment:   "kodata contents, at $KO_DATA_PATH",
-		},
+		Layer:   dataLayer,
+		History: gb.history(s, "kodata contents, at $"+gb.koDataEnvName),
 	})
 
-	appPath := filepath.Join(appDir, appFilename(s))
-
-	// Construct a tarball with the binary and produce a layer.
-	binaryLayerBuf, err := tarBinary(appPath, file)
+	appPath := path.Join(gb.appDir, appFilename(s, platform.OS))
+	layer, err := gb.binaryLayer(appPath, file, s, platform.OS)
 	if err != nil {
 		return nil, err
 	}
-	binaryLayerBytes := binaryLayerBuf.Bytes()
-	binaryLayer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
-		return ioutil.NopCloser(bytes.NewBuffer(binaryLayerBytes)), nil
-	})
-	if err != nil {
-		return nil, err
+	layers = append(layers, layer)
+
+	// Add a layer for each of the binaries bundled alongside this one.
+	appPaths := map[string]string{appPath: s}
+	entrypoint, ok := gb.entrypoints[s]
+	if !ok || entrypoint == s {
+		entrypoint = ""
+	}
+	for _, ip := range gb.bundles[s] {
+		bundledPath := path.Join(gb.appDir, appFilename(ip, platform.OS))
+		if other, ok := appPaths[bundledPath]; ok {
+			return nil, fmt.Errorf("cannot bundle %s with %s, both would be written to %s", ip, other, bundledPath)
+		}
+		appPaths[bundledPath] = ip
+		if ip == entrypoint {
+			// The bundled binary is run instead of this one.
+			appPath, entrypoint = bundledPath, ""
+		}
+
+		file, err := gb.build(ip, platform, gb.buildConfig())
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(filepath.Dir(file))
+		if gb.validateBinaries {
+			if err := validateBinary(ip, file, platform); err != nil {
+				return nil, err
+			}
+		}
+		if gb.scratchBase {
+			if err := checkStatic(ip, file, platform); err != nil {
+				return nil, err
+			}
+		}
+
+		layer, err := gb.binaryLayer(bundledPath, file, ip, platform.OS)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	if entrypoint != "" {
+		return nil, fmt.Errorf("entrypoint of %s is %s, which isn't bundled with it", s, entrypoint)
+	}
+
+	// Add a layer for the wrapper that runs the app, if there is one.
+	var wrapperPath string
+	if gb.entrypointWrapper != "" {
+		layer, p, err := gb.wrapperLayer(base, s, platform)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+		wrapperPath = p
 	}
-	layers = append(layers, mutate.Addendum{
-		Layer: binaryLayer,
-		History: v1.History{
-			Author:    "ko",
-			CreatedBy: "ko publish " + s,
-			Comment:   "go build output, at " + appPath,
-		},
-	})
 
 	// Augment the base image with our application layer.
 	withApp, err := mutate.Append(base, layers...)
@@ -446,8 +965,53 @@ func (gb *gobuild) Build(s string) (v1.Image, error) {
 	}
 
 	cfg = cfg.DeepCopy()
-	cfg.Config.Entrypoint = []string{appPath}
-	cfg.Config.Env = append(cfg.Config.Env, "KO_DATA_PATH="+kodataRoot)
+	cfg.OS = platform.OS
+	cfg.Architecture = platform.Architecture
+	cfg.OSVersion = platform.OSVersion
+	cfg.Config.Entrypoint = []string{containerPath(appPath, platform.OS)}
+	if wrapperPath != "" {
+		// The wrapper is passed the app, along with its args, to exec.
+		cfg.Config.Entrypoint = []string{wrapperPath, appPath}
+	}
+	// Our entrypoint is in exec form, so whether the base's Cmd was
+	// escaped doesn't apply to it.
+	cfg.Config.ArgsEscaped = false
+	if gb.defaultArgs != nil {
+		cfg.Config.Cmd = gb.defaultArgs
+	}
+	if gb.debugEntrypoint {
+		// Start a shell instead of our app, which can be run from it.
+		shell, err := findShell(base)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Config.Entrypoint = []string{shell}
+		cfg.Config.Cmd = nil
+		cfg.Config.Env = append(cfg.Config.Env, "KO_APP_PATH="+containerPath(appPath, platform.OS))
+	}
+	if gb.stopSignal != "" {
+		cfg.Config.StopSignal = gb.stopSignal
+	}
+	if gb.healthcheck != nil {
+		cfg.Config.Healthcheck = gb.healthcheck
+	}
+	if gb.race {
+		if cfg.Config.Labels == nil {
+			cfg.Config.Labels = map[string]string{}
+		}
+		cfg.Config.Labels[RaceLabel] = "true"
+	}
+	if gb.sourceHash != nil {
+		h, err := gb.sourceHash(s, platform, gb.buildConfig())
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Config.Labels == nil {
+			cfg.Config.Labels = map[string]string{}
+		}
+		cfg.Config.Labels[SourceHashLabel] = h
+	}
+	cfg.Config.Env = append(cfg.Config.Env, gb.koDataEnvName+"="+containerPath(kodataRoot, platform.OS))
 	cfg.Author = "github.com/google/ko"
 
 	image, err := mutate.ConfigFile(withApp, cfg)
@@ -457,7 +1021,19 @@ func (gb *gobuild) Build(s string) (v1.Image, error) {
 
 	empty := v1.Time{}
 	if gb.creationTime != empty {
-		return mutate.CreatedAt(image, gb.creationTime)
+		image, err = mutate.CreatedAt(image, gb.creationTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(gb.annotations) > 0 {
+		image = annotate(image, gb.annotations)
+	}
+	if gb.maxImageSize > 0 {
+		if err := checkImageSize(s, image, gb.maxImageSize); err != nil {
+			return nil, err
+		}
 	}
 	return image, nil
 }
@@ -16,13 +16,21 @@ package build
 
 import (
 	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 )
 
@@ -102,8 +110,8 @@ func TestGoBuildIsSupportedRefWithModules(t *testing.T) {
 }
 
 // A helper method we use to substitute for the default "build" method.
-func writeTempFile(s string, _ v1.Platform, _ bool) (string, error) {
-	tmpDir, err := ioutil.TempDir("", "ko")
+func writeTempFile(s string, _ v1.Platform, config buildConfig) (string, error) {
+	tmpDir, err := ioutil.TempDir(config.tempDir, "ko")
 	if err != nil {
 		return "", err
 	}
@@ -350,3 +358,1784 @@ func TestGoBuild(t *testing.T) {
 		}
 	})
 }
+
+func TestGoBuildAnnotations(t *testing.T) {
+	base, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	annotations := map[string]string{
+		"org.opencontainers.image.source": "https://github.com/google/ko",
+	}
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithAnnotations(annotations),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	t.Run("check manifest annotations", func(t *testing.T) {
+		m, err := img.Manifest()
+		if err != nil {
+			t.Fatalf("Manifest() = %v", err)
+		}
+		if diff := cmp.Diff(annotations, m.Annotations); diff != "" {
+			t.Errorf("Manifest().Annotations; (-want +got) = %v", diff)
+		}
+	})
+
+	t.Run("check raw manifest annotations", func(t *testing.T) {
+		raw, err := img.RawManifest()
+		if err != nil {
+			t.Fatalf("RawManifest() = %v", err)
+		}
+		m, err := v1.ParseManifest(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("ParseManifest() = %v", err)
+		}
+		if diff := cmp.Diff(annotations, m.Annotations); diff != "" {
+			t.Errorf("RawManifest() annotations; (-want +got) = %v", diff)
+		}
+
+		// The digest must reflect the annotated manifest.
+		want, _, err := v1.SHA256(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("SHA256() = %v", err)
+		}
+		if got, err := img.Digest(); err != nil {
+			t.Errorf("Digest() = %v", err)
+		} else if got != want {
+			t.Errorf("Digest() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("check config labels untouched", func(t *testing.T) {
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() = %v", err)
+		}
+		if len(cfg.Config.Labels) != 0 {
+			t.Errorf("ConfigFile().Config.Labels = %v, want none", cfg.Config.Labels)
+		}
+	})
+}
+
+func TestGoBuildPlatform(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	cf = cf.DeepCopy()
+	cf.OS, cf.Architecture = "linux", "ppc64le"
+	platformBase, err := mutate.ConfigFile(base, cf)
+	if err != nil {
+		t.Fatalf("mutate.ConfigFile() = %v", err)
+	}
+	host := v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+
+	for _, test := range []struct {
+		desc string
+		base v1.Image
+		opts []Option
+		want v1.Platform
+	}{{
+		desc: "defaults to the host",
+		base: base,
+		want: host,
+	}, {
+		desc: "explicit platform",
+		base: base,
+		opts: []Option{WithPlatform(v1.Platform{OS: "linux", Architecture: "s390x"})},
+		want: v1.Platform{OS: "linux", Architecture: "s390x"},
+	}, {
+		desc: "defaults to the base's platform",
+		base: platformBase,
+		want: v1.Platform{OS: "linux", Architecture: "ppc64le"},
+	}, {
+		desc: "explicit platform overrides the base's",
+		base: platformBase,
+		opts: []Option{WithPlatform(host)},
+		want: host,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var built v1.Platform
+			base := test.base
+			opts := append(test.opts,
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+					built = p
+					return writeTempFile(s, p, c)
+				}),
+			)
+			ng, err := NewGo(opts...)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, built); diff != "" {
+				t.Errorf("built platform; (-want +got) = %v", diff)
+			}
+
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			got := v1.Platform{OS: cfg.OS, Architecture: cfg.Architecture}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ConfigFile() platform; (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	tempDir, err := ioutil.TempDir("", "ko-build-config")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	bundle := filepath.Join(tempDir, "ca-certificates.crt")
+	if err := ioutil.WriteFile(bundle, nil, 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	goBinary := filepath.Join(tempDir, "go1.13.4")
+	if err := ioutil.WriteFile(goBinary, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	// The cache directory doesn't have to exist yet.
+	cacheDir := filepath.Join(tempDir, "gocache")
+	// Configuration that's already passed to git is kept.
+	defer os.Setenv("GIT_CONFIG_COUNT", os.Getenv("GIT_CONFIG_COUNT"))
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+
+	for _, test := range []struct {
+		desc string
+		opts []Option
+		want buildConfig
+	}{{
+		desc: "defaults",
+	}, {
+		desc: "disabled optimizations",
+		opts: []Option{WithDisabledOptimizations()},
+		want: buildConfig{disableOptimizations: true},
+	}, {
+		desc: "CA certificates",
+		opts: []Option{WithCACerts(bundle)},
+		want: buildConfig{env: []string{
+			"SSL_CERT_FILE=" + bundle,
+			"GIT_SSL_CAINFO=" + bundle,
+		}},
+	}, {
+		desc: "go cache",
+		opts: []Option{WithGoCache(cacheDir)},
+		want: buildConfig{env: []string{"GOCACHE=" + cacheDir}},
+	}, {
+		desc: "extra hosts",
+		opts: []Option{WithExtraHosts(map[string]string{
+			"git.internal":  "10.0.0.1",
+			"mods.internal": "fd00::1",
+		})},
+		want: buildConfig{env: []string{
+			"GIT_CONFIG_KEY_1=http.curloptResolve",
+			"GIT_CONFIG_VALUE_1=git.internal:443:10.0.0.1",
+			"GIT_CONFIG_KEY_2=http.curloptResolve",
+			"GIT_CONFIG_VALUE_2=git.internal:80:10.0.0.1",
+			"GIT_CONFIG_KEY_3=http.curloptResolve",
+			"GIT_CONFIG_VALUE_3=mods.internal:443:[fd00::1]",
+			"GIT_CONFIG_KEY_4=http.curloptResolve",
+			"GIT_CONFIG_VALUE_4=mods.internal:80:[fd00::1]",
+			"GIT_CONFIG_COUNT=5",
+		}},
+	}, {
+		desc: "go binary",
+		opts: []Option{WithGoBinary(goBinary)},
+		want: buildConfig{goBinary: goBinary},
+	}, {
+		desc: "race",
+		opts: []Option{WithRace()},
+		want: buildConfig{race: true},
+	}, {
+		desc: "buildvcs auto",
+		opts: []Option{WithBuildVCS("auto")},
+		want: buildConfig{},
+	}, {
+		desc: "buildvcs true",
+		opts: []Option{WithBuildVCS("true")},
+		want: buildConfig{buildVCS: "true"},
+	}, {
+		desc: "buildvcs false",
+		opts: []Option{WithBuildVCS("false")},
+		want: buildConfig{buildVCS: "false"},
+	}, {
+		desc: "build log dir",
+		opts: []Option{WithBuildLogDir(filepath.Join(tempDir, "logs"))},
+		want: buildConfig{logDir: filepath.Join(tempDir, "logs")},
+	}, {
+		desc: "temp dir",
+		opts: []Option{WithTempDir(tempDir)},
+		want: buildConfig{tempDir: tempDir},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got buildConfig
+			opts := append(test.opts,
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+					got = c
+					return writeTempFile(s, p, c)
+				}),
+			)
+			ng, err := NewGo(opts...)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+			if _, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test")); err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(buildConfig{})); diff != "" {
+				t.Errorf("build config; (-want +got) = %v", diff)
+			}
+		})
+	}
+
+	if info, err := os.Stat(cacheDir); err != nil || !info.IsDir() {
+		t.Errorf("Stat(%s) = %v, want a directory", cacheDir, err)
+	}
+}
+
+func TestBuildConfigErrors(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ko-build-config")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Bad configuration should be caught up front.
+	for desc, opt := range map[string]Option{
+		"missing CA certificates": WithCACerts(filepath.Join(tempDir, "missing.crt")),
+		"extra host by name":      WithExtraHosts(map[string]string{"git.internal": "git.example.com"}),
+		"missing go binary":       WithGoBinary(filepath.Join(tempDir, "missing")),
+		"unsupported buildvcs":    WithBuildVCS("off"),
+	} {
+		if _, err := NewGo(WithBaseImages(nil), opt); err == nil {
+			t.Errorf("NewGo() with %s = nil, want error", desc)
+		}
+	}
+}
+
+func TestGoBuildGoBinary(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	tempDir, err := ioutil.TempDir("", "ko-gobinary")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A stand-in for go that writes its arguments to the -o file.
+	goBinary := filepath.Join(tempDir, "go1.13.4")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; fi
+  shift
+done
+echo fake go > "$out"
+`
+	if err := ioutil.WriteFile(goBinary, []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithGoBinary(goBinary),
+		withBuilder(build),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	// The binary in the image is what the stand-in built.
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	rc, err := layers[len(layers)-1].Uncompressed()
+	if err != nil {
+		t.Fatalf("Uncompressed() = %v", err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	found := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if header.Typeflag != tar.TypeReg || filepath.Base(header.Name) != "test" {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		}
+		if string(b) != "fake go\n" {
+			t.Errorf("binary = %q, want the stand-in's output", b)
+		}
+		found = true
+	}
+	if !found {
+		t.Error("didn't find the binary in the image")
+	}
+}
+
+func TestGoBuildLogDir(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ko-buildlog")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A stand-in for go that reports what it builds, and fails to build
+	// anything named "broken".
+	goBinary := filepath.Join(tempDir, "go")
+	script := `#!/bin/sh
+for ip; do :; done
+echo "building $ip"
+case "$ip" in *broken) echo "syntax error" >&2; exit 1;; esac
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; fi
+  shift
+done
+echo fake go > "$out"
+`
+	if err := ioutil.WriteFile(goBinary, []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	logDir := filepath.Join(tempDir, "logs")
+	config := buildConfig{goBinary: goBinary, logDir: logDir}
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	file, err := build("github.com/foo/bar", platform, config)
+	if err != nil {
+		t.Fatalf("build() = %v", err)
+	}
+	os.RemoveAll(filepath.Dir(file))
+	if _, err := os.Stat(filepath.Join(logDir, "github.com", "foo", "bar.log")); err != nil {
+		t.Errorf("Stat() = %v", err)
+	}
+	if _, err := build("github.com/foo/broken", platform, config); err == nil {
+		t.Error("build() of a broken import path = nil, want error")
+	}
+
+	for ip, want := range map[string]string{
+		"github.com/foo/bar":    "building github.com/foo/bar\n",
+		"github.com/foo/broken": "building github.com/foo/broken\nsyntax error\n",
+	} {
+		b, err := ioutil.ReadFile(buildLogPath(logDir, ip))
+		if err != nil {
+			t.Errorf("ReadFile() = %v", err)
+			continue
+		}
+		if got := string(b); got != want {
+			t.Errorf("build log of %s = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestBuildLogPath(t *testing.T) {
+	for ip, want := range map[string]string{
+		"github.com/foo/bar": filepath.Join("logs", "github.com", "foo", "bar.log"),
+		"./cmd/app":          filepath.Join("logs", "cmd", "app.log"),
+		"../../escape":       filepath.Join("logs", "escape.log"),
+	} {
+		if got := buildLogPath("logs", ip); got != want {
+			t.Errorf("buildLogPath(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestGoBuildRace(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithRace(),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if got := cfg.Config.Labels[RaceLabel]; got != "true" {
+		t.Errorf("label %s = %q, want %q", RaceLabel, got, "true")
+	}
+}
+
+func TestGoBuildForPlatform(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	armBase, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	var gotPlatform v1.Platform
+	var gotBasePlatform v1.Platform
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithPlatformBaseImages(func(_ string, p v1.Platform) (v1.Image, error) {
+			gotBasePlatform = p
+			return armBase, nil
+		}),
+		WithPlatform(v1.Platform{OS: "linux", Architecture: "amd64"}),
+		withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+			gotPlatform = p
+			return writeTempFile(s, p, c)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	want := v1.Platform{OS: "linux", Architecture: "arm64"}
+	img, err := BuildPlatform(ng, filepath.Join("github.com/google/ko", "cmd", "ko", "test"), want)
+	if err != nil {
+		t.Fatalf("BuildPlatform() = %v", err)
+	}
+	if diff := cmp.Diff(want, gotPlatform); diff != "" {
+		t.Errorf("built platform (-want +got) = %v", diff)
+	}
+	if diff := cmp.Diff(want, gotBasePlatform); diff != "" {
+		t.Errorf("base platform (-want +got) = %v", diff)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if cf.OS != want.OS || cf.Architecture != want.Architecture {
+		t.Errorf("config platform = %s/%s, want %s/%s", cf.OS, cf.Architecture, want.OS, want.Architecture)
+	}
+
+	// The image is built on the platform's base image.
+	armLayers, err := armBase.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	wantDigest, err := armLayers[0].Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	gotDigest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if gotDigest != wantDigest {
+		t.Errorf("first layer = %v, want the platform base's %v", gotDigest, wantDigest)
+	}
+}
+
+func TestGoBuildWindows(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	cf = cf.DeepCopy()
+	cf.OS = "windows"
+	cf.Architecture = "amd64"
+	cf.OSVersion = "10.0.17763.1879"
+	cf.Config.ArgsEscaped = true
+	base, err := mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatalf("mutate.ConfigFile() = %v", err)
+	}
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	result, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	got, err := result.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if got.OS != "windows" || got.Architecture != "amd64" || got.OSVersion != "10.0.17763.1879" {
+		t.Errorf("platform = %s/%s %s, want windows/amd64 10.0.17763.1879", got.OS, got.Architecture, got.OSVersion)
+	}
+	if diff := cmp.Diff([]string{`C:\ko-app\test.exe`}, got.Config.Entrypoint); diff != "" {
+		t.Errorf("entrypoint (-want +got) = %v", diff)
+	}
+	if got.Config.ArgsEscaped {
+		t.Error("ArgsEscaped = true, want false")
+	}
+	found := false
+	for _, entry := range got.Config.Env {
+		if entry == `KO_DATA_PATH=C:\var\run\ko` {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("env = %v, want KO_DATA_PATH in C:", got.Config.Env)
+	}
+
+	// The binary goes under Files/ in a layer that also has Hives/.
+	layers, err := result.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	rc, err := layers[len(layers)-1].Uncompressed()
+	if err != nil {
+		t.Fatalf("Uncompressed() = %v", err)
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		names = append(names, header.Name)
+		if header.Typeflag == tar.TypeReg {
+			if sd := header.PAXRecords["MSWINDOWS.rawsd"]; sd != userOwnerAndGroupSID {
+				t.Errorf("security descriptor of %s = %q, want %q", header.Name, sd, userOwnerAndGroupSID)
+			}
+		}
+	}
+	if diff := cmp.Diff([]string{"Files", "Files/ko-app", "Files/ko-app/test.exe", "Hives"}, names); diff != "" {
+		t.Errorf("binary layer entries (-want +got) = %v", diff)
+	}
+
+	// Windows binaries can't be put on other bases.
+	linux, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	lcf, err := linux.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	lcf = lcf.DeepCopy()
+	lcf.OS = "linux"
+	linuxBase, err := mutate.ConfigFile(linux, lcf)
+	if err != nil {
+		t.Fatalf("mutate.ConfigFile() = %v", err)
+	}
+	ng, err = NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return linuxBase, nil }),
+		WithPlatform(v1.Platform{OS: "windows", Architecture: "amd64"}),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	if _, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test")); err == nil {
+		t.Error("Build() for windows on a linux base = nil, want error")
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		config buildConfig
+		want   []string
+	}{{
+		desc: "default",
+		want: []string{"build", "-o", "/tmp/out", "github.com/foo/bar"},
+	}, {
+		desc:   "race",
+		config: buildConfig{race: true},
+		want:   []string{"build", "-race", "-o", "/tmp/out", "github.com/foo/bar"},
+	}, {
+		desc:   "buildvcs",
+		config: buildConfig{buildVCS: "false"},
+		want:   []string{"build", "-buildvcs=false", "-o", "/tmp/out", "github.com/foo/bar"},
+	}, {
+		desc:   "everything",
+		config: buildConfig{disableOptimizations: true, race: true, modMode: "vendor", buildVCS: "true"},
+		want:   []string{"build", "-gcflags", "all=-N -l", "-race", "-mod=vendor", "-buildvcs=true", "-o", "/tmp/out", "github.com/foo/bar"},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := buildArgs("github.com/foo/bar", "/tmp/out", test.config)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("buildArgs() (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuildBundledBinaries(t *testing.T) {
+	baseLayers := int64(3)
+	base, err := random.Image(1024, baseLayers)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+	bundled := []string{"github.com/google/ko/cmd/tool", "github.com/google/ko/cmd/other"}
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithBundledBinaries(map[string][]string{importpath: bundled}),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	img, err := ng.Build(importpath)
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	ls, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	// We get a layer for kodata/ and one for each of the go binaries.
+	if got, want := int64(len(ls)), baseLayers+1+3; got != want {
+		t.Fatalf("len(Layers()) = %v, want %v", got, want)
+	}
+
+	// writeTempFile writes the import path as the contents of each binary.
+	got := make(map[string]string)
+	for _, l := range ls[baseLayers+1:] {
+		r, err := l.Uncompressed()
+		if err != nil {
+			t.Fatalf("Uncompressed() = %v", err)
+		}
+		defer r.Close()
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			got[header.Name] = string(b)
+		}
+	}
+	want := map[string]string{
+		"/ko-app/ko":    importpath,
+		"/ko-app/tool":  bundled[0],
+		"/ko-app/other": bundled[1],
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("binaries; (-want +got) = %v", diff)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"/ko-app/ko"}, cfg.Config.Entrypoint); diff != "" {
+		t.Errorf("entrypoint; (-want +got) = %v", diff)
+	}
+}
+
+func TestGoBuildBundledBinariesCollide(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+
+	ng, err := NewGo(
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		WithBundledBinaries(map[string][]string{importpath: {"github.com/google/other/cmd/ko"}}),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	if _, err := ng.Build(importpath); err == nil {
+		t.Error("Build() = nil, want error for binaries with the same name")
+	}
+}
+
+func TestGoBuildBundledEntrypoint(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+	tool := "github.com/google/ko/cmd/tool"
+
+	for _, test := range []struct {
+		desc        string
+		entrypoints map[string]string
+		want        []string
+		wantErr     bool
+	}{{
+		desc: "own binary",
+		want: []string{"/ko-app/ko"},
+	}, {
+		desc:        "own binary explicitly",
+		entrypoints: map[string]string{importpath: importpath},
+		want:        []string{"/ko-app/ko"},
+	}, {
+		desc:        "bundled binary",
+		entrypoints: map[string]string{importpath: tool},
+		want:        []string{"/ko-app/tool"},
+	}, {
+		desc:        "binary that isn't bundled",
+		entrypoints: map[string]string{importpath: "github.com/google/ko/cmd/other"},
+		wantErr:     true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				WithBundledBinaries(map[string][]string{importpath: {tool}}),
+				WithEntrypoints(test.entrypoints),
+				withBuilder(writeTempFile),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+			img, err := ng.Build(importpath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			if diff := cmp.Diff(test.want, cfg.Config.Entrypoint); diff != "" {
+				t.Errorf("entrypoint; (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuildTempDir(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	tempDir, err := ioutil.TempDir("", "ko-temp-dir")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var built string
+	ng, err := NewGo(
+		WithTempDir(tempDir),
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+			file, err := writeTempFile(s, p, c)
+			built = file
+			return file, err
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	if _, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko")); err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	if !strings.HasPrefix(built, tempDir+string(filepath.Separator)) {
+		t.Errorf("built %s, want it under %s", built, tempDir)
+	}
+	// The build output is cleaned up once the image is built.
+	if fis, err := ioutil.ReadDir(tempDir); err != nil {
+		t.Errorf("ReadDir() = %v", err)
+	} else if len(fis) != 0 {
+		t.Errorf("%s holds %d entries after the build, want none", tempDir, len(fis))
+	}
+
+	if _, err := NewGo(WithTempDir(filepath.Join(tempDir, "missing"))); err == nil {
+		t.Error("NewGo(WithTempDir(missing)) = nil, want error")
+	}
+}
+
+func TestGoBuildDefaultArgs(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		opts    []Option
+		wantCmd []string
+	}{{
+		desc: "no default args",
+	}, {
+		desc:    "default args",
+		opts:    []Option{WithDefaultArgs([]string{"--port=8080", "--verbose"})},
+		wantCmd: []string{"--port=8080", "--verbose"},
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(append(test.opts,
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(writeTempFile),
+			)...)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			// The binary stays the entrypoint, so that the args can be
+			// overridden without repeating it.
+			if diff := cmp.Diff([]string{"/ko-app/ko"}, cfg.Config.Entrypoint); diff != "" {
+				t.Errorf("Entrypoint (-want +got) = %v", diff)
+			}
+			if diff := cmp.Diff(test.wantCmd, cfg.Config.Cmd); diff != "" {
+				t.Errorf("Cmd (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuildStopSignal(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		signal  string
+		want    string
+		wantErr bool
+	}{
+		{signal: "SIGQUIT", want: "SIGQUIT"},
+		{signal: "quit", want: "SIGQUIT"},
+		{signal: "9", want: "9"},
+		{signal: "SIGBOGUS", wantErr: true},
+		{signal: "0", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.signal, func(t *testing.T) {
+			ng, err := NewGo(
+				WithStopSignal(test.signal),
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(writeTempFile),
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewGo() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			if got := cfg.Config.StopSignal; got != test.want {
+				t.Errorf("StopSignal = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGoBuildKoDataEnvName(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "APP_DATA", want: "APP_DATA=/var/run/ko"},
+		{name: "_data2", want: "_data2=/var/run/ko"},
+		{name: "", wantErr: true},
+		{name: "2DATA", wantErr: true},
+		{name: "APP-DATA", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ng, err := NewGo(
+				WithKoDataEnvName(test.name),
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(writeTempFile),
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewGo() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			found := false
+			for _, entry := range cfg.Config.Env {
+				if entry == test.want {
+					found = true
+				}
+				if strings.HasPrefix(entry, "KO_DATA_PATH=") {
+					t.Errorf("Env contains %q, want it renamed to %s", entry, test.name)
+				}
+			}
+			if !found {
+				t.Errorf("Env = %v, want it to contain %q", cfg.Config.Env, test.want)
+			}
+		})
+	}
+}
+
+func TestGoBuildSourceHash(t *testing.T) {
+	importpath := "github.com/google/ko"
+	var got []string
+	for i := 0; i < 2; i++ {
+		// Each build is on a different base, which doesn't affect the hash.
+		base, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image() = %v", err)
+		}
+		ng, err := NewGo(
+			WithSourceHash(),
+			WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+			withBuilder(writeTempFile),
+		)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		img, err := ng.Build(filepath.Join(importpath, "cmd", "ko"))
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() = %v", err)
+		}
+		got = append(got, cfg.Config.Labels[SourceHashLabel])
+	}
+	if got[0] == "" {
+		t.Fatalf("%s label is empty", SourceHashLabel)
+	}
+	if got[0] != got[1] {
+		t.Errorf("%s labels of identical source = %q and %q, want the same", SourceHashLabel, got[0], got[1])
+	}
+}
+
+func TestGoBuildPreBuildHook(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko")
+
+	var steps []string
+	hook := func(name string, err error) PreBuildHook {
+		return func(_ context.Context, ip string) error {
+			steps = append(steps, name+" "+ip)
+			return err
+		}
+	}
+	recordBuild := func(ip string, platform v1.Platform, config buildConfig) (string, error) {
+		steps = append(steps, "build "+ip)
+		return writeTempFile(ip, platform, config)
+	}
+
+	ng, err := NewGo(
+		WithPreBuildHook(hook("generate", nil)),
+		WithPreBuildHook(hook("protoc", nil)),
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		withBuilder(recordBuild),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	if _, err := ng.Build(importpath); err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	want := []string{"generate " + importpath, "protoc " + importpath, "build " + importpath}
+	if diff := cmp.Diff(want, steps); diff != "" {
+		t.Errorf("steps (-want +got) = %v", diff)
+	}
+
+	// A failing hook aborts the build.
+	steps = nil
+	ng, err = NewGo(
+		WithPreBuildHook(hook("generate", errors.New("protoc not found"))),
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		withBuilder(recordBuild),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	if _, err := ng.Build(importpath); err == nil {
+		t.Error("Build() with a failing hook = nil, want error")
+	}
+	if diff := cmp.Diff([]string{"generate " + importpath}, steps); diff != "" {
+		t.Errorf("steps (-want +got) = %v", diff)
+	}
+}
+
+func TestGoBuildLayerOwner(t *testing.T) {
+	baseLayers := int64(1)
+	base, err := random.Image(1024, baseLayers)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	ng, err := NewGo(
+		WithLayerOwner(65532, 65533),
+		WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+		withBuilder(writeTempFile),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+
+	img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	ls, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+
+	// Both the kodata and the app layer are owned by 65532:65533.
+	for _, l := range ls[baseLayers:] {
+		r, err := l.Uncompressed()
+		if err != nil {
+			t.Fatalf("Uncompressed() = %v", err)
+		}
+		defer r.Close()
+		tr := tar.NewReader(r)
+		entries := 0
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			entries++
+			if header.Uid != 65532 || header.Gid != 65533 {
+				t.Errorf("%s is owned by %d:%d, want 65532:65533", header.Name, header.Uid, header.Gid)
+			}
+		}
+		if entries == 0 {
+			t.Error("Layer contained no files")
+		}
+	}
+
+	if _, err := NewGo(WithLayerOwner(-1, 0)); err == nil {
+		t.Error("NewGo(WithLayerOwner(-1, 0)) = nil, want error")
+	}
+}
+
+func TestGoBuildBaseVerification(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+
+	tests := []struct {
+		desc    string
+		verify  VerifyBase
+		wantErr bool
+	}{{
+		desc:   "valid signature",
+		verify: func(string, v1.Image) error { return nil },
+	}, {
+		desc:    "invalid signature",
+		verify:  func(string, v1.Image) error { return errors.New("no matching signatures") },
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var verified []string
+			ng, err := NewGo(
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				WithBaseImageVerification(func(ip string, img v1.Image) error {
+					if img != base {
+						t.Errorf("verified %v, want the base image", img)
+					}
+					verified = append(verified, ip)
+					return test.verify(ip, img)
+				}),
+				withBuilder(writeTempFile),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			_, err = ng.Build(importpath)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff([]string{importpath}, verified); diff != "" {
+				t.Errorf("verified import paths (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuildLicenseCheck(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	// mutate.Config modifies the config of the image it's given, so label
+	// another one.
+	labeled, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	cf, err := labeled.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	cfg := cf.Config.DeepCopy()
+	cfg.Labels = map[string]string{"org.opencontainers.image.licenses": "Apache-2.0"}
+	labeled, err = mutate.Config(labeled, *cfg)
+	if err != nil {
+		t.Fatalf("mutate.Config() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+
+	tests := []struct {
+		desc    string
+		base    v1.Image
+		wantErr bool
+	}{{
+		desc: "license label",
+		base: labeled,
+	}, {
+		desc: "license annotation",
+		base: annotate(base, map[string]string{"org.opencontainers.image.licenses": "MIT"}),
+	}, {
+		desc:    "no license",
+		base:    base,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithBaseImages(func(string) (v1.Image, error) { return test.base, nil }),
+				WithLicenseCheck(),
+				withBuilder(writeTempFile),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			if _, err := ng.Build(importpath); (err != nil) != test.wantErr {
+				t.Errorf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGoBuildMaxImageSize(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		max     int64
+		wantErr bool
+	}{{
+		desc: "under the limit",
+		max:  50 * 1000 * 1000,
+	}, {
+		desc:    "over the limit",
+		max:     100,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				WithMaxImageSize(test.max),
+				withBuilder(writeTempFile),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			if _, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test")); (err != nil) != test.wantErr {
+				t.Errorf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewGo(WithMaxImageSize(0)); err == nil {
+		t.Error("NewGo(WithMaxImageSize(0)) = nil, want error")
+	}
+}
+
+func TestGoBuildHealthcheck(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		desc     string
+		cmd      []string
+		interval time.Duration
+		timeout  time.Duration
+		retries  int
+		want     *v1.HealthConfig
+		wantErr  bool
+	}{{
+		desc:     "command",
+		cmd:      []string{"/ko-app/ko", "healthz"},
+		interval: 30 * time.Second,
+		timeout:  5 * time.Second,
+		retries:  3,
+		want: &v1.HealthConfig{
+			Test:     []string{"CMD", "/ko-app/ko", "healthz"},
+			Interval: 30 * time.Second,
+			Timeout:  5 * time.Second,
+			Retries:  3,
+		},
+	}, {
+		desc: "shell",
+		cmd:  []string{"CMD-SHELL", "curl -f localhost:8080"},
+		want: &v1.HealthConfig{
+			Test: []string{"CMD-SHELL", "curl -f localhost:8080"},
+		},
+	}, {
+		desc: "disabled",
+		cmd:  []string{"NONE"},
+		want: &v1.HealthConfig{
+			Test: []string{"NONE"},
+		},
+	}, {
+		desc:    "empty",
+		wantErr: true,
+	}, {
+		desc:    "CMD without command",
+		cmd:     []string{"CMD"},
+		wantErr: true,
+	}, {
+		desc:    "negative retries",
+		cmd:     []string{"/ko-app/ko"},
+		retries: -1,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithHealthcheck(test.cmd, test.interval, test.timeout, test.retries),
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(writeTempFile),
+			)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewGo() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			cfg, err := img.ConfigFile()
+			if err != nil {
+				t.Fatalf("ConfigFile() = %v", err)
+			}
+			if diff := cmp.Diff(test.want, cfg.Config.Healthcheck); diff != "" {
+				t.Errorf("Healthcheck (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestGoBuildAppPath(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		opts    []Option
+		want    string
+		wantErr bool
+	}{{
+		desc: "default",
+		want: "/ko-app/test",
+	}, {
+		desc: "configured",
+		opts: []Option{WithAppPath("/usr/local/bin")},
+		want: "/usr/local/bin/test",
+	}, {
+		desc: "trailing slash",
+		opts: []Option{WithAppPath("/usr/local/bin/")},
+		want: "/usr/local/bin/test",
+	}, {
+		desc:    "relative",
+		opts:    []Option{WithAppPath("usr/local/bin")},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			opts := append([]Option{
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(writeTempFile),
+			}, test.opts...)
+			ng, err := NewGo(opts...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewGo() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko", "test"))
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+
+			t.Run("check entrypoint", func(t *testing.T) {
+				cfg, err := img.ConfigFile()
+				if err != nil {
+					t.Fatalf("ConfigFile() = %v", err)
+				}
+				if diff := cmp.Diff([]string{test.want}, cfg.Config.Entrypoint); diff != "" {
+					t.Errorf("Entrypoint; (-want +got) = %v", diff)
+				}
+			})
+
+			t.Run("check app layer", func(t *testing.T) {
+				ls, err := img.Layers()
+				if err != nil {
+					t.Fatalf("Layers() = %v", err)
+				}
+				r, err := ls[len(ls)-1].Uncompressed()
+				if err != nil {
+					t.Fatalf("Uncompressed() = %v", err)
+				}
+				defer r.Close()
+				tr := tar.NewReader(r)
+				for {
+					header, err := tr.Next()
+					if err == io.EOF {
+						t.Fatalf("app layer doesn't contain %s", test.want)
+					} else if err != nil {
+						t.Fatalf("Next() = %v", err)
+					}
+					if header.Name == test.want {
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestGoBuildModMode(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	// newModule writes a fake module with a command under cmd/app, and a
+	// vendor directory if vendored is set.
+	newModule := func(vendored bool) string {
+		dir, err := ioutil.TempDir("", "ko-module")
+		if err != nil {
+			t.Fatalf("TempDir() = %v", err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "cmd", "app"), 0755); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cmd", "app", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		if vendored {
+			if err := os.Mkdir(filepath.Join(dir, "vendor"), 0755); err != nil {
+				t.Fatalf("Mkdir() = %v", err)
+			}
+		}
+		return dir
+	}
+
+	goflags, ok := os.LookupEnv("GOFLAGS")
+	defer func() {
+		if ok {
+			os.Setenv("GOFLAGS", goflags)
+		} else {
+			os.Unsetenv("GOFLAGS")
+		}
+	}()
+
+	tests := []struct {
+		desc     string
+		vendored bool
+		goflags  string
+		opts     []Option
+		want     string
+	}{{
+		desc: "not vendored",
+		want: "",
+	}, {
+		desc:     "vendored",
+		vendored: true,
+		want:     "vendor",
+	}, {
+		desc:     "vendored with GOFLAGS",
+		vendored: true,
+		goflags:  "-mod=mod",
+		want:     "",
+	}, {
+		desc:     "explicit",
+		vendored: true,
+		opts:     []Option{WithModMode("readonly")},
+		want:     "readonly",
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			os.Setenv("GOFLAGS", test.goflags)
+			dir := newModule(test.vendored)
+			defer os.RemoveAll(dir)
+
+			var got string
+			opts := append([]Option{
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withModuleInfo(&modInfo{Path: "example.com/fake", Dir: dir}),
+				withBuilder(func(s string, p v1.Platform, c buildConfig) (string, error) {
+					got = c.modMode
+					return writeTempFile(s, p, c)
+				}),
+			}, test.opts...)
+			ng, err := NewGo(opts...)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+			if _, err := ng.Build("./cmd/app"); err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("modMode = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := NewGo(WithModMode("bogus")); err == nil {
+		t.Error("NewGo(WithModMode(bogus)) = nil, want error")
+	}
+}
+
+func TestGoBuildHistory(t *testing.T) {
+	baseLayers := int64(2)
+	base, err := random.Image(1024, baseLayers)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	creationTime := v1.Time{Time: time.Unix(5000, 0).UTC()}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko", "test")
+
+	buildImage := func() v1.Image {
+		ng, err := NewGo(
+			WithCreationTime(creationTime),
+			WithVersion("v1.2.3"),
+			WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+			withBuilder(writeTempFile),
+		)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		img, err := ng.Build(importpath)
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+		return img
+	}
+	img := buildImage()
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if got, want := int64(len(cfg.History)), baseLayers+2; got != want {
+		t.Fatalf("len(History) = %d, want %d", got, want)
+	}
+	want := []v1.History{{
+		Author:    "ko",
+		Created:   creationTime,
+		CreatedBy: "ko build v1.2.3",
+		Comment:   "kodata contents, at $KO_DATA_PATH (" + importpath + ")",
+	}, {
+		Author:    "ko",
+		Created:   creationTime,
+		CreatedBy: "ko build v1.2.3",
+		Comment:   "go build output, at /ko-app/test (" + importpath + ")",
+	}}
+	if diff := cmp.Diff(want, cfg.History[baseLayers:]); diff != "" {
+		t.Errorf("History; (-want +got) = %v", diff)
+	}
+
+	// The history doesn't depend on when the image is built.
+	cfgDigest, err := img.ConfigName()
+	if err != nil {
+		t.Fatalf("ConfigName() = %v", err)
+	}
+	if again, err := buildImage().ConfigName(); err != nil {
+		t.Fatalf("ConfigName() = %v", err)
+	} else if again != cfgDigest {
+		t.Errorf("ConfigName() = %v, want %v", again, cfgDigest)
+	}
+}
+
+func TestKoDataModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows can't mark files executable")
+	}
+	root, err := ioutil.TempDir("", "ko-kodata")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(root)
+	for name, mode := range map[string]os.FileMode{
+		"script.sh":  0700,
+		"config.txt": 0600,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), mode); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := walkRecursive(tw, root, kodataRoot, layerOwner{}); err != nil {
+		t.Fatalf("walkRecursive() = %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	got := make(map[string]int64)
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		got[header.Name] = header.Mode
+		if header.Uid != 0 || header.Gid != 0 {
+			t.Errorf("%s is owned by %d:%d, want 0:0", header.Name, header.Uid, header.Gid)
+		}
+	}
+	want := map[string]int64{
+		filepath.Join(kodataRoot, "script.sh"):  0755,
+		filepath.Join(kodataRoot, "config.txt"): 0644,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("kodata modes; (-want +got) = %v", diff)
+	}
+}
+
+func TestKoDataOrder(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "ko-kodata")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	baseLayers := int64(1)
+	base, err := random.Image(1024, baseLayers)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+
+	// Lay out the same files in the kodata of two modules, creating them in
+	// opposite orders and at different times, with a directory that is
+	// symlinked in from elsewhere.
+	files := []string{"b.txt", "a", "b/x", "shared/y"}
+	makeModule := func(dir string, files []string, mtime time.Time) string {
+		app := filepath.Join(dir, "cmd", "app")
+		if err := os.MkdirAll(app, 0755); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(app, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		root := filepath.Join(app, "kodata")
+		for _, f := range files {
+			p := filepath.Join(dir, f)
+			if !strings.HasPrefix(f, "shared/") {
+				p = filepath.Join(root, f)
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("MkdirAll() = %v", err)
+			}
+			if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+				t.Fatalf("WriteFile() = %v", err)
+			}
+			if err := os.Chtimes(p, mtime, mtime); err != nil {
+				t.Fatalf("Chtimes() = %v", err)
+			}
+		}
+		if err := os.Symlink(filepath.Join(dir, "shared"), filepath.Join(root, "c")); err != nil {
+			t.Fatalf("Symlink() = %v", err)
+		}
+		return dir
+	}
+	reversed := make([]string, len(files))
+	for i, f := range files {
+		reversed[len(files)-1-i] = f
+	}
+
+	// kodataLayer builds the app of the module in dir, returning its
+	// kodata layer.
+	kodataLayer := func(dir string) v1.Layer {
+		ng, err := NewGo(
+			WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+			withModuleInfo(&modInfo{Path: "example.com/fake", Dir: dir}),
+			withBuilder(writeTempFile),
+		)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		img, err := ng.Build("./cmd/app")
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+		layers, err := img.Layers()
+		if err != nil {
+			t.Fatalf("Layers() = %v", err)
+		}
+		return layers[baseLayers]
+	}
+	first := kodataLayer(makeModule(filepath.Join(tempDir, "first"), files, time.Unix(1000, 0)))
+	second := kodataLayer(makeModule(filepath.Join(tempDir, "second"), reversed, time.Unix(2000, 0)))
+
+	rc, err := first.Uncompressed()
+	if err != nil {
+		t.Fatalf("Uncompressed() = %v", err)
+	}
+	defer rc.Close()
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	want := []string{
+		kodataRoot,
+		kodataRoot + "/a",
+		kodataRoot + "/b.txt",
+		kodataRoot + "/b/x",
+		kodataRoot + "/c",
+		kodataRoot + "/c/y",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("kodata entries; (-want +got) = %v", diff)
+	}
+
+	firstDigest, err := first.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	secondDigest, err := second.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if firstDigest != secondDigest {
+		t.Errorf("kodata layer digests differ: %v != %v", firstDigest, secondDigest)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// extraHostsEnv returns the environment that makes git, which "go build"
+// fetches modules with when they aren't fetched through a proxy (e.g. those
+// matched by GOPRIVATE), resolve each host in hosts to its address.  This
+// uses git's http.curloptResolve setting, passed via GIT_CONFIG_COUNT, so it
+// needs git 2.37 or later.  Modules that go itself fetches from a proxy
+// still resolve the proxy's host as usual, e.g. via /etc/hosts.
+func extraHostsEnv(hosts map[string]string) []string {
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+
+	// Append to any configuration that's already passed to git this way,
+	// rather than replacing it.
+	n, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	if err != nil || n < 0 {
+		n = 0
+	}
+	var env []string
+	for _, host := range names {
+		addr := hosts[host]
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+			addr = "[" + addr + "]"
+		}
+		for _, port := range []string{"443", "80"} {
+			env = append(env,
+				fmt.Sprintf("GIT_CONFIG_KEY_%d=http.curloptResolve", n),
+				fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s:%s:%s", n, host, port, addr))
+			n++
+		}
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n))
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// listedPackage is the subset of the output of "go list -json" that makes up
+// the inputs of a build.
+type listedPackage struct {
+	ImportPath   string
+	Dir          string
+	Standard     bool
+	GoFiles      []string
+	CgoFiles     []string
+	CFiles       []string
+	CXXFiles     []string
+	MFiles       []string
+	HFiles       []string
+	FFiles       []string
+	SFiles       []string
+	SwigFiles    []string
+	SwigCXXFiles []string
+	SysoFiles    []string
+	EmbedFiles   []string
+	Module       *listedModule
+}
+
+// files returns the source files of pkg that are compiled, linked or
+// embedded into what it's built into.
+func (pkg *listedPackage) files() []string {
+	var files []string
+	for _, fs := range [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles,
+		pkg.HFiles, pkg.FFiles, pkg.SFiles, pkg.SwigFiles, pkg.SwigCXXFiles,
+		pkg.SysoFiles, pkg.EmbedFiles,
+	} {
+		files = append(files, fs...)
+	}
+	return files
+}
+
+type listedModule struct {
+	Path    string
+	Version string
+	Sum     string
+	Replace *listedModule
+}
+
+// InputHash returns a hash of the inputs of building the import path ip: the
+// versions of the modules it depends on, the contents of the source files of
+// its dependencies that aren't in a versioned module, and its kodata.  Any
+// change to what ip depends on changes its hash, even if ip doesn't change.
+// The source files are those of a default build for the host; builders hash
+// those that they build from, see InputHasher.
+func InputHash(ip string) (string, error) {
+	return inputHash("", ip, v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}, buildConfig{})
+}
+
+// SourceHash returns the hash of the inputs of building the import path ip
+// for platform, as InputHash does, but selecting source files for platform
+// rather than for the host, so that identical source hashes the same
+// wherever it is built.
+func SourceHash(ip string, platform v1.Platform) (string, error) {
+	return sourceHash(ip, platform, buildConfig{})
+}
+
+// sourceHash is SourceHash, selecting the source files that building with
+// config builds from, e.g. those using cgo when it's enabled.
+func sourceHash(ip string, platform v1.Platform, config buildConfig) (string, error) {
+	return inputHash("", ip, platform, config)
+}
+
+// inputHash hashes the inputs of building ip for platform with config,
+// listing its dependencies from dir with the go command and environment
+// that "go build" runs with.
+func inputHash(dir, ip string, platform v1.Platform, config buildConfig) (string, error) {
+	args := []string{"list", "-deps", "-json"}
+	if config.modMode != "" {
+		args = append(args, "-mod="+config.modMode)
+	}
+	cmd := exec.Command(config.goCommand(), append(args, ip)...)
+	cmd.Dir = dir
+	cmd.Env = buildEnv(platform, config)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go list -deps %s: %v\n%s", ip, err, stderr.String())
+	}
+
+	h := sha256.New()
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	var last listedPackage
+	for {
+		var pkg listedPackage
+		if err := decoder.Decode(&pkg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+		// -deps lists ip itself last, after its dependencies.
+		last = pkg
+		if pkg.Standard {
+			continue
+		}
+		fmt.Fprintf(h, "package %s\n", pkg.ImportPath)
+		if m := pkg.Module; m != nil && m.Replace == nil && m.Version != "" {
+			// The contents of versioned modules are fixed by their version.
+			fmt.Fprintf(h, "module %s@%s %s\n", m.Path, m.Version, m.Sum)
+			continue
+		}
+		for _, f := range pkg.files() {
+			if err := hashFile(h, pkg.Dir, f); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// The kodata of ip is added to its image, so is an input too.
+	kodata := filepath.Join(last.Dir, "kodata")
+	if err := filepath.Walk(kodata, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == kodata {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return hashFile(h, kodata, path[len(kodata)+1:])
+	}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile writes the name and contents of the file f within dir to w.
+func hashFile(w io.Writer, dir, f string) error {
+	file, err := os.Open(filepath.Join(dir, f))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fmt.Fprintf(w, "file %s\n", filepath.ToSlash(f))
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestInputHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-inputs")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+	hash := func() string {
+		h, err := inputHash(dir, "./cmd/app", v1.Platform{OS: "linux", Architecture: "amd64"}, buildConfig{})
+		if err != nil {
+			t.Fatalf("inputHash() = %v", err)
+		}
+		return h
+	}
+
+	writeFile("go.mod", "module example.com/app\n")
+	writeFile("cmd/app/main.go", "package main\n\nimport \"example.com/app/lib\"\n\nfunc main() { lib.Run() }\n")
+	writeFile("lib/lib.go", "package lib\n\nfunc Run() {}\n")
+	// An unrelated package isn't an input.
+	writeFile("other/other.go", "package other\n")
+
+	first := hash()
+	if got := hash(); got != first {
+		t.Errorf("inputHash() = %v, then %v, want the same", first, got)
+	}
+
+	writeFile("other/other.go", "package other\n\nfunc Other() {}\n")
+	if got := hash(); got != first {
+		t.Errorf("inputHash() = %v after changing an unrelated package, want %v", got, first)
+	}
+
+	writeFile("lib/lib.go", "package lib\n\nfunc Run() { println() }\n")
+	second := hash()
+	if second == first {
+		t.Errorf("inputHash() = %v after changing a dependency, want it to change", second)
+	}
+
+	writeFile("cmd/app/kodata/index.html", "hello\n")
+	if got := hash(); got == second {
+		t.Errorf("inputHash() = %v after adding kodata, want it to change", got)
+	}
+
+	if _, err := inputHash(dir, "./cmd/missing", v1.Platform{OS: "linux", Architecture: "amd64"}, buildConfig{}); err == nil {
+		t.Error("inputHash(missing) = nil, want error")
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	// The same source, checked out in two places, as on two machines.
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "ko-source")
+		if err != nil {
+			t.Fatalf("TempDir() = %v", err)
+		}
+		defer os.RemoveAll(dir)
+		for name, content := range map[string]string{
+			"go.mod":                 "module example.com/app\n",
+			"cmd/app/main.go":        "package main\n\nfunc main() { run() }\n",
+			"cmd/app/run_linux.go":   "package main\n\nfunc run() {}\n",
+			"cmd/app/run_windows.go": "package main\n\nfunc run() { println() }\n",
+		} {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("MkdirAll() = %v", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("WriteFile() = %v", err)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	hash := func(dir string, platform v1.Platform) string {
+		h, err := inputHash(dir, "./cmd/app", platform, buildConfig{})
+		if err != nil {
+			t.Fatalf("inputHash() = %v", err)
+		}
+		return h
+	}
+
+	linux := v1.Platform{OS: "linux", Architecture: "amd64"}
+	windows := v1.Platform{OS: "windows", Architecture: "amd64"}
+	if first, second := hash(dirs[0], linux), hash(dirs[1], linux); first != second {
+		t.Errorf("hash of identical source = %v and %v, want the same", first, second)
+	}
+	// Each platform builds from its own files.
+	if hash(dirs[0], linux) == hash(dirs[0], windows) {
+		t.Error("hash for linux = hash for windows, want them to differ")
+	}
+}
+
+func TestInputHashNonGoFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-inputs")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+	hash := func(config buildConfig) string {
+		h, err := inputHash(dir, ".", platform, config)
+		if err != nil {
+			t.Fatalf("inputHash() = %v", err)
+		}
+		return h
+	}
+
+	writeFile("go.mod", "module example.com/app\n")
+	writeFile("main.go", "package main\n\nfunc add(a, b int64) int64\n\nfunc main() { println(add(1, 2)) }\n")
+	writeFile("add_amd64.s", "TEXT \u00b7add(SB),4,$0-24\n\tRET\n")
+	// Only built with cgo, which must be listed as the build would be.
+	writeFile("cgo.go", "// +build cgo\n\npackage main\n\n// int one(void);\nimport \"C\"\n\nfunc one() int { return int(C.one()) }\n")
+	writeFile("one.c", "int one(void) { return 1; }\n")
+
+	cgo := buildConfig{env: []string{"CGO_ENABLED=1"}}
+	for _, test := range []struct {
+		desc   string
+		config buildConfig
+		file   string
+	}{{
+		desc: "assembly",
+		file: "add_amd64.s",
+	}, {
+		desc:   "C with cgo enabled",
+		config: cgo,
+		file:   "one.c",
+	}, {
+		desc:   "C with the race detector",
+		config: buildConfig{race: true},
+		file:   "one.c",
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			before := hash(test.config)
+			b, err := ioutil.ReadFile(filepath.Join(dir, test.file))
+			if err != nil {
+				t.Fatalf("ReadFile() = %v", err)
+			}
+			writeFile(test.file, string(b)+"// edited\n")
+			if got := hash(test.config); got == before {
+				t.Errorf("inputHash() = %v after editing %s, want it to change", got, test.file)
+			}
+		})
+	}
+}
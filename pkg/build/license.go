@@ -0,0 +1,61 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// licenseKeys are the labels and annotations that base images record their
+// license under, in the order we look for them.
+var licenseKeys = []string{
+	"org.opencontainers.image.licenses",
+	"org.label-schema.license",
+	"license",
+}
+
+// checkLicense checks that the base image that importpath is to be built on
+// declares its license, in the labels of its config or the annotations of
+// its manifest.
+func checkLicense(importpath string, base v1.Image) error {
+	cf, err := base.ConfigFile()
+	if err != nil {
+		return err
+	}
+	if hasLicense(cf.Config.Labels) {
+		return nil
+	}
+	m, err := base.Manifest()
+	if err != nil {
+		return err
+	}
+	if hasLicense(m.Annotations) {
+		return nil
+	}
+	return fmt.Errorf("the base image for %s doesn't declare a license in any of its %s labels or annotations", importpath, strings.Join(licenseKeys, ", "))
+}
+
+// hasLicense reports whether m has a non-empty value for any of licenseKeys.
+func hasLicense(m map[string]string) bool {
+	for _, k := range licenseKeys {
+		if strings.TrimSpace(m[k]) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -27,8 +27,8 @@ type Limiter struct {
 	semaphore *semaphore.Weighted
 }
 
-// Limiter implements Interface
-var _ Interface = (*Recorder)(nil)
+// Limiter implements PlatformInterface
+var _ PlatformInterface = (*Limiter)(nil)
 
 // IsSupportedReference implements Interface
 func (l *Limiter) IsSupportedReference(ip string) bool {
@@ -46,6 +46,16 @@ func (l *Limiter) Build(ip string) (v1.Image, error) {
 	return l.Builder.Build(ip)
 }
 
+// BuildPlatform implements PlatformInterface
+func (l *Limiter) BuildPlatform(ip string, platform v1.Platform) (v1.Image, error) {
+	if err := l.semaphore.Acquire(context.TODO(), 1); err != nil {
+		return nil, err
+	}
+	defer l.semaphore.Release(1)
+
+	return BuildPlatform(l.Builder, ip, platform)
+}
+
 // NewLimiter returns a new builder that only allows n concurrent builds of b.
 func NewLimiter(b Interface, n int) *Limiter {
 	return &Limiter{
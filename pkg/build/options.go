@@ -15,6 +15,18 @@
 package build
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
@@ -27,6 +39,37 @@ func WithBaseImages(gb GetBase) Option {
 	}
 }
 
+// WithPlatformBaseImages is a functional option for providing the base
+// images to use when building for a platform other than the one images
+// are otherwise built for.  Without it, such builds use the base images
+// from WithBaseImages.
+func WithPlatformBaseImages(gpb GetPlatformBase) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.getPlatformBase = gpb
+		return nil
+	}
+}
+
+// WithBaseImageVerification is a functional option for checking each base
+// image with verify before building on it, failing the build if it returns
+// an error.
+func WithBaseImageVerification(verify VerifyBase) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.verifyBase = verify
+		return nil
+	}
+}
+
+// WithLicenseCheck is a functional option for failing the build of images
+// whose base image doesn't declare its license, in an
+// org.opencontainers.image.licenses (or similar) label or annotation.
+func WithLicenseCheck() Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.checkLicense = true
+		return nil
+	}
+}
+
 // WithCreationTime is a functional option for overriding the creation
 // time given to images.
 func WithCreationTime(t v1.Time) Option {
@@ -45,6 +88,422 @@ func WithDisabledOptimizations() Option {
 	}
 }
 
+// WithAnnotations is a functional option for setting annotations on the
+// manifests of the images produced.  These are distinct from the labels
+// held in the image's config file.
+func WithAnnotations(annotations map[string]string) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.annotations = annotations
+		return nil
+	}
+}
+
+// WithPlatform is a functional option for overriding the platform that
+// images are built for, which otherwise comes from the base image.
+func WithPlatform(platform v1.Platform) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.platform = &platform
+		return nil
+	}
+}
+
+// WithCACerts is a functional option for trusting the certificates in the
+// given bundle when "go build" fetches modules, e.g. from behind a proxy
+// that intercepts TLS.
+func WithCACerts(path string) Option {
+	return func(gbo *gobuildOpener) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return err
+		}
+		gbo.caCerts = abs
+		return nil
+	}
+}
+
+// WithGoCache is a functional option for keeping the build cache of "go build"
+// in dir, which is created if it doesn't exist, so that it can be preserved
+// between builds on ephemeral machines, e.g. by CI.
+func WithGoCache(dir string) Option {
+	return func(gbo *gobuildOpener) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return err
+		}
+		gbo.goCache = abs
+		return nil
+	}
+}
+
+// WithBuildLogDir is a functional option for writing the output of each
+// "go build" to a file named after the import path it built, within dir,
+// which is created if it doesn't exist.  Output is written whether or not the
+// build succeeds.
+func WithBuildLogDir(dir string) Option {
+	return func(gbo *gobuildOpener) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return err
+		}
+		gbo.buildLogDir = abs
+		return nil
+	}
+}
+
+// envNameRE matches the names that environment variables can portably have.
+var envNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WithKoDataEnvName is a functional option for renaming the environment
+// variable that points at the kodata directory, KO_DATA_PATH by default, e.g.
+// for apps that already read a variable of their own.
+func WithKoDataEnvName(name string) Option {
+	return func(gbo *gobuildOpener) error {
+		if !envNameRE.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		gbo.koDataEnvName = name
+		return nil
+	}
+}
+
+// WithSourceHash is a functional option for labeling images with the hash of
+// the source that they were built from, as computed by SourceHash, under
+// SourceHashLabel, so that they can be tagged with it.
+func WithSourceHash() Option {
+	return withSourceHash(sourceHash)
+}
+
+// withSourceHash is WithSourceHash, hashing source with hash.
+func withSourceHash(hash func(string, v1.Platform, buildConfig) (string, error)) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.sourceHash = hash
+		return nil
+	}
+}
+
+// WithBinaryCache is a functional option for keeping the binaries that "go
+// build" produces in dir, keyed on the hash of their inputs, as computed by
+// SourceHash, and of how they're built, so that builds of the same inputs,
+// even by later invocations, reuse them instead of running "go build".
+func WithBinaryCache(dir string) Option {
+	return withBinaryCache(dir, sourceHash)
+}
+
+// withBinaryCache is WithBinaryCache, hashing inputs with hash.
+func withBinaryCache(dir string, hash func(string, v1.Platform, buildConfig) (string, error)) Option {
+	return func(gbo *gobuildOpener) error {
+		if dir == "" {
+			return errors.New("the binary cache needs a directory")
+		}
+		gbo.binaryCache = &binaryCache{dir: dir, hash: hash}
+		return nil
+	}
+}
+
+// WithPreBuildHook is a functional option for running hook before each
+// import path is built, e.g. PreBuildCommand("go generate").  Hooks run in the
+// order that they are added, and a hook that fails fails the build.
+func WithPreBuildHook(hook PreBuildHook) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.preBuildHooks = append(gbo.preBuildHooks, hook)
+		return nil
+	}
+}
+
+// WithBuildRetries is a functional option for retrying "go build" up to
+// retries times when it fails to download modules for reasons that may be
+// transient, such as a flaky GOPROXY, waiting longer before each retry.
+// Other failures, such as compile errors, aren't retried.
+func WithBuildRetries(retries int) Option {
+	return func(gbo *gobuildOpener) error {
+		if retries < 0 {
+			return fmt.Errorf("build retries must not be negative, got %d", retries)
+		}
+		gbo.buildRetries = retries
+		return nil
+	}
+}
+
+// WithExtraHosts is a functional option for resolving each host in hosts to
+// its IP address when "go build" fetches modules with git, e.g. private
+// modules on hosts that aren't in DNS.  Modules fetched through a proxy
+// resolve the proxy's host as usual.
+func WithExtraHosts(hosts map[string]string) Option {
+	return func(gbo *gobuildOpener) error {
+		for host, ip := range hosts {
+			if host == "" {
+				return errors.New("extra host must not be empty")
+			}
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("extra host %s: %q is not an IP address", host, ip)
+			}
+		}
+		gbo.extraHosts = hosts
+		return nil
+	}
+}
+
+// WithGoBinary is a functional option for building with the go command at
+// path, e.g. $GOROOT/bin/go or a shim like go1.13.4 on PATH, instead of the
+// go on PATH.
+func WithGoBinary(path string) Option {
+	return func(gbo *gobuildOpener) error {
+		bin, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("go binary %q: %v", path, err)
+		}
+		gbo.goBinary = bin
+		return nil
+	}
+}
+
+// WithRace is a functional option for building binaries with the race
+// detector.  Such binaries are built with cgo, so the base image must
+// provide the C library they link against, which distroless/static doesn't.
+func WithRace() Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.race = true
+		return nil
+	}
+}
+
+// WithTempDir is a functional option for writing build output under dir,
+// which must exist, instead of the default temporary directory.
+func WithTempDir(dir string) Option {
+	return func(gbo *gobuildOpener) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if fi, err := os.Stat(abs); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", abs)
+		}
+		gbo.tempDir = abs
+		return nil
+	}
+}
+
+// WithAppPath is a functional option for placing the binaries we build in
+// dir, an absolute path within the image, instead of /ko-app.
+func WithAppPath(dir string) Option {
+	return func(gbo *gobuildOpener) error {
+		if !path.IsAbs(dir) {
+			return fmt.Errorf("app path %q is not absolute", dir)
+		}
+		gbo.appDir = path.Clean(dir)
+		return nil
+	}
+}
+
+// WithModMode is a functional option for passing -mod=mode to "go build",
+// where mode is one of mod, vendor or readonly.  Without it, modules with a
+// vendor directory are built with -mod=vendor, unless GOFLAGS sets -mod.
+func WithModMode(mode string) Option {
+	return func(gbo *gobuildOpener) error {
+		switch mode {
+		case "mod", "vendor", "readonly":
+			gbo.modMode = mode
+			return nil
+		default:
+			return fmt.Errorf("unsupported mod mode %q, want one of mod, vendor or readonly", mode)
+		}
+	}
+}
+
+// WithBuildVCS is a functional option for passing -buildvcs=mode to
+// "go build", where mode is one of true, false or auto, e.g. to stop go 1.18
+// and later from failing to stamp binaries with version control information
+// in shallow clones.  Since auto is go's default, it isn't passed, so that
+// older versions of go, which don't have the flag, can still build.
+func WithBuildVCS(mode string) Option {
+	return func(gbo *gobuildOpener) error {
+		switch mode {
+		case "auto":
+			gbo.buildVCS = ""
+			return nil
+		case "true", "false":
+			gbo.buildVCS = mode
+			return nil
+		default:
+			return fmt.Errorf("unsupported buildvcs mode %q, want one of true, false or auto", mode)
+		}
+	}
+}
+
+// WithVersion is a functional option for recording the version of ko in the
+// history of the layers we add to images.
+func WithVersion(version string) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.version = version
+		return nil
+	}
+}
+
+// WithDebugEntrypoint is a functional option for making a shell from the base
+// image the entrypoint instead of the app, for debugging images that won't
+// start.  The path of the app is set in the KO_APP_PATH environment variable.
+func WithDebugEntrypoint() Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.debugEntrypoint = true
+		return nil
+	}
+}
+
+// WithEntrypointWrapper is a functional option for making the script at path
+// the entrypoint, e.g. to template config from the environment when the
+// container starts.  The script is passed the path of the app followed by
+// its args, which it should exec when it's done, e.g. with exec "$@".  It
+// is run with the shell of the base image, which must have one.
+func WithEntrypointWrapper(path string) Option {
+	return func(gbo *gobuildOpener) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if err := checkWrapperScript(abs); err != nil {
+			return err
+		}
+		gbo.entrypointWrapper = abs
+		return nil
+	}
+}
+
+// WithDefaultArgs is a functional option for setting the arguments the app
+// is run with when the container doesn't specify any, as the image config's
+// Cmd, while the app itself stays the Entrypoint.  Unlike arguments baked
+// into the Entrypoint, these are replaced by the container's args.
+func WithDefaultArgs(args []string) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.defaultArgs = append([]string{}, args...)
+		return nil
+	}
+}
+
+// WithMaxImageSize is a functional option for failing the build of images
+// whose layers, including the base image's, add up to more than max bytes
+// compressed.
+func WithMaxImageSize(max int64) Option {
+	return func(gbo *gobuildOpener) error {
+		if max <= 0 {
+			return fmt.Errorf("max image size must be positive, got %d", max)
+		}
+		gbo.maxImageSize = max
+		return nil
+	}
+}
+
+// WithBinaryValidation is a functional option for checking that each binary
+// we build can run on the target platform, failing the build if it can't.
+func WithBinaryValidation() Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.validateBinaries = true
+		return nil
+	}
+}
+
+// WithScratchBase is a functional option for building each import path onto
+// an empty base image, as FROM scratch does, instead of the base images
+// otherwise provided.  Binaries are built without cgo, and the build fails
+// if one is nonetheless dynamically linked, as it couldn't run.
+func WithScratchBase() Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.scratchBase = true
+		return nil
+	}
+}
+
+// WithLayerOwner is a functional option for setting the user and group ids
+// that own the files and directories in the layers holding our binaries and
+// kodata, instead of root (0:0), e.g. for scanners that flag files owned by
+// root.
+func WithLayerOwner(uid, gid int) Option {
+	return func(gbo *gobuildOpener) error {
+		if uid < 0 || gid < 0 {
+			return fmt.Errorf("layer owner must not be negative, got %d:%d", uid, gid)
+		}
+		gbo.owner = layerOwner{uid: uid, gid: gid}
+		return nil
+	}
+}
+
+// signals holds the names of the signals that may be used as the stop signal.
+var signals = map[string]struct{}{
+	"SIGABRT": {}, "SIGALRM": {}, "SIGBUS": {}, "SIGCHLD": {}, "SIGCONT": {},
+	"SIGFPE": {}, "SIGHUP": {}, "SIGILL": {}, "SIGINT": {}, "SIGIO": {},
+	"SIGKILL": {}, "SIGPIPE": {}, "SIGPROF": {}, "SIGPWR": {}, "SIGQUIT": {},
+	"SIGSEGV": {}, "SIGSTKFLT": {}, "SIGSTOP": {}, "SIGSYS": {}, "SIGTERM": {},
+	"SIGTRAP": {}, "SIGTSTP": {}, "SIGTTIN": {}, "SIGTTOU": {}, "SIGURG": {},
+	"SIGUSR1": {}, "SIGUSR2": {}, "SIGVTALRM": {}, "SIGWINCH": {}, "SIGXCPU": {},
+	"SIGXFSZ": {},
+}
+
+// WithStopSignal is a functional option for setting the signal that the
+// container runtime sends to stop the image's containers.  The signal may be
+// given by name, with or without the "SIG" prefix, or by number.
+func WithStopSignal(signal string) Option {
+	return func(gbo *gobuildOpener) error {
+		if n, err := strconv.Atoi(signal); err == nil {
+			if n < 1 || n > 64 {
+				return fmt.Errorf("stop signal %d is out of range", n)
+			}
+			gbo.stopSignal = signal
+			return nil
+		}
+		name := strings.ToUpper(signal)
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		if _, ok := signals[name]; !ok {
+			return fmt.Errorf("unknown stop signal %q", signal)
+		}
+		gbo.stopSignal = name
+		return nil
+	}
+}
+
+// WithHealthcheck is a functional option for setting the healthcheck that
+// container runtimes run in the image's containers.  cmd is run directly,
+// unless its first element is "CMD", "CMD-SHELL" or "NONE", in which case it
+// is used as the healthcheck's test as-is.  Zero values of interval, timeout
+// and retries inherit the runtime's defaults.
+func WithHealthcheck(cmd []string, interval, timeout time.Duration, retries int) Option {
+	return func(gbo *gobuildOpener) error {
+		if len(cmd) == 0 || cmd[0] == "" {
+			return errors.New("healthcheck command must not be empty")
+		}
+		if interval < 0 || timeout < 0 || retries < 0 {
+			return fmt.Errorf("healthcheck interval, timeout and retries must not be negative, got %v, %v and %d", interval, timeout, retries)
+		}
+		test := cmd
+		switch cmd[0] {
+		case "CMD", "CMD-SHELL", "NONE":
+		default:
+			test = append([]string{"CMD"}, cmd...)
+		}
+		if len(test) == 1 && test[0] != "NONE" {
+			return fmt.Errorf("healthcheck %s must be followed by a command", test[0])
+		}
+		gbo.healthcheck = &v1.HealthConfig{
+			Test:     test,
+			Interval: interval,
+			Timeout:  timeout,
+			Retries:  retries,
+		}
+		return nil
+	}
+}
+
 // withBuilder is a functional option for overriding the way go binaries
 // are built.
 func withBuilder(b builder) Option {
@@ -63,3 +522,24 @@ func withModuleInfo(mi *modInfo) Option {
 		return nil
 	}
 }
+
+// WithBundledBinaries is a functional option for building the binaries of
+// other import paths into the image for an import path, alongside its own.
+// bundles maps the import path whose binary is the image's entrypoint to
+// those bundled with it, each of which is placed at /ko-app/<name>.
+func WithBundledBinaries(bundles map[string][]string) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.bundles = bundles
+		return nil
+	}
+}
+
+// WithEntrypoints is a functional option for running one of the binaries
+// bundled into the image for an import path, instead of its own.
+// entrypoints maps import paths to that of the bundled binary to run.
+func WithEntrypoints(entrypoints map[string]string) Option {
+	return func(gbo *gobuildOpener) error {
+		gbo.entrypoints = entrypoints
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PreBuildCommand returns a PreBuildHook that runs command with "sh -c" in
+// the directory of the package being built, as "go generate" expects.
+func PreBuildCommand(command string) PreBuildHook {
+	return func(ctx context.Context, ip string) error {
+		dir, err := packageDir(ctx, ip)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Dir = dir
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running %q in %s: %v\n%s", command, dir, err, output.String())
+		}
+		return nil
+	}
+}
+
+// packageDir returns the directory of the package with import path ip.
+func packageDir(ctx context.Context, ip string) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-f", "{{.Dir}}", ip)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go list %s: %v\n%s", ip, err, stderr.String())
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreBuildCommand(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko-prebuild")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	out := filepath.Join(tmpDir, "pwd")
+
+	if err := PreBuildCommand("pwd > "+out)(context.Background(), "github.com/google/ko/cmd/ko"); err != nil {
+		t.Fatalf("PreBuildCommand() = %v", err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	want, err := filepath.Abs(filepath.Join("..", "..", "cmd", "ko"))
+	if err != nil {
+		t.Fatalf("Abs() = %v", err)
+	}
+	if got := strings.TrimSpace(string(b)); got != want {
+		t.Errorf("command ran in %s, want %s", got, want)
+	}
+
+	if err := PreBuildCommand("exit 1")(context.Background(), "github.com/google/ko/cmd/ko"); err == nil {
+		t.Error("PreBuildCommand(exit 1) = nil, want error")
+	}
+	if err := PreBuildCommand("true")(context.Background(), "github.com/google/ko/cmd/missing"); err == nil {
+		t.Error("PreBuildCommand() for a missing package = nil, want error")
+	}
+}
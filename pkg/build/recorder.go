@@ -16,6 +16,7 @@ package build
 
 import (
 	"sync"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
@@ -25,10 +26,23 @@ type Recorder struct {
 	m           sync.Mutex
 	ImportPaths []string
 	Builder     Interface
+
+	// RecordResults has Results recorded for each successful build.
+	RecordResults bool
+	Results       []Result
+}
+
+// Result describes the image built for an import path.
+type Result struct {
+	ImportPath string
+	Digest     v1.Hash
+	// Size is the size of the image's config and compressed layers.
+	Size     int64
+	Duration time.Duration
 }
 
-// Recorder implements Interface
-var _ Interface = (*Recorder)(nil)
+// Recorder implements PlatformInterface
+var _ PlatformInterface = (*Recorder)(nil)
 
 // IsSupportedReference implements Interface
 func (r *Recorder) IsSupportedReference(ip string) bool {
@@ -37,10 +51,62 @@ func (r *Recorder) IsSupportedReference(ip string) bool {
 
 // Build implements Interface
 func (r *Recorder) Build(ip string) (v1.Image, error) {
+	return r.record(ip, func() (v1.Image, error) {
+		return r.Builder.Build(ip)
+	})
+}
+
+// BuildPlatform implements PlatformInterface
+func (r *Recorder) BuildPlatform(ip string, platform v1.Platform) (v1.Image, error) {
+	return r.record(ip, func() (v1.Image, error) {
+		return BuildPlatform(r.Builder, ip, platform)
+	})
+}
+
+// record records ip, and the result of building it with build when
+// RecordResults is set.
+func (r *Recorder) record(ip string, build func() (v1.Image, error)) (v1.Image, error) {
 	func() {
 		r.m.Lock()
 		defer r.m.Unlock()
 		r.ImportPaths = append(r.ImportPaths, ip)
 	}()
-	return r.Builder.Build(ip)
+	if !r.RecordResults {
+		return build()
+	}
+
+	start := time.Now()
+	img, err := build()
+	if err != nil {
+		return nil, err
+	}
+	result, err := newResult(ip, img, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.Results = append(r.Results, result)
+	return img, nil
+}
+
+func newResult(ip string, img v1.Image, d time.Duration) (Result, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return Result{}, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return Result{}, err
+	}
+	size := m.Config.Size
+	for _, l := range m.Layers {
+		size += l.Size
+	}
+	return Result{
+		ImportPath: ip,
+		Digest:     digest,
+		Size:       size,
+		Duration:   d,
+	}, nil
 }
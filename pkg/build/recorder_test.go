@@ -15,11 +15,14 @@
 package build
 
 import (
+	"errors"
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 type fake struct {
@@ -119,3 +122,48 @@ func TestBuildRecording(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildRecordingResults(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest() = %v", err)
+	}
+	size := m.Config.Size + m.Layers[0].Size + m.Layers[1].Size
+
+	inner := &fake{
+		b: func(ip string) (v1.Image, error) {
+			if ip == "github.com/foo/broken" {
+				return nil, errors.New("broken")
+			}
+			return img, nil
+		},
+	}
+	rec := &Recorder{
+		Builder:       inner,
+		RecordResults: true,
+	}
+	for _, in := range []string{"github.com/foo/bar", "github.com/foo/broken", "github.com/foo/baz"} {
+		rec.Build(in)
+	}
+
+	want := []Result{{
+		ImportPath: "github.com/foo/bar",
+		Digest:     digest,
+		Size:       size,
+	}, {
+		ImportPath: "github.com/foo/baz",
+		Digest:     digest,
+		Size:       size,
+	}}
+	if diff := cmp.Diff(want, rec.Results, cmpopts.IgnoreFields(Result{}, "Duration")); diff != "" {
+		t.Errorf("Results (-want, +got): %s", diff)
+	}
+}
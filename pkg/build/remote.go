@@ -0,0 +1,219 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// The remote build service is spoken to over HTTP, with JSON bodies:
+//
+//   GET  <endpoint>/supported?importpath=<import path>
+//     -> {"supported": true}
+//   POST <endpoint>/build  {"importpath": "<import path>"}
+//     -> {"image": "<image reference, by digest>"}
+//
+// Failures are reported with a status other than 200 OK, and the error
+// message as the body.  The service publishes the images it builds to a
+// registry that we can pull them from.
+
+type supportedResponse struct {
+	Supported bool `json:"supported"`
+}
+
+type buildRequest struct {
+	ImportPath string `json:"importpath"`
+}
+
+type buildResponse struct {
+	Image string `json:"image"`
+}
+
+// How long we wait for the build service to answer whether it supports an
+// import path, and to build one.
+const (
+	supportedTimeout = 30 * time.Second
+	buildTimeout     = 10 * time.Minute
+)
+
+// remoteBuild is a build.Interface implementation that has a remote build
+// service build images.
+type remoteBuild struct {
+	endpoint         string
+	client           *http.Client
+	fetch            func(name.Reference) (v1.Image, error)
+	supportedTimeout time.Duration
+	buildTimeout     time.Duration
+
+	m sync.Mutex
+	// supported memoizes the answers of the build service to whether it
+	// supports import paths, which are asked for every reference.
+	supported map[string]bool
+}
+
+// remoteBuild implements Interface
+var _ Interface = (*remoteBuild)(nil)
+
+// NewRemote returns a build.Interface implementation that has the build
+// service at endpoint build images, which it pulls with keys.
+func NewRemote(endpoint string, keys authn.Keychain) (Interface, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("build service endpoint %q is not an http(s) URL", endpoint)
+	}
+	return &remoteBuild{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		// Each call has a deadline of its own, so this only bounds any
+		// call that somehow has none.
+		client: &http.Client{Timeout: buildTimeout},
+		fetch: func(ref name.Reference) (v1.Image, error) {
+			return remote.Image(ref, remote.WithAuthFromKeychain(keys))
+		},
+		supportedTimeout: supportedTimeout,
+		buildTimeout:     buildTimeout,
+		supported:        make(map[string]bool),
+	}, nil
+}
+
+// IsSupportedReference implements build.Interface
+func (r *remoteBuild) IsSupportedReference(s string) bool {
+	r.m.Lock()
+	supported, ok := r.supported[s]
+	r.m.Unlock()
+	if ok {
+		return supported
+	}
+
+	var resp supportedResponse
+	if err := r.call(r.supportedTimeout, http.MethodGet, "/supported?importpath="+url.QueryEscape(s), nil, &resp); err != nil {
+		// Not remembered, as the next call may well succeed.
+		log.Printf("Unable to ask the build service whether %s is supported: %v", s, err)
+		return false
+	}
+	r.m.Lock()
+	r.supported[s] = resp.Supported
+	r.m.Unlock()
+	return resp.Supported
+}
+
+// Build implements build.Interface
+func (r *remoteBuild) Build(s string) (v1.Image, error) {
+	var resp buildResponse
+	if err := r.call(r.buildTimeout, http.MethodPost, "/build", buildRequest{ImportPath: s}, &resp); err != nil {
+		return nil, fmt.Errorf("building %s: %v", s, err)
+	}
+	ref, err := name.NewDigest(resp.Image)
+	if err != nil {
+		return nil, fmt.Errorf("building %s: the build service returned %q: %v", s, resp.Image, err)
+	}
+	return r.fetch(ref)
+}
+
+// call makes a request to the build service, decoding its response into out,
+// giving up if that takes longer than timeout.
+func (r *remoteBuild) call(timeout time.Duration, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, r.endpoint+path, &body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// NewRemoteHandler returns a reference implementation of the build service,
+// which builds images with builder and publishes them with publish.
+func NewRemoteHandler(builder Interface, publish func(v1.Image, string) (name.Reference, error)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/supported", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := req.URL.Query().Get("importpath")
+		writeJSON(w, supportedResponse{Supported: builder.IsSupportedReference(ip)})
+	})
+	mux.HandleFunc("/build", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var br buildRequest
+		if err := json.NewDecoder(req.Body).Decode(&br); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !builder.IsSupportedReference(br.ImportPath) {
+			http.Error(w, fmt.Sprintf("%s is not a supported import path", br.ImportPath), http.StatusBadRequest)
+			return
+		}
+		img, err := builder.Build(br.ImportPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ref, err := publish(img, br.ImportPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, buildResponse{Image: ref.String()})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Unable to write response: %v", err)
+	}
+}
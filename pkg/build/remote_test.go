@@ -0,0 +1,189 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// memoryRegistry holds the images published by the build service, by digest.
+type memoryRegistry struct {
+	m      sync.Mutex
+	images map[string]v1.Image
+}
+
+func (mr *memoryRegistry) publish(img v1.Image, s string) (name.Reference, error) {
+	d, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("example.com/built/%s@%s", s, d))
+	if err != nil {
+		return nil, err
+	}
+	mr.m.Lock()
+	defer mr.m.Unlock()
+	mr.images[ref.String()] = img
+	return ref, nil
+}
+
+func (mr *memoryRegistry) fetch(ref name.Reference) (v1.Image, error) {
+	mr.m.Lock()
+	defer mr.m.Unlock()
+	img, ok := mr.images[ref.String()]
+	if !ok {
+		return nil, fmt.Errorf("%v not found", ref)
+	}
+	return img, nil
+}
+
+// newRemoteForTest starts a build service backed by inner, and returns a
+// client for it, which pulls images from the service's registry.
+func newRemoteForTest(t *testing.T, inner Interface) (Interface, func()) {
+	mr := &memoryRegistry{images: make(map[string]v1.Image)}
+	server := httptest.NewServer(NewRemoteHandler(inner, mr.publish))
+	rb, err := NewRemote(server.URL+"/", authn.DefaultKeychain)
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewRemote() = %v", err)
+	}
+	rb.(*remoteBuild).fetch = mr.fetch
+	return rb, server.Close
+}
+
+func TestRemoteBuild(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	inner := &fake{
+		isr: func(ip string) bool {
+			return strings.HasPrefix(ip, "github.com/")
+		},
+		b: func(ip string) (v1.Image, error) {
+			if ip == "github.com/foo/broken" {
+				return nil, errors.New("compilation failed")
+			}
+			return img, nil
+		},
+	}
+	rb, cleanup := newRemoteForTest(t, inner)
+	defer cleanup()
+
+	if !rb.IsSupportedReference("github.com/foo/bar") {
+		t.Error("IsSupportedReference(github.com/foo/bar) = false, want true")
+	}
+	if rb.IsSupportedReference("gcr.io/foo/bar") {
+		t.Error("IsSupportedReference(gcr.io/foo/bar) = true, want false")
+	}
+
+	got, err := rb.Build("github.com/foo/bar")
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if d, err := got.Digest(); err != nil {
+		t.Errorf("Digest() = %v", err)
+	} else if d != want {
+		t.Errorf("Digest() = %v, want %v", d, want)
+	}
+
+	for _, ip := range []string{"github.com/foo/broken", "gcr.io/foo/bar"} {
+		if _, err := rb.Build(ip); err == nil {
+			t.Errorf("Build(%q) = nil, want error", ip)
+		}
+	}
+}
+
+func TestNewRemoteErrors(t *testing.T) {
+	for _, endpoint := range []string{"", "builds.example.com", "ftp://builds.example.com"} {
+		if _, err := NewRemote(endpoint, authn.DefaultKeychain); err == nil {
+			t.Errorf("NewRemote(%q) = nil, want error", endpoint)
+		}
+	}
+
+	// An unreachable build service supports nothing.
+	rb, cleanup := newRemoteForTest(t, &fake{})
+	cleanup()
+	if rb.IsSupportedReference("github.com/foo/bar") {
+		t.Error("IsSupportedReference() = true with the build service down, want false")
+	}
+}
+
+func TestRemoteSupportedIsMemoized(t *testing.T) {
+	var m sync.Mutex
+	asked := map[string]int{}
+	inner := &fake{
+		isr: func(ip string) bool {
+			m.Lock()
+			defer m.Unlock()
+			asked[ip]++
+			return strings.HasPrefix(ip, "github.com/")
+		},
+	}
+	rb, cleanup := newRemoteForTest(t, inner)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		if !rb.IsSupportedReference("github.com/foo/bar") {
+			t.Error("IsSupportedReference(github.com/foo/bar) = false, want true")
+		}
+		if rb.IsSupportedReference("gcr.io/foo/bar") {
+			t.Error("IsSupportedReference(gcr.io/foo/bar) = true, want false")
+		}
+	}
+	for _, ip := range []string{"github.com/foo/bar", "gcr.io/foo/bar"} {
+		if asked[ip] != 1 {
+			t.Errorf("asked the build service about %s %d times, want 1", ip, asked[ip])
+		}
+	}
+}
+
+func TestRemoteTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	rb, err := NewRemote(server.URL, authn.DefaultKeychain)
+	if err != nil {
+		t.Fatalf("NewRemote() = %v", err)
+	}
+	rb.(*remoteBuild).supportedTimeout = 10 * time.Millisecond
+	rb.(*remoteBuild).buildTimeout = 10 * time.Millisecond
+
+	if rb.IsSupportedReference("github.com/foo/bar") {
+		t.Error("IsSupportedReference() = true with the build service hung, want false")
+	}
+	if _, err := rb.Build("github.com/foo/bar"); err == nil {
+		t.Error("Build() = nil with the build service hung, want error")
+	}
+}
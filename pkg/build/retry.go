@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// buildRetryDelay is how long to wait before the first retry of a build,
+// doubling with each retry after it.
+var buildRetryDelay = time.Second
+
+// buildOutputError is the error of a failed "go build", along with its output.
+type buildOutputError struct {
+	err    error
+	output string
+}
+
+// Error implements error
+func (e *buildOutputError) Error() string {
+	return e.err.Error()
+}
+
+// fetchMarkers appear on the lines of "go build" output that report failing
+// to fetch a module, or its checksum.
+var fetchMarkers = []string{`Get "https://`, "Get https://", "reading https://"}
+
+// transientMarkers appear on those lines when the fetch failed for reasons
+// that may well not recur, such as a flaky GOPROXY.
+var transientMarkers = []string{
+	"dial tcp",
+	"i/o timeout",
+	"connection reset by peer",
+	"TLS handshake timeout",
+	"unexpected EOF",
+	"429 Too Many Requests",
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+}
+
+// isTransientBuildError reports whether err is a build that failed to fetch
+// a module for reasons that may be transient, as opposed to, say, failing
+// to compile, which retrying won't fix.
+func isTransientBuildError(err error) bool {
+	boe, ok := err.(*buildOutputError)
+	if !ok {
+		return false
+	}
+	for _, line := range strings.Split(boe.output, "\n") {
+		if containsAny(line, fetchMarkers) && containsAny(line, transientMarkers) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildWithRetries builds s, retrying up to gb.buildRetries times when the
+// build fails to fetch modules for reasons that may be transient.
+func (gb *gobuild) buildWithRetries(s string, platform v1.Platform) (string, error) {
+	for attempt := 0; ; attempt++ {
+		file, err := gb.build(s, platform, gb.buildConfig())
+		if err == nil || attempt >= gb.buildRetries || !isTransientBuildError(err) {
+			return file, err
+		}
+		delay := buildRetryDelay << uint(attempt)
+		log.Printf("Building %s failed to download modules, retrying in %v", s, delay)
+		time.Sleep(delay)
+	}
+}
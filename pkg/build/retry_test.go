@@ -0,0 +1,119 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+const (
+	proxyFailure   = `main.go:5:2: github.com/foo/bar@v1.2.3: Get "https://proxy.golang.org/github.com/foo/bar/@v/v1.2.3.zip": dial tcp: lookup proxy.golang.org: i/o timeout`
+	compileFailure = "# github.com/google/ko/cmd/ko\n./main.go:5:2: undefined: foo"
+)
+
+func TestIsTransientBuildError(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "proxy timeout", err: &buildOutputError{err: errors.New("exit status 1"), output: proxyFailure}, want: true},
+		{desc: "bad gateway", err: &buildOutputError{err: errors.New("exit status 1"), output: "go: verifying module: github.com/foo/bar@v1.2.3: reading https://sum.golang.org/lookup/github.com/foo/bar@v1.2.3: 502 Bad Gateway"}, want: true},
+		{desc: "missing module", err: &buildOutputError{err: errors.New("exit status 1"), output: `go: github.com/foo/bar@v1.2.3: reading https://proxy.golang.org/github.com/foo/bar/@v/v1.2.3.info: 404 Not Found`}},
+		{desc: "compile error", err: &buildOutputError{err: errors.New("exit status 1"), output: compileFailure}},
+		{desc: "other error", err: errors.New("dial tcp: i/o timeout")},
+	} {
+		if got := isTransientBuildError(test.err); got != test.want {
+			t.Errorf("%s: isTransientBuildError() = %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestGoBuildRetries(t *testing.T) {
+	defer func(delay time.Duration) { buildRetryDelay = delay }(buildRetryDelay)
+	buildRetryDelay = 0
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko")
+
+	for _, test := range []struct {
+		desc         string
+		retries      int
+		failures     []string
+		wantAttempts int
+		wantErr      bool
+	}{{
+		desc:         "network error, then success",
+		retries:      2,
+		failures:     []string{proxyFailure},
+		wantAttempts: 2,
+	}, {
+		desc:         "compile error",
+		retries:      2,
+		failures:     []string{compileFailure},
+		wantAttempts: 1,
+		wantErr:      true,
+	}, {
+		desc:         "retries exhausted",
+		retries:      1,
+		failures:     []string{proxyFailure, proxyFailure},
+		wantAttempts: 2,
+		wantErr:      true,
+	}, {
+		desc:         "no retries",
+		failures:     []string{proxyFailure},
+		wantAttempts: 1,
+		wantErr:      true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			attempts := 0
+			flaky := func(ip string, platform v1.Platform, config buildConfig) (string, error) {
+				attempts++
+				if attempts <= len(test.failures) {
+					return "", &buildOutputError{err: errors.New("exit status 1"), output: test.failures[attempts-1]}
+				}
+				return writeTempFile(ip, platform, config)
+			}
+			ng, err := NewGo(
+				WithBuildRetries(test.retries),
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(flaky),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+			_, err = ng.Build(importpath)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("built %d times, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+
+	if _, err := NewGo(WithBuildRetries(-1)); err == nil {
+		t.Error("NewGo(WithBuildRetries(-1)) = nil, want error")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"debug/elf"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+)
+
+// scratchBase provides the empty image as the base of every import path.
+func scratchBase(string) (v1.Image, error) {
+	return empty.Image, nil
+}
+
+// checkStatic checks that the binary built from importpath at path is
+// statically linked, as it must be to run on an empty base image, which has
+// no dynamic loader or C library for it to use.  Binaries that need one name
+// their loader in an interp section.
+func checkStatic(importpath, path string, platform v1.Platform) error {
+	if platform.OS == "windows" || platform.OS == "darwin" {
+		return fmt.Errorf("cannot build %s for %s on a scratch base, which only supports ELF binaries", importpath, platform.OS)
+	}
+
+	f, err := elf.Open(path)
+	if err != nil {
+		return fmt.Errorf("the binary built from %s is not a valid ELF binary for %s/%s: %v", importpath, platform.OS, platform.Architecture, err)
+	}
+	defer f.Close()
+
+	dynamic := f.Section(".interp") != nil
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			dynamic = true
+		}
+	}
+	if dynamic {
+		return fmt.Errorf("the binary built from %s is dynamically linked, so it can't run on a scratch base; build it without cgo", importpath)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestGoBuildScratchBase(t *testing.T) {
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko")
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	for _, test := range []struct {
+		desc    string
+		interp  string
+		wantErr string
+	}{{
+		desc: "static binary",
+	}, {
+		desc:    "dynamic binary",
+		interp:  "/lib64/ld-linux-x86-64.so.2",
+		wantErr: "dynamically linked",
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var env []string
+			ng, err := NewGo(
+				WithScratchBase(),
+				WithPlatform(platform),
+				withBuilder(func(_ string, _ v1.Platform, config buildConfig) (string, error) {
+					env = config.env
+					return writeELFWithInterp(elf.EM_X86_64, test.interp)
+				}),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			img, err := ng.Build(importpath)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Build() = %v, want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+
+			// The image holds only our kodata and binary layers.
+			layers, err := img.Layers()
+			if err != nil {
+				t.Fatalf("Layers() = %v", err)
+			}
+			if got, want := len(layers), 2; got != want {
+				t.Errorf("len(Layers()) = %d, want %d", got, want)
+			}
+			if got, want := env[len(env)-1], "CGO_ENABLED=0"; got != want {
+				t.Errorf("last build env = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGoBuildScratchBaseDefaultPlatform(t *testing.T) {
+	var built v1.Platform
+	ng, err := NewGo(
+		WithScratchBase(),
+		withBuilder(func(_ string, p v1.Platform, _ buildConfig) (string, error) {
+			built = p
+			return writeELF(elf.EM_X86_64)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewGo() = %v", err)
+	}
+	// The binary's architecture isn't validated, so whatever it's built
+	// for, the fake's ELF binary will do.
+	img, err := ng.Build(filepath.Join("github.com/google/ko", "cmd", "ko"))
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	want := v1.Platform{OS: "linux", Architecture: runtime.GOARCH}
+	if built.OS != want.OS || built.Architecture != want.Architecture {
+		t.Errorf("built for %v, want %v", built, want)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() = %v", err)
+	}
+	if cfg.OS != want.OS || cfg.Architecture != want.Architecture {
+		t.Errorf("ConfigFile() platform = %s/%s, want %s/%s", cfg.OS, cfg.Architecture, want.OS, want.Architecture)
+	}
+}
+
+func TestCheckStatic(t *testing.T) {
+	file, err := writeELF(elf.EM_X86_64)
+	if err != nil {
+		t.Fatalf("writeELF() = %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(file))
+
+	if err := checkStatic("github.com/google/ko", file, v1.Platform{OS: "linux", Architecture: "amd64"}); err != nil {
+		t.Errorf("checkStatic(linux) = %v", err)
+	}
+	if err := checkStatic("github.com/google/ko", file, v1.Platform{OS: "windows", Architecture: "amd64"}); err == nil {
+		t.Error("checkStatic(windows) = nil, want error")
+	}
+}
+
+func TestScratchBaseRace(t *testing.T) {
+	if _, err := NewGo(WithScratchBase(), WithRace()); err == nil {
+		t.Error("NewGo(WithScratchBase(), WithRace()) = nil, want error")
+	}
+}
@@ -15,54 +15,225 @@
 package build
 
 import (
+	"fmt"
+	"log"
 	"sync"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 // Caching wraps a builder implementation in a layer that shares build results
 // for the same inputs using a simple "future" implementation.  Cached results
-// may be invalidated by calling Invalidate with the same input passed to Build.
+// may be invalidated by calling Invalidate with the same input passed to Build,
+// and are evicted once they exceed the optional size and age bounds.
 type Caching struct {
 	inner Interface
 
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+	inputHash  func(string) (string, error)
+
 	m       sync.Mutex
-	results map[string]*future
+	results map[cacheKey]*cacheEntry
+	// hashes memoizes the hashes of the inputs of import paths, which
+	// are only hashed again once the import path is invalidated.
+	hashes map[string]*hashEntry
+}
+
+// hashEntry is the hash of the inputs of an import path, computed once.
+type hashEntry struct {
+	once sync.Once
+	hash string
+	err  error
 }
 
-// Caching implements Interface
-var _ Interface = (*Caching)(nil)
+// cacheKey identifies a build result by the import path it was built from, the
+// platform it was explicitly built for, if any, and, when inputs are hashed,
+// the hash of its inputs at the time.
+type cacheKey struct {
+	ip   string
+	hash string
+	// platform is the platform ip was built for, or "" if it was built for
+	// the builder's own.
+	platform string
+}
+
+// cacheEntry is a cached build result, along with the bookkeeping we need to
+// decide when to evict it.
+type cacheEntry struct {
+	f *future
+	// waiters is the number of Build calls currently blocked on f.
+	waiters int
+	// used is when f was last requested or returned.
+	used time.Time
+}
+
+// Caching implements PlatformInterface
+var _ PlatformInterface = (*Caching)(nil)
+
+// CachingOption is a functional option for NewCaching.
+type CachingOption func(*Caching) error
+
+// WithMaxEntries is a functional option for bounding the number of build
+// results that are cached.  Once there are more, the least recently used
+// results that no Build call is waiting on are evicted.
+func WithMaxEntries(n int) CachingOption {
+	return func(c *Caching) error {
+		if n < 0 {
+			return fmt.Errorf("max entries must not be negative, got %d", n)
+		}
+		c.maxEntries = n
+		return nil
+	}
+}
+
+// WithTTL is a functional option for evicting cached build results that no
+// Build call has used for longer than ttl.
+func WithTTL(ttl time.Duration) CachingOption {
+	return func(c *Caching) error {
+		if ttl < 0 {
+			return fmt.Errorf("ttl must not be negative, got %v", ttl)
+		}
+		c.ttl = ttl
+		return nil
+	}
+}
+
+// WithInputHash is a functional option for keying cached build results on the
+// hash of their inputs, as computed by hash (e.g. InputHash), as well as on the
+// import path, so that a change to what an import path depends on results in a
+// new build without the import path having been invalidated.
+func WithInputHash(hash func(ip string) (string, error)) CachingOption {
+	return func(c *Caching) error {
+		c.inputHash = hash
+		return nil
+	}
+}
 
 // NewCaching wraps the provided build.Interface in an implementation that
-// shares build results for a given path until the result has been invalidated.
-func NewCaching(inner Interface) (*Caching, error) {
-	return &Caching{
+// shares build results for a given path until the result has been invalidated
+// or evicted.  By default, results are never evicted.
+func NewCaching(inner Interface, opts ...CachingOption) (*Caching, error) {
+	c := &Caching{
 		inner:   inner,
-		results: make(map[string]*future),
-	}, nil
+		now:     time.Now,
+		results: make(map[cacheKey]*cacheEntry),
+		hashes:  make(map[string]*hashEntry),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 // Build implements Interface
 func (c *Caching) Build(ip string) (v1.Image, error) {
-	f := func() *future {
+	return c.get(cacheKey{ip: ip}, func() (v1.Image, error) {
+		return c.inner.Build(ip)
+	})
+}
+
+// BuildPlatform implements PlatformInterface
+func (c *Caching) BuildPlatform(ip string, platform v1.Platform) (v1.Image, error) {
+	return c.get(cacheKey{ip: ip, platform: platformString(platform)}, func() (v1.Image, error) {
+		return BuildPlatform(c.inner, ip, platform)
+	})
+}
+
+// get returns the cached result for key, calling build to produce it if
+// there isn't one.
+func (c *Caching) get(key cacheKey, build func() (v1.Image, error)) (v1.Image, error) {
+	ip := key.ip
+	if c.inputHash != nil {
+		key.hash = c.hash(ip)
+	}
+
+	e := func() *cacheEntry {
 		// Lock the map of futures.
 		c.m.Lock()
 		defer c.m.Unlock()
 
 		// If a future for "ip" exists, then return it.
-		f, ok := c.results[ip]
-		if ok {
-			return f
-		}
 		// Otherwise create and record a future for a Build of "ip".
-		f = newFuture(func() (v1.Image, error) {
-			return c.inner.Build(ip)
-		})
-		c.results[ip] = f
-		return f
+		e, ok := c.results[key]
+		if !ok {
+			e = &cacheEntry{
+				f: newFuture(build),
+			}
+			c.results[key] = e
+		}
+		e.waiters++
+		e.used = c.now()
+		c.evict()
+		return e
+	}()
+	defer func() {
+		c.m.Lock()
+		defer c.m.Unlock()
+		e.waiters--
+		e.used = c.now()
+	}()
+
+	return e.f.Get()
+}
+
+// hash returns the hash of the inputs of ip, hashing them only the first
+// time it's asked for since ip was last invalidated, or "" if they can't be
+// hashed.
+func (c *Caching) hash(ip string) string {
+	e := func() *hashEntry {
+		c.m.Lock()
+		defer c.m.Unlock()
+		e, ok := c.hashes[ip]
+		if !ok {
+			e = &hashEntry{}
+			c.hashes[ip] = e
+		}
+		return e
 	}()
+	e.once.Do(func() {
+		e.hash, e.err = c.inputHash(ip)
+		if e.err != nil {
+			// Leave it to the build to report what's wrong with ip.
+			log.Printf("Not hashing the inputs of %s: %v", ip, e.err)
+		}
+	})
+	return e.hash
+}
 
-	return f.Get()
+// evict removes the results that have outlived the TTL, and then the least
+// recently used results until there are at most maxEntries.  Results that a
+// Build call is waiting on are never evicted.  c.m must be held.
+func (c *Caching) evict() {
+	if c.ttl > 0 {
+		cutoff := c.now().Add(-c.ttl)
+		for key, e := range c.results {
+			if e.waiters == 0 && e.used.Before(cutoff) {
+				delete(c.results, key)
+			}
+		}
+	}
+	if c.maxEntries == 0 {
+		return
+	}
+	for len(c.results) > c.maxEntries {
+		var lru cacheKey
+		var oldest *cacheEntry
+		for key, e := range c.results {
+			if e.waiters == 0 && (oldest == nil || e.used.Before(oldest.used)) {
+				lru, oldest = key, e
+			}
+		}
+		if oldest == nil {
+			// Everything left is in use.
+			return
+		}
+		delete(c.results, lru)
+	}
 }
 
 // IsSupportedReference implements Interface
@@ -70,10 +241,17 @@ func (c *Caching) IsSupportedReference(ip string) bool {
 	return c.inner.IsSupportedReference(ip)
 }
 
-// Invalidate removes an import path's cached results.
+// Invalidate removes an import path's cached results, and the hash of its
+// inputs.
 func (c *Caching) Invalidate(ip string) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	delete(c.results, ip)
+	delete(c.hashes, ip)
+
+	for key := range c.results {
+		if key.ip == ip {
+			delete(c.results, key)
+		}
+	}
 }
@@ -15,9 +15,12 @@
 package build
 
 import (
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 )
@@ -92,3 +95,184 @@ func TestCaching(t *testing.T) {
 		cb.Invalidate(ip)
 	}
 }
+
+func TestCachingEviction(t *testing.T) {
+	tests := []struct {
+		desc string
+		opts []CachingOption
+		// builds are performed a second apart.
+		builds []string
+		// then the clock advances by this much before evicting.
+		advance time.Duration
+		want    []string
+	}{{
+		desc:   "unbounded",
+		builds: []string{"a", "b", "c", "d"},
+		want:   []string{"a", "b", "c", "d"},
+	}, {
+		desc:   "max entries",
+		opts:   []CachingOption{WithMaxEntries(2)},
+		builds: []string{"a", "b", "c", "d"},
+		want:   []string{"c", "d"},
+	}, {
+		desc:   "max entries keeps recently used",
+		opts:   []CachingOption{WithMaxEntries(2)},
+		builds: []string{"a", "b", "a", "c"},
+		want:   []string{"a", "c"},
+	}, {
+		desc:    "ttl",
+		opts:    []CachingOption{WithTTL(3 * time.Second)},
+		builds:  []string{"a", "b", "c", "d"},
+		advance: 2 * time.Second,
+		want:    []string{"c", "d"},
+	}, {
+		desc:    "ttl not exceeded",
+		opts:    []CachingOption{WithTTL(time.Minute)},
+		builds:  []string{"a", "b", "c", "d"},
+		advance: 2 * time.Second,
+		want:    []string{"a", "b", "c", "d"},
+	}, {
+		desc:    "max entries and ttl",
+		opts:    []CachingOption{WithMaxEntries(3), WithTTL(3 * time.Second)},
+		builds:  []string{"a", "b", "c", "d"},
+		advance: 2 * time.Second,
+		want:    []string{"c", "d"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			cb, err := NewCaching(&slowbuild{}, test.opts...)
+			if err != nil {
+				t.Fatalf("NewCaching() = %v", err)
+			}
+			now := time.Unix(0, 0)
+			cb.now = func() time.Time { return now }
+
+			digests := make(map[string]string)
+			for _, ip := range test.builds {
+				now = now.Add(time.Second)
+				img, err := cb.Build(ip)
+				if err != nil {
+					t.Fatalf("Build(%q) = %v", ip, err)
+				}
+				if d, ok := digests[ip]; ok && d != digest(t, img) {
+					t.Errorf("Build(%q) was rebuilt, wanted the cached result", ip)
+				}
+				digests[ip] = digest(t, img)
+			}
+			now = now.Add(test.advance)
+			cb.m.Lock()
+			cb.evict()
+			got := make([]string, 0, len(cb.results))
+			for key := range cb.results {
+				got = append(got, key.ip)
+			}
+			cb.m.Unlock()
+
+			sort.Strings(got)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("cached results; (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestCachingKeepsWaitedOnResults(t *testing.T) {
+	cb, err := NewCaching(&slowbuild{100 * time.Millisecond}, WithMaxEntries(1))
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+
+	// Both builds are in flight at once, so neither may be evicted until
+	// they complete, even though only one result may be cached.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cb.Build("a"); err != nil {
+			t.Errorf("Build(a) = %v", err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := cb.Build("b"); err != nil {
+		t.Errorf("Build(b) = %v", err)
+	}
+	<-done
+
+	cb.m.Lock()
+	defer cb.m.Unlock()
+	if len(cb.results) != 2 {
+		t.Errorf("got %d cached results, want both in-flight builds kept", len(cb.results))
+	}
+	cb.evict()
+	if len(cb.results) != 1 {
+		t.Errorf("got %d cached results after they completed, want 1", len(cb.results))
+	}
+}
+
+func TestCachingInputHash(t *testing.T) {
+	hashes := map[string]string{"a": "1", "b": "1"}
+	calls := map[string]int{}
+	var m sync.Mutex
+	cb, err := NewCaching(&slowbuild{}, WithInputHash(func(ip string) (string, error) {
+		m.Lock()
+		defer m.Unlock()
+		calls[ip]++
+		return hashes[ip], nil
+	}))
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	buildDigest := func(ip string) string {
+		img, err := cb.Build(ip)
+		if err != nil {
+			t.Fatalf("Build(%q) = %v", ip, err)
+		}
+		return digest(t, img)
+	}
+
+	a, b := buildDigest("a"), buildDigest("b")
+	if got := buildDigest("a"); got != a {
+		t.Errorf("Build(a) = %v, want the cached %v", got, a)
+	}
+	// The inputs of a are hashed once however often it's built.
+	if calls["a"] != 1 {
+		t.Errorf("hashed the inputs of a %d times, want 1", calls["a"])
+	}
+
+	// A change to the inputs of a results in a new build of a only, once
+	// a is invalidated, as it is by a watch event.
+	m.Lock()
+	hashes["a"] = "2"
+	m.Unlock()
+	if got := buildDigest("a"); got != a {
+		t.Errorf("Build(a) = %v before it was invalidated, want the cached %v", got, a)
+	}
+	cb.Invalidate("a")
+	cb.m.Lock()
+	for key := range cb.results {
+		if key.ip == "a" {
+			t.Errorf("cached result for %v after Invalidate(a)", key)
+		}
+	}
+	cb.m.Unlock()
+	if got := buildDigest("a"); got == a {
+		t.Errorf("Build(a) = %v after its inputs changed, want a new build", got)
+	}
+	if calls["a"] != 2 {
+		t.Errorf("hashed the inputs of a %d times, want 2", calls["a"])
+	}
+	if got := buildDigest("b"); got != b {
+		t.Errorf("Build(b) = %v, want the cached %v", got, b)
+	}
+	if calls["b"] != 1 {
+		t.Errorf("hashed the inputs of b %d times, want 1", calls["b"])
+	}
+}
+
+func TestCachingOptionErrors(t *testing.T) {
+	for _, opt := range []CachingOption{WithMaxEntries(-1), WithTTL(-time.Second)} {
+		if _, err := NewCaching(&slowbuild{}, opt); err == nil {
+			t.Error("NewCaching() = nil, want error")
+		}
+	}
+}
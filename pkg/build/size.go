@@ -0,0 +1,52 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// imageSize returns the sum of the compressed sizes of img's layers, which is
+// roughly what pulling it transfers.
+func imageSize(img v1.Image) (int64, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, l := range layers {
+		size, err := l.Size()
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// checkImageSize checks that the image built from importpath is no larger
+// than max bytes.
+func checkImageSize(importpath string, img v1.Image, max int64) error {
+	size, err := imageSize(img)
+	if err != nil {
+		return err
+	}
+	if size > max {
+		return fmt.Errorf("the image for %s is %d bytes compressed, over the limit of %d bytes", importpath, size, max)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"debug/elf"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// elfMachines maps the architectures of platforms to the machine that their
+// ELF binaries are built for.
+var elfMachines = map[string]elf.Machine{
+	"386":      elf.EM_386,
+	"amd64":    elf.EM_X86_64,
+	"arm":      elf.EM_ARM,
+	"arm64":    elf.EM_AARCH64,
+	"mips":     elf.EM_MIPS,
+	"mipsle":   elf.EM_MIPS,
+	"mips64":   elf.EM_MIPS,
+	"mips64le": elf.EM_MIPS,
+	"ppc64":    elf.EM_PPC64,
+	"ppc64le":  elf.EM_PPC64,
+	"riscv64":  elf.EM_RISCV,
+	"s390x":    elf.EM_S390,
+}
+
+// validateBinary checks that the binary built from importpath at path can
+// run on platform, by comparing the machine in its ELF header with the
+// platform's architecture.  Platforms whose binaries aren't ELF, or whose
+// architectures we don't know, aren't checked.
+func validateBinary(importpath, path string, platform v1.Platform) error {
+	if platform.OS == "windows" || platform.OS == "darwin" {
+		return nil
+	}
+	want, ok := elfMachines[platform.Architecture]
+	if !ok {
+		return nil
+	}
+
+	f, err := elf.Open(path)
+	if err != nil {
+		return fmt.Errorf("the binary built from %s is not a valid ELF binary for %s/%s: %v", importpath, platform.OS, platform.Architecture, err)
+	}
+	defer f.Close()
+
+	if f.Machine != want {
+		return fmt.Errorf("the binary built from %s is for %v, which can't run on %s/%s; check the base image and target platform", importpath, f.Machine, platform.OS, platform.Architecture)
+	}
+	return nil
+}
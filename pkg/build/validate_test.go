@@ -0,0 +1,168 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// writeELF writes a minimal ELF executable header for machine to a
+// temporary file, standing in for the output of "go build".
+func writeELF(machine elf.Machine) (string, error) {
+	return writeELFWithInterp(machine, "")
+}
+
+// writeELFWithInterp is like writeELF, but when interp isn't "" the binary
+// names it as its dynamic loader, as dynamically linked binaries do.
+func writeELFWithInterp(machine elf.Machine, interp string) (string, error) {
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Phentsize: uint16(binary.Size(elf.Prog64{})),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var progs []elf.Prog64
+	if interp != "" {
+		hdr.Phoff = uint64(hdr.Ehsize)
+		hdr.Phnum = 1
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_INTERP),
+			Flags:  uint32(elf.PF_R),
+			Off:    uint64(hdr.Ehsize) + uint64(hdr.Phentsize),
+			Filesz: uint64(len(interp) + 1),
+			Memsz:  uint64(len(interp) + 1),
+			Align:  1,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		return "", err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, progs); err != nil {
+		return "", err
+	}
+	if interp != "" {
+		buf.WriteString(interp + "\x00")
+	}
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(tmpDir, "out")
+	return file, ioutil.WriteFile(file, buf.Bytes(), 0755)
+}
+
+func TestValidateBinary(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		machine  elf.Machine
+		platform v1.Platform
+		wantErr  bool
+	}{{
+		desc:     "matching architecture",
+		machine:  elf.EM_X86_64,
+		platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+	}, {
+		desc:     "matching arm64",
+		machine:  elf.EM_AARCH64,
+		platform: v1.Platform{OS: "linux", Architecture: "arm64"},
+	}, {
+		desc:     "mismatched architecture",
+		machine:  elf.EM_AARCH64,
+		platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+		wantErr:  true,
+	}, {
+		desc:     "unknown architecture",
+		machine:  elf.EM_X86_64,
+		platform: v1.Platform{OS: "linux", Architecture: "wasm"},
+	}, {
+		desc:     "windows binaries are not checked",
+		machine:  elf.EM_X86_64,
+		platform: v1.Platform{OS: "windows", Architecture: "arm64"},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			file, err := writeELF(test.machine)
+			if err != nil {
+				t.Fatalf("writeELF() = %v", err)
+			}
+			defer os.RemoveAll(filepath.Dir(file))
+
+			if err := validateBinary("github.com/google/ko", file, test.platform); (err != nil) != test.wantErr {
+				t.Errorf("validateBinary(%v, %v) = %v, wantErr %v", test.machine, test.platform, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGoBuildBinaryValidation(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko")
+
+	for _, test := range []struct {
+		desc    string
+		builder builder
+		wantErr bool
+	}{{
+		desc: "matching binary",
+		builder: func(string, v1.Platform, buildConfig) (string, error) {
+			return writeELF(elf.EM_S390)
+		},
+	}, {
+		desc: "mismatched binary",
+		builder: func(string, v1.Platform, buildConfig) (string, error) {
+			return writeELF(elf.EM_X86_64)
+		},
+		wantErr: true,
+	}, {
+		desc:    "not a binary",
+		builder: writeTempFile,
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			ng, err := NewGo(
+				WithBinaryValidation(),
+				WithPlatform(v1.Platform{OS: "linux", Architecture: "s390x"}),
+				WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+				withBuilder(test.builder),
+			)
+			if err != nil {
+				t.Fatalf("NewGo() = %v", err)
+			}
+
+			if _, err := ng.Build(importpath); (err != nil) != test.wantErr {
+				t.Errorf("Build() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"path"
+	"strings"
+)
+
+// userOwnerAndGroupSID is the security descriptor, with BUILTIN\Users as both
+// owner and group (O:BUG:BU), that files in a Windows layer need to be
+// executable in the container.
+const userOwnerAndGroupSID = "AQAAgBQAAAAkAAAAAAAAAAAAAAABAgAAAAAABSAAAAAhAgAAAQIAAAAAAAUgAAAAIQIAAA=="
+
+// isWindows reports whether images for goos are Windows images, whose layers
+// and paths are laid out differently.
+func isWindows(goos string) bool {
+	return goos == "windows"
+}
+
+// windowsPath returns the path that a container sees the absolute image path
+// p at, e.g. C:\ko-app\foo.exe for /ko-app/foo.exe.
+func windowsPath(p string) string {
+	return "C:" + strings.Replace(p, "/", `\`, -1)
+}
+
+// windowsLayerPath returns the name of the absolute image path p within a
+// Windows layer, which keeps the container's filesystem under Files/.
+func windowsLayerPath(p string) string {
+	return path.Join("Files", p)
+}
+
+// tarAddWindowsHives writes the Hives/ directory that Windows layers must
+// have alongside Files/, even when they don't change the registry.
+func tarAddWindowsHives(tw *tar.Writer) error {
+	return tw.WriteHeader(&tar.Header{
+		Name:     "Hives",
+		Typeflag: tar.TypeDir,
+		Mode:     0555,
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// wrapperFilename is the name of the entrypoint wrapper within the app
+// directory.
+const wrapperFilename = "ko-entrypoint"
+
+// checkWrapperScript checks that the file at path is a script that can be
+// run as an entrypoint, which requires it to start with a #! line naming
+// its interpreter.
+func checkWrapperScript(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(line) < 2 || line[:2] != "#!" {
+		return fmt.Errorf("entrypoint wrapper %s must start with a #! line, e.g. #!/bin/sh", path)
+	}
+	return nil
+}
+
+// wrapperLayer constructs a layer holding the entrypoint wrapper for the
+// app built from importpath, returning it along with the path that the
+// wrapper is at in the image.  The base image must have a shell, for the
+// wrapper to be run with.
+func (gb *gobuild) wrapperLayer(base v1.Image, importpath string, platform v1.Platform) (mutate.Addendum, string, error) {
+	if isWindows(platform.OS) {
+		return mutate.Addendum{}, "", fmt.Errorf("cannot use an entrypoint wrapper for %s, which is built for windows", importpath)
+	}
+	if _, err := findShell(base); err != nil {
+		return mutate.Addendum{}, "", fmt.Errorf("cannot use an entrypoint wrapper for %s: %v", importpath, err)
+	}
+
+	wrapperPath := path.Join(gb.appDir, wrapperFilename)
+	buf, err := tarBinary(wrapperPath, gb.entrypointWrapper, platform.OS, gb.owner)
+	if err != nil {
+		return mutate.Addendum{}, "", err
+	}
+	layerBytes := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewBuffer(layerBytes)), nil
+	})
+	if err != nil {
+		return mutate.Addendum{}, "", err
+	}
+	return mutate.Addendum{
+		Layer:   layer,
+		History: gb.history(importpath, "entrypoint wrapper, at "+wrapperPath),
+	}, wrapperPath, nil
+}
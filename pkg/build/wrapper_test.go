@@ -0,0 +1,138 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestGoBuildEntrypointWrapper(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	script := "#!/bin/sh\nenvsubst < /etc/app.tmpl > /etc/app.conf\nexec \"$@\"\n"
+	wrapper := filepath.Join(tmpDir, "wrapper.sh")
+	if err := ioutil.WriteFile(wrapper, []byte(script), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := filepath.Join("github.com/google/ko", "cmd", "ko", "test")
+
+	t.Run("with a shell", func(t *testing.T) {
+		base := withFiles(t, img, "bin/sh")
+		ng, err := NewGo(
+			WithEntrypointWrapper(wrapper),
+			WithDefaultArgs([]string{"--port=8080"}),
+			WithBaseImages(func(string) (v1.Image, error) { return base, nil }),
+			withBuilder(writeTempFile),
+		)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		built, err := ng.Build(importpath)
+		if err != nil {
+			t.Fatalf("Build() = %v", err)
+		}
+
+		// The wrapper is the entrypoint, and is passed the app to exec.
+		cfg, err := built.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() = %v", err)
+		}
+		if diff := cmp.Diff([]string{"/ko-app/ko-entrypoint", "/ko-app/test"}, cfg.Config.Entrypoint); diff != "" {
+			t.Errorf("Entrypoint; (-want +got) = %v", diff)
+		}
+		if diff := cmp.Diff([]string{"--port=8080"}, cfg.Config.Cmd); diff != "" {
+			t.Errorf("Cmd; (-want +got) = %v", diff)
+		}
+
+		// The last layer holds the wrapper, executable.
+		ls, err := built.Layers()
+		if err != nil {
+			t.Fatalf("Layers() = %v", err)
+		}
+		r, err := ls[len(ls)-1].Uncompressed()
+		if err != nil {
+			t.Fatalf("Uncompressed() = %v", err)
+		}
+		defer r.Close()
+		tr := tar.NewReader(r)
+		found := false
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			if header.Name != "/ko-app/ko-entrypoint" {
+				continue
+			}
+			found = true
+			if header.Mode&0111 == 0 {
+				t.Errorf("wrapper mode = %o, want it executable", header.Mode)
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			if got := string(b); got != script {
+				t.Errorf("wrapper = %q, want %q", got, script)
+			}
+		}
+		if !found {
+			t.Error("wrapper not found in the last layer")
+		}
+	})
+
+	t.Run("without a shell", func(t *testing.T) {
+		ng, err := NewGo(
+			WithEntrypointWrapper(wrapper),
+			WithBaseImages(func(string) (v1.Image, error) { return img, nil }),
+			withBuilder(writeTempFile),
+		)
+		if err != nil {
+			t.Fatalf("NewGo() = %v", err)
+		}
+		if _, err := ng.Build(importpath); err == nil {
+			t.Error("Build() = nil, want error for a base without a shell")
+		}
+	})
+
+	t.Run("without #!", func(t *testing.T) {
+		noShebang := filepath.Join(tmpDir, "noshebang.sh")
+		if err := ioutil.WriteFile(noShebang, []byte("exec \"$@\"\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		if _, err := NewGo(WithEntrypointWrapper(noShebang)); err == nil {
+			t.Error("NewGo(WithEntrypointWrapper()) = nil, want error for a script without #!")
+		}
+	})
+}
@@ -28,13 +28,18 @@ import (
 // addApply augments our CLI surface with apply.
 func addApply(topLevel *cobra.Command) {
 	koApplyFlags := []string{}
-	lo := &options.LocalOptions{}
+	lo := &options.LocalOptions{Push: true}
 	no := &options.NameOptions{}
-	fo := &options.FilenameOptions{}
+	fo := &options.FilenameOptions{PassThrough: true}
 	ta := &options.TagsOptions{}
 	so := &options.SelectorOptions{}
 	sto := &options.StrictOptions{}
+	ro := &options.ResolveOptions{}
 	bo := &options.BuildOptions{}
+	oo := &options.OutputOptions{}
+	ko := &options.KubectlOptions{}
+	po := &options.PreflightOptions{}
+	pr := &options.PrimingOptions{}
 	apply := &cobra.Command{
 		Use:   "apply -f FILENAME",
 		Short: "Apply the input files with image references resolved to built/pushed image digests.",
@@ -64,7 +69,10 @@ func addApply(topLevel *cobra.Command) {
   cat config.yaml | ko apply -f -`,
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			builder, err := makeBuilder(bo)
+			if !lo.Push {
+				log.Fatal("--push=false leaves the images unpublished, which ko apply can't deploy")
+			}
+			builder, err := makeBuilder(bo, lo, ta)
 			if err != nil {
 				log.Fatalf("error creating builder: %v", err)
 			}
@@ -80,17 +88,29 @@ func addApply(topLevel *cobra.Command) {
 			}
 
 			// Filter out ko flags from what we will pass through to kubectl.
-			kubectlFlags := []string{}
-			cmd.Flags().Visit(func(flag *pflag.Flag) {
-				if _, ok := ignoreSet[flag.Name]; !ok {
-					kubectlFlags = append(kubectlFlags, "--"+flag.Name, flag.Value.String())
+			kubectlFlags := passthroughFlags(cmd.Flags(), ignoreSet)
+
+			if po.Preflight {
+				if err := checkCluster(kubectlFlags); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			var prune func([]byte)
+			if fo.PruneOnDelete {
+				if !fo.Watch {
+					log.Fatal("--prune-on-delete requires --watch")
 				}
-			})
+				prune = kubectlDelete(kubectlFlags)
+			}
 
 			// Issue a "kubectl apply" command reading from stdin,
 			// to which we will pipe the resolved files.
 			argv := []string{"apply", "-f", "-"}
 			argv = append(argv, kubectlFlags...)
+			if ko.Print {
+				printKubectl(os.Stderr, argv)
+			}
 			kubectlCmd := exec.Command("kubectl", argv...)
 
 			// Pass through our environment
@@ -105,6 +125,7 @@ func addApply(topLevel *cobra.Command) {
 				log.Fatalf("error piping to 'kubectl apply': %v", err)
 			}
 
+			separators := primingSeparators(pr.Separators)
 			go func() {
 				// kubectl buffers data before starting to apply it, which
 				// can lead to resources being created more slowly than desired.
@@ -113,11 +134,11 @@ func addApply(topLevel *cobra.Command) {
 				// around this, we prime the stream with a bunch of empty objects
 				// which kubectl will discard.
 				// See https://github.com/google/go-containerregistry/pull/348
-				for i := 0; i < 1000; i++ {
-					stdin.Write([]byte("---\n"))
-				}
+				// Newer versions of kubectl don't need this, see
+				// primingSeparators.
+				prime(stdin, separators)
 				// Once primed kick things off.
-				resolveFilesToWriter(builder, publisher, fo, so, sto, stdin)
+				resolveFilesToWriter(builder, publisher, fo, so, sto, ro, oo, prune, stdin)
 			}()
 
 			// Run it.
@@ -129,10 +150,16 @@ func addApply(topLevel *cobra.Command) {
 	options.AddLocalArg(apply, lo)
 	options.AddNamingArgs(apply, no)
 	options.AddFileArg(apply, fo)
+	options.AddPruneArg(apply, fo)
 	options.AddTagsArg(apply, ta)
 	options.AddSelectorArg(apply, so)
 	options.AddStrictArg(apply, sto)
+	options.AddResolveArgs(apply, ro)
 	options.AddBuildOptions(apply, bo)
+	options.AddSummaryArg(apply, oo)
+	options.AddKubectlArgs(apply, ko)
+	options.AddPreflightArg(apply, po)
+	options.AddPrimingArg(apply, pr)
 
 	// Collect the ko-specific apply flags before registering the kubectl global
 	// flags so that we can ignore them when passing kubectl global flags through
@@ -0,0 +1,217 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// baseImageCache memoizes base images by the reference they are pulled from,
+// so that import paths sharing a base resolve its tag to a digest only once
+// per invocation.  If dir is set, the compressed layers of base images are
+// also kept there across invocations, and discarded once the reference
+// resolves to a different digest.
+type baseImageCache struct {
+	// fetch resolves a reference to the image it currently refers to.
+	fetch func(name.Reference) (v1.Image, error)
+	dir   string
+
+	m      sync.Mutex
+	images map[string]*baseImageEntry
+}
+
+type baseImageEntry struct {
+	once sync.Once
+	img  v1.Image
+	err  error
+}
+
+func newBaseImageCache(dir string, fetch func(name.Reference) (v1.Image, error)) *baseImageCache {
+	return &baseImageCache{
+		fetch:  fetch,
+		dir:    dir,
+		images: make(map[string]*baseImageEntry),
+	}
+}
+
+// Get returns the image that ref refers to, fetching it on first use.
+func (c *baseImageCache) Get(ref name.Reference) (v1.Image, error) {
+	c.m.Lock()
+	e, ok := c.images[ref.String()]
+	if !ok {
+		e = &baseImageEntry{}
+		c.images[ref.String()] = e
+	}
+	c.m.Unlock()
+
+	e.once.Do(func() {
+		e.img, e.err = c.fetch(ref)
+		if e.err != nil || c.dir == "" {
+			return
+		}
+		dir, err := c.layerDir(ref, e.img)
+		if err != nil {
+			log.Printf("Not caching layers of %s on disk: %v", ref, err)
+			return
+		}
+		e.img = &cachedImage{Image: e.img, dir: dir}
+	})
+	return e.img, e.err
+}
+
+// layerDir returns the directory to keep the layers of img, the image ref
+// currently refers to, in.  If ref referred to a different image the last
+// time we saw it, the layers we kept for that image are discarded.
+func (c *baseImageCache) layerDir(ref name.Reference, img v1.Image) (string, error) {
+	h, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(ref.String()))
+	dir := filepath.Join(c.dir, hex.EncodeToString(key[:]))
+	digestFile := filepath.Join(dir, "digest")
+
+	if b, err := ioutil.ReadFile(digestFile); err == nil && strings.TrimSpace(string(b)) != h.String() {
+		log.Printf("Base %s now refers to %s, discarding cached layers", ref, h)
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(digestFile, []byte(h.String()), 0644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// cachedImage wraps a base image so that its compressed layers are read
+// from dir when present, and written there when they are first fetched.
+type cachedImage struct {
+	v1.Image
+	dir string
+}
+
+// Layers implements v1.Image
+func (ci *cachedImage) Layers() ([]v1.Layer, error) {
+	ls, err := ci.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	cls := make([]v1.Layer, 0, len(ls))
+	for _, l := range ls {
+		cl, err := ci.wrap(l)
+		if err != nil {
+			return nil, err
+		}
+		cls = append(cls, cl)
+	}
+	return cls, nil
+}
+
+// LayerByDigest implements v1.Image
+func (ci *cachedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := ci.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return ci.wrap(l)
+}
+
+func (ci *cachedImage) wrap(l v1.Layer) (v1.Layer, error) {
+	h, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	cl := &cachedLayer{
+		Layer: l,
+		path:  filepath.Join(ci.dir, h.Algorithm+"-"+h.Hex),
+	}
+	// Keep track of where remote layers came from, so that publishing to
+	// the same registry can mount them rather than upload them again.
+	if ml, ok := l.(*remote.MountableLayer); ok {
+		return &remote.MountableLayer{Layer: cl, Reference: ml.Reference}, nil
+	}
+	return cl, nil
+}
+
+type cachedLayer struct {
+	v1.Layer
+	path string
+}
+
+// Compressed implements v1.Layer
+func (cl *cachedLayer) Compressed() (io.ReadCloser, error) {
+	if f, err := os.Open(cl.path); err == nil {
+		return f, nil
+	}
+	rc, err := cl.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cl.path), "layer")
+	if err != nil {
+		// Still serve the layer, just without caching it.
+		return rc, nil
+	}
+	return &teeToFile{rc: rc, tmp: tmp, path: cl.path}, nil
+}
+
+// teeToFile copies what is read from rc into tmp, which is moved to path
+// once rc has been read in full.  The layers of remote images verify their
+// digest as they are read, so reaching EOF means the contents are intact.
+type teeToFile struct {
+	rc   io.ReadCloser
+	tmp  *os.File
+	path string
+	done bool
+}
+
+func (t *teeToFile) Read(p []byte) (int, error) {
+	n, err := t.rc.Read(p)
+	if n > 0 {
+		if _, werr := t.tmp.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	if err == io.EOF {
+		t.done = true
+	}
+	return n, err
+}
+
+func (t *teeToFile) Close() error {
+	err := t.rc.Close()
+	if cerr := t.tmp.Close(); cerr == nil && t.done {
+		if os.Rename(t.tmp.Name(), t.path) == nil {
+			return err
+		}
+	}
+	os.Remove(t.tmp.Name())
+	return err
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestBaseImageCacheResolvesOnce(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	base, err := name.ParseReference("gcr.io/distroless/static:latest")
+	if err != nil {
+		t.Fatalf("ParseReference() = %v", err)
+	}
+
+	var calls int32
+	cache := newBaseImageCache("", func(ref name.Reference) (v1.Image, error) {
+		atomic.AddInt32(&calls, 1)
+		return img, nil
+	})
+
+	var wg sync.WaitGroup
+	for _, ip := range []string{"example.com/foo", "example.com/bar", "example.com/baz", "example.com/foo"} {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			got, err := cache.Get(base)
+			if err != nil {
+				t.Errorf("Get(%v) for %s = %v", base, ip, err)
+			} else if got != img {
+				t.Errorf("Get(%v) for %s returned a different image", base, ip)
+			}
+		}(ip)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("resolved %v %d times, want 1", base, calls)
+	}
+}
+
+func TestBaseImageCacheOnDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-base")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base, err := name.ParseReference("gcr.io/distroless/static:latest")
+	if err != nil {
+		t.Fatalf("ParseReference() = %v", err)
+	}
+	// readLayers reads the layers of the base as resolved by a new cache,
+	// as a new invocation would, where the base's tag refers to img.
+	readLayers := func(img v1.Image) [][]byte {
+		cache := newBaseImageCache(dir, func(name.Reference) (v1.Image, error) { return img, nil })
+		got, err := cache.Get(base)
+		if err != nil {
+			t.Fatalf("Get(%v) = %v", base, err)
+		}
+		ls, err := got.Layers()
+		if err != nil {
+			t.Fatalf("Layers() = %v", err)
+		}
+		var contents [][]byte
+		for _, l := range ls {
+			rc, err := l.Compressed()
+			if err != nil {
+				t.Fatalf("Compressed() = %v", err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+			rc.Close()
+			contents = append(contents, b)
+		}
+		return contents
+	}
+	cachedLayers := func() []string {
+		matches, err := filepath.Glob(filepath.Join(dir, "*", "sha256-*"))
+		if err != nil {
+			t.Fatalf("Glob() = %v", err)
+		}
+		return matches
+	}
+
+	first, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	want := readLayers(first)
+	if got := cachedLayers(); len(got) != 2 {
+		t.Fatalf("cached layers = %v, want 2", got)
+	}
+	// The second time around the layers are read from disk.
+	got := readLayers(first)
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("layer %d from disk differs from the original", i)
+		}
+	}
+
+	// Once the tag refers to another image, its layers replace the old ones.
+	second, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	readLayers(second)
+	if got := cachedLayers(); len(got) != 1 {
+		t.Errorf("cached layers = %v, want 1", got)
+	}
+}
+
+// mountableImage yields its layers as mountable from ref, as remote.Image
+// does.
+type mountableImage struct {
+	v1.Image
+	ref name.Reference
+}
+
+func (mi *mountableImage) Layers() ([]v1.Layer, error) {
+	ls, err := mi.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	mls := make([]v1.Layer, 0, len(ls))
+	for _, l := range ls {
+		mls = append(mls, &remote.MountableLayer{Layer: l, Reference: mi.ref})
+	}
+	return mls, nil
+}
+
+func TestBaseImageCacheKeepsLayersMountable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-base")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base, err := name.ParseReference("gcr.io/distroless/static:latest")
+	if err != nil {
+		t.Fatalf("ParseReference() = %v", err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	cache := newBaseImageCache(dir, func(ref name.Reference) (v1.Image, error) {
+		return &mountableImage{Image: img, ref: ref}, nil
+	})
+	got, err := cache.Get(base)
+	if err != nil {
+		t.Fatalf("Get(%v) = %v", base, err)
+	}
+	ls, err := got.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	for i, l := range ls {
+		ml, ok := l.(*remote.MountableLayer)
+		if !ok {
+			t.Errorf("layer %d is a %T, want *remote.MountableLayer", i, l)
+			continue
+		}
+		if ml.Reference != base {
+			t.Errorf("layer %d is mountable from %v, want %v", i, ml.Reference, base)
+		}
+		if _, ok := ml.Layer.(*cachedLayer); !ok {
+			t.Errorf("layer %d wraps a %T, want *cachedLayer", i, ml.Layer)
+		}
+	}
+}
+
+func TestBaseCacheDir(t *testing.T) {
+	tests := []struct {
+		desc     string
+		cacheDir string
+		platform *v1.Platform
+		want     string
+	}{{
+		desc:     "disk cache off",
+		cacheDir: "",
+		platform: &v1.Platform{OS: "linux", Architecture: "amd64"},
+		want:     "",
+	}, {
+		desc:     "default platform",
+		cacheDir: "/cache/ko",
+		want:     filepath.Join("/cache/ko", "base", "default"),
+	}, {
+		desc:     "platform",
+		cacheDir: "/cache/ko",
+		platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		want:     filepath.Join("/cache/ko", "base", "linux-arm-v7"),
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := baseCacheDir(test.cacheDir, test.platform); got != test.want {
+				t.Errorf("baseCacheDir(%q, %v) = %q, want %q", test.cacheDir, test.platform, got, test.want)
+			}
+		})
+	}
+}
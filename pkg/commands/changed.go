@@ -0,0 +1,165 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// changeDetector determines whether the inputs to building an import path
+// have changed since a particular git ref.
+type changeDetector struct {
+	ref string
+
+	// diff returns the absolute paths of files that differ from the ref,
+	// including untracked files.
+	diff func(ref string) ([]string, error)
+	// deps returns the directories of the packages that importpath depends
+	// upon, with the directory of importpath itself last.
+	deps func(importpath string) ([]string, error)
+
+	// once diffs against the ref once, for all of the import paths we're
+	// asked about.
+	once    sync.Once
+	changed []string
+	err     error
+}
+
+func newChangeDetector(ref string) *changeDetector {
+	return &changeDetector{
+		ref:  ref,
+		diff: gitDiff,
+		deps: goListDeps,
+	}
+}
+
+// Changed reports whether any of the files that importpath is built from may
+// have changed since the ref.  This errs on the side of reporting changes:
+// any change to a file within a dependency's directory, within the kodata
+// directory of importpath, or to a go.mod or go.sum counts.
+func (cd *changeDetector) Changed(importpath string) (bool, error) {
+	cd.once.Do(func() {
+		cd.changed, cd.err = cd.diff(cd.ref)
+	})
+	changed, err := cd.changed, cd.err
+	if err != nil {
+		return false, err
+	}
+	dirs, err := cd.deps(importpath)
+	if err != nil {
+		return false, err
+	}
+	if len(dirs) == 0 {
+		return false, errors.New("no packages found for " + importpath)
+	}
+
+	depDirs := make(map[string]struct{}, len(dirs))
+	for _, dir := range dirs {
+		depDirs[dir] = struct{}{}
+	}
+	kodata := filepath.Join(dirs[len(dirs)-1], "kodata") + string(filepath.Separator)
+
+	for _, f := range changed {
+		switch filepath.Base(f) {
+		case "go.mod", "go.sum":
+			return true, nil
+		}
+		if _, ok := depDirs[filepath.Dir(f)]; ok {
+			return true, nil
+		}
+		if strings.HasPrefix(f, kodata) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// gitDiff returns the absolute paths of the files in the current git
+// repository that differ from ref, or that are untracked.
+func gitDiff(ref string) ([]string, error) {
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSpace(string(top))
+
+	var files []string
+	for _, args := range [][]string{
+		{"diff", "--name-only", ref},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Split(string(output), "\n") {
+			if f != "" {
+				files = append(files, filepath.Join(root, filepath.FromSlash(f)))
+			}
+		}
+	}
+	return files, nil
+}
+
+// goListDeps returns the directories of the non-standard packages that
+// importpath depends upon, ending with importpath itself.
+func goListDeps(importpath string) ([]string, error) {
+	output, err := exec.Command("go", "list", "-deps", "-f", "{{if not .Standard}}{{.Dir}}{{end}}", importpath).Output()
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, dir := range strings.Split(string(output), "\n") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// reuseUnchanged returns a function that reports the previously published
+// image for an import path, as recorded in the digests file, so long as it
+// hasn't changed since ref.
+func reuseUnchanged(ref, digestsFile string) (func(string) (string, bool), error) {
+	digests, err := readDigests(digestsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cd := newChangeDetector(ref)
+	return func(importpath string) (string, bool) {
+		digest, ok := digests[importpath]
+		if !ok {
+			return "", false
+		}
+		changed, err := cd.Changed(importpath)
+		if err != nil {
+			log.Printf("Unable to determine whether %s changed since %s, rebuilding: %v", importpath, ref, err)
+			return "", false
+		}
+		if changed {
+			return "", false
+		}
+		log.Printf("Reusing %s for %s, unchanged since %s", digest, importpath, ref)
+		return digest, true
+	}, nil
+}
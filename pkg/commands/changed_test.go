@@ -0,0 +1,130 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangeDetector(t *testing.T) {
+	root := filepath.FromSlash("/src/repo")
+	path := func(s string) string {
+		return filepath.Join(root, filepath.FromSlash(s))
+	}
+	deps := map[string][]string{
+		"example.com/repo/cmd/foo": {path("pkg/lib"), path("pkg/foo"), path("cmd/foo")},
+		"example.com/repo/cmd/bar": {path("pkg/lib"), path("cmd/bar")},
+	}
+
+	tests := []struct {
+		desc    string
+		diff    []string
+		changed map[string]bool
+	}{{
+		desc:    "nothing changed",
+		changed: map[string]bool{"example.com/repo/cmd/foo": false, "example.com/repo/cmd/bar": false},
+	}, {
+		desc:    "main package changed",
+		diff:    []string{path("cmd/foo/main.go")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": true, "example.com/repo/cmd/bar": false},
+	}, {
+		desc:    "dependency changed",
+		diff:    []string{path("pkg/foo/foo.go")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": true, "example.com/repo/cmd/bar": false},
+	}, {
+		desc:    "shared dependency changed",
+		diff:    []string{path("pkg/lib/lib.go")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": true, "example.com/repo/cmd/bar": true},
+	}, {
+		desc:    "subdirectory of dependency changed",
+		diff:    []string{path("pkg/lib/internal/x.go")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": false, "example.com/repo/cmd/bar": false},
+	}, {
+		desc:    "kodata changed",
+		diff:    []string{path("cmd/bar/kodata/static/index.html")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": false, "example.com/repo/cmd/bar": true},
+	}, {
+		desc:    "module requirements changed",
+		diff:    []string{path("go.sum")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": true, "example.com/repo/cmd/bar": true},
+	}, {
+		desc:    "unrelated files changed",
+		diff:    []string{path("README.md"), path("config/foo.yaml")},
+		changed: map[string]bool{"example.com/repo/cmd/foo": false, "example.com/repo/cmd/bar": false},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			diffs := 0
+			cd := &changeDetector{
+				ref: "HEAD~1",
+				diff: func(ref string) ([]string, error) {
+					diffs++
+					if ref != "HEAD~1" {
+						t.Errorf("diff(%q), want diff(%q)", ref, "HEAD~1")
+					}
+					return test.diff, nil
+				},
+				deps: func(ip string) ([]string, error) {
+					return deps[ip], nil
+				},
+			}
+			for ip, want := range test.changed {
+				if got, err := cd.Changed(ip); err != nil {
+					t.Errorf("Changed(%q) = %v", ip, err)
+				} else if got != want {
+					t.Errorf("Changed(%q) = %v, want %v", ip, got, want)
+				}
+			}
+			// One diff serves all of the import paths.
+			if diffs != 1 {
+				t.Errorf("diffed against the ref %d times, want 1", diffs)
+			}
+		})
+	}
+}
+
+func TestChangeDetectorErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		cd   *changeDetector
+	}{{
+		desc: "diff fails",
+		cd: &changeDetector{
+			diff: func(string) ([]string, error) { return nil, errors.New("bad ref") },
+			deps: func(string) ([]string, error) { return []string{"/src"}, nil },
+		},
+	}, {
+		desc: "deps fails",
+		cd: &changeDetector{
+			diff: func(string) ([]string, error) { return nil, nil },
+			deps: func(string) ([]string, error) { return nil, errors.New("no such package") },
+		},
+	}, {
+		desc: "no packages",
+		cd: &changeDetector{
+			diff: func(string) ([]string, error) { return nil, nil },
+			deps: func(string) ([]string, error) { return nil, nil },
+		},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got, err := test.cd.Changed("example.com/repo/cmd/foo"); err == nil {
+				t.Errorf("Changed() = %v, want error", got)
+			}
+		})
+	}
+}
@@ -26,8 +26,10 @@ func AddKubeCommands(topLevel *cobra.Command) {
 	addVersion(topLevel)
 	addCreate(topLevel)
 	addApply(topLevel)
+	addDiff(topLevel)
 	addResolve(topLevel)
 	addPublish(topLevel)
+	addWarm(topLevel)
 	addRun(topLevel)
 	addCompletion(topLevel)
 }
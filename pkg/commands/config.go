@@ -15,31 +15,186 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/google/ko/pkg/publish"
 	"github.com/spf13/viper"
 )
 
+// fallbackBaseImage is the base image to use when none is configured.
+const fallbackBaseImage = "gcr.io/distroless/static:latest"
+
 var (
 	defaultBaseImage   name.Reference
 	baseImageOverrides map[string]name.Reference
+	// dockerRepo is the repository to publish to when KO_DOCKER_REPO is unset.
+	dockerRepo string
+	// bundledBinaries maps import paths to those whose binaries are built
+	// into the same image.
+	bundledBinaries map[string][]string
+	// entrypoints maps import paths to that of the bundled binary that their
+	// images run instead of their own.
+	entrypoints map[string]string
+	// namingRules name the import paths they match, instead of the naming
+	// flags.
+	namingRules []options.NamingRule
 )
 
-func getBaseImage(s string) (v1.Image, error) {
-	ref, ok := baseImageOverrides[s]
-	if !ok {
-		ref = defaultBaseImage
+// namingRuleConfig is how each of the 'namingRules' is configured, e.g.
+//
+//	namingRules:
+//	- match: ^github.com/org/(.*)$
+//	  replace: myrepo/$1
+type namingRuleConfig struct {
+	Match   string `mapstructure:"match"`
+	Replace string `mapstructure:"replace"`
+}
+
+// parseNamingRules parses the configured 'namingRules', in order.
+func parseNamingRules(configs []namingRuleConfig) ([]options.NamingRule, error) {
+	rules := make([]options.NamingRule, 0, len(configs))
+	for _, c := range configs {
+		rule, err := options.NewNamingRule(c.Match, c.Replace)
+		if err != nil {
+			return nil, fmt.Errorf("'namingRules': %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func getBaseImage(platform *v1.Platform, insecureRegistry string, keys authn.Keychain, cacheDir string) build.GetBase {
+	opts := []remote.Option{remote.WithAuthFromKeychain(keys)}
+	if platform != nil {
+		// Select the matching image when the base is an index.
+		opts = append(opts, remote.WithPlatform(*platform))
+	}
+	cache := newBaseImageCache(baseCacheDir(cacheDir, platform), func(ref name.Reference) (v1.Image, error) {
+		return remote.Image(ref, opts...)
+	})
+	return func(s string) (v1.Image, error) {
+		ref, err := insecureRef(baseImageRef(s), insecureRegistry)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using base %s for %s", ref, s)
+		return cache.Get(ref)
+	}
+}
+
+// getPlatformBaseImage is like getBaseImage, but for building import paths
+// for the platforms that references to them select.
+func getPlatformBaseImage(insecureRegistry string, keys authn.Keychain, cacheDir string) build.GetPlatformBase {
+	var m sync.Mutex
+	bases := make(map[string]build.GetBase)
+	return func(s string, platform v1.Platform) (v1.Image, error) {
+		key := strings.Join([]string{platform.OS, platform.Architecture, platform.Variant}, "-")
+		getBase := func() build.GetBase {
+			m.Lock()
+			defer m.Unlock()
+			if _, ok := bases[key]; !ok {
+				bases[key] = getBaseImage(&platform, insecureRegistry, keys, cacheDir)
+			}
+			return bases[key]
+		}()
+		return getBase(s)
+	}
+}
+
+// insecureRef returns ref, marked to be pulled over plain http if it is on
+// insecureRegistry.
+func insecureRef(ref name.Reference, insecureRegistry string) (name.Reference, error) {
+	if insecureRegistry == "" || ref.Context().RegistryStr() != insecureRegistry {
+		return ref, nil
+	}
+	return name.ParseReference(ref.String(), name.Insecure)
+}
+
+// baseImageRef returns the base image configured for the import path s.
+func baseImageRef(s string) name.Reference {
+	if ref, ok := baseImageOverrides[s]; ok {
+		return ref
+	}
+	return defaultBaseImage
+}
+
+// diskCacheDir returns the directory to keep what we cache on disk in, or ""
+// if there is no user cache directory.
+func diskCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
 	}
-	log.Printf("Using base %s for %s", ref, s)
-	return remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	return filepath.Join(dir, "ko")
+}
+
+// baseCacheDir returns the directory within cacheDir to keep the layers of
+// base images for platform in, or "" if cacheDir is.  A tag can refer to a
+// different image on each platform, so each gets its own directory.
+func baseCacheDir(cacheDir string, platform *v1.Platform) string {
+	if cacheDir == "" {
+		return ""
+	}
+	p := "default"
+	if platform != nil {
+		p = strings.Join([]string{platform.OS, platform.Architecture, platform.Variant}, "-")
+	}
+	return filepath.Join(cacheDir, "base", p)
+}
+
+// getDockerRepo returns the repository to publish images to, which is read
+// from KO_DOCKER_REPO or, when that is unset, from dockerRepo in .ko.yaml.
+func getDockerRepo() (string, error) {
+	repoName, source := os.Getenv("KO_DOCKER_REPO"), "environment variable KO_DOCKER_REPO"
+	if repoName == "" {
+		repoName, source = dockerRepo, "'dockerRepo'"
+	}
+	if repoName == "" {
+		return "", errors.New("KO_DOCKER_REPO environment variable is unset and 'dockerRepo' is not configured")
+	}
+	if repoName == publish.LocalDomain {
+		return repoName, nil
+	}
+	if _, err := name.NewRegistry(repoName); err != nil {
+		if _, err := name.NewRepository(repoName); err != nil {
+			return "", fmt.Errorf("failed to parse %s=%q as repository: %v", source, repoName, err)
+		}
+	}
+	return repoName, nil
+}
+
+// isLocalDockerRepo reports whether images are configured to be published
+// to the local docker daemon.
+func isLocalDockerRepo() bool {
+	repoName, err := getDockerRepo()
+	return err == nil && repoName == publish.LocalDomain
+}
+
+// parseDefaultBaseImage parses the configured 'defaultBaseImage', falling
+// back on fallbackBaseImage when it is unset.
+func parseDefaultBaseImage(ref string) (name.Reference, error) {
+	if ref == "" {
+		ref = fallbackBaseImage
+	}
+	dbi, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("'defaultBaseImage': error parsing %q as image reference: %v", ref, err)
+	}
+	return dbi, nil
 }
 
 func getCreationTime() (*v1.Time, error) {
@@ -56,8 +211,6 @@ func getCreationTime() (*v1.Time, error) {
 }
 
 func init() {
-	// If omitted, use this base image.
-	viper.SetDefault("defaultBaseImage", "gcr.io/distroless/static:latest")
 	viper.SetConfigName(".ko") // .yaml is implicit
 
 	if override := os.Getenv("KO_CONFIG_PATH"); override != "" {
@@ -72,13 +225,24 @@ func init() {
 		}
 	}
 
-	ref := viper.GetString("defaultBaseImage")
-	dbi, err := name.ParseReference(ref)
+	dbi, err := parseDefaultBaseImage(viper.GetString("defaultBaseImage"))
 	if err != nil {
-		log.Fatalf("'defaultBaseImage': error parsing %q as image reference: %v", ref, err)
+		log.Fatal(err)
 	}
 	defaultBaseImage = dbi
 
+	dockerRepo = viper.GetString("dockerRepo")
+	bundledBinaries = viper.GetStringMapStringSlice("bundledBinaries")
+	entrypoints = viper.GetStringMapString("entrypoints")
+
+	var configs []namingRuleConfig
+	if err := viper.UnmarshalKey("namingRules", &configs); err != nil {
+		log.Fatalf("'namingRules': %v", err)
+	}
+	if namingRules, err = parseNamingRules(configs); err != nil {
+		log.Fatal(err)
+	}
+
 	baseImageOverrides = make(map[string]name.Reference)
 	overrides := viper.GetStringMapString("baseImageOverrides")
 	for k, v := range overrides {
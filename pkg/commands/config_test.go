@@ -0,0 +1,206 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestGetDockerRepo(t *testing.T) {
+	tests := []struct {
+		desc    string
+		env     string
+		config  string
+		want    string
+		wantErr bool
+	}{{
+		desc:    "neither set",
+		wantErr: true,
+	}, {
+		desc: "env set",
+		env:  "gcr.io/from-env",
+		want: "gcr.io/from-env",
+	}, {
+		desc:   "config set",
+		config: "gcr.io/from-config",
+		want:   "gcr.io/from-config",
+	}, {
+		desc:   "env takes precedence",
+		env:    "gcr.io/from-env",
+		config: "gcr.io/from-config",
+		want:   "gcr.io/from-env",
+	}, {
+		desc:   "local daemon",
+		config: "ko.local",
+		want:   "ko.local",
+	}, {
+		desc:   "registry with port",
+		config: "localhost:5000",
+		want:   "localhost:5000",
+	}, {
+		desc:    "invalid env",
+		env:     "gcr.io/UPPER",
+		config:  "gcr.io/from-config",
+		wantErr: true,
+	}, {
+		desc:    "invalid config",
+		config:  "gcr.io/UPPER",
+		wantErr: true,
+	}}
+
+	env, ok := os.LookupEnv("KO_DOCKER_REPO")
+	config := dockerRepo
+	defer func() {
+		if ok {
+			os.Setenv("KO_DOCKER_REPO", env)
+		} else {
+			os.Unsetenv("KO_DOCKER_REPO")
+		}
+		dockerRepo = config
+	}()
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			os.Setenv("KO_DOCKER_REPO", test.env)
+			dockerRepo = test.config
+
+			got, err := getDockerRepo()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("getDockerRepo() = %v, wantErr %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("getDockerRepo() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDefaultBaseImage(t *testing.T) {
+	tests := []struct {
+		desc    string
+		config  string
+		want    string
+		wantErr bool
+	}{{
+		desc: "unset",
+		want: fallbackBaseImage,
+	}, {
+		desc:   "configured",
+		config: "gcr.io/foo/base@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		want:   "gcr.io/foo/base@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+	}, {
+		desc:    "invalid",
+		config:  "gcr.io/UPPER",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := parseDefaultBaseImage(test.config)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseDefaultBaseImage() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.String() != test.want {
+				t.Errorf("parseDefaultBaseImage() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBaseImageRefFallback(t *testing.T) {
+	dbi, overrides := defaultBaseImage, baseImageOverrides
+	defer func() {
+		defaultBaseImage, baseImageOverrides = dbi, overrides
+	}()
+
+	var err error
+	defaultBaseImage, err = parseDefaultBaseImage("")
+	if err != nil {
+		t.Fatalf("parseDefaultBaseImage() = %v", err)
+	}
+	baseImageOverrides = map[string]name.Reference{}
+	if got := baseImageRef("github.com/foo/bar").String(); got != fallbackBaseImage {
+		t.Errorf("baseImageRef() = %v, want %v", got, fallbackBaseImage)
+	}
+}
+
+func TestInsecureRef(t *testing.T) {
+	tests := []struct {
+		desc     string
+		ref      string
+		registry string
+		want     string
+	}{{
+		desc:     "matching registry",
+		ref:      "registry.internal:5000/base:latest",
+		registry: "registry.internal:5000",
+		want:     "http",
+	}, {
+		desc:     "other registry",
+		ref:      "gcr.io/distroless/static:latest",
+		registry: "registry.internal:5000",
+		want:     "https",
+	}, {
+		desc: "no insecure registry",
+		ref:  "registry.internal:5000/base:latest",
+		want: "https",
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			ref, err := name.ParseReference(test.ref)
+			if err != nil {
+				t.Fatalf("ParseReference() = %v", err)
+			}
+			got, err := insecureRef(ref, test.registry)
+			if err != nil {
+				t.Fatalf("insecureRef() = %v", err)
+			}
+			if got.String() != test.ref {
+				t.Errorf("insecureRef() = %v, want %v", got, test.ref)
+			}
+			if scheme := got.Context().Registry.Scheme(); scheme != test.want {
+				t.Errorf("Scheme() = %v, want %v", scheme, test.want)
+			}
+		})
+	}
+}
+
+func TestParseNamingRules(t *testing.T) {
+	rules, err := parseNamingRules([]namingRuleConfig{
+		{Match: `^github.com/org/(.*)$`, Replace: "myrepo/$1"},
+		{Match: `^github.com/other/(.*)$`, Replace: "other/$1"},
+	})
+	if err != nil {
+		t.Fatalf("parseNamingRules() = %v", err)
+	}
+	var got []string
+	for _, rule := range rules {
+		got = append(got, rule.Match.String())
+	}
+	if want := []string{`^github.com/org/(.*)$`, `^github.com/other/(.*)$`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNamingRules() = %v, want %v", got, want)
+	}
+
+	if _, err := parseNamingRules([]namingRuleConfig{{Match: "(", Replace: "x"}}); err == nil {
+		t.Error("parseNamingRules() with an invalid expression = nil, want error")
+	}
+}
@@ -28,13 +28,18 @@ import (
 // addCreate augments our CLI surface with apply.
 func addCreate(topLevel *cobra.Command) {
 	koCreateFlags := []string{}
-	lo := &options.LocalOptions{}
+	lo := &options.LocalOptions{Push: true}
 	no := &options.NameOptions{}
-	fo := &options.FilenameOptions{}
+	fo := &options.FilenameOptions{PassThrough: true}
 	ta := &options.TagsOptions{}
 	so := &options.SelectorOptions{}
 	sto := &options.StrictOptions{}
+	ro := &options.ResolveOptions{}
 	bo := &options.BuildOptions{}
+	oo := &options.OutputOptions{}
+	ko := &options.KubectlOptions{}
+	po := &options.PreflightOptions{}
+	pr := &options.PrimingOptions{}
 	create := &cobra.Command{
 		Use:   "create -f FILENAME",
 		Short: "Create the input files with image references resolved to built/pushed image digests.",
@@ -64,7 +69,10 @@ func addCreate(topLevel *cobra.Command) {
   cat config.yaml | ko create -f -`,
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			builder, err := makeBuilder(bo)
+			if !lo.Push {
+				log.Fatal("--push=false leaves the images unpublished, which ko create can't deploy")
+			}
+			builder, err := makeBuilder(bo, lo, ta)
 			if err != nil {
 				log.Fatalf("error creating builder: %v", err)
 			}
@@ -80,17 +88,21 @@ func addCreate(topLevel *cobra.Command) {
 			}
 
 			// Filter out ko flags from what we will pass through to kubectl.
-			kubectlFlags := []string{}
-			cmd.Flags().Visit(func(flag *pflag.Flag) {
-				if _, ok := ignoreSet[flag.Name]; !ok {
-					kubectlFlags = append(kubectlFlags, "--"+flag.Name, flag.Value.String())
+			kubectlFlags := passthroughFlags(cmd.Flags(), ignoreSet)
+
+			if po.Preflight {
+				if err := checkCluster(kubectlFlags); err != nil {
+					log.Fatal(err)
 				}
-			})
+			}
 
 			// Issue a "kubectl create" command reading from stdin,
 			// to which we will pipe the resolved files.
 			argv := []string{"create", "-f", "-"}
 			argv = append(argv, kubectlFlags...)
+			if ko.Print {
+				printKubectl(os.Stderr, argv)
+			}
 			kubectlCmd := exec.Command("kubectl", argv...)
 
 			// Pass through our environment
@@ -105,6 +117,7 @@ func addCreate(topLevel *cobra.Command) {
 				log.Fatalf("error piping to 'kubectl create': %v", err)
 			}
 
+			separators := primingSeparators(pr.Separators)
 			go func() {
 				// kubectl buffers data before starting to create it, which
 				// can lead to resources being created more slowly than desired.
@@ -113,11 +126,11 @@ func addCreate(topLevel *cobra.Command) {
 				// around this, we prime the stream with a bunch of empty objects
 				// which kubectl will discard.
 				// See https://github.com/google/go-containerregistry/pull/348
-				for i := 0; i < 1000; i++ {
-					stdin.Write([]byte("---\n"))
-				}
+				// Newer versions of kubectl don't need this, see
+				// primingSeparators.
+				prime(stdin, separators)
 				// Once primed kick things off.
-				resolveFilesToWriter(builder, publisher, fo, so, sto, stdin)
+				resolveFilesToWriter(builder, publisher, fo, so, sto, ro, oo, nil, stdin)
 			}()
 
 			// Run it.
@@ -132,7 +145,12 @@ func addCreate(topLevel *cobra.Command) {
 	options.AddTagsArg(create, ta)
 	options.AddSelectorArg(create, so)
 	options.AddStrictArg(create, sto)
+	options.AddResolveArgs(create, ro)
 	options.AddBuildOptions(create, bo)
+	options.AddSummaryArg(create, oo)
+	options.AddKubectlArgs(create, ko)
+	options.AddPreflightArg(create, po)
+	options.AddPrimingArg(create, pr)
 
 	// Collect the ko-specific apply flags before registering the kubectl global
 	// flags so that we can ignore them when passing kubectl global flags through
@@ -0,0 +1,141 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/kubernetes/pkg/kubectl/genericclioptions"
+)
+
+// addDiff augments our CLI surface with diff.
+func addDiff(topLevel *cobra.Command) {
+	koDiffFlags := []string{}
+	lo := &options.LocalOptions{Push: true}
+	no := &options.NameOptions{}
+	fo := &options.FilenameOptions{PassThrough: true}
+	ta := &options.TagsOptions{}
+	so := &options.SelectorOptions{}
+	sto := &options.StrictOptions{}
+	ro := &options.ResolveOptions{}
+	bo := &options.BuildOptions{}
+	oo := &options.OutputOptions{}
+	ko := &options.KubectlOptions{}
+	diff := &cobra.Command{
+		Use:   "diff -f FILENAME",
+		Short: "Diff the input files with image references resolved to built/pushed image digests against the cluster.",
+		Long:  `This sub-command finds import path references within the provided files, builds them into Go binaries, containerizes them, publishes them, and then feeds the resulting yaml into "kubectl diff".`,
+		Example: `
+  # Build and publish import path references to a Docker
+  # Registry as:
+  #   ${KO_DOCKER_REPO}/<package name>-<hash of import path>
+  # Then, feed the resulting yaml into "kubectl diff" to see
+  # what "ko apply" would change.
+  # When KO_DOCKER_REPO is ko.local, it is the same as if
+  # --local was passed.
+  ko diff -f config/
+
+  # Diff from stdin:
+  cat config.yaml | ko diff -f -`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if fo.Watch {
+				log.Fatal("--watch is not supported by ko diff")
+			}
+			builder, err := makeBuilder(bo, lo, ta)
+			if err != nil {
+				log.Fatalf("error creating builder: %v", err)
+			}
+			publisher, err := makePublisher(no, lo, ta)
+			if err != nil {
+				log.Fatalf("error creating publisher: %v", err)
+			}
+			// Create a set of ko-specific flags to ignore when passing through
+			// kubectl global flags.
+			ignoreSet := make(map[string]struct{})
+			for _, s := range koDiffFlags {
+				ignoreSet[s] = struct{}{}
+			}
+
+			// Filter out ko flags from what we will pass through to kubectl.
+			kubectlFlags := passthroughFlags(cmd.Flags(), ignoreSet)
+
+			// Issue a "kubectl diff" command reading from stdin,
+			// to which we will pipe the resolved files.
+			argv := []string{"diff", "-f", "-"}
+			argv = append(argv, kubectlFlags...)
+			if ko.Print {
+				printKubectl(os.Stderr, argv)
+			}
+			kubectlCmd := exec.Command("kubectl", argv...)
+
+			// Pass through our environment
+			kubectlCmd.Env = os.Environ()
+			// Pass through our std{out,err} and make our resolved buffer stdin.
+			kubectlCmd.Stderr = os.Stderr
+			kubectlCmd.Stdout = os.Stdout
+
+			// Wire up kubectl stdin to resolveFilesToWriter.
+			stdin, err := kubectlCmd.StdinPipe()
+			if err != nil {
+				log.Fatalf("error piping to 'kubectl diff': %v", err)
+			}
+
+			go resolveFilesToWriter(builder, publisher, fo, so, sto, ro, oo, nil, stdin)
+
+			// Run it.
+			if err := diffResult(kubectlCmd.Run()); err != nil {
+				log.Fatalf("error executing 'kubectl diff': %v", err)
+			}
+		},
+	}
+	options.AddLocalArg(diff, lo)
+	options.AddNamingArgs(diff, no)
+	options.AddFileArg(diff, fo)
+	options.AddTagsArg(diff, ta)
+	options.AddSelectorArg(diff, so)
+	options.AddStrictArg(diff, sto)
+	options.AddResolveArgs(diff, ro)
+	options.AddBuildOptions(diff, bo)
+	options.AddSummaryArg(diff, oo)
+	options.AddKubectlArgs(diff, ko)
+
+	// Collect the ko-specific diff flags before registering the kubectl global
+	// flags so that we can ignore them when passing kubectl global flags through
+	// to kubectl.
+	diff.Flags().VisitAll(func(flag *pflag.Flag) {
+		koDiffFlags = append(koDiffFlags, flag.Name)
+	})
+
+	// Register the kubectl global flags.
+	kubeConfigFlags := genericclioptions.NewConfigFlags()
+	kubeConfigFlags.AddFlags(diff.Flags())
+
+	topLevel.AddCommand(diff)
+}
+
+// diffResult interprets the error from running "kubectl diff", which exits
+// with status 1 when it finds differences, and greater statuses on failure.
+func diffResult(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestDiffResult(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		err     error
+		wantErr bool
+	}{{
+		desc: "no differences",
+		err:  exec.Command("sh", "-c", "exit 0").Run(),
+	}, {
+		desc: "differences found",
+		err:  exec.Command("sh", "-c", "exit 1").Run(),
+	}, {
+		desc:    "kubectl failed",
+		err:     exec.Command("sh", "-c", "exit 2").Run(),
+		wantErr: true,
+	}, {
+		desc:    "kubectl not found",
+		err:     exec.Command("/no/such/kubectl").Run(),
+		wantErr: true,
+	}, {
+		desc:    "other error",
+		err:     errors.New("broken pipe"),
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			if err := diffResult(test.err); (err != nil) != test.wantErr {
+				t.Errorf("diffResult(%v) = %v, wantErr %v", test.err, err, test.wantErr)
+			}
+		})
+	}
+}
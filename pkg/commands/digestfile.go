@@ -0,0 +1,133 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/publish"
+)
+
+// digestFilePublisher writes the reference to each image it publishes, by
+// digest, to a file, for steps such as signing to pick up afterwards.
+type digestFilePublisher struct {
+	inner publish.Interface
+	// pattern is the path of the file to write, in which {name} is
+	// replaced with the image's import path.
+	pattern string
+
+	m sync.Mutex
+	// first is the import path whose digest was written first, which is
+	// the only one that a pattern without {name} can hold.
+	first string
+}
+
+// digestFilePublisher implements Tagger and IndexPublisher
+var _ publish.Tagger = (*digestFilePublisher)(nil)
+var _ publish.IndexPublisher = (*digestFilePublisher)(nil)
+
+// Publish implements publish.Interface
+func (dp *digestFilePublisher) Publish(img v1.Image, s string) (name.Reference, error) {
+	ref, err := dp.inner.Publish(img, s)
+	if err != nil {
+		return nil, err
+	}
+	return ref, dp.write(img.Digest, s, ref)
+}
+
+// PublishWithTags implements publish.Tagger
+func (dp *digestFilePublisher) PublishWithTags(img v1.Image, s string, tags []string) (name.Reference, error) {
+	tagger, ok := dp.inner.(publish.Tagger)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing with tags", dp.inner)
+	}
+	ref, err := tagger.PublishWithTags(img, s, tags)
+	if err != nil {
+		return nil, err
+	}
+	return ref, dp.write(img.Digest, s, ref)
+}
+
+// PublishIndex implements publish.IndexPublisher
+func (dp *digestFilePublisher) PublishIndex(idx v1.ImageIndex, s string) (name.Reference, error) {
+	ip, ok := dp.inner.(publish.IndexPublisher)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing image indexes", dp.inner)
+	}
+	ref, err := ip.PublishIndex(idx, s)
+	if err != nil {
+		return nil, err
+	}
+	return ref, dp.write(idx.Digest, s, ref)
+}
+
+// write writes <repo>@<digest> of the image or index published as ref, whose
+// digest is returned by digest, to the file for the import path s, creating
+// its directory if need be.
+func (dp *digestFilePublisher) write(digest func() (v1.Hash, error), s string, ref name.Reference) error {
+	// Publishers return the digest that references resolve to, but e.g. the
+	// daemon publisher returns a tag, for which we use the image's digest.
+	content := ref.String() + "\n"
+	if _, ok := ref.(*name.Digest); !ok {
+		h, err := digest()
+		if err != nil {
+			return err
+		}
+		content = fmt.Sprintf("%s@%s\n", ref.Context(), h)
+	}
+	if err := dp.checkPattern(s); err != nil {
+		return err
+	}
+	path := digestFilePath(dp.pattern, s)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing digest of %s: %v", s, err)
+	}
+	return nil
+}
+
+// checkPattern returns an error if the pattern has no {name}, and an image
+// of an import path other than s was already published, as the digest of s
+// would silently overwrite its digest.
+func (dp *digestFilePublisher) checkPattern(s string) error {
+	if strings.Contains(dp.pattern, "{name}") {
+		return nil
+	}
+	dp.m.Lock()
+	defer dp.m.Unlock()
+	if dp.first == "" {
+		dp.first = s
+	}
+	if dp.first != s {
+		return fmt.Errorf("--digest-file %s has no {name}, so can't hold the digests of both %s and %s", dp.pattern, dp.first, s)
+	}
+	return nil
+}
+
+// digestFilePath returns the path that pattern names for the import path s.
+// Import paths keep their slashes, so that files for different import paths
+// with the same base name don't collide.
+func digestFilePath(pattern, s string) string {
+	return filepath.FromSlash(strings.Replace(pattern, "{name}", s, -1))
+}
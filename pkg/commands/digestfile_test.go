@@ -0,0 +1,163 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/ko/pkg/publish"
+)
+
+// tagPublisher publishes images under ko.local/<import path>:latest, like
+// the daemon publisher does.
+type tagPublisher struct{}
+
+func (tagPublisher) Publish(_ v1.Image, s string) (name.Reference, error) {
+	t, err := name.NewTag(publish.LocalDomain + "/" + s + ":latest")
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (tp tagPublisher) PublishIndex(_ v1.ImageIndex, s string) (name.Reference, error) {
+	return tp.Publish(nil, s)
+}
+
+func TestDigestFilePublisher(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+
+	for _, test := range []struct {
+		desc  string
+		inner publish.Interface
+		want  map[string]string
+	}{{
+		desc:  "by digest",
+		inner: fakePublisher{},
+		want: map[string]string{
+			"github.com/foo/app": "gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n",
+			"github.com/bar/app": "gcr.io/fake/github.com/bar/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n",
+		},
+	}, {
+		desc:  "by tag",
+		inner: tagPublisher{},
+		want: map[string]string{
+			"github.com/foo/app": "ko.local/github.com/foo/app@" + h.String() + "\n",
+		},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "ko")
+			if err != nil {
+				t.Fatalf("TempDir() = %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			dp := &digestFilePublisher{
+				inner:   test.inner,
+				pattern: filepath.Join(tmpDir, "digests", "{name}.digest"),
+			}
+			for importpath, want := range test.want {
+				if _, err := dp.Publish(img, importpath); err != nil {
+					t.Fatalf("Publish(%s) = %v", importpath, err)
+				}
+				b, err := ioutil.ReadFile(filepath.Join(tmpDir, "digests", filepath.FromSlash(importpath)+".digest"))
+				if err != nil {
+					t.Fatalf("ReadFile() = %v", err)
+				}
+				if got := string(b); got != want {
+					t.Errorf("digest file of %s = %q, want %q", importpath, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestFileWithoutName(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dp := &digestFilePublisher{
+		inner:   fakePublisher{},
+		pattern: filepath.Join(tmpDir, "image.digest"),
+	}
+	// A pattern without {name} will do for a single image, even if it's
+	// published again.
+	for i := 0; i < 2; i++ {
+		if _, err := dp.Publish(img, "github.com/foo/app"); err != nil {
+			t.Fatalf("Publish(github.com/foo/app) = %v", err)
+		}
+	}
+	if _, err := dp.Publish(img, "github.com/bar/app"); err == nil {
+		t.Error("Publish(github.com/bar/app) = nil, want error for the digest file of github.com/foo/app")
+	}
+	b, err := ioutil.ReadFile(dp.pattern)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	if want := "gcr.io/fake/github.com/foo/app@"; !strings.HasPrefix(string(b), want) {
+		t.Errorf("digest file = %q, want the digest of github.com/foo/app", b)
+	}
+}
+
+func TestDigestFileIndex(t *testing.T) {
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index() = %v", err)
+	}
+	h, err := idx.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "app.digest")
+	dp := &digestFilePublisher{inner: tagPublisher{}, pattern: path}
+	if _, err := dp.PublishIndex(idx, "github.com/foo/app"); err != nil {
+		t.Fatalf("PublishIndex() = %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	// The file holds the digest of the index, not of any one image.
+	if got, want := string(b), "ko.local/github.com/foo/app@"+h.String()+"\n"; got != want {
+		t.Errorf("digest file = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/pflag"
+)
+
+// passthroughFlags returns the argv to pass through to kubectl for the flags
+// that have been set on fs, skipping those named in ignoreSet.
+func passthroughFlags(fs *pflag.FlagSet, ignoreSet map[string]struct{}) []string {
+	kubectlFlags := []string{}
+	fs.Visit(func(flag *pflag.Flag) {
+		if _, ok := ignoreSet[flag.Name]; !ok {
+			kubectlFlags = append(kubectlFlags, flagArgs(flag)...)
+		}
+	})
+	return kubectlFlags
+}
+
+// flagArgs renders a single flag as kubectl expects to receive it.
+func flagArgs(flag *pflag.Flag) []string {
+	// Slice values render as "[a,b]", so repeat the flag once per element.
+	if sv, ok := flag.Value.(pflag.SliceValue); ok {
+		args := []string{}
+		for _, elem := range sv.GetSlice() {
+			args = append(args, "--"+flag.Name+"="+elem)
+		}
+		return args
+	}
+
+	switch flag.Value.Type() {
+	case "bool":
+		// Boolean flags don't consume the following argument, so
+		// "--flag false" would be read as "--flag" and a stray "false".
+		return []string{"--" + flag.Name + "=" + flag.Value.String()}
+	default:
+		return []string{"--" + flag.Name, flag.Value.String()}
+	}
+}
+
+// printKubectl writes the kubectl command line with the arguments argv to w,
+// quoting the arguments that a shell would need quoted.
+func printKubectl(w io.Writer, argv []string) {
+	args := []string{"kubectl"}
+	for _, arg := range argv {
+		args = append(args, shellQuote(arg))
+	}
+	fmt.Fprintln(w, strings.Join(args, " "))
+}
+
+// shellQuote quotes s for a POSIX shell, unless it's made up of characters
+// that don't need quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_=./:,@+%", r)
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/pflag"
+)
+
+func TestPassthroughFlags(t *testing.T) {
+	tests := []struct {
+		desc string
+		args []string
+		want []string
+	}{{
+		desc: "no flags",
+		args: []string{},
+		want: []string{},
+	}, {
+		desc: "bool flag",
+		args: []string{"--insecure-skip-tls-verify"},
+		want: []string{"--insecure-skip-tls-verify=true"},
+	}, {
+		desc: "bool flag set false",
+		args: []string{"--insecure-skip-tls-verify=false"},
+		want: []string{"--insecure-skip-tls-verify=false"},
+	}, {
+		desc: "string flag",
+		args: []string{"--namespace", "foo"},
+		want: []string{"--namespace", "foo"},
+	}, {
+		desc: "int flag",
+		args: []string{"--v=3"},
+		want: []string{"--v", "3"},
+	}, {
+		desc: "string slice flag",
+		args: []string{"--filename=a,b"},
+		want: []string{"--filename=a", "--filename=b"},
+	}, {
+		desc: "repeated string slice flag",
+		args: []string{"-f", "a", "-f", "b,c"},
+		want: []string{"--filename=a", "--filename=b", "--filename=c"},
+	}, {
+		desc: "repeated string array flag",
+		args: []string{"--selector=a=b,c=d", "--selector", "e=f"},
+		want: []string{"--selector=a=b,c=d", "--selector=e=f"},
+	}, {
+		desc: "ignored flag",
+		args: []string{"--strict", "--namespace=foo"},
+		want: []string{"--namespace", "foo"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.Bool("insecure-skip-tls-verify", false, "")
+			fs.Bool("strict", false, "")
+			fs.String("namespace", "", "")
+			fs.Int("v", 0, "")
+			fs.StringSliceP("filename", "f", nil, "")
+			fs.StringArray("selector", nil, "")
+			if err := fs.Parse(test.args); err != nil {
+				t.Fatalf("Parse(%v) = %v", test.args, err)
+			}
+
+			got := passthroughFlags(fs, map[string]struct{}{"strict": {}})
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("passthroughFlags(%v); (-want +got) = %v", test.args, diff)
+			}
+		})
+	}
+}
+
+func TestPrintKubectl(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("print-kubectl", false, "")
+	fs.String("namespace", "", "")
+	fs.StringArray("selector", nil, "")
+	args := []string{"--print-kubectl", "--namespace", "foo", "--selector", "app in (a, b)"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%v) = %v", args, err)
+	}
+
+	argv := []string{"apply", "-f", "-"}
+	argv = append(argv, passthroughFlags(fs, map[string]struct{}{"print-kubectl": {}})...)
+	var buf bytes.Buffer
+	printKubectl(&buf, argv)
+
+	want := "kubectl apply -f - --namespace foo '--selector=app in (a, b)'\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("printKubectl(%v); (-want +got) = %v", argv, diff)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{in: "--namespace=foo", want: "--namespace=foo"},
+		{in: "", want: "''"},
+		{in: "a b", want: "'a b'"},
+		{in: "it's", want: `'it'\''s'`},
+		{in: "$HOME", want: "'$HOME'"},
+	} {
+		if got := shellQuote(test.in); got != test.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
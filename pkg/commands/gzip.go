@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// gzipWriteCloser gzips what is written to it onto out, flushing after each
+// write, so that each resolved document written can be decompressed as soon
+// as it arrives, e.g. while watching.
+type gzipWriteCloser struct {
+	zw  *gzip.Writer
+	out io.WriteCloser
+}
+
+func newGzipWriteCloser(out io.WriteCloser) *gzipWriteCloser {
+	return &gzipWriteCloser{
+		zw:  gzip.NewWriter(out),
+		out: out,
+	}
+}
+
+// Write implements io.Writer
+func (g *gzipWriteCloser) Write(p []byte) (int, error) {
+	n, err := g.zw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, g.zw.Flush()
+}
+
+// Close implements io.Closer, closing out once the gzip stream is complete.
+func (g *gzipWriteCloser) Close() error {
+	if err := g.zw.Close(); err != nil {
+		g.out.Close()
+		return err
+	}
+	return g.out.Close()
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// jsonnetCommand creates the jsonnet command run by evaluateJsonnet.  It is
+// a variable so that tests can stand in for jsonnet.
+var jsonnetCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("jsonnet", args...)
+}
+
+// isJsonnet reports whether the input file f holds Jsonnet, which is
+// evaluated before references within it are resolved.
+func isJsonnet(f string) bool {
+	return filepath.Ext(f) == ".jsonnet" && !options.IsURL(f)
+}
+
+// evaluateJsonnet evaluates the Jsonnet file f with the import paths and
+// external variables of fo, returning the JSON that it evaluates to, which
+// is resolved like any other yaml.
+func evaluateJsonnet(f string, fo *options.FilenameOptions) ([]byte, error) {
+	var args []string
+	for _, dir := range fo.JsonnetImportPaths {
+		args = append(args, "--jpath", dir)
+	}
+	for _, v := range fo.JsonnetExtVars {
+		args = append(args, "--ext-str", v)
+	}
+	args = append(args, f)
+
+	cmd := jsonnetCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err == nil {
+		return b, nil
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return nil, fmt.Errorf("running jsonnet, which evaluating %s requires: %v", f, err)
+	}
+	return nil, fmt.Errorf("evaluating %s:\n%s", f, strings.TrimSpace(stderr.String()))
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// TestJsonnetEvaluate isn't a real test, but stands in for jsonnet when run
+// by fakeJsonnet.  It evaluates a manifest whose image is the value of the
+// app external variable, and fails on files named broken.jsonnet.
+func TestJsonnetEvaluate(t *testing.T) {
+	if os.Getenv("KO_TEST_JSONNET") != "1" {
+		return
+	}
+	args := os.Args[len(os.Args)-3:]
+	if filepath.Base(args[2]) == "broken.jsonnet" {
+		fmt.Fprintln(os.Stderr, "STATIC ERROR: broken.jsonnet:1:1: Unexpected end of file.")
+		os.Exit(1)
+	}
+	app := strings.TrimPrefix(args[1], "app=")
+	fmt.Printf("{\n   \"apiVersion\": \"v1\",\n   \"kind\": \"Pod\",\n   \"spec\": {\n      \"containers\": [\n         {\n            \"image\": \"ko://%s\"\n         }\n      ]\n   }\n}\n", app)
+	os.Exit(0)
+}
+
+// fakeJsonnet returns a jsonnetCommand that runs TestJsonnetEvaluate, and
+// records the arguments it was passed in args.
+func fakeJsonnet(args *[]string) func(...string) *exec.Cmd {
+	return func(argv ...string) *exec.Cmd {
+		*args = argv
+		cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestJsonnetEvaluate", "--"}, argv...)...)
+		cmd.Env = append(os.Environ(), "KO_TEST_JSONNET=1")
+		return cmd
+	}
+}
+
+func TestResolveJsonnet(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f := filepath.Join(tmpDir, "app.jsonnet")
+	if err := ioutil.WriteFile(f, []byte(`{
+  apiVersion: "v1",
+  kind: "Pod",
+  spec: { containers: [{ image: "ko://" + std.extVar("app") }] },
+}
+`), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	var args []string
+	defer func(c func(...string) *exec.Cmd) { jsonnetCommand = c }(jsonnetCommand)
+	jsonnetCommand = fakeJsonnet(&args)
+
+	fo := &options.FilenameOptions{
+		JsonnetImportPaths: []string{filepath.Join(tmpDir, "lib")},
+		JsonnetExtVars:     []string{"app=github.com/foo/app"},
+	}
+	got, err := resolveFile(f, fo, fakeBuilder{}, fakePublisher{}, &options.SelectorOptions{}, &options.StrictOptions{Strict: true}, nil)
+	if err != nil {
+		t.Fatalf("resolveFile() = %v", err)
+	}
+	want := `apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("resolveFile(); (-want +got) = %v", diff)
+	}
+	wantArgs := []string{"--jpath", filepath.Join(tmpDir, "lib"), "--ext-str", "app=github.com/foo/app", f}
+	if diff := cmp.Diff(wantArgs, args); diff != "" {
+		t.Errorf("jsonnet args; (-want +got) = %v", diff)
+	}
+
+	// Errors evaluating the file are reported along with jsonnet's output.
+	broken := filepath.Join(tmpDir, "broken.jsonnet")
+	_, err = resolveFile(broken, fo, fakeBuilder{}, fakePublisher{}, &options.SelectorOptions{}, &options.StrictOptions{Strict: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Unexpected end of file") {
+		t.Errorf("resolveFile(%s) = %v, want jsonnet's error", broken, err)
+	}
+}
+
+func TestIsJsonnet(t *testing.T) {
+	for f, want := range map[string]bool{
+		"app.jsonnet":                     true,
+		"config/app.jsonnet":              true,
+		"app.libsonnet":                   false,
+		"app.yaml":                        false,
+		"-":                               false,
+		"https://example.com/app.jsonnet": false,
+	} {
+		if got := isJsonnet(f); got != want {
+			t.Errorf("isJsonnet(%q) = %v, want %v", f, got, want)
+		}
+	}
+}
+
+func TestEnumerateJsonnetFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, f := range []string{"app.jsonnet", "app.yaml", "lib.libsonnet", "README.md"} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, f), nil, 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	var got []string
+	for f := range options.EnumerateFiles(&options.FilenameOptions{Filenames: []string{tmpDir}}) {
+		got = append(got, filepath.Base(f))
+	}
+	// Directories may hold Jsonnet libraries, which can't be evaluated
+	// alone, so only Jsonnet passed by name is.
+	want := []string{"app.yaml"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("EnumerateFiles(); (-want +got) = %v", diff)
+	}
+
+	got = nil
+	named := filepath.Join(tmpDir, "app.jsonnet")
+	for f := range options.EnumerateFiles(&options.FilenameOptions{Filenames: []string{named}}) {
+		got = append(got, f)
+	}
+	if diff := cmp.Diff([]string{named}, got); diff != "" {
+		t.Errorf("EnumerateFiles(%s); (-want +got) = %v", named, diff)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// ecrRegistryRE matches the hosts of Amazon ECR registries, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com.
+var ecrRegistryRE = regexp.MustCompile(`^\d{12}\.dkr\.ecr(-fips)?\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// isGCR reports whether registry is one of GCR's, e.g. gcr.io or eu.gcr.io.
+func isGCR(registry string) bool {
+	return registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io")
+}
+
+// cloudHelper returns the name of the docker credential helper, run as
+// docker-credential-<name>, that authenticates to the registry of a cloud
+// provider, or "" if registry isn't one.
+func cloudHelper(registry string) string {
+	switch {
+	case isGCR(registry) || strings.HasSuffix(registry, "-docker.pkg.dev"):
+		return "gcloud"
+	case ecrRegistryRE.MatchString(registry):
+		return "ecr-login"
+	case strings.HasSuffix(registry, ".azurecr.io"):
+		return "acr-env"
+	default:
+		return ""
+	}
+}
+
+// cloudKeychain authenticates to the registries of Google, Amazon and Azure:
+// to GCR with the google keychain, which finds application default
+// credentials as well as gcloud's, and to the others with their docker
+// credential helpers, as "docker login" would with them configured as
+// credHelpers.  Amazon's and Azure's keychains would need their SDKs, which
+// ko doesn't depend on.
+type cloudKeychain struct{}
+
+// cloudKeychain implements authn.Keychain
+var _ authn.Keychain = cloudKeychain{}
+
+// Resolve implements authn.Keychain
+func (cloudKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+	helper := cloudHelper(registry)
+	if helper == "" {
+		return authn.Anonymous, nil
+	}
+	if isGCR(registry) {
+		auth, err := google.Keychain.Resolve(target)
+		if err != nil {
+			log.Printf("Unable to get credentials for %s: %v", registry, err)
+			return authn.Anonymous, nil
+		}
+		return auth, nil
+	}
+	creds, err := client.Get(client.NewShellProgramFunc("docker-credential-"+helper), registry)
+	if err != nil {
+		// The helper may not be installed, or set up, which is no reason
+		// not to try the registry anonymously.
+		log.Printf("Unable to get credentials for %s from docker-credential-%s: %v", registry, helper, err)
+		return authn.Anonymous, nil
+	}
+	if creds.Username == "<token>" {
+		return authn.FromConfig(authn.AuthConfig{IdentityToken: creds.Secret}), nil
+	}
+	return authn.FromConfig(authn.AuthConfig{Username: creds.Username, Password: creds.Secret}), nil
+}
+
+// keychain returns the keychain to authenticate to registries with: that of
+// the docker config, followed with --cloud-keychain by the cloudKeychain.
+func keychain(lo *options.LocalOptions) authn.Keychain {
+	if !lo.CloudKeychain {
+		return authn.DefaultKeychain
+	}
+	return authn.NewMultiKeychain(authn.DefaultKeychain, cloudKeychain{})
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+func TestCloudHelper(t *testing.T) {
+	for registry, want := range map[string]string{
+		"gcr.io":            "gcloud",
+		"eu.gcr.io":         "gcloud",
+		"us-docker.pkg.dev": "gcloud",
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com":     "ecr-login",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn": "ecr-login",
+		"myregistry.azurecr.io":                            "acr-env",
+		"index.docker.io":                                  "",
+		"ecr.example.com":                                  "",
+	} {
+		if got := cloudHelper(registry); got != want {
+			t.Errorf("cloudHelper(%q) = %q, want %q", registry, got, want)
+		}
+	}
+}
+
+func TestCloudKeychain(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko-keychain")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Fake the credential helpers, each of which answers with its own name.
+	for _, helper := range []string{"gcloud", "ecr-login", "acr-env"} {
+		script := "#!/bin/sh\necho '{\"Username\": \"" + helper + "\", \"Secret\": \"secret\"}'\n"
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, "docker-credential-"+helper), []byte(script), 0755); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+	// Fake gcloud, which GCR's tokens come from instead, as application
+	// default credentials are missing.
+	script := "#!/bin/sh\necho '{\"credential\": {\"access_token\": \"gcloud-token\", \"token_expiry\": \"2099-01-01T00:00:00Z\"}}'\n"
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "gcloud"), []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	// An empty docker config, which has no credentials of its own.
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "config.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	for key, value := range map[string]string{
+		"PATH":                           tmpDir,
+		"DOCKER_CONFIG":                  tmpDir,
+		"GOOGLE_APPLICATION_CREDENTIALS": filepath.Join(tmpDir, "missing.json"),
+	} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	resolve := func(kc authn.Keychain, registry string) string {
+		reg, err := name.NewRegistry(registry)
+		if err != nil {
+			t.Fatalf("NewRegistry() = %v", err)
+		}
+		auth, err := kc.Resolve(reg)
+		if err != nil {
+			t.Fatalf("Resolve(%s) = %v", registry, err)
+		}
+		if auth == authn.Anonymous {
+			return ""
+		}
+		cfg, err := auth.Authorization()
+		if err != nil {
+			t.Fatalf("Authorization() = %v", err)
+		}
+		if cfg.RegistryToken != "" {
+			return cfg.RegistryToken
+		}
+		return cfg.Username
+	}
+
+	kc := keychain(&options.LocalOptions{CloudKeychain: true})
+	for registry, want := range map[string]string{
+		"gcr.io":            "gcloud-token",
+		"eu.gcr.io":         "gcloud-token",
+		"us-docker.pkg.dev": "gcloud",
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com": "ecr-login",
+		"myregistry.azurecr.io":                        "acr-env",
+		"index.docker.io":                              "",
+	} {
+		if got := resolve(kc, registry); got != want {
+			t.Errorf("Resolve(%s) authenticated with %q, want %q", registry, got, want)
+		}
+	}
+
+	// Without --cloud-keychain, the helpers aren't used.
+	if got := resolve(keychain(&options.LocalOptions{}), "gcr.io"); got != "" {
+		t.Errorf("Resolve(gcr.io) without the cloud keychain authenticated with %q, want anonymous", got)
+	}
+}
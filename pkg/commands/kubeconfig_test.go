@@ -0,0 +1,110 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/ko/pkg/commands/options"
+)
+
+const kubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: test
+  user:
+    token: secret
+contexts:
+- name: with-namespace
+  context:
+    cluster: test
+    user: test
+    namespace: team-a
+- name: without-namespace
+  context:
+    cluster: test
+    user: test
+current-context: %s
+`
+
+func TestSetContextNamespace(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f := filepath.Join(tmpDir, "app.yaml")
+	if err := ioutil.WriteFile(f, []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - image: ko://github.com/foo/app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: other
+`), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	config := filepath.Join(tmpDir, "kubeconfig")
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", config)
+
+	for _, test := range []struct {
+		context string
+		want    string
+	}{
+		{context: "with-namespace", want: "team-a"},
+		{context: "without-namespace", want: "default"},
+	} {
+		if err := ioutil.WriteFile(config, []byte(strings.Replace(kubeconfig, "%s", test.context, 1)), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		opts, err := resolveOptions(&options.ResolveOptions{ContextNamespace: true})
+		if err != nil {
+			t.Fatalf("%s: resolveOptions() = %v", test.context, err)
+		}
+		b, err := resolveFile(f, &options.FilenameOptions{}, fakeBuilder{}, &fakePublisher{}, &options.SelectorOptions{}, &options.StrictOptions{}, opts)
+		if err != nil {
+			t.Fatalf("%s: resolveFile() = %v", test.context, err)
+		}
+		if got := string(b); !strings.Contains(got, "name: app\n  namespace: "+test.want+"\n") {
+			t.Errorf("%s: resolveFile() = %s, want the Deployment in namespace %s", test.context, got, test.want)
+		}
+		// Resources that name their namespace keep it.
+		if got := string(b); !strings.Contains(got, "namespace: other\n") {
+			t.Errorf("%s: resolveFile() = %s, want the Service to stay in namespace other", test.context, got)
+		}
+	}
+
+	if _, err := resolveOptions(&options.ResolveOptions{ContextNamespace: true, Namespace: "other"}); err == nil {
+		t.Error("resolveOptions(--set-context-namespace, --set-namespace) = nil, want error")
+	}
+}
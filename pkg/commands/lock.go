@@ -0,0 +1,71 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// readDigests reads a yaml file mapping import paths to the images they
+// were published as, which is the format of both --previous-digests and
+// lockfiles.
+func readDigests(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string)
+	if err := yaml.Unmarshal(b, &digests); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// reuseLocked returns a function that reports the image recorded for an
+// import path in the lockfile at path.  Import paths missing from the
+// lockfile are built as usual.
+func reuseLocked(path string) (func(string) (string, bool), error) {
+	digests, err := readDigests(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(importpath string) (string, bool) {
+		digest, ok := digests[importpath]
+		if !ok {
+			log.Printf("%s is not in %s, building it", importpath, path)
+			return "", false
+		}
+		log.Printf("Using %s for %s, from %s", digest, importpath, path)
+		return digest, true
+	}, nil
+}
+
+// writeLock writes a lockfile to path, mapping the import path of each of
+// the resolved references in images to the image it resolved to.
+func writeLock(path string, images map[string]string) error {
+	digests := make(map[string]string, len(images))
+	for ref, image := range images {
+		digests[strings.TrimPrefix(ref, "ko://")] = image
+	}
+	b, err := yaml.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
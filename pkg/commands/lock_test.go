@@ -0,0 +1,123 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// countingBuilder is a fakeBuilder that counts its builds.
+type countingBuilder struct {
+	fakeBuilder
+	builds *int32
+}
+
+func (cb countingBuilder) Build(ip string) (v1.Image, error) {
+	atomic.AddInt32(cb.builds, 1)
+	return cb.fakeBuilder.Build(ip)
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "app.yaml")
+	if err := ioutil.WriteFile(input, []byte("image: ko://github.com/foo/app\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	lock := filepath.Join(tmpDir, "ko.lock")
+	resolveWith := func(ro *options.ResolveOptions, b build.Interface) string {
+		builder, err := build.NewCaching(b)
+		if err != nil {
+			t.Fatalf("NewCaching() = %v", err)
+		}
+		out := &nopWriteCloser{}
+		resolveFilesToWriter(builder, fakePublisher{},
+			&options.FilenameOptions{Filenames: []string{input}},
+			&options.SelectorOptions{},
+			&options.StrictOptions{},
+			ro,
+			&options.OutputOptions{},
+			nil,
+			out)
+		return out.String()
+	}
+
+	want := resolveWith(&options.ResolveOptions{WriteLock: lock}, fakeBuilder{})
+	image := "gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	got, err := readDigests(lock)
+	if err != nil {
+		t.Fatalf("readDigests() = %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{"github.com/foo/app": image}, got); diff != "" {
+		t.Errorf("lock (-want +got) = %v", diff)
+	}
+
+	// Reading the lock resolves to the same image, without building it.
+	var builds int32
+	cb := countingBuilder{builds: &builds}
+	if got := resolveWith(&options.ResolveOptions{ReadLock: lock}, cb); got != want {
+		t.Errorf("resolved with lock = %q, want %q", got, want)
+	}
+	if builds != 0 {
+		t.Errorf("built %d times with the lock, want 0", builds)
+	}
+}
+
+func TestReuseLockedStale(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lock := filepath.Join(tmpDir, "ko.lock")
+	image := "gcr.io/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	if err := writeLock(lock, map[string]string{"ko://github.com/foo/app": image}); err != nil {
+		t.Fatalf("writeLock() = %v", err)
+	}
+	reuse, err := reuseLocked(lock)
+	if err != nil {
+		t.Fatalf("reuseLocked() = %v", err)
+	}
+
+	if got, ok := reuse("github.com/foo/app"); !ok || got != image {
+		t.Errorf("reuse(locked) = %q, %v, want %q, true", got, ok, image)
+	}
+	// Import paths that aren't in the lock are built.
+	if got, ok := reuse("github.com/foo/new"); ok {
+		t.Errorf("reuse(stale) = %q, true, want false", got)
+	}
+
+	if _, err := reuseLocked(filepath.Join(tmpDir, "missing.lock")); err == nil {
+		t.Error("reuseLocked(missing) = nil, want error")
+	}
+	if _, err := resolveOptions(&options.ResolveOptions{ReadLock: lock, ChangedSince: "HEAD"}); err == nil || !strings.Contains(err.Error(), "--read-lock") {
+		t.Errorf("resolveOptions(--read-lock, --changed-since) = %v, want error", err)
+	}
+}
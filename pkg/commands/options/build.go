@@ -15,7 +15,9 @@
 package options
 
 import (
+	"os"
 	"runtime"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -24,6 +26,78 @@ import (
 type BuildOptions struct {
 	ConcurrentBuilds     int
 	DisableOptimizations bool
+	// Builder selects the build.Interface implementation to use, e.g. "go".
+	Builder string
+	// ImageAnnotations holds key=value pairs to set as manifest annotations.
+	ImageAnnotations []string
+	// ExtraHosts holds host=ip pairs to resolve when fetching modules.
+	ExtraHosts []string
+	// Platform is the os/arch[/variant] to build images for.
+	Platform string
+	// CACert is a bundle of certificates to trust when fetching modules.
+	CACert string
+	// TempDir is the directory to write build output under.
+	TempDir string
+	// GoCache is the directory to keep the go build cache in.
+	GoCache string
+	// GoBinary is the go command to build with.
+	GoBinary string
+	// DiskCache keeps the layers of base images and built binaries in the
+	// user cache directory, for later invocations to reuse.
+	DiskCache bool
+	// BuildLogDir is the directory to write the output of each build to.
+	BuildLogDir string
+	// BuildRetries is how many times to retry builds that fail to download
+	// modules.
+	BuildRetries int
+	// PreBuildCommands are run in the directory of each package before it
+	// is built.
+	PreBuildCommands []string
+	// Race builds binaries with the race detector.
+	Race bool
+	// DefaultArgs are set as the image config's Cmd.
+	DefaultArgs []string
+	// ValidateBinaries checks that built binaries can run on the platform.
+	ValidateBinaries bool
+	// StopSignal is the signal to set in the image config to stop containers.
+	StopSignal string
+	// AppPath is the directory within the image that binaries are put in.
+	AppPath string
+	// KoDataEnvName is the environment variable that points at kodata.
+	KoDataEnvName string
+	// ModMode is passed to "go build" as -mod.
+	ModMode string
+	// BuildVCS is passed to "go build" as -buildvcs.
+	BuildVCS string
+	// DebugEntrypoint makes a shell from the base image the entrypoint.
+	DebugEntrypoint bool
+	// BuilderEndpoint is the URL of a remote build service to build with.
+	BuilderEndpoint string
+	// VerifyBase is the path of a public key that base images must have a
+	// cosign signature from.
+	VerifyBase string
+	// VerifyBaseRoots is the path of the root certificates that issue the
+	// certificates of keyless signatures of base images, which are verified
+	// instead of signatures made with VerifyBase.
+	VerifyBaseRoots string
+	// VerifyBaseIdentity is the email address or URI that the certificates
+	// of keyless signatures must be issued for.
+	VerifyBaseIdentity string
+	// VerifyBaseRekorKey is the path of the public key of the transparency
+	// log that keyless signatures must be logged in.
+	VerifyBaseRekorKey string
+	// MaxImageSize is the size, e.g. 50MB, that the compressed layers of
+	// images may add up to at most.
+	MaxImageSize string
+	// RequireLicense fails builds on base images that don't declare a
+	// license.
+	RequireLicense bool
+	// Healthcheck is the command of the healthcheck to set in the image
+	// config, with its interval, timeout and number of retries.
+	Healthcheck         []string
+	HealthcheckInterval time.Duration
+	HealthcheckTimeout  time.Duration
+	HealthcheckRetries  int
 }
 
 func AddBuildOptions(cmd *cobra.Command, bo *BuildOptions) {
@@ -31,4 +105,68 @@ func AddBuildOptions(cmd *cobra.Command, bo *BuildOptions) {
 		"The maximum number of concurrent builds")
 	cmd.Flags().BoolVar(&bo.DisableOptimizations, "disable-optimizations", bo.DisableOptimizations,
 		"Disable optimizations when building Go code. Useful when you want to interactively debug the created container.")
+	cmd.Flags().StringVar(&bo.Builder, "builder", bo.Builder,
+		"Which builder to use to produce images, one of: go, buildpacks (experimental). Defaults to go.")
+	cmd.Flags().StringVar(&bo.BuilderEndpoint, "builder-endpoint", bo.BuilderEndpoint,
+		"URL of a remote build service to build images with, instead of --builder.")
+	cmd.Flags().StringArrayVar(&bo.ImageAnnotations, "image-annotation", bo.ImageAnnotations,
+		"Annotation to set on the manifest of produced images, as key=value. May be repeated.")
+	cmd.Flags().StringVar(&bo.Platform, "platform", bo.Platform,
+		"Platform to build images for, as os/arch[/variant]. Defaults to the platform of the Docker daemon with --local, and of the base image otherwise.")
+	cmd.Flags().StringVar(&bo.CACert, "ca-cert", bo.CACert,
+		"Path to a bundle of CA certificates to trust when fetching modules during the build, e.g. behind a TLS-intercepting proxy.")
+	cmd.Flags().StringVar(&bo.TempDir, "temp-dir", os.Getenv("KO_TEMP_DIR"),
+		"Directory to write build output under while producing images. Defaults to $KO_TEMP_DIR, or the system temporary directory.")
+	cmd.Flags().StringVar(&bo.GoCache, "gocache", bo.GoCache,
+		"Directory to keep the go build cache in, e.g. one that CI preserves between runs. Defaults to go's GOCACHE.")
+	cmd.Flags().StringArrayVar(&bo.ExtraHosts, "extra-host", bo.ExtraHosts,
+		"Host to resolve to an IP address when go build fetches modules with git, as host=ip. May be repeated.")
+	cmd.Flags().StringVar(&bo.GoBinary, "go-binary", bo.GoBinary,
+		"Path or name of the go command to build with, e.g. a pinned toolchain's. Defaults to go on PATH.")
+	cmd.Flags().BoolVar(&bo.DiskCache, "disk-cache", bo.DiskCache,
+		"Whether to keep the layers of base images and built binaries in the user cache directory, e.g. ~/.cache/ko, for later invocations to reuse.")
+	cmd.Flags().StringVar(&bo.BuildLogDir, "build-log-dir", bo.BuildLogDir,
+		"Directory to write the output of go build to, in a file per import path, e.g. DIR/github.com/foo/bar.log.")
+	cmd.Flags().IntVar(&bo.BuildRetries, "build-retries", bo.BuildRetries,
+		"Number of times to retry go build when it fails to download modules, e.g. from a flaky GOPROXY. Compile errors aren't retried.")
+	cmd.Flags().StringArrayVar(&bo.PreBuildCommands, "pre-build-command", bo.PreBuildCommands,
+		"Shell command to run in the directory of each package before building it, e.g. \"go generate\", failing the build if it fails. May be repeated.")
+	cmd.Flags().BoolVar(&bo.Race, "race", bo.Race,
+		"Whether to build binaries with the race detector. This enables cgo, so the base image must provide a C library, e.g. gcr.io/distroless/base.")
+	cmd.Flags().BoolVar(&bo.ValidateBinaries, "validate-binaries", bo.ValidateBinaries,
+		"Whether to check that built binaries match the architecture of the image they are put in.")
+	cmd.Flags().StringVar(&bo.VerifyBase, "verify-base", bo.VerifyBase,
+		"Path to a PEM encoded ECDSA public key. Base images must have a cosign signature made with its private key.")
+	cmd.Flags().StringVar(&bo.VerifyBaseRoots, "verify-base-roots", bo.VerifyBaseRoots,
+		"Path to PEM encoded root certificates, e.g. Fulcio's. Base images must have a keyless cosign signature whose certificate they issued.")
+	cmd.Flags().StringVar(&bo.VerifyBaseIdentity, "verify-base-identity", bo.VerifyBaseIdentity,
+		"Email address or URI that the certificates of keyless signatures of base images must be issued for.")
+	cmd.Flags().StringVar(&bo.VerifyBaseRekorKey, "verify-base-rekor-key", bo.VerifyBaseRekorKey,
+		"Path to the PEM encoded public key of the transparency log that keyless signatures of base images must be logged in.")
+	cmd.Flags().StringVar(&bo.MaxImageSize, "max-image-size", bo.MaxImageSize,
+		"Size, e.g. 50MB or 1GiB, that the compressed layers of each image, including its base's, may add up to at most, failing the build otherwise.")
+	cmd.Flags().BoolVar(&bo.RequireLicense, "require-license", bo.RequireLicense,
+		"Whether to fail builds on base images without an org.opencontainers.image.licenses label or annotation.")
+	cmd.Flags().StringVar(&bo.StopSignal, "stop-signal", bo.StopSignal,
+		"Signal to set in the image config for stopping containers, e.g. SIGQUIT. Defaults to the base image's.")
+	cmd.Flags().StringVar(&bo.AppPath, "app-path", bo.AppPath,
+		"Absolute directory within the image that binaries are put in, and run from. Defaults to /ko-app.")
+	cmd.Flags().StringVar(&bo.KoDataEnvName, "kodata-env-name", bo.KoDataEnvName,
+		"Name of the environment variable that points at the kodata directory within the image. Defaults to KO_DATA_PATH.")
+	cmd.Flags().StringVar(&bo.ModMode, "mod", bo.ModMode,
+		"Module download mode to pass to go build as -mod: mod, vendor or readonly. Defaults to vendor for modules with a vendor directory.")
+	cmd.Flags().StringVar(&bo.BuildVCS, "buildvcs", bo.BuildVCS,
+		"Whether go build stamps binaries with version control information: true, false or auto, go's default. Set false when it fails, e.g. in shallow clones.")
+	cmd.Flags().BoolVar(&bo.DebugEntrypoint, "debug-entrypoint", bo.DebugEntrypoint,
+		"Whether to make a shell from the base image the entrypoint, for debugging. The app is at $KO_APP_PATH.")
+	cmd.Flags().StringArrayVar(&bo.DefaultArgs, "default-arg", bo.DefaultArgs,
+		"Argument to run the app with when the container doesn't set any, set as the image config's Cmd. May be repeated.")
+	cmd.Flags().StringArrayVar(&bo.Healthcheck, "healthcheck", bo.Healthcheck,
+		"Argument of the healthcheck command to set in the image config, run directly unless the first is CMD-SHELL or NONE. May be repeated.")
+	cmd.Flags().DurationVar(&bo.HealthcheckInterval, "healthcheck-interval", bo.HealthcheckInterval,
+		"Time between runs of the healthcheck. Defaults to the container runtime's.")
+	cmd.Flags().DurationVar(&bo.HealthcheckTimeout, "healthcheck-timeout", bo.HealthcheckTimeout,
+		"Time after which a run of the healthcheck is considered to have hung. Defaults to the container runtime's.")
+	cmd.Flags().IntVar(&bo.HealthcheckRetries, "healthcheck-retries", bo.HealthcheckRetries,
+		"Number of consecutive failures of the healthcheck after which the container is unhealthy. Defaults to the container runtime's.")
 }
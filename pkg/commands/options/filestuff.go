@@ -18,6 +18,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
@@ -28,6 +29,24 @@ type FilenameOptions struct {
 	Filenames []string
 	Recursive bool
 	Watch     bool
+	// PruneOnDelete deletes the resources from files deleted during --watch.
+	PruneOnDelete bool
+	// ResolveOnly holds globs of the files to resolve references in, or
+	// is empty to resolve them in all files.
+	ResolveOnly []string
+	// PassThrough passes the files that don't match ResolveOnly through
+	// unresolved, instead of leaving them out.  It is set by the commands
+	// that hand the files to kubectl.
+	PassThrough bool
+	// ConcurrentFiles is the maximum number of files to resolve at once,
+	// or 0 for no limit.
+	ConcurrentFiles int
+	// JsonnetImportPaths are searched for the files that .jsonnet inputs
+	// import.
+	JsonnetImportPaths []string
+	// JsonnetExtVars are the external variables of .jsonnet inputs, as
+	// KEY=VALUE, or KEY to take the value from the environment.
+	JsonnetExtVars []string
 }
 
 func AddFileArg(cmd *cobra.Command, fo *FilenameOptions) {
@@ -38,6 +57,49 @@ func AddFileArg(cmd *cobra.Command, fo *FilenameOptions) {
 		"Process the directory used in -f, --filename recursively. Useful when you want to manage related manifests organized within the same directory.")
 	cmd.Flags().BoolVarP(&fo.Watch, "watch", "W", fo.Watch,
 		"Continuously monitor the transitive dependencies of the passed yaml files, and redeploy whenever anything changes.")
+	cmd.Flags().IntVar(&fo.ConcurrentFiles, "concurrent-files", fo.ConcurrentFiles,
+		"The maximum number of files to resolve at once, or 0 for no limit. Their output keeps the order in which they are listed.")
+	cmd.Flags().StringArrayVar(&fo.JsonnetImportPaths, "jsonnet-jpath", fo.JsonnetImportPaths,
+		"Directory to search for the files that .jsonnet inputs import. May be repeated. Only .jsonnet files passed to -f by name are evaluated, and --watch doesn't watch what they import.")
+	cmd.Flags().StringArrayVar(&fo.JsonnetExtVars, "jsonnet-ext-str", fo.JsonnetExtVars,
+		"External variable of .jsonnet inputs, as KEY=VALUE, or KEY to take its value from the environment. May be repeated.")
+	cmd.Flags().StringArrayVar(&fo.ResolveOnly, "resolve-only", fo.ResolveOnly,
+		"Glob of the files to resolve references in, matched against their path or their path relative to the -f directory, e.g. apps/*.yaml. Other files are applied as-is, and left out by resolve. May be repeated.")
+}
+
+// ShouldResolve reports whether references should be resolved in the file f,
+// which is the case if it matches any of the ResolveOnly globs, either as
+// enumerated or relative to the -f directory it was enumerated from.
+func ShouldResolve(fo *FilenameOptions, f string) bool {
+	if len(fo.ResolveOnly) == 0 {
+		return true
+	}
+	candidates := []string{f}
+	for _, root := range fo.Filenames {
+		if rel, err := filepath.Rel(root, f); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+			candidates = append(candidates, rel)
+		}
+	}
+	for _, pattern := range fo.ResolveOnly {
+		for _, c := range candidates {
+			if ok, _ := filepath.Match(pattern, c); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddPruneArg registers --prune-on-delete, for commands that apply the
+// resolved files.
+func AddPruneArg(cmd *cobra.Command, fo *FilenameOptions) {
+	cmd.Flags().BoolVar(&fo.PruneOnDelete, "prune-on-delete", fo.PruneOnDelete,
+		"With --watch, delete the resources from yaml files when they are deleted.")
+}
+
+// IsURL reports whether the filename passed to -f is an http(s) URL.
+func IsURL(filename string) bool {
+	return strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://")
 }
 
 // Based heavily on pkg/kubectl
@@ -58,12 +120,23 @@ func EnumerateFiles(fo *FilenameOptions) chan string {
 			}
 			defer watcher.Close()
 		}
+		// The files we were passed, which are watched as they're named.
+		explicit := make(map[string]bool, len(fo.Filenames))
+		for _, paths := range fo.Filenames {
+			explicit[paths] = true
+		}
 		for _, paths := range fo.Filenames {
 			// Just pass through '-' as it is indicative of stdin.
 			if paths == "-" {
 				files <- paths
 				continue
 			}
+			// Pass through URLs too, they are fetched when they're resolved.
+			// There is nothing to watch for them.
+			if IsURL(paths) {
+				files <- paths
+				continue
+			}
 			// For each of the "filenames" we are passed (file or directory) start a
 			// "Walk" to enumerate all of the contained files recursively.
 			err := filepath.Walk(paths, func(path string, fi os.FileInfo, err error) error {
@@ -88,6 +161,9 @@ func EnumerateFiles(fo *FilenameOptions) chan string {
 
 				// Don't check extension if the filepath was passed explicitly
 				if path != paths {
+					// .jsonnet files are only evaluated when they're
+					// passed explicitly, as directories may hold
+					// libraries that aren't meant to be evaluated alone.
 					switch filepath.Ext(path) {
 					case ".json", ".yaml":
 						// Process these.
@@ -122,6 +198,10 @@ func EnumerateFiles(fo *FilenameOptions) chan string {
 					switch filepath.Ext(event.Name) {
 					case ".json", ".yaml":
 						files <- event.Name
+					case ".jsonnet":
+						if explicit[event.Name] {
+							files <- event.Name
+						}
 					}
 				case err := <-watcher.Errors:
 					log.Fatalf("Error watching: %v", err)
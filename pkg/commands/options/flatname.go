@@ -17,8 +17,12 @@ package options
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/ko/pkg/publish"
 	"github.com/spf13/cobra"
 )
@@ -29,34 +33,93 @@ type NameOptions struct {
 	PreserveImportPaths bool
 	// BaseImportPaths uses the base path without MD5 hash after KO_DOCKER_REPO.
 	BaseImportPaths bool
+	// NamingRules name the import paths they match, taking precedence over
+	// the other options.  The first rule that matches is used.
+	NamingRules []NamingRule
+	// RepoTemplate names import paths that no rule matches, taking
+	// precedence over the options that remain.
+	RepoTemplate *RepoTemplate
+}
+
+// NamingRule names the import paths that Match matches with Replace, which
+// is expanded like the replacement of regexp.Regexp.ReplaceAllString, e.g.
+// "myrepo/$1".
+type NamingRule struct {
+	Match   *regexp.Regexp
+	Replace string
+}
+
+// NewNamingRule returns the rule naming import paths that the regular
+// expression match matches with replace.  As we can't know the import paths
+// it will be given, replace is checked to produce a valid repository name
+// when each of the expression's groups captures a valid path component.
+func NewNamingRule(match, replace string) (NamingRule, error) {
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return NamingRule{}, fmt.Errorf("naming rule %q: %v", match, err)
+	}
+	// Expand replace as if the match and each group had captured "x".
+	groups := make([]int, 0, 2*(re.NumSubexp()+1))
+	for i := 0; i <= re.NumSubexp(); i++ {
+		groups = append(groups, 0, 1)
+	}
+	sample := string(re.ExpandString(nil, replace, "x", groups))
+	if sample == "" {
+		return NamingRule{}, fmt.Errorf("naming rule %q: replacement %q is empty", match, replace)
+	}
+	if _, err := name.NewRepository("ko.local/" + strings.ToLower(sample)); err != nil {
+		return NamingRule{}, fmt.Errorf("naming rule %q: replacement %q doesn't produce a valid repository name: %v", match, replace, err)
+	}
+	return NamingRule{Match: re, Replace: replace}, nil
 }
 
 func AddNamingArgs(cmd *cobra.Command, no *NameOptions) {
 	cmd.Flags().BoolVarP(&no.PreserveImportPaths, "preserve-import-paths", "P", no.PreserveImportPaths,
-		"Whether to preserve the full import path after KO_DOCKER_REPO.")
+		"Whether to preserve the full import path after KO_DOCKER_REPO, lowercased as registries require.")
 	cmd.Flags().BoolVarP(&no.BaseImportPaths, "base-import-paths", "B", no.BaseImportPaths,
 		"Whether to use the base path without MD5 hash after KO_DOCKER_REPO.")
+	cmd.Flags().Var(repoTemplateFlag{&no.RepoTemplate}, "repo-template",
+		"Template of the repository to publish each import path to after KO_DOCKER_REPO, e.g. '{env.TEAM}/{basename}', "+
+			"with the variables {importpath}, {basename}, {hash} (of the import path) and {env.NAME} (the environment variable NAME).")
 }
 
 func packageWithMD5(importpath string) string {
 	hasher := md5.New()
 	hasher.Write([]byte(importpath))
-	return filepath.Base(importpath) + "-" + hex.EncodeToString(hasher.Sum(nil))
+	return strings.ToLower(filepath.Base(importpath)) + "-" + hex.EncodeToString(hasher.Sum(nil))
 }
 
 func preserveImportPath(importpath string) string {
-	return importpath
+	return strings.ToLower(importpath)
 }
 
 func baseImportPaths(importpath string) string {
-	return filepath.Base(importpath)
+	return strings.ToLower(filepath.Base(importpath))
 }
 
+// MakeNamer returns the namer that no chooses.  Repository names must be
+// lowercase, but import paths needn't be, so each of our namers lowercases
+// what it takes from the import path.  Import paths that differ only in case
+// therefore share a name.
 func MakeNamer(no *NameOptions) publish.Namer {
-	if no.PreserveImportPaths {
-		return preserveImportPath
+	namer := packageWithMD5
+	if no.RepoTemplate != nil {
+		namer = no.RepoTemplate.Name
+	} else if no.PreserveImportPaths {
+		namer = preserveImportPath
 	} else if no.BaseImportPaths {
-		return baseImportPaths
+		namer = baseImportPaths
+	}
+	if len(no.NamingRules) == 0 {
+		return namer
+	}
+	rules := no.NamingRules
+	return func(importpath string) string {
+		for _, rule := range rules {
+			if rule.Match.MatchString(importpath) {
+				return strings.ToLower(rule.Match.ReplaceAllString(importpath, rule.Replace))
+			}
+		}
+		return namer(importpath)
 	}
-	return packageWithMD5
 }
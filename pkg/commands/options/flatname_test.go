@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestMakeNamer(t *testing.T) {
+	for _, test := range []struct {
+		desc       string
+		no         *NameOptions
+		importpath string
+		want       string
+	}{{
+		desc:       "preserve lowercase",
+		no:         &NameOptions{PreserveImportPaths: true},
+		importpath: "github.com/my-org/repo/cmd/foo",
+		want:       "github.com/my-org/repo/cmd/foo",
+	}, {
+		desc:       "preserve mixed case",
+		no:         &NameOptions{PreserveImportPaths: true},
+		importpath: "github.com/MyOrg/Repo/cmd/Foo",
+		want:       "github.com/myorg/repo/cmd/foo",
+	}, {
+		desc:       "base mixed case",
+		no:         &NameOptions{BaseImportPaths: true},
+		importpath: "github.com/MyOrg/Repo/cmd/Foo",
+		want:       "foo",
+	}, {
+		desc:       "md5 mixed case",
+		no:         &NameOptions{},
+		importpath: "github.com/MyOrg/Repo/cmd/Foo",
+		want:       "foo-" + md5Hex("github.com/MyOrg/Repo/cmd/Foo"),
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := MakeNamer(test.no)(test.importpath)
+			if got != test.want {
+				t.Errorf("MakeNamer(%+v)(%q) = %q, want %q", test.no, test.importpath, got, test.want)
+			}
+			// Whatever the namer produces must be usable as a repository.
+			if _, err := name.NewRepository(fmt.Sprintf("gcr.io/project/%s", got)); err != nil {
+				t.Errorf("NewRepository(%q) = %v", got, err)
+			}
+		})
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMakeNamerRules(t *testing.T) {
+	var rules []NamingRule
+	for _, r := range []struct{ match, replace string }{
+		{`^github.com/org/(.*)$`, "myrepo/$1"},
+		{`^example.com/(?P<team>[^/]+)/cmd/([^/]+)$`, "${team}/$2"},
+		{`^github.com/org/special$`, "never-used"},
+	} {
+		rule, err := NewNamingRule(r.match, r.replace)
+		if err != nil {
+			t.Fatalf("NewNamingRule(%q, %q) = %v", r.match, r.replace, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, test := range []struct {
+		desc       string
+		no         *NameOptions
+		importpath string
+		want       string
+	}{{
+		desc:       "first rule",
+		no:         &NameOptions{NamingRules: rules},
+		importpath: "github.com/org/repo/cmd/foo",
+		want:       "myrepo/repo/cmd/foo",
+	}, {
+		desc:       "named group",
+		no:         &NameOptions{NamingRules: rules},
+		importpath: "example.com/payments/cmd/ledger",
+		want:       "payments/ledger",
+	}, {
+		desc:       "first match wins",
+		no:         &NameOptions{NamingRules: rules},
+		importpath: "github.com/org/special",
+		want:       "myrepo/special",
+	}, {
+		desc:       "lowercased",
+		no:         &NameOptions{NamingRules: rules},
+		importpath: "github.com/org/Repo/cmd/Foo",
+		want:       "myrepo/repo/cmd/foo",
+	}, {
+		desc:       "no match",
+		no:         &NameOptions{NamingRules: rules},
+		importpath: "example.com/payments/pkg/ledger",
+		want:       "ledger-" + md5Hex("example.com/payments/pkg/ledger"),
+	}, {
+		desc:       "no match preserved",
+		no:         &NameOptions{NamingRules: rules, PreserveImportPaths: true},
+		importpath: "example.com/payments/pkg/ledger",
+		want:       "example.com/payments/pkg/ledger",
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := MakeNamer(test.no)(test.importpath)
+			if got != test.want {
+				t.Errorf("MakeNamer()(%q) = %q, want %q", test.importpath, got, test.want)
+			}
+			if _, err := name.NewRepository(fmt.Sprintf("gcr.io/project/%s", got)); err != nil {
+				t.Errorf("NewRepository(%q) = %v", got, err)
+			}
+		})
+	}
+}
+
+func TestNewNamingRuleInvalid(t *testing.T) {
+	for _, test := range []struct {
+		desc, match, replace string
+	}{
+		{"bad expression", `^github.com/org/(.*$`, "myrepo/$1"},
+		{"empty replacement", `^github.com/org/(.*)$`, ""},
+		{"illegal characters", `^github.com/org/(.*)$`, "my repo/$1"},
+		{"tag in replacement", `^github.com/org/(.*)$`, "myrepo/$1:latest"},
+	} {
+		if _, err := NewNamingRule(test.match, test.replace); err == nil {
+			t.Errorf("%s: NewNamingRule(%q, %q) = nil, want error", test.desc, test.match, test.replace)
+		}
+	}
+}
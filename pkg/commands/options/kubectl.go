@@ -0,0 +1,30 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// KubectlOptions holds options for how ko runs kubectl.
+type KubectlOptions struct {
+	// Print writes the kubectl command line to stderr before running it.
+	Print bool
+}
+
+func AddKubectlArgs(cmd *cobra.Command, ko *KubectlOptions) {
+	cmd.Flags().BoolVar(&ko.Print, "print-kubectl", ko.Print,
+		"Whether to print the kubectl command that is run, including the flags passed through to it, to stderr.")
+}
@@ -21,13 +21,51 @@ import (
 // LocalOptions represents options for the ko binary.
 type LocalOptions struct {
 	// Local publishes images to a local docker daemon.
-	Local            bool
+	Local bool
+	// InsecureRegistry uses the registry images are published to over
+	// plain http, both when pushing and when pulling base images from it.
 	InsecureRegistry bool
+	// PushChunkSize uploads layers in chunks of this many bytes, if non-zero.
+	PushChunkSize int64
+	// Provenance publishes a SLSA provenance attestation of each image.
+	Provenance bool
+	// Push publishes images; when unset, images are only built, and
+	// references are resolved to the digests they would be published as.
+	Push bool
+	// AlsoLocal also loads images published to a registry into the local
+	// docker daemon.
+	AlsoLocal bool
+	// ScanCommand is a shell command run over each published image, which
+	// fails the publish if it fails, unless ContinueOnError is set.
+	ScanCommand     string
+	ContinueOnError bool
+	// DigestFile is the path to write the digest of each published image
+	// to, in which {name} is replaced with the image's import path.
+	DigestFile string
+	// CloudKeychain authenticates to the registries of cloud providers with
+	// their credentials, without a docker login.
+	CloudKeychain bool
 }
 
 func AddLocalArg(cmd *cobra.Command, lo *LocalOptions) {
 	cmd.Flags().BoolVarP(&lo.Local, "local", "L", lo.Local,
 		"Whether to publish images to a local docker daemon vs. a registry.")
 	cmd.Flags().BoolVar(&lo.InsecureRegistry, "insecure-registry", lo.InsecureRegistry,
-		"Whether to skip TLS verification on the registry")
+		"Whether the registry images are published to is insecure, and is used over plain http, both to push images and to pull base images from it.")
+	cmd.Flags().Int64Var(&lo.PushChunkSize, "push-chunk-size", lo.PushChunkSize,
+		"Upload layers to the registry in chunks of at most this many bytes, resuming failed chunks (0 uploads each layer in one request).")
+	cmd.Flags().BoolVar(&lo.Provenance, "provenance", lo.Provenance,
+		"Whether to publish a SLSA provenance attestation of each image, tagged sha256-<digest>.att.")
+	cmd.Flags().BoolVar(&lo.Push, "push", lo.Push,
+		"Whether to publish images. With --push=false, images are built and references resolved to the digests they would be published as.")
+	cmd.Flags().BoolVar(&lo.AlsoLocal, "also-local", lo.AlsoLocal,
+		"Whether to also load images published to a registry into the local docker daemon. References still resolve to the registry.")
+	cmd.Flags().StringVar(&lo.ScanCommand, "scan-command", lo.ScanCommand,
+		"Shell command to scan each published image with, e.g. 'trivy image --exit-code 1 \"$KO_IMAGE\"'. The image's reference, digest and import path are in $KO_IMAGE, $KO_DIGEST and $KO_IMPORT_PATH. Fails if the command does, unless --continue-on-error. Ignored with --push=false.")
+	cmd.Flags().BoolVar(&lo.ContinueOnError, "continue-on-error", lo.ContinueOnError,
+		"Whether to only warn when --scan-command fails, instead of failing.")
+	cmd.Flags().StringVar(&lo.DigestFile, "digest-file", lo.DigestFile,
+		"Path to write the repo@sha256:... reference of each published image to, e.g. for signing it, in which {name} is replaced with its import path, e.g. digests/{name}.digest.")
+	cmd.Flags().BoolVar(&lo.CloudKeychain, "cloud-keychain", lo.CloudKeychain,
+		"Whether to authenticate to GCR with application default credentials or gcloud's, and to Artifact Registry, ECR and ACR with docker-credential-gcloud, docker-credential-ecr-login and docker-credential-acr-env, without a docker login.")
 }
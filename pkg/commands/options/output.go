@@ -0,0 +1,71 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// OutputOptions holds options that control where resolved files are written.
+type OutputOptions struct {
+	// OutputDir mirrors each resolved input file under this directory
+	// instead of writing them all to a single stream.
+	OutputDir string
+	// Summary is the file to write a JSON summary of the builds to, or "-"
+	// for stderr.
+	Summary string
+	// KustomizeImages writes a kustomization images fragment overriding the
+	// resolved references, instead of the resolved files.
+	KustomizeImages bool
+	// Validate checks the resolved files against the Kubernetes schemas
+	// before writing them.
+	Validate bool
+	// Merge merges the documents describing the same resource across the
+	// input files, later ones overriding earlier ones.
+	Merge bool
+	// Gzip compresses what is written to stdout with gzip.
+	Gzip bool
+	// SortByKind sorts the resolved documents by kind, e.g. Namespaces
+	// first, before their apply order.
+	SortByKind bool
+	// ShowChanges writes the values that resolution changed, instead of the
+	// resolved files.
+	ShowChanges bool
+}
+
+func AddOutputArgs(cmd *cobra.Command, oo *OutputOptions) {
+	cmd.Flags().StringVar(&oo.OutputDir, "output-dir", oo.OutputDir,
+		"Directory to which each resolved file is written, mirroring the structure of the input files, instead of stdout.")
+	cmd.Flags().BoolVar(&oo.KustomizeImages, "kustomize-images", oo.KustomizeImages,
+		"Whether to write a kustomization fragment whose images transformer overrides each resolved reference, instead of the resolved files.")
+	cmd.Flags().BoolVar(&oo.Validate, "validate", oo.Validate,
+		"Whether to validate the resolved files against the Kubernetes schemas with kubeconform, failing on invalid manifests.")
+	cmd.Flags().BoolVar(&oo.Merge, "merge", oo.Merge,
+		"Whether to merge the documents describing the same resource (by apiVersion, kind, namespace and name) across the input files, later files overriding earlier ones.")
+	cmd.Flags().BoolVar(&oo.SortByKind, "sort-by-kind", oo.SortByKind,
+		"Whether to sort the resolved documents by kind, in the order Helm installs them, e.g. Namespaces, then CustomResourceDefinitions, then Deployments. ko.build/apply-order annotations still take precedence. With --watch, only the documents within each file are sorted.")
+	cmd.Flags().BoolVar(&oo.ShowChanges, "show-changes", oo.ShowChanges,
+		"Whether to write a line of the form \"file: kind/name: path: old -> new\" for each value that resolution changed, instead of the resolved files.")
+	cmd.Flags().BoolVar(&oo.Gzip, "gzip", oo.Gzip,
+		"Whether to compress the resolved files written to stdout with gzip, flushing after each document.")
+	AddSummaryArg(cmd, oo)
+}
+
+// AddSummaryArg registers only the --summary flag, for commands that stream
+// the resolved files to kubectl.
+func AddSummaryArg(cmd *cobra.Command, oo *OutputOptions) {
+	cmd.Flags().StringVar(&oo.Summary, "summary", oo.Summary,
+		"File to write a JSON summary of the built images to once all files are resolved, or - for stderr.")
+}
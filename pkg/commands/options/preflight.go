@@ -0,0 +1,30 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// PreflightOptions holds options for checking the cluster before building.
+type PreflightOptions struct {
+	// Preflight checks that the cluster is reachable before building.
+	Preflight bool
+}
+
+func AddPreflightArg(cmd *cobra.Command, po *PreflightOptions) {
+	cmd.Flags().BoolVar(&po.Preflight, "preflight", true,
+		"Whether to check that the cluster is reachable with 'kubectl cluster-info' before building, to fail fast.")
+}
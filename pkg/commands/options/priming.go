@@ -0,0 +1,31 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// PrimingOptions holds options for priming the stream of yaml piped to kubectl.
+type PrimingOptions struct {
+	// Separators is the number of empty documents to write before the
+	// resolved yaml, or negative to choose based on the kubectl version.
+	Separators int
+}
+
+func AddPrimingArg(cmd *cobra.Command, po *PrimingOptions) {
+	cmd.Flags().IntVar(&po.Separators, "priming-separators", -1,
+		"Number of empty yaml documents to write to kubectl before the resolved yaml, so that it doesn't wait on its input buffer. Negative chooses based on the kubectl version.")
+}
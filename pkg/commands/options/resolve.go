@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ResolveOptions holds options that control how references are resolved.
+type ResolveOptions struct {
+	// Embedded resolves references within string values holding yaml documents.
+	Embedded bool
+	// Interpolated resolves ${ko://...} references within larger strings.
+	Interpolated bool
+	// FilepathRefs replaces file:// references with the digest of the file.
+	FilepathRefs bool
+	// ChangedSince is a git ref; import paths unchanged since it reuse the
+	// image recorded for them in PreviousDigests instead of being rebuilt.
+	ChangedSince string
+	// PreviousDigests is a yaml file mapping import paths to the images
+	// they were previously published as.
+	PreviousDigests string
+	// PullPolicy is set as the imagePullPolicy of containers whose image
+	// references are resolved.
+	PullPolicy string
+	// Namespace is set as the namespace of every namespaced resource.
+	Namespace string
+	// ContextNamespace sets the namespace of the current kubeconfig context
+	// on every namespaced resource that doesn't have one.
+	ContextNamespace bool
+	// Paths limits resolution to the nodes at these JSONPath-like paths.
+	Paths []string
+	// Fields limits resolution to image fields, and optionally env values.
+	Fields string
+	// WriteLock is a file to record the image each import path resolved to
+	// in, in the format of PreviousDigests.
+	WriteLock string
+	// ReadLock is a file written by WriteLock, whose images are used for
+	// the import paths it records instead of building them.
+	ReadLock string
+}
+
+func AddResolveArgs(cmd *cobra.Command, ro *ResolveOptions) {
+	cmd.Flags().BoolVar(&ro.Embedded, "resolve-embedded", ro.Embedded,
+		"Whether to also resolve references within multi-line string values that hold yaml documents (e.g. ConfigMap data).")
+	cmd.Flags().BoolVar(&ro.Interpolated, "resolve-interpolated", ro.Interpolated,
+		"Whether to also resolve references written as ${ko://...} within larger string values.")
+	cmd.Flags().BoolVar(&ro.FilepathRefs, "resolve-filepath-refs", ro.FilepathRefs,
+		"Whether to replace file:// references with the sha256 digest of the named file's contents.")
+	cmd.Flags().StringVar(&ro.ChangedSince, "changed-since", ro.ChangedSince,
+		"Only build import paths whose sources changed since this git ref, reusing the images in --previous-digests for the rest.")
+	cmd.Flags().StringVar(&ro.PreviousDigests, "previous-digests", ro.PreviousDigests,
+		"Yaml file mapping import paths to previously published images, for use with --changed-since.")
+	cmd.Flags().StringVar(&ro.PullPolicy, "set-pull-policy", ro.PullPolicy,
+		"imagePullPolicy to set on containers whose image references are resolved, e.g. IfNotPresent. Other containers are left alone.")
+	cmd.Flags().StringVar(&ro.Namespace, "set-namespace", ro.Namespace,
+		"Namespace to set on every namespaced resource, replacing any they have. Cluster-scoped resources are left alone.")
+	cmd.Flags().BoolVar(&ro.ContextNamespace, "set-context-namespace", ro.ContextNamespace,
+		"Whether to set the namespace of the current kubeconfig context on every namespaced resource that doesn't have one, as kubectl apply would. Cluster-scoped resources are left alone.")
+	cmd.Flags().StringArrayVar(&ro.Paths, "resolve-path", ro.Paths,
+		"Only resolve references at this path within each document, e.g. spec.template.spec.containers[*].image. May be repeated.")
+	cmd.Flags().StringVar(&ro.Fields, "resolve-fields", ro.Fields,
+		"Fields to resolve references within: all, image for fields named image or ending in Image, or image+env to also resolve the values of containers' env. Defaults to all.")
+	cmd.Flags().StringVar(&ro.WriteLock, "write-lock", ro.WriteLock,
+		"File to record the image each import path resolved to in, once all files are resolved, for use with --read-lock.")
+	cmd.Flags().StringVar(&ro.ReadLock, "read-lock", ro.ReadLock,
+		"File written by --write-lock whose images are used for the import paths it records, instead of building them.")
+}
@@ -19,11 +19,15 @@ import (
 )
 
 // SelectorOptions allows selecting objects from the input manifests by label
+// and by annotation
 type SelectorOptions struct {
-	Selector string
+	Selector           string
+	AnnotationSelector string
 }
 
 func AddSelectorArg(cmd *cobra.Command, so *SelectorOptions) {
 	cmd.Flags().StringVarP(&so.Selector, "selector", "l", "",
 		"Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringVar(&so.AnnotationSelector, "annotation-selector", "",
+		"Selector (annotation query) to filter on, with the same syntax as --selector, but taking any values without commas, e.g. URLs.(e.g. --annotation-selector 'team in (web,db)')")
 }
@@ -21,9 +21,13 @@ import (
 // TagsOptions holds the list of tags to tag the built image
 type TagsOptions struct {
 	Tags []string
+	// TagScheme adds a tag derived from each image, e.g. "digest12".
+	TagScheme string
 }
 
 func AddTagsArg(cmd *cobra.Command, ta *TagsOptions) {
 	cmd.Flags().StringSliceVarP(&ta.Tags, "tags", "t", []string{"latest"},
-		"Which tags to use for the produced image instead of the default 'latest' tag.")
+		"Which tags to use for the produced image instead of the default 'latest' tag. {{.SourceHash}} in a tag expands to a hash of the image's source, e.g. src-{{.SourceHash}}.")
+	cmd.Flags().StringVar(&ta.TagScheme, "tag-scheme", ta.TagScheme,
+		"Scheme of a tag derived from each image to add to --tags. The only scheme is digest12, the first 12 hex characters of the image's digest.")
 }
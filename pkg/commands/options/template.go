@@ -0,0 +1,136 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// templateVarRE matches the variables of a RepoTemplate.
+var templateVarRE = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// envVarPrefix prefixes the variables of a RepoTemplate that are read from
+// the environment, e.g. {env.TEAM}.
+const envVarPrefix = "env."
+
+// RepoTemplate names import paths by expanding a template of the repository
+// to publish them to under KO_DOCKER_REPO, e.g. "{env.TEAM}/{basename}".
+// {importpath} expands to the import path, {basename} to its last element,
+// {hash} to its MD5 hash, as in the default names, and {env.NAME} to the
+// value of the environment variable NAME.
+type RepoTemplate struct {
+	template string
+	// expanded is the template with the environment variables expanded,
+	// which is all that is left to do once we have an import path.
+	expanded string
+}
+
+// NewRepoTemplate parses template, expanding the environment variables that
+// it refers to, which must be set.  As we can't know the import paths it will
+// be given, it is checked to produce a valid repository name for a sample.
+func NewRepoTemplate(template string) (*RepoTemplate, error) {
+	return newRepoTemplate(template, os.LookupEnv)
+}
+
+func newRepoTemplate(template string, lookupEnv func(string) (string, bool)) (*RepoTemplate, error) {
+	var err error
+	expanded := templateVarRE.ReplaceAllStringFunc(template, func(v string) string {
+		key := v[1 : len(v)-1]
+		switch {
+		case key == "importpath" || key == "basename" || key == "hash":
+			// Expanded for each import path.
+			return v
+		case strings.HasPrefix(key, envVarPrefix):
+			env := strings.TrimPrefix(key, envVarPrefix)
+			value, ok := lookupEnv(env)
+			if !ok || value == "" {
+				if err == nil {
+					err = fmt.Errorf("repo template %q: environment variable %s is not set", template, env)
+				}
+				return v
+			}
+			return value
+		default:
+			if err == nil {
+				err = fmt.Errorf("repo template %q: unknown variable %s", template, v)
+			}
+			return v
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rest := templateVarRE.ReplaceAllString(expanded, ""); strings.ContainsAny(rest, "{}") {
+		return nil, fmt.Errorf("repo template %q: unbalanced braces", template)
+	}
+
+	t := &RepoTemplate{template: template, expanded: expanded}
+	sample := t.Name("example.com/org/repo/cmd/app")
+	if sample == "" {
+		return nil, fmt.Errorf("repo template %q is empty", template)
+	}
+	if _, err := name.NewRepository("ko.local/" + sample); err != nil {
+		return nil, fmt.Errorf("repo template %q doesn't produce a valid repository name: %v", template, err)
+	}
+	return t, nil
+}
+
+// Name returns the name of the repository to publish importpath to.
+func (t *RepoTemplate) Name(importpath string) string {
+	hash := md5.Sum([]byte(importpath))
+	return strings.ToLower(strings.NewReplacer(
+		"{importpath}", importpath,
+		"{basename}", filepath.Base(importpath),
+		"{hash}", hex.EncodeToString(hash[:]),
+	).Replace(t.expanded))
+}
+
+// String returns the template t was parsed from.
+func (t *RepoTemplate) String() string {
+	return t.template
+}
+
+// repoTemplateFlag is a flag that parses its value into a RepoTemplate.
+type repoTemplateFlag struct {
+	t **RepoTemplate
+}
+
+func (f repoTemplateFlag) String() string {
+	if *f.t == nil {
+		return ""
+	}
+	return (*f.t).String()
+}
+
+func (f repoTemplateFlag) Set(s string) error {
+	t, err := NewRepoTemplate(s)
+	if err != nil {
+		return err
+	}
+	*f.t = t
+	return nil
+}
+
+func (repoTemplateFlag) Type() string {
+	return "string"
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+func fakeEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestRepoTemplate(t *testing.T) {
+	env := fakeEnv(map[string]string{"ENV": "Staging", "TEAM": "payments"})
+	importpath := "github.com/MyOrg/Repo/cmd/Ledger"
+	for _, test := range []struct {
+		template string
+		want     string
+	}{
+		{"{basename}", "ledger"},
+		{"{importpath}", "github.com/myorg/repo/cmd/ledger"},
+		{"{env.ENV}/{env.TEAM}/{basename}", "staging/payments/ledger"},
+		{"{env.TEAM}/{basename}-{hash}", "payments/ledger-" + md5Hex(importpath)},
+		{"apps/{basename}", "apps/ledger"},
+	} {
+		t.Run(test.template, func(t *testing.T) {
+			rt, err := newRepoTemplate(test.template, env)
+			if err != nil {
+				t.Fatalf("newRepoTemplate(%q) = %v", test.template, err)
+			}
+			got := MakeNamer(&NameOptions{RepoTemplate: rt})(importpath)
+			if got != test.want {
+				t.Errorf("MakeNamer()(%q) = %q, want %q", importpath, got, test.want)
+			}
+			if _, err := name.NewRepository(fmt.Sprintf("gcr.io/project/%s", got)); err != nil {
+				t.Errorf("NewRepository(%q) = %v", got, err)
+			}
+		})
+	}
+}
+
+func TestRepoTemplateInvalid(t *testing.T) {
+	env := fakeEnv(map[string]string{"TEAM": "payments", "EMPTY": "", "SPACEY": "my team"})
+	for _, test := range []struct {
+		desc, template string
+	}{
+		{"missing environment variable", "{env.ENV}/{basename}"},
+		{"empty environment variable", "{env.EMPTY}/{basename}"},
+		{"unknown variable", "{team}/{basename}"},
+		{"unbalanced braces", "{env.TEAM}/{basename"},
+		{"empty", ""},
+		{"invalid result", "{env.SPACEY}/{basename}"},
+		{"tag in result", "{basename}:latest"},
+	} {
+		if _, err := newRepoTemplate(test.template, env); err == nil {
+			t.Errorf("%s: newRepoTemplate(%q) = nil, want error", test.desc, test.template)
+		}
+	}
+}
+
+func TestRepoTemplateFlag(t *testing.T) {
+	no := &NameOptions{}
+	cmd := &cobra.Command{}
+	AddNamingArgs(cmd, no)
+	if err := cmd.Flags().Parse([]string{"--repo-template", "apps/{basename}"}); err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	if got, want := MakeNamer(no)("github.com/foo/bar"), "apps/bar"; got != want {
+		t.Errorf("MakeNamer()() = %q, want %q", got, want)
+	}
+	if err := cmd.Flags().Parse([]string{"--repo-template", "{nope}"}); err == nil {
+		t.Error("Parse() with an invalid template = nil, want error")
+	}
+}
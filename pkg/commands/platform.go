@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/client"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// parsePlatform parses a platform of the form os/arch[/variant].
+func parsePlatform(s string) (*v1.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("platform %q is not of the form os/arch[/variant]", s)
+	}
+	p := &v1.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// daemonPlatform returns the platform of the local Docker daemon.
+func daemonPlatform() (*v1.Platform, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+	cli.NegotiateAPIVersion(context.Background())
+	v, err := cli.ServerVersion(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Platform{
+		OS:           v.Os,
+		Architecture: v.Arch,
+	}, nil
+}
+
+// targetPlatform returns the platform to build images for, or nil if it
+// should be determined by the base image.
+func targetPlatform(bo *options.BuildOptions, lo *options.LocalOptions) (*v1.Platform, error) {
+	if bo.Platform != "" {
+		return parsePlatform(bo.Platform)
+	}
+	// Images loaded into the daemon should be able to run there.
+	if lo.Local || isLocalDockerRepo() {
+		p, err := daemonPlatform()
+		if err != nil {
+			log.Printf("Unable to determine the platform of the Docker daemon, falling back to %s/%s: %v", runtime.GOOS, runtime.GOARCH, err)
+			return &v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}, nil
+		}
+		return p, nil
+	}
+	return nil, nil
+}
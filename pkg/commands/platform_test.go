@@ -0,0 +1,86 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+func TestParsePlatform(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  *v1.Platform
+	}{{
+		input: "linux/amd64",
+		want:  &v1.Platform{OS: "linux", Architecture: "amd64"},
+	}, {
+		input: "linux/arm/v7",
+		want:  &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	}} {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := parsePlatform(test.input)
+			if err != nil {
+				t.Fatalf("parsePlatform(%q) = %v", test.input, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parsePlatform(%q); (-want +got) = %v", test.input, diff)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "linux", "/amd64", "linux/", "linux/arm/v7/extra"} {
+		t.Run(input, func(t *testing.T) {
+			if got, err := parsePlatform(input); err == nil {
+				t.Errorf("parsePlatform(%q) = %v, want error", input, got)
+			}
+		})
+	}
+}
+
+func TestTargetPlatformWithoutDaemon(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Point the Docker client at a socket that nothing listens on.
+	old, ok := os.LookupEnv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", "unix://"+filepath.Join(tmp, "docker.sock"))
+	defer func() {
+		if ok {
+			os.Setenv("DOCKER_HOST", old)
+		} else {
+			os.Unsetenv("DOCKER_HOST")
+		}
+	}()
+
+	got, err := targetPlatform(&options.BuildOptions{}, &options.LocalOptions{Local: true})
+	if err != nil {
+		t.Fatalf("targetPlatform() = %v", err)
+	}
+	want := &v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("targetPlatform(); (-want +got) = %v", diff)
+	}
+}
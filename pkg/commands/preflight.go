@@ -0,0 +1,39 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// preflightCommand creates the kubectl command run by checkCluster.  It is a
+// variable so that tests can stand in for kubectl.
+var preflightCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("kubectl", args...)
+}
+
+// checkCluster checks that the cluster selected by kubectlFlags is reachable,
+// so that we fail fast rather than after building everything.
+func checkCluster(kubectlFlags []string) error {
+	argv := []string{"cluster-info", "--request-timeout=10s"}
+	argv = append(argv, kubectlFlags...)
+	if output, err := preflightCommand(argv...).CombinedOutput(); err != nil {
+		return fmt.Errorf("the cluster is unreachable, 'kubectl cluster-info' failed: %v\n%s\n(pass --preflight=false to skip this check)",
+			err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestPreflightKubectl isn't a real test, but stands in for kubectl when run
+// by fakeKubectl.  It fails unless KO_TEST_REACHABLE is set.
+func TestPreflightKubectl(t *testing.T) {
+	if os.Getenv("KO_TEST_KUBECTL") != "1" {
+		return
+	}
+	if os.Getenv("KO_TEST_REACHABLE") != "1" {
+		fmt.Fprintln(os.Stderr, "The connection to the server localhost:8080 was refused")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// fakeKubectl returns a preflightCommand that runs TestPreflightKubectl, and
+// records the arguments it was passed in args.
+func fakeKubectl(reachable bool, args *[]string) func(...string) *exec.Cmd {
+	return func(argv ...string) *exec.Cmd {
+		*args = argv
+		cmd := exec.Command(os.Args[0], "-test.run=TestPreflightKubectl")
+		cmd.Env = append(os.Environ(), "KO_TEST_KUBECTL=1")
+		if reachable {
+			cmd.Env = append(cmd.Env, "KO_TEST_REACHABLE=1")
+		}
+		return cmd
+	}
+}
+
+func TestCheckCluster(t *testing.T) {
+	defer func(orig func(...string) *exec.Cmd) {
+		preflightCommand = orig
+	}(preflightCommand)
+
+	for _, test := range []struct {
+		desc      string
+		reachable bool
+		wantErr   bool
+	}{{
+		desc:      "reachable",
+		reachable: true,
+	}, {
+		desc:    "unreachable",
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var args []string
+			preflightCommand = fakeKubectl(test.reachable, &args)
+
+			err := checkCluster([]string{"--context=prod"})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("checkCluster() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "connection to the server") {
+				t.Errorf("checkCluster() = %v, want kubectl's output", err)
+			}
+			want := []string{"cluster-info", "--request-timeout=10s", "--context=prod"}
+			if diff := cmp.Diff(want, args); diff != "" {
+				t.Errorf("kubectl args (-want +got) = %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultPrimingSeparators is how many empty documents we prime the
+	// stream to kubectl with when its version doesn't tell us otherwise;
+	// enough to fill the 4096 byte buffer that it decodes its input with.
+	defaultPrimingSeparators = 1000
+
+	// unprimedKubectlMinor is the first minor version of kubectl 1.x whose
+	// apply and create we don't prime.
+	unprimedKubectlMinor = 18
+)
+
+// kubectlVersion returns the output of "kubectl version --client -o json".
+// It is a variable so that tests can stand in for kubectl.
+var kubectlVersion = func() ([]byte, error) {
+	return exec.Command("kubectl", "version", "--client", "-o", "json").Output()
+}
+
+// parseKubectlVersion returns the major and minor version of kubectl from the
+// output of kubectlVersion.
+func parseKubectlVersion(output []byte) (int, int, error) {
+	var v struct {
+		ClientVersion struct {
+			Major string `json:"major"`
+			Minor string `json:"minor"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(output, &v); err != nil {
+		return 0, 0, err
+	}
+	major, err := strconv.Atoi(v.ClientVersion.Major)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing major version %q: %v", v.ClientVersion.Major, err)
+	}
+	// Vendor builds of kubectl report minor versions like "18+".
+	minor, err := strconv.Atoi(strings.TrimSuffix(v.ClientVersion.Minor, "+"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing minor version %q: %v", v.ClientVersion.Minor, err)
+	}
+	return major, minor, nil
+}
+
+// primingSeparators returns how many empty documents to prime the stream to
+// kubectl with: n if it isn't negative, and otherwise the number the version
+// of kubectl needs, falling back on defaultPrimingSeparators when that can't
+// be determined.
+func primingSeparators(n int) int {
+	if n >= 0 {
+		return n
+	}
+	output, err := kubectlVersion()
+	if err != nil {
+		log.Printf("Could not determine the kubectl version, priming its input: %v", err)
+		return defaultPrimingSeparators
+	}
+	major, minor, err := parseKubectlVersion(output)
+	if err != nil {
+		log.Printf("Could not determine the kubectl version, priming its input: %v", err)
+		return defaultPrimingSeparators
+	}
+	if major > 1 || (major == 1 && minor >= unprimedKubectlMinor) {
+		return 0
+	}
+	return defaultPrimingSeparators
+}
+
+// prime writes n empty documents to w, which kubectl discards.
+func prime(w io.Writer, n int) {
+	for i := 0; i < n; i++ {
+		w.Write([]byte("---\n"))
+	}
+}
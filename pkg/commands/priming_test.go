@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrimingSeparators(t *testing.T) {
+	defer func(orig func() ([]byte, error)) {
+		kubectlVersion = orig
+	}(kubectlVersion)
+
+	version := func(major, minor string) string {
+		return `{"clientVersion":{"major":"` + major + `","minor":"` + minor + `","gitVersion":"v1.x"}}`
+	}
+	tests := []struct {
+		desc   string
+		flag   int
+		output string
+		err    error
+		want   int
+	}{{
+		desc:   "old kubectl",
+		flag:   -1,
+		output: version("1", "15"),
+		want:   defaultPrimingSeparators,
+	}, {
+		desc:   "new kubectl",
+		flag:   -1,
+		output: version("1", "18"),
+		want:   0,
+	}, {
+		desc:   "vendor kubectl",
+		flag:   -1,
+		output: version("1", "20+"),
+		want:   0,
+	}, {
+		desc: "kubectl fails",
+		flag: -1,
+		err:  errors.New("executable file not found in $PATH"),
+		want: defaultPrimingSeparators,
+	}, {
+		desc:   "unparseable version",
+		flag:   -1,
+		output: "Client Version: v1.20.0",
+		want:   defaultPrimingSeparators,
+	}, {
+		desc:   "flag",
+		flag:   10,
+		output: version("1", "20"),
+		want:   10,
+	}, {
+		desc: "flag disables priming",
+		flag: 0,
+		err:  errors.New("kubectl is not run when the flag is set"),
+		want: 0,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			kubectlVersion = func() ([]byte, error) {
+				return []byte(test.output), test.err
+			}
+			if got := primingSeparators(test.flag); got != test.want {
+				t.Errorf("primingSeparators(%d) = %d, want %d", test.flag, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrime(t *testing.T) {
+	var buf bytes.Buffer
+	prime(&buf, 3)
+	if got, want := buf.String(), strings.Repeat("---\n", 3); got != want {
+		t.Errorf("prime() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/ko/pkg/publish"
+)
+
+// provenanceInfo describes how this invocation of ko builds images, for
+// their provenance.
+func provenanceInfo() publish.BuildInfo {
+	builder := "https://github.com/google/ko"
+	if v := koVersion(); v != "" {
+		builder += "@" + v
+	}
+	info := publish.BuildInfo{
+		BuilderID: builder,
+		Flags:     os.Args[1:],
+	}
+	if m, ok := sourceMaterial(); ok {
+		info.Materials = append(info.Materials, m)
+	}
+	return info
+}
+
+// sourceMaterial returns the module in the working directory, at the git
+// commit it is checked out at, if any.
+func sourceMaterial() (publish.Material, bool) {
+	mod, err := exec.Command("go", "list", "-mod=readonly", "-m").Output()
+	if err != nil {
+		return publish.Material{}, false
+	}
+	m := publish.Material{URI: strings.TrimSpace(string(mod))}
+	if head, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+		m.Digest = map[string]string{"sha1": strings.TrimSpace(string(head))}
+	}
+	return m, true
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// deletionTracker remembers what each file resolved to, so that once a file
+// is deleted during --watch, the resources that were applied from it can be
+// deleted too.
+type deletionTracker struct {
+	m        sync.Mutex
+	resolved map[string][]byte
+}
+
+func newDeletionTracker() *deletionTracker {
+	return &deletionTracker{resolved: make(map[string][]byte)}
+}
+
+// record remembers the resolved yaml last applied from the file f.
+func (dt *deletionTracker) record(f string, b []byte) {
+	dt.m.Lock()
+	defer dt.m.Unlock()
+	dt.resolved[f] = b
+}
+
+// deleted reports whether the file f has been deleted since its resolved yaml
+// was recorded, in which case it returns that yaml and forgets it.
+func (dt *deletionTracker) deleted(f string) ([]byte, bool) {
+	if _, err := os.Stat(f); !os.IsNotExist(err) {
+		return nil, false
+	}
+	dt.m.Lock()
+	defer dt.m.Unlock()
+	b, ok := dt.resolved[f]
+	if ok {
+		delete(dt.resolved, f)
+	}
+	return b, ok
+}
+
+// kubectlDelete returns a function that deletes the resources in resolved
+// yaml with "kubectl delete", passing through kubectlFlags.
+func kubectlDelete(kubectlFlags []string) func([]byte) {
+	return func(resolved []byte) {
+		argv := []string{"delete", "--ignore-not-found", "-f", "-"}
+		argv = append(argv, kubectlFlags...)
+		kubectlCmd := exec.Command("kubectl", argv...)
+		kubectlCmd.Env = os.Environ()
+		kubectlCmd.Stdin = bytes.NewReader(resolved)
+		kubectlCmd.Stderr = os.Stderr
+		kubectlCmd.Stdout = os.Stdout
+		if err := kubectlCmd.Run(); err != nil {
+			// Don't let delete errors disrupt the watch.
+			log.Printf("error executing 'kubectl delete': %v", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeletionTracker(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	kept := filepath.Join(tmpDir, "kept.yaml")
+	removed := filepath.Join(tmpDir, "removed.yaml")
+	unknown := filepath.Join(tmpDir, "unknown.yaml")
+	for _, f := range []string{kept, removed} {
+		if err := ioutil.WriteFile(f, []byte("kind: ConfigMap\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	dt := newDeletionTracker()
+	dt.record(kept, []byte("kept"))
+	dt.record(removed, []byte("first"))
+	// Only the last resolution of a file is deleted.
+	dt.record(removed, []byte("second"))
+
+	if b, ok := dt.deleted(removed); ok {
+		t.Errorf("deleted(%s) = %q before deleting it, want nothing", removed, b)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+
+	for _, test := range []struct {
+		f      string
+		want   string
+		wantOK bool
+	}{
+		{f: kept},
+		{f: removed, want: "second", wantOK: true},
+		// Once handled, the deletion isn't reported again.
+		{f: removed},
+		// Files that were never resolved have nothing to delete.
+		{f: unknown},
+	} {
+		b, ok := dt.deleted(test.f)
+		if ok != test.wantOK {
+			t.Errorf("deleted(%s) = %v, want %v", test.f, ok, test.wantOK)
+		}
+		if diff := cmp.Diff(test.want, string(b)); diff != "" {
+			t.Errorf("deleted(%s); (-want +got) = %v", test.f, diff)
+		}
+	}
+}
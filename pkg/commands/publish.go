@@ -24,7 +24,7 @@ import (
 
 // addPublish augments our CLI surface with publish.
 func addPublish(topLevel *cobra.Command) {
-	lo := &options.LocalOptions{}
+	lo := &options.LocalOptions{Push: true}
 	no := &options.NameOptions{}
 	ta := &options.TagsOptions{}
 	bo := &options.BuildOptions{}
@@ -60,7 +60,7 @@ func addPublish(topLevel *cobra.Command) {
   ko publish --local github.com/foo/bar/cmd/baz github.com/foo/bar/cmd/blah`,
 		Args: cobra.MinimumNArgs(1),
 		Run: func(_ *cobra.Command, args []string) {
-			builder, err := makeBuilder(bo)
+			builder, err := makeBuilder(bo, lo, ta)
 			if err != nil {
 				log.Fatalf("error creating builder: %v", err)
 			}
@@ -24,12 +24,14 @@ import (
 
 // addResolve augments our CLI surface with resolve.
 func addResolve(topLevel *cobra.Command) {
-	lo := &options.LocalOptions{}
+	lo := &options.LocalOptions{Push: true}
 	no := &options.NameOptions{}
 	fo := &options.FilenameOptions{}
 	ta := &options.TagsOptions{}
 	so := &options.SelectorOptions{}
 	sto := &options.StrictOptions{}
+	ro := &options.ResolveOptions{}
+	oo := &options.OutputOptions{}
 	bo := &options.BuildOptions{}
 
 	resolve := &cobra.Command{
@@ -55,10 +57,41 @@ func addResolve(topLevel *cobra.Command) {
   # daemon as:
   #   ko.local/<import path>
   # This always preserves import paths.
-  ko resolve --local -f config/`,
+  ko resolve --local -f config/
+
+  # Write each resolved file to the path mirroring its
+  # location under config/, e.g. config/foo/bar.yaml is
+  # written to resolved/foo/bar.yaml.
+  ko resolve -f config/ --output-dir resolved/
+
+  # Write a kustomization images transformer that overrides
+  # each ko:// reference in config/ with its built image.
+  ko resolve -f config/ --kustomize-images
+
+  # Fail if any of the resolved files aren't valid against
+  # the Kubernetes schemas, using kubeconform.
+  ko resolve -f config/ --validate
+
+  # Record the image each import path resolved to, so that
+  # they can be redeployed later without rebuilding them
+  # with: ko apply -f config/ --read-lock ko.lock
+  ko resolve -f config/ --write-lock ko.lock
+
+  # Resolve a base and an environment's overlay, where the
+  # resources in config/prod/ override the ones with the
+  # same kind and name in config/base/.
+  ko resolve -f config/base/ -f config/prod/ --merge
+
+  # Compress the resolved files, e.g. to store them as a
+  # build artifact.
+  ko resolve -f config/ --gzip > release.yaml.gz
+
+  # List each reference in config/ with the image that it
+  # resolves to, e.g. to comment on a pull request.
+  ko resolve -f config/ --show-changes`,
 		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			builder, err := makeBuilder(bo)
+			builder, err := makeBuilder(bo, lo, ta)
 			if err != nil {
 				log.Fatalf("error creating builder: %v", err)
 			}
@@ -66,7 +99,19 @@ func addResolve(topLevel *cobra.Command) {
 			if err != nil {
 				log.Fatalf("error creating publisher: %v", err)
 			}
-			resolveFilesToWriter(builder, publisher, fo, so, sto, os.Stdout)
+			if oo.KustomizeImages && (fo.Watch || oo.OutputDir != "") {
+				log.Fatal("--kustomize-images can't be used with --watch or --output-dir")
+			}
+			if oo.Gzip && oo.OutputDir != "" {
+				log.Fatal("--gzip can't be used with --output-dir")
+			}
+			if oo.ShowChanges && (oo.KustomizeImages || oo.OutputDir != "") {
+				log.Fatal("--show-changes can't be used with --kustomize-images or --output-dir")
+			}
+			if oo.Merge && (fo.Watch || oo.OutputDir != "") {
+				log.Fatal("--merge can't be used with --watch or --output-dir")
+			}
+			resolveFilesToWriter(builder, publisher, fo, so, sto, ro, oo, nil, os.Stdout)
 		},
 	}
 	options.AddLocalArg(resolve, lo)
@@ -75,6 +120,8 @@ func addResolve(topLevel *cobra.Command) {
 	options.AddTagsArg(resolve, ta)
 	options.AddSelectorArg(resolve, so)
 	options.AddStrictArg(resolve, sto)
+	options.AddResolveArgs(resolve, ro)
+	options.AddOutputArgs(resolve, oo)
 	options.AddBuildOptions(resolve, bo)
 	topLevel.AddCommand(resolve)
 }
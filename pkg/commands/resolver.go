@@ -15,15 +15,19 @@
 package commands
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/ko/pkg/build"
 	"github.com/google/ko/pkg/commands/options"
@@ -32,13 +36,28 @@ import (
 	"github.com/mattmoor/dep-notify/pkg/graph"
 )
 
-func gobuildOptions(bo *options.BuildOptions) ([]build.Option, error) {
+func gobuildOptions(bo *options.BuildOptions, lo *options.LocalOptions) ([]build.Option, error) {
 	creationTime, err := getCreationTime()
 	if err != nil {
 		return nil, err
 	}
+	platform, err := targetPlatform(bo, lo)
+	if err != nil {
+		return nil, err
+	}
+	insecure := insecureRegistry(lo)
+	keys := keychain(lo)
+	var cacheDir string
+	if bo.DiskCache {
+		cacheDir = diskCacheDir()
+	}
 	opts := []build.Option{
-		build.WithBaseImages(getBaseImage),
+		build.WithBaseImages(getBaseImage(platform, insecure, keys, cacheDir)),
+		build.WithPlatformBaseImages(getPlatformBaseImage(insecure, keys, cacheDir)),
+		build.WithVersion(koVersion()),
+	}
+	if platform != nil {
+		opts = append(opts, build.WithPlatform(*platform))
 	}
 	if creationTime != nil {
 		opts = append(opts, build.WithCreationTime(*creationTime))
@@ -46,18 +65,218 @@ func gobuildOptions(bo *options.BuildOptions) ([]build.Option, error) {
 	if bo.DisableOptimizations {
 		opts = append(opts, build.WithDisabledOptimizations())
 	}
+	if len(bundledBinaries) > 0 {
+		opts = append(opts, build.WithBundledBinaries(bundledBinaries))
+	}
+	if len(entrypoints) > 0 {
+		opts = append(opts, build.WithEntrypoints(entrypoints))
+	}
+	switch {
+	case bo.VerifyBase != "" && bo.VerifyBaseRoots != "":
+		return nil, errors.New("--verify-base and --verify-base-roots are mutually exclusive")
+	case bo.VerifyBase != "":
+		sv, err := newSignatureVerifier(bo.VerifyBase, keys)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, build.WithBaseImageVerification(sv.Verify))
+	case bo.VerifyBaseRoots != "":
+		sv, err := newKeylessVerifier(bo.VerifyBaseRoots, bo.VerifyBaseIdentity, bo.VerifyBaseRekorKey, keys)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, build.WithBaseImageVerification(sv.Verify))
+	}
+	if bo.RequireLicense {
+		opts = append(opts, build.WithLicenseCheck())
+	}
+	if bo.DebugEntrypoint {
+		opts = append(opts, build.WithDebugEntrypoint())
+	}
+	if len(bo.DefaultArgs) > 0 {
+		opts = append(opts, build.WithDefaultArgs(bo.DefaultArgs))
+	}
+	if bo.ModMode != "" {
+		opts = append(opts, build.WithModMode(bo.ModMode))
+	}
+	if bo.BuildVCS != "" {
+		opts = append(opts, build.WithBuildVCS(bo.BuildVCS))
+	}
+	if bo.AppPath != "" {
+		opts = append(opts, build.WithAppPath(bo.AppPath))
+	}
+	if bo.KoDataEnvName != "" {
+		opts = append(opts, build.WithKoDataEnvName(bo.KoDataEnvName))
+	}
+	if len(bo.Healthcheck) > 0 {
+		opts = append(opts, build.WithHealthcheck(bo.Healthcheck, bo.HealthcheckInterval, bo.HealthcheckTimeout, bo.HealthcheckRetries))
+	}
+	if bo.StopSignal != "" {
+		opts = append(opts, build.WithStopSignal(bo.StopSignal))
+	}
+	if bo.ValidateBinaries {
+		opts = append(opts, build.WithBinaryValidation())
+	}
+	if bo.MaxImageSize != "" {
+		max, err := parseSize(bo.MaxImageSize)
+		if err != nil {
+			return nil, fmt.Errorf("--max-image-size: %v", err)
+		}
+		opts = append(opts, build.WithMaxImageSize(max))
+	}
+	if bo.TempDir != "" {
+		opts = append(opts, build.WithTempDir(bo.TempDir))
+	}
+	if bo.GoCache != "" {
+		opts = append(opts, build.WithGoCache(bo.GoCache))
+	}
+	if bo.GoBinary != "" {
+		opts = append(opts, build.WithGoBinary(bo.GoBinary))
+	}
+	if cacheDir != "" {
+		opts = append(opts, build.WithBinaryCache(filepath.Join(cacheDir, "binaries")))
+	}
+	if bo.BuildLogDir != "" {
+		opts = append(opts, build.WithBuildLogDir(bo.BuildLogDir))
+	}
+	if bo.BuildRetries != 0 {
+		opts = append(opts, build.WithBuildRetries(bo.BuildRetries))
+	}
+	for _, command := range bo.PreBuildCommands {
+		opts = append(opts, build.WithPreBuildHook(build.PreBuildCommand(command)))
+	}
+	if bo.Race {
+		opts = append(opts, build.WithRace())
+	}
+	if bo.CACert != "" {
+		opts = append(opts, build.WithCACerts(bo.CACert))
+	}
+	if len(bo.ImageAnnotations) > 0 {
+		annotations := make(map[string]string, len(bo.ImageAnnotations))
+		for _, kv := range bo.ImageAnnotations {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("--image-annotation %q is not of the form key=value", kv)
+			}
+			annotations[parts[0]] = parts[1]
+		}
+		opts = append(opts, build.WithAnnotations(annotations))
+	}
+	if len(bo.ExtraHosts) > 0 {
+		hosts := make(map[string]string, len(bo.ExtraHosts))
+		for _, kv := range bo.ExtraHosts {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("--extra-host %q is not of the form host=ip", kv)
+			}
+			hosts[parts[0]] = parts[1]
+		}
+		opts = append(opts, build.WithExtraHosts(hosts))
+	}
 	return opts, nil
 }
 
-func makeBuilder(bo *options.BuildOptions) (*build.Caching, error) {
-	opt, err := gobuildOptions(bo)
+// insecureRegistry returns the registry that --insecure-registry applies to,
+// which is the one images are published to, or "" if there is none.
+func insecureRegistry(lo *options.LocalOptions) string {
+	if !lo.InsecureRegistry || lo.Local {
+		return ""
+	}
+	repoName, err := getDockerRepo()
+	if err != nil || repoName == publish.LocalDomain {
+		return ""
+	}
+	repo, err := name.NewRepository(repoName)
 	if err != nil {
-		log.Fatalf("error setting up builder options: %v", err)
+		return ""
+	}
+	return repo.RegistryStr()
+}
+
+func newBuilder(bo *options.BuildOptions, lo *options.LocalOptions, ta *options.TagsOptions) (build.Interface, error) {
+	if bo.BuilderEndpoint != "" {
+		if flags := localBuildFlags(bo, ta); len(flags) > 0 {
+			return nil, fmt.Errorf("--builder-endpoint has the build service build images, which doesn't take %s", strings.Join(flags, ", "))
+		}
+		return build.NewRemote(bo.BuilderEndpoint, keychain(lo))
 	}
-	innerBuilder, err := build.NewGo(opt...)
+	switch bo.Builder {
+	case "", "go":
+		opt, err := gobuildOptions(bo, lo)
+		if err != nil {
+			return nil, err
+		}
+		if usesSourceHash(ta.Tags) {
+			opt = append(opt, build.WithSourceHash())
+		}
+		return build.NewGo(opt...)
+	case "buildpacks":
+		return build.NewBuildpacks()
+	default:
+		return nil, fmt.Errorf("unknown builder %q", bo.Builder)
+	}
+}
+
+// localBuildFlags returns the flags set in bo and ta that configure how we
+// build images ourselves, which a remote build service doesn't take.
+func localBuildFlags(bo *options.BuildOptions, ta *options.TagsOptions) []string {
+	var flags []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--builder", bo.Builder != ""},
+		{"--platform", bo.Platform != ""},
+		{"--disable-optimizations", bo.DisableOptimizations},
+		{"--image-annotation", len(bo.ImageAnnotations) > 0},
+		{"--ca-cert", bo.CACert != ""},
+		{"--gocache", bo.GoCache != ""},
+		{"--extra-host", len(bo.ExtraHosts) > 0},
+		{"--go-binary", bo.GoBinary != ""},
+		{"--disk-cache", bo.DiskCache},
+		{"--build-log-dir", bo.BuildLogDir != ""},
+		{"--build-retries", bo.BuildRetries != 0},
+		{"--pre-build-command", len(bo.PreBuildCommands) > 0},
+		{"--race", bo.Race},
+		{"--validate-binaries", bo.ValidateBinaries},
+		{"--verify-base", bo.VerifyBase != ""},
+		{"--verify-base-roots", bo.VerifyBaseRoots != ""},
+		{"--max-image-size", bo.MaxImageSize != ""},
+		{"--require-license", bo.RequireLicense},
+		{"--stop-signal", bo.StopSignal != ""},
+		{"--app-path", bo.AppPath != ""},
+		{"--kodata-env-name", bo.KoDataEnvName != ""},
+		{"--mod", bo.ModMode != ""},
+		{"--buildvcs", bo.BuildVCS != ""},
+		{"--debug-entrypoint", bo.DebugEntrypoint},
+		{"--default-arg", len(bo.DefaultArgs) > 0},
+		{"--healthcheck", len(bo.Healthcheck) > 0},
+		{"--tags with {{.SourceHash}}", usesSourceHash(ta.Tags)},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// usesSourceHash reports whether any of tags is a template that refers to
+// the source hash, which images must then be labeled with.
+func usesSourceHash(tags []string) bool {
+	for _, tag := range tags {
+		if strings.Contains(tag, ".SourceHash") {
+			return true
+		}
+	}
+	return false
+}
+
+func makeBuilder(bo *options.BuildOptions, lo *options.LocalOptions, ta *options.TagsOptions) (*build.Caching, error) {
+	innerBuilder, err := newBuilder(bo, lo, ta)
 	if err != nil {
 		return nil, err
 	}
+	hasher, _ := innerBuilder.(build.InputHasher)
 
 	innerBuilder = build.NewLimiter(innerBuilder, bo.ConcurrentBuilds)
 
@@ -77,46 +296,110 @@ func makeBuilder(bo *options.BuildOptions) (*build.Caching, error) {
 	//    we can elide subsequent builds by blocking on the same image future.
 	// 2. When an affected yaml file has multiple import paths (mostly unaffected)
 	//    we can elide the builds of unchanged import paths.
-	return build.NewCaching(innerBuilder)
+	//
+	// Go builds are also keyed on the hash of their inputs, so that a change
+	// to a dependency results in a new build even if nothing invalidated it.
+	var opts []build.CachingOption
+	if hasher != nil {
+		opts = append(opts, build.WithInputHash(hasher.InputHash))
+	}
+	return build.NewCaching(innerBuilder, opts...)
 }
 
 func makePublisher(no *options.NameOptions, lo *options.LocalOptions, ta *options.TagsOptions) (publish.Interface, error) {
 	// Create the publish.Interface that we will use to publish image references
 	// to either a docker daemon or a container image registry.
 	innerPublisher, err := func() (publish.Interface, error) {
-		namer := options.MakeNamer(no)
+		nameOpts := *no
+		nameOpts.NamingRules = namingRules
+		namer := options.MakeNamer(&nameOpts)
 
-		repoName := os.Getenv("KO_DOCKER_REPO")
-		if lo.Local || repoName == publish.LocalDomain {
-			return publish.NewDaemon(namer, ta.Tags), nil
-		}
-		if repoName == "" {
-			return nil, errors.New("KO_DOCKER_REPO environment variable is unset")
+		repoName, err := getDockerRepo()
+		if !lo.Push {
+			if lo.Local || err != nil {
+				repoName = publish.LocalDomain
+			}
+			return publish.NewNoop(repoName, namer), nil
 		}
-		if _, err := name.NewRegistry(repoName); err != nil {
-			if _, err := name.NewRepository(repoName); err != nil {
-				return nil, fmt.Errorf("failed to parse environment variable KO_DOCKER_REPO=%q as repository: %v", repoName, err)
+		if lo.Local || (err == nil && repoName == publish.LocalDomain) {
+			if lo.Provenance {
+				log.Printf("--provenance is not supported by the local docker daemon, ignoring")
 			}
+			if ta.TagScheme != "" {
+				log.Printf("--tag-scheme is not supported by the local docker daemon, ignoring")
+			}
+			return publish.NewDaemon(namer, ta.Tags), nil
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		return publish.NewDefault(repoName,
-			publish.WithAuthFromKeychain(authn.DefaultKeychain),
+		opts := []publish.Option{
+			publish.WithAuthFromKeychain(keychain(lo)),
 			publish.WithNamer(namer),
 			publish.WithTags(ta.Tags),
-			publish.Insecure(lo.InsecureRegistry))
+			publish.Insecure(lo.InsecureRegistry),
+			publish.WithChunkSize(lo.PushChunkSize),
+			publish.WithTagScheme(ta.TagScheme),
+		}
+		if lo.Provenance {
+			opts = append(opts, publish.WithProvenance(provenanceInfo()))
+		}
+		def, err := publish.NewDefault(repoName, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if lo.AlsoLocal {
+			// Side-load into the daemon, but resolve to the registry.
+			return publish.NewMulti(def, publish.NewDaemon(namer, ta.Tags)), nil
+		}
+		return def, nil
 	}()
 	if err != nil {
 		return nil, err
 	}
+	if lo.ScanCommand != "" && !lo.Push {
+		log.Printf("--push=false publishes nothing to scan, ignoring --scan-command")
+	} else if lo.ScanCommand != "" {
+		innerPublisher = &scanningPublisher{
+			inner:           innerPublisher,
+			command:         lo.ScanCommand,
+			continueOnError: lo.ContinueOnError,
+		}
+	}
+	if lo.DigestFile != "" {
+		innerPublisher = &digestFilePublisher{
+			inner:   innerPublisher,
+			pattern: lo.DigestFile,
+		}
+	}
 
 	// Wrap publisher in a memoizing publisher implementation.
 	return publish.NewCaching(innerPublisher)
 }
 
-// resolvedFuture represents a "future" for the bytes of a resolved file.
-type resolvedFuture chan []byte
+// resolvedFile holds the resolved bytes of an input file.
+type resolvedFile struct {
+	name string
+	b    []byte
+	// changes are the values that resolution changed, for --show-changes.
+	changes []resolve.Change
+}
+
+// resolvedFuture represents a "future" for a resolved file.
+type resolvedFuture chan resolvedFile
+
+// resolveJob is a file for a worker to resolve, and the future to send the
+// result on.
+type resolveJob struct {
+	name string
+	ch   resolvedFuture
+}
 
-func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, fo *options.FilenameOptions, so *options.SelectorOptions, sto *options.StrictOptions, out io.WriteCloser) {
+func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, fo *options.FilenameOptions, so *options.SelectorOptions, sto *options.StrictOptions, ro *options.ResolveOptions, oo *options.OutputOptions, prune func([]byte), out io.WriteCloser) {
+	if oo.Gzip {
+		out = newGzipWriteCloser(out)
+	}
 	defer out.Close()
 
 	// By having this as a channel, we can hook this up to a filesystem
@@ -125,12 +408,35 @@ func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, f
 	// creation of new yaml files).
 	fs := options.EnumerateFiles(fo)
 
+	opts, err := resolveOptions(ro)
+	if err != nil {
+		log.Fatalf("error setting up resolve options: %v", err)
+	}
+
 	// This tracks filename -> []importpath
 	var sm sync.Map
 
+	// This collects the results of the builds for --summary.
+	var summary buildSummary
+
+	// This tracks what each file resolved to, when the resources from
+	// deleted files are pruned.
+	tracker := newDeletionTracker()
+
+	// This collects the images that references resolve to, for
+	// --kustomize-images and --write-lock.
+	var km sync.Mutex
+	images := make(map[string]string)
+	if oo.KustomizeImages || ro.WriteLock != "" {
+		opts = append(opts, resolve.WithResolvedRefs(func(ref, image string) {
+			km.Lock()
+			defer km.Unlock()
+			images[ref] = image
+		}))
+	}
+
 	var g graph.Interface
 	var errCh chan error
-	var err error
 	if fo.Watch {
 		// Start a dep-notify process that on notifications scans the
 		// file-to-recorded-build map and for each affected file resends
@@ -157,7 +463,98 @@ func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, f
 		defer g.Shutdown()
 	}
 
+	// Without --watch, the files are written as they are resolved, unless
+	// their documents need to be reordered or merged across files, which
+	// requires holding on to them until all the files are resolved.
+	buffer := !fo.Watch && (oo.Merge || oo.SortByKind || hasApplyOrder(fo))
+
+	// resolveInto resolves the file f, responding with its bytes on the future
+	// ch.  Each future has room for its result, so that resolving a file
+	// never waits on the futures before it being received.
+	resolveInto := func(f string, ch resolvedFuture) {
+		defer close(ch)
+		if !options.ShouldResolve(fo, f) {
+			if !fo.PassThrough {
+				return
+			}
+			b, err := readInput(f, fo)
+			if err != nil {
+				lg := log.Fatalf
+				if fo.Watch {
+					lg = log.Printf
+				}
+				lg("error reading %q: %v", f, err)
+				return
+			}
+			if prune != nil {
+				tracker.record(f, b)
+			}
+			ch <- resolvedFile{name: f, b: b}
+			return
+		}
+		// Record the builds we do via this builder.
+		recordingBuilder := &build.Recorder{
+			Builder:       builder,
+			RecordResults: oo.Summary != "",
+		}
+		fileOpts := opts
+		var changes []resolve.Change
+		if oo.ShowChanges {
+			// Copy, so as not to append to the options of other files.
+			fileOpts = append(opts[:len(opts):len(opts)], resolve.WithChanges(func(c resolve.Change) {
+				changes = append(changes, c)
+			}))
+		}
+		b, err := resolveFile(f, fo, recordingBuilder, publisher, so, sto, fileOpts)
+		if err != nil {
+			// Don't let build errors disrupt the watch.
+			lg := log.Fatalf
+			if fo.Watch {
+				lg = log.Printf
+			}
+			lg("error processing import paths in %q: %v", f, err)
+			return
+		}
+		// Associate with this file the collection of binary import paths.
+		sm.Store(f, recordingBuilder.ImportPaths)
+		summary.add(recordingBuilder.Results)
+		if prune != nil {
+			tracker.record(f, b)
+		}
+		ch <- resolvedFile{name: f, b: b, changes: changes}
+		if fo.Watch {
+			for _, ip := range recordingBuilder.ImportPaths {
+				// Technically we never remove binary targets from the graph,
+				// which will increase our graph's watch load, but the
+				// notifications that they change will result in no affected
+				// yamls, and no new builds or deploys.
+				if err := g.Add(ip); err != nil {
+					log.Fatalf("Error adding importpath to dep graph: %v", err)
+				}
+			}
+		}
+	}
+
+	// With --concurrent-files, that many workers resolve the files, which
+	// are queued for them in the order they're enumerated.  Otherwise each
+	// file is resolved as soon as it's enumerated.
+	var jobs chan resolveJob
+	var queue []resolveJob
+	if fo.ConcurrentFiles > 0 {
+		jobs = make(chan resolveJob)
+		defer close(jobs)
+		for i := 0; i < fo.ConcurrentFiles; i++ {
+			go func() {
+				for j := range jobs {
+					resolveInto(j.name, j.ch)
+				}
+			}()
+		}
+	}
+
 	var futures []resolvedFuture
+	var pending [][]byte
+	written := make(writtenBodies)
 	for {
 		// Each iteration, if there is anything in the list of futures,
 		// listen to it in addition to the file enumerating channel.
@@ -165,6 +562,13 @@ func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, f
 		// is available, this will result in us exclusively selecting
 		// on the file enumerating channel.
 		var bf resolvedFuture
+		// Likewise, the next queued file is only handed to a worker if
+		// there is one.
+		var next chan resolveJob
+		var head resolveJob
+		if len(queue) > 0 {
+			next, head = jobs, queue[0]
+		}
 		if len(futures) > 0 {
 			bf = futures[0]
 		} else if fs == nil {
@@ -184,70 +588,346 @@ func resolveFilesToWriter(builder *build.Caching, publisher publish.Interface, f
 				break
 			}
 
+			if prune != nil {
+				if b, ok := tracker.deleted(f); ok {
+					// The file is gone, so stop watching the import paths
+					// it referenced, and delete what was applied from it.
+					sm.Delete(f)
+					written.forget(f)
+					log.Printf("Deleting the resources from deleted file %q", f)
+					prune(b)
+					break
+				}
+			}
+
 			// Make a new future to use to ship the bytes back and append
 			// it to the list of futures (see comment below about ordering).
-			ch := make(resolvedFuture)
+			ch := make(resolvedFuture, 1)
 			futures = append(futures, ch)
 
 			// Kick off the resolution that will respond with its bytes on
 			// the future.
-			go func(f string) {
-				defer close(ch)
-				// Record the builds we do via this builder.
-				recordingBuilder := &build.Recorder{
-					Builder: builder,
-				}
-				b, err := resolveFile(f, recordingBuilder, publisher, so, sto)
-				if err != nil {
-					// Don't let build errors disrupt the watch.
+			if jobs == nil {
+				go resolveInto(f, ch)
+			} else {
+				queue = append(queue, resolveJob{name: f, ch: ch})
+			}
+
+		case next <- head:
+			queue = queue[1:]
+
+		case r, ok := <-bf:
+			// Once the head channel returns something, dequeue it.
+			// We listen to the futures in order to be respectful of
+			// the kubectl apply ordering, which matters!
+			futures = futures[1:]
+			if !ok {
+				break
+			}
+			if oo.Validate {
+				if err := validateManifests(r.b); err != nil {
+					// Don't let invalid files disrupt the watch.
 					lg := log.Fatalf
 					if fo.Watch {
 						lg = log.Printf
 					}
-					lg("error processing import paths in %q: %v", f, err)
-					return
+					lg("error validating %q: %v", r.name, err)
+					break
 				}
-				// Associate with this file the collection of binary import paths.
-				sm.Store(f, recordingBuilder.ImportPaths)
-				ch <- b
-				if fo.Watch {
-					for _, ip := range recordingBuilder.ImportPaths {
-						// Technically we never remove binary targets from the graph,
-						// which will increase our graph's watch load, but the
-						// notifications that they change will result in no affected
-						// yamls, and no new builds or deploys.
-						if err := g.Add(ip); err != nil {
-							log.Fatalf("Error adding importpath to dep graph: %v", err)
-						}
+			}
+			if oo.KustomizeImages {
+				// Only the images are written.
+				break
+			}
+			if oo.ShowChanges {
+				// Only the changes are written.
+				writeChanges(out, r.name, r.changes)
+				break
+			}
+			if oo.OutputDir != "" {
+				if err := writeToOutputDir(fo, oo.OutputDir, r.name, r.b); err != nil {
+					// Don't let write errors disrupt the watch.
+					lg := log.Fatalf
+					if fo.Watch {
+						lg = log.Printf
 					}
+					lg("error writing resolved %q: %v", r.name, err)
 				}
-			}(f)
-
-		case b, ok := <-bf:
-			// Once the head channel returns something, dequeue it.
-			// We listen to the futures in order to be respectful of
-			// the kubectl apply ordering, which matters!
-			futures = futures[1:]
-			if ok {
-				// Write the next body and a trailing delimiter.
-				// We write the delimeter LAST so that when streamed to
-				// kubectl it knows that the resource is complete and may
-				// be applied.
-				out.Write(append(b, []byte("\n---\n")...))
+				break
+			}
+			if buffer {
+				// Hold on to the bodies until all the files are resolved,
+				// so that their documents can be put in apply order.
+				pending = append(pending, r.b)
+				break
+			}
+			if !fo.Watch {
+				writeBodies(out, [][]byte{r.b})
+				break
 			}
+			// Rebuilds that produced the same images resolve to the
+			// same body, which there is no need to apply again.
+			if !written.changed(r.name, r.b) {
+				log.Printf("Not reapplying %q, the images it references are unchanged", r.name)
+				break
+			}
+			// When watching, only the documents within each file can be
+			// put in apply order, or sorted by kind.
+			bodies, err := applyOrdered([][]byte{r.b}, oo.SortByKind)
+			if err != nil {
+				log.Printf("error ordering documents in %q: %v", r.name, err)
+				break
+			}
+			writeBodies(out, bodies)
 
 		case err := <-errCh:
 			log.Fatalf("Error watching dependencies: %v", err)
 		}
 	}
+
+	if oo.KustomizeImages {
+		b, err := resolve.KustomizeImages(images)
+		if err != nil {
+			log.Fatalf("error writing kustomization images: %v", err)
+		}
+		out.Write(b)
+	} else if buffer {
+		if oo.Merge {
+			merged, err := mergeBodies(pending)
+			if err != nil {
+				log.Fatalf("error merging documents: %v", err)
+			}
+			pending = merged
+		}
+		bodies, err := applyOrdered(pending, oo.SortByKind)
+		if err != nil {
+			log.Fatalf("error ordering documents: %v", err)
+		}
+		writeBodies(out, bodies)
+	}
+
+	if oo.Summary != "" {
+		if err := summary.writeFile(oo.Summary); err != nil {
+			log.Fatalf("error writing summary to %q: %v", oo.Summary, err)
+		}
+	}
+	if ro.WriteLock != "" {
+		if err := writeLock(ro.WriteLock, images); err != nil {
+			log.Fatalf("error writing lock to %q: %v", ro.WriteLock, err)
+		}
+	}
+}
+
+// hasApplyOrder reports whether any of the files of fo may have documents
+// with an ApplyOrderAnnotation, which must then be put in apply order along
+// with those of the other files.  Files that can't be read twice, such as
+// stdin, or that would have to be fetched twice, such as URLs, are assumed
+// to have one.
+func hasApplyOrder(fo *options.FilenameOptions) bool {
+	found := false
+	for f := range options.EnumerateFiles(fo) {
+		if found {
+			// Drain the files, so that enumerating them finishes.
+			continue
+		}
+		if f == "-" || options.IsURL(f) {
+			found = true
+			continue
+		}
+		b, err := ioutil.ReadFile(f)
+		found = err != nil || bytes.Contains(b, []byte(resolve.ApplyOrderAnnotation))
+	}
+	return found
+}
+
+// applyOrdered returns the resolved bodies to write, which are the bodies
+// themselves unless any of their documents have an apply order, or byKind is
+// set, in which case it is their documents, sorted by kind if byKind is set,
+// and then by apply order, which takes precedence.
+func applyOrdered(bodies [][]byte, byKind bool) ([][]byte, error) {
+	var docs [][]byte
+	for _, b := range bodies {
+		for _, doc := range resolve.SplitDocuments(b) {
+			if len(bytes.TrimSpace(doc)) != 0 {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	if byKind {
+		resolve.SortByKind(docs)
+	}
+	ordered, err := resolve.SortByApplyOrder(docs)
+	if err != nil || !(ordered || byKind) {
+		return bodies, err
+	}
+	return docs, nil
+}
+
+// mergeBodies returns the documents of the resolved bodies, with those
+// describing the same resource merged in the order of the bodies.
+func mergeBodies(bodies [][]byte) ([][]byte, error) {
+	var docs [][]byte
+	for _, b := range bodies {
+		for _, doc := range resolve.SplitDocuments(b) {
+			if len(bytes.TrimSpace(doc)) != 0 {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return resolve.MergeDocuments(docs)
+}
+
+// writeBodies writes each body and a trailing delimiter.
+func writeBodies(out io.Writer, bodies [][]byte) {
+	for _, b := range bodies {
+		// We write the delimeter LAST so that when streamed to
+		// kubectl it knows that the resource is complete and may
+		// be applied.
+		out.Write(append(b, []byte("\n---\n")...))
+	}
+}
+
+// writeChanges writes each of the changes that resolving the file name made
+// on a line of its own.
+func writeChanges(out io.Writer, name string, changes []resolve.Change) {
+	for _, c := range changes {
+		fmt.Fprintf(out, "%s: %s\n", name, c)
+	}
 }
 
-func resolveFile(f string, builder build.Interface, pub publish.Interface, so *options.SelectorOptions, sto *options.StrictOptions) (b []byte, err error) {
+// outputPath returns the path under outputDir that mirrors where the input
+// file f sits relative to the filenames it was enumerated from.
+func outputPath(fo *options.FilenameOptions, outputDir, f string) (string, error) {
 	if f == "-" {
-		b, err = ioutil.ReadAll(os.Stdin)
-	} else {
-		b, err = ioutil.ReadFile(f)
+		return "", errors.New("cannot mirror stdin into an output directory")
 	}
+	for _, root := range fo.Filenames {
+		if f == root {
+			// Explicitly passed files are written to the top of outputDir.
+			return filepath.Join(outputDir, filepath.Base(f)), nil
+		}
+		rel, err := filepath.Rel(root, f)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.Join(outputDir, rel), nil
+	}
+	return "", fmt.Errorf("%q is not within any of the input filenames", f)
+}
+
+// writeToOutputDir writes the resolved bytes of the input file f to its
+// mirrored path under outputDir, creating any parent directories.
+func writeToOutputDir(fo *options.FilenameOptions, outputDir, f string, b []byte) error {
+	path, err := outputPath(fo, outputDir, f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+func resolveOptions(ro *options.ResolveOptions) ([]resolve.Option, error) {
+	var opts []resolve.Option
+	if ro.Embedded {
+		opts = append(opts, resolve.WithEmbeddedYAML())
+	}
+	if ro.Interpolated {
+		opts = append(opts, resolve.WithInterpolatedRefs())
+	}
+	if ro.FilepathRefs {
+		opts = append(opts, resolve.WithFilepathRefs())
+	}
+	if len(ro.Paths) > 0 {
+		opts = append(opts, resolve.WithPaths(ro.Paths))
+	}
+	if ro.Fields != "" {
+		opts = append(opts, resolve.WithFields(ro.Fields))
+	}
+	if ro.PullPolicy != "" {
+		opts = append(opts, resolve.WithPullPolicy(ro.PullPolicy))
+	}
+	if ro.Namespace != "" {
+		opts = append(opts, resolve.WithNamespace(ro.Namespace))
+	}
+	if ro.ContextNamespace {
+		if ro.Namespace != "" {
+			return nil, errors.New("--set-context-namespace can't be used with --set-namespace")
+		}
+		namespace, err := contextNamespace()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, resolve.WithDefaultNamespace(namespace))
+	}
+	if ro.ReadLock != "" {
+		if ro.ChangedSince != "" {
+			return nil, errors.New("--read-lock can't be used with --changed-since")
+		}
+		reuse, err := reuseLocked(ro.ReadLock)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, resolve.WithReusedDigests(reuse))
+	}
+	if ro.ChangedSince != "" {
+		if ro.PreviousDigests == "" {
+			return nil, errors.New("--changed-since requires --previous-digests")
+		}
+		reuse, err := reuseUnchanged(ro.ChangedSince, ro.PreviousDigests)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, resolve.WithReusedDigests(reuse))
+	}
+	return opts, nil
+}
+
+var (
+	// urlTimeout bounds how long fetching a URL passed to -f may take.
+	urlTimeout = 30 * time.Second
+	// maxURLSize bounds the size of the yaml fetched from a URL.
+	maxURLSize int64 = 10 << 20
+)
+
+// readURL fetches the yaml to resolve from an http(s) URL.
+func readURL(url string) ([]byte, error) {
+	client := &http.Client{Timeout: urlTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	// Read one byte past the limit to tell whether it was exceeded.
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxURLSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", url, err)
+	}
+	if int64(len(b)) > maxURLSize {
+		return nil, fmt.Errorf("fetching %s: larger than %d bytes", url, maxURLSize)
+	}
+	return b, nil
+}
+
+// readInput reads the input file f, which may be "-" for stdin, or a URL.
+func readInput(f string, fo *options.FilenameOptions) ([]byte, error) {
+	if isJsonnet(f) {
+		return evaluateJsonnet(f, fo)
+	}
+	if f == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	} else if options.IsURL(f) {
+		return readURL(f)
+	}
+	return ioutil.ReadFile(f)
+}
+
+func resolveFile(f string, fo *options.FilenameOptions, builder build.Interface, pub publish.Interface, so *options.SelectorOptions, sto *options.StrictOptions, opts []resolve.Option) (b []byte, err error) {
+	b, err = readInput(f, fo)
 	if err != nil {
 		return nil, err
 	}
@@ -258,6 +938,39 @@ func resolveFile(f string, builder build.Interface, pub publish.Interface, so *o
 			return nil, err
 		}
 	}
+	if so.AnnotationSelector != "" {
+		b, err = resolve.FilterByAnnotationSelector(b, so.AnnotationSelector)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return resolve.ImageReferences(b, sto.Strict, builder, pub)
+	docs := resolve.SplitDocuments(b)
+	skipped := false
+	for _, doc := range docs {
+		skipped = skipped || resolve.Skipped(doc)
+	}
+	if !skipped {
+		return resolve.ImageReferences(b, sto.Strict, builder, pub, opts...)
+	}
+
+	// Resolve the documents one at a time, so that those that are skipped
+	// can be passed through untouched.
+	var resolved [][]byte
+	for _, doc := range docs {
+		if !resolve.Skipped(doc) {
+			doc, err = resolve.ImageReferences(doc, sto.Strict, builder, pub, opts...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(doc, []byte("\n")) {
+			doc = append(doc, '\n')
+		}
+		resolved = append(resolved, doc)
+	}
+	return bytes.Join(resolved, []byte("---\n")), nil
 }
@@ -0,0 +1,919 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestWriteToOutputDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inputDir := filepath.Join(tmpDir, "config")
+	single := filepath.Join(tmpDir, "single.yaml")
+	inputs := []string{
+		filepath.Join(inputDir, "top.yaml"),
+		filepath.Join(inputDir, "nested", "middle.yaml"),
+		filepath.Join(inputDir, "nested", "deeper", "bottom.json"),
+		single,
+	}
+	for _, f := range inputs {
+		if err := os.MkdirAll(filepath.Dir(f), os.ModePerm); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	fo := &options.FilenameOptions{
+		Filenames: []string{inputDir, single},
+		Recursive: true,
+	}
+	outputDir := filepath.Join(tmpDir, "resolved")
+	for f := range options.EnumerateFiles(fo) {
+		if err := writeToOutputDir(fo, outputDir, f, []byte("resolved "+f)); err != nil {
+			t.Fatalf("writeToOutputDir(%q) = %v", f, err)
+		}
+	}
+
+	want := map[string]string{
+		"top.yaml":                  "resolved " + inputs[0],
+		"nested/middle.yaml":        "resolved " + inputs[1],
+		"nested/deeper/bottom.json": "resolved " + inputs[2],
+		"single.yaml":               "resolved " + inputs[3],
+	}
+	got := make(map[string]string)
+	if err := filepath.Walk(outputDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		got[filepath.ToSlash(rel)] = string(b)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk() = %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("output files; (-want +got) = %v", diff)
+	}
+}
+
+func TestOutputPathErrors(t *testing.T) {
+	fo := &options.FilenameOptions{
+		Filenames: []string{"config", "-"},
+	}
+	for _, f := range []string{
+		"-",                // stdin can't be mirrored.
+		"other/foo.yaml",   // not within config/.
+		"config/../x.yaml", // escapes config/.
+	} {
+		t.Run(f, func(t *testing.T) {
+			if got, err := outputPath(fo, "out", f); err == nil {
+				t.Errorf("outputPath(%q) = %v, want error", f, got)
+			}
+		})
+	}
+}
+
+// fakeBuilder builds a random image for any github.com import path.
+type fakeBuilder struct{}
+
+func (fakeBuilder) IsSupportedReference(s string) bool {
+	return strings.HasPrefix(s, "github.com/")
+}
+
+func (fakeBuilder) Build(string) (v1.Image, error) {
+	return random.Image(1024, 1)
+}
+
+// fakePublisher publishes every image under the same digest.
+type fakePublisher struct{}
+
+func (fakePublisher) Publish(_ v1.Image, s string) (name.Reference, error) {
+	d, err := name.NewDigest("gcr.io/fake/" + s + "@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef")
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func TestResolveFileSkipsDocuments(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	digest := "gcr.io/fake/github.com/foo/bar@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	input := `image: ko://github.com/foo/bar
+---
+metadata:
+  annotations:
+    ko.build/skip: "true"
+image: ko://github.com/foo/bar   # kept as written
+---
+# ko:ignore
+image: ko://github.com/foo/bar
+---
+image: ko://github.com/foo/bar
+`
+	want := `image: ` + digest + `
+---
+metadata:
+  annotations:
+    ko.build/skip: "true"
+image: ko://github.com/foo/bar   # kept as written
+---
+# ko:ignore
+image: ko://github.com/foo/bar
+---
+image: ` + digest + `
+`
+	f := filepath.Join(tmpDir, "mixed.yaml")
+	if err := ioutil.WriteFile(f, []byte(input), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	got, err := resolveFile(f, &options.FilenameOptions{}, fakeBuilder{}, fakePublisher{}, &options.SelectorOptions{}, &options.StrictOptions{Strict: true}, nil)
+	if err != nil {
+		t.Fatalf("resolveFile() = %v", err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("resolveFile(); (-want +got) = %v", diff)
+	}
+}
+
+func TestResolveFileFromURL(t *testing.T) {
+	digest := "gcr.io/fake/github.com/foo/bar@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.yaml":
+			io.WriteString(w, "image: ko://github.com/foo/bar\n")
+		case "/large.yaml":
+			io.WriteString(w, "image: ko://github.com/foo/bar\n"+strings.Repeat("# padding\n", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	oldSize := maxURLSize
+	defer func() { maxURLSize = oldSize }()
+	maxURLSize = 100
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		path: "/manifest.yaml",
+		want: "image: " + digest + "\n",
+	}, {
+		path:    "/large.yaml",
+		wantErr: true,
+	}, {
+		path:    "/missing.yaml",
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := resolveFile(server.URL+test.path, &options.FilenameOptions{}, fakeBuilder{}, fakePublisher{}, &options.SelectorOptions{}, &options.StrictOptions{Strict: true}, nil)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("resolveFile() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, string(got)); diff != "" {
+				t.Errorf("resolveFile(); (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+// signalingWriter closes seen once what it's written contains want.
+type signalingWriter struct {
+	nopWriteCloser
+	want string
+	seen chan struct{}
+	once sync.Once
+}
+
+func (w *signalingWriter) Write(b []byte) (int, error) {
+	n, err := w.nopWriteCloser.Write(b)
+	if strings.Contains(w.String(), w.want) {
+		w.once.Do(func() { close(w.seen) })
+	}
+	return n, err
+}
+
+// waitingBuilder waits for seen before building github.com/foo/last,
+// recording whether it saw it.
+type waitingBuilder struct {
+	fakeBuilder
+	seen  chan struct{}
+	ready bool
+}
+
+func (b *waitingBuilder) Build(s string) (v1.Image, error) {
+	if s == "github.com/foo/last" {
+		select {
+		case <-b.seen:
+			b.ready = true
+		case <-time.After(5 * time.Second):
+		}
+	}
+	return b.fakeBuilder.Build(s)
+}
+
+func TestResolveFilesStreams(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	first := filepath.Join(tmpDir, "first.yaml")
+	if err := ioutil.WriteFile(first, []byte("image: ko://github.com/foo/first\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	last := filepath.Join(tmpDir, "last.yaml")
+	if err := ioutil.WriteFile(last, []byte("image: ko://github.com/foo/last\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	out := &signalingWriter{want: "github.com/foo/first@", seen: make(chan struct{})}
+	inner := &waitingBuilder{seen: out.seen}
+	builder, err := build.NewCaching(inner)
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{first, last}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{},
+		nil,
+		out)
+
+	// Without apply-order annotations, the first file is written while the
+	// last is still being built.
+	if !inner.ready {
+		t.Error("the first file wasn't written until the last was resolved, want it streamed")
+	}
+	want := "image: gcr.io/fake/github.com/foo/first@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n\n---\n" +
+		"image: gcr.io/fake/github.com/foo/last@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n\n---\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("resolveFilesToWriter(); (-want +got) = %v", diff)
+	}
+}
+
+func TestHasApplyOrder(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	plain := filepath.Join(tmpDir, "plain.yaml")
+	if err := ioutil.WriteFile(plain, []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	ordered := filepath.Join(tmpDir, "ordered.yaml")
+	if err := ioutil.WriteFile(ordered, []byte("kind: Namespace\nmetadata:\n  annotations:\n    ko.build/apply-order: \"-1\"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	for _, test := range []struct {
+		files []string
+		want  bool
+	}{
+		{files: []string{plain}, want: false},
+		{files: []string{plain, ordered}, want: true},
+		{files: []string{tmpDir}, want: true},
+		{files: []string{"-"}, want: true},
+	} {
+		if got := hasApplyOrder(&options.FilenameOptions{Filenames: test.files}); got != test.want {
+			t.Errorf("hasApplyOrder(%v) = %v, want %v", test.files, got, test.want)
+		}
+	}
+}
+
+func TestResolveFilesApplyOrder(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	deployment := filepath.Join(tmpDir, "deployment.yaml")
+	if err := ioutil.WriteFile(deployment, []byte("kind: Deployment\nmetadata:\n  name: app\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	namespace := filepath.Join(tmpDir, "namespace.yaml")
+	if err := ioutil.WriteFile(namespace, []byte(`kind: Namespace
+metadata:
+  annotations:
+    ko.build/apply-order: "-1"
+  name: app
+`), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	builder, err := build.NewCaching(fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{deployment, namespace}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{},
+		nil,
+		out)
+
+	var kinds []string
+	decoder := yaml.NewDecoder(&out.Buffer)
+	for {
+		var obj struct {
+			Kind string `yaml:"kind"`
+		}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+		if obj.Kind != "" {
+			kinds = append(kinds, obj.Kind)
+		}
+	}
+	if diff := cmp.Diff([]string{"Namespace", "Deployment"}, kinds); diff != "" {
+		t.Errorf("applied kinds; (-want +got) = %v", diff)
+	}
+}
+
+func TestResolveFilesResolveOnly(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	app := filepath.Join(tmpDir, "apps", "app.yaml")
+	db := filepath.Join(tmpDir, "infra", "db.yaml")
+	for f, content := range map[string]string{
+		app: "image: ko://github.com/foo/app\n",
+		db:  "image: ko://github.com/foo/db\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), os.ModePerm); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	resolved := "image: gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n"
+	tests := []struct {
+		desc        string
+		passThrough bool
+		want        []string
+	}{{
+		desc: "resolve",
+		want: []string{resolved},
+	}, {
+		desc:        "apply",
+		passThrough: true,
+		want:        []string{resolved, "image: ko://github.com/foo/db\n"},
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			builder, err := build.NewCaching(fakeBuilder{})
+			if err != nil {
+				t.Fatalf("NewCaching() = %v", err)
+			}
+			out := &nopWriteCloser{}
+			resolveFilesToWriter(builder, fakePublisher{},
+				&options.FilenameOptions{
+					Filenames:   []string{tmpDir},
+					Recursive:   true,
+					ResolveOnly: []string{"apps/*.yaml"},
+					PassThrough: test.passThrough,
+				},
+				&options.SelectorOptions{},
+				&options.StrictOptions{},
+				&options.ResolveOptions{},
+				&options.OutputOptions{},
+				nil,
+				out)
+
+			var got []string
+			for _, doc := range strings.Split(out.String(), "\n---\n") {
+				if doc != "" {
+					got = append(got, doc)
+				}
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("resolved files; (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestResolveFilesGzip(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f := filepath.Join(tmpDir, "app.yaml")
+	if err := ioutil.WriteFile(f, []byte("image: ko://github.com/foo/app\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	builder, err := build.NewCaching(fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{f}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{Gzip: true},
+		nil,
+		out)
+
+	zr, err := gzip.NewReader(&out.Buffer)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %v", err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	want := "image: gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n\n---\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("decompressed output; (-want +got) = %v", diff)
+	}
+}
+
+// concurrencyBuilder records the most builds that it has had in flight at
+// once, each of which takes a little while.
+type concurrencyBuilder struct {
+	fakeBuilder
+
+	m        sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (b *concurrencyBuilder) Build(s string) (v1.Image, error) {
+	b.m.Lock()
+	b.inFlight++
+	if b.inFlight > b.max {
+		b.max = b.inFlight
+	}
+	b.m.Unlock()
+	defer func() {
+		b.m.Lock()
+		b.inFlight--
+		b.m.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return b.fakeBuilder.Build(s)
+}
+
+func TestResolveFilesConcurrentFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const files = 40
+	var want strings.Builder
+	for i := 0; i < files; i++ {
+		ip := fmt.Sprintf("github.com/foo/app%02d", i)
+		f := filepath.Join(tmpDir, fmt.Sprintf("app%02d.yaml", i))
+		if err := ioutil.WriteFile(f, []byte("image: ko://"+ip+"\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		want.WriteString("image: gcr.io/fake/" + ip + "@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n\n---\n")
+	}
+
+	inner := &concurrencyBuilder{}
+	builder, err := build.NewCaching(inner)
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{tmpDir}, ConcurrentFiles: 3},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{},
+		nil,
+		out)
+
+	if inner.max > 3 {
+		t.Errorf("resolved %d files at once, want at most 3", inner.max)
+	}
+	// The output keeps the order of the files, whichever resolved first.
+	if diff := cmp.Diff(want.String(), out.String()); diff != "" {
+		t.Errorf("resolveFilesToWriter(); (-want +got) = %v", diff)
+	}
+}
+
+// gatedBuilder holds up building first until last has been built.
+type gatedBuilder struct {
+	fakeBuilder
+	first, last string
+	built       chan struct{}
+	timedOut    bool
+}
+
+func (b *gatedBuilder) Build(s string) (v1.Image, error) {
+	switch s {
+	case b.first:
+		select {
+		case <-b.built:
+		case <-time.After(5 * time.Second):
+			b.timedOut = true
+		}
+	case b.last:
+		close(b.built)
+	}
+	return b.fakeBuilder.Build(s)
+}
+
+func TestResolveFilesWorkersOutpaceOutput(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	const files = 10
+	var want strings.Builder
+	for i := 0; i < files; i++ {
+		ip := fmt.Sprintf("github.com/foo/app%02d", i)
+		f := filepath.Join(tmpDir, fmt.Sprintf("app%02d.yaml", i))
+		if err := ioutil.WriteFile(f, []byte("image: ko://"+ip+"\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		want.WriteString("image: gcr.io/fake/" + ip + "@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef\n\n---\n")
+	}
+
+	// The first file can't be output until every other file has been
+	// resolved by the one other worker, so workers mustn't wait for the
+	// files before theirs to be output.
+	inner := &gatedBuilder{
+		first: "github.com/foo/app00",
+		last:  fmt.Sprintf("github.com/foo/app%02d", files-1),
+		built: make(chan struct{}),
+	}
+	builder, err := build.NewCaching(inner)
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{tmpDir}, ConcurrentFiles: 2},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{},
+		nil,
+		out)
+
+	if inner.timedOut {
+		t.Error("the other files weren't resolved while the first was held up")
+	}
+	if diff := cmp.Diff(want.String(), out.String()); diff != "" {
+		t.Errorf("resolveFilesToWriter(); (-want +got) = %v", diff)
+	}
+}
+
+func TestGzipWriteCloserFlushes(t *testing.T) {
+	out := &nopWriteCloser{}
+	zw := newGzipWriteCloser(out)
+	if _, err := zw.Write([]byte("kind: Namespace\n---\n")); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	// The document can be read before the stream is closed.
+	zr, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %v", err)
+	}
+	b := make([]byte, len("kind: Namespace\n---\n"))
+	if _, err := io.ReadFull(zr, b); err != nil {
+		t.Fatalf("ReadFull() = %v", err)
+	}
+	if got, want := string(b), "kind: Namespace\n---\n"; got != want {
+		t.Errorf("read %q before Close(), want %q", got, want)
+	}
+	if err := zw.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestApplyOrderedByKind(t *testing.T) {
+	bodies := [][]byte{
+		[]byte("kind: Deployment\nmetadata:\n  name: app\n---\nkind: Namespace\nmetadata:\n  name: app\n"),
+		[]byte("kind: Job\nmetadata:\n  name: migrate\n  annotations:\n    ko.build/apply-order: \"-1\"\n"),
+	}
+	kinds := func(docs [][]byte) []string {
+		var got []string
+		for _, doc := range docs {
+			var obj struct {
+				Kind string `yaml:"kind"`
+			}
+			if err := yaml.Unmarshal(doc, &obj); err != nil {
+				t.Fatalf("yaml.Unmarshal() = %v", err)
+			}
+			got = append(got, obj.Kind)
+		}
+		return got
+	}
+
+	// The apply order takes precedence over the order of kinds.
+	got, err := applyOrdered(bodies, true)
+	if err != nil {
+		t.Fatalf("applyOrdered() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"Job", "Namespace", "Deployment"}, kinds(got)); diff != "" {
+		t.Errorf("applyOrdered() kinds; (-want +got) = %v", diff)
+	}
+
+	// Without an apply order, the documents are sorted by kind alone.
+	got, err = applyOrdered(bodies[:1], true)
+	if err != nil {
+		t.Fatalf("applyOrdered() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"Namespace", "Deployment"}, kinds(got)); diff != "" {
+		t.Errorf("applyOrdered() kinds; (-want +got) = %v", diff)
+	}
+
+	// Unless asked to, the bodies are written as they are.
+	got, err = applyOrdered(bodies[:1], false)
+	if err != nil {
+		t.Fatalf("applyOrdered() = %v", err)
+	}
+	if diff := cmp.Diff(bodies[:1], got); diff != "" {
+		t.Errorf("applyOrdered(); (-want +got) = %v", diff)
+	}
+}
+
+func TestResolveFilesShowChanges(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f := filepath.Join(tmpDir, "app.yaml")
+	if err := ioutil.WriteFile(f, []byte(`kind: Pod
+metadata:
+  name: app
+spec:
+  containers:
+  - image: ko://github.com/foo/app
+  - image: busybox
+  - image: ko://github.com/foo/sidecar
+`), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	builder, err := build.NewCaching(fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{f}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{ShowChanges: true},
+		nil,
+		out)
+
+	digest := "@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef"
+	want := f + ": Pod/app: spec.containers[0].image: ko://github.com/foo/app -> gcr.io/fake/github.com/foo/app" + digest + "\n" +
+		f + ": Pod/app: spec.containers[2].image: ko://github.com/foo/sidecar -> gcr.io/fake/github.com/foo/sidecar" + digest + "\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("changes; (-want +got) = %v", diff)
+	}
+}
+
+func TestShouldResolve(t *testing.T) {
+	fo := &options.FilenameOptions{
+		Filenames:   []string{"config", "single.yaml"},
+		ResolveOnly: []string{"apps/*.yaml", "single.yaml"},
+	}
+	for _, test := range []struct {
+		f    string
+		want bool
+	}{
+		{"config/apps/app.yaml", true},
+		{"config/apps/nested/app.yaml", false},
+		{"config/infra/db.yaml", false},
+		{"single.yaml", true},
+	} {
+		if got := options.ShouldResolve(fo, test.f); got != test.want {
+			t.Errorf("ShouldResolve(%q) = %v, want %v", test.f, got, test.want)
+		}
+	}
+	if !options.ShouldResolve(&options.FilenameOptions{Filenames: []string{"config"}}, "config/infra/db.yaml") {
+		t.Error("ShouldResolve() without --resolve-only = false, want true")
+	}
+}
+
+func TestResolveFilesMerge(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	base := filepath.Join(tmpDir, "base")
+	prod := filepath.Join(tmpDir, "prod")
+	for f, content := range map[string]string{
+		filepath.Join(base, "app.yaml"): `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: ko://github.com/foo/app
+        name: app
+`,
+		filepath.Join(prod, "app.yaml"): `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 3
+`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), os.ModePerm); err != nil {
+			t.Fatalf("MkdirAll() = %v", err)
+		}
+		if err := ioutil.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	builder, err := build.NewCaching(fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	out := &nopWriteCloser{}
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: []string{base, prod}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{},
+		&options.ResolveOptions{},
+		&options.OutputOptions{Merge: true},
+		nil,
+		out)
+
+	want := []string{`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - image: gcr.io/fake/github.com/foo/app@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef
+        name: app
+`}
+	var got []string
+	for _, doc := range strings.Split(out.String(), "\n---\n") {
+		if doc != "" {
+			got = append(got, doc)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("merged files; (-want +got) = %v", diff)
+	}
+}
+
+func TestInsecureRegistry(t *testing.T) {
+	defer os.Setenv("KO_DOCKER_REPO", os.Getenv("KO_DOCKER_REPO"))
+	os.Setenv("KO_DOCKER_REPO", "registry.internal:5000/apps")
+
+	for _, test := range []struct {
+		desc string
+		lo   options.LocalOptions
+		want string
+	}{{
+		desc: "secure",
+	}, {
+		desc: "insecure",
+		lo:   options.LocalOptions{InsecureRegistry: true},
+		want: "registry.internal:5000",
+	}, {
+		desc: "local",
+		lo:   options.LocalOptions{InsecureRegistry: true, Local: true},
+	}} {
+		if got := insecureRegistry(&test.lo); got != test.want {
+			t.Errorf("%s: insecureRegistry() = %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestNewBuilderRemote(t *testing.T) {
+	for _, test := range []struct {
+		desc    string
+		bo      options.BuildOptions
+		ta      options.TagsOptions
+		wantErr bool
+	}{{
+		desc: "defaults",
+	}, {
+		desc:    "local platform",
+		bo:      options.BuildOptions{Platform: "linux/arm64"},
+		wantErr: true,
+	}, {
+		desc:    "local builder",
+		bo:      options.BuildOptions{Builder: "buildpacks"},
+		wantErr: true,
+	}, {
+		desc:    "disk cache",
+		bo:      options.BuildOptions{DiskCache: true},
+		wantErr: true,
+	}, {
+		desc:    "source hash tags",
+		ta:      options.TagsOptions{Tags: []string{"src-{{.SourceHash}}"}},
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			test.bo.BuilderEndpoint = "https://builds.example.com"
+			_, err := newBuilder(&test.bo, &options.LocalOptions{}, &test.ta)
+			if (err != nil) != test.wantErr {
+				t.Errorf("newBuilder() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewBuilderOptionErrors(t *testing.T) {
+	// Errors in the options of the go builder are returned, rather than
+	// exiting.
+	bo := &options.BuildOptions{VerifyBase: "cosign.pub", VerifyBaseRoots: "fulcio.pem"}
+	if _, err := newBuilder(bo, &options.LocalOptions{}, &options.TagsOptions{}); err == nil {
+		t.Error("newBuilder() = nil, want error")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/google/ko/pkg/commands/options"
 	"github.com/spf13/cobra"
@@ -25,7 +26,7 @@ import (
 
 // addRun augments our CLI surface with run.
 func addRun(topLevel *cobra.Command) {
-	lo := &options.LocalOptions{}
+	lo := &options.LocalOptions{Push: true}
 	po := &options.PublishOptions{}
 	no := &options.NameOptions{}
 	ta := &options.TagsOptions{}
@@ -34,7 +35,7 @@ func addRun(topLevel *cobra.Command) {
 	run := &cobra.Command{
 		Use:   "run NAME --image=IMPORTPATH",
 		Short: "A variant of `kubectl run` that containerizes IMPORTPATH first.",
-		Long:  `This sub-command combines "ko publish" and "kubectl run" to support containerizing and running Go binaries on Kubernetes in a single command.`,
+		Long:  `This sub-command combines "ko publish" and "kubectl run" to support containerizing and running Go binaries on Kubernetes in a single command. When publishing to a local Docker daemon, the image is run there with "docker run" instead.`,
 		Example: `
   # Publish the --image and run it on Kubernetes as:
   #   ${KO_DOCKER_REPO}/<package name>-<hash of import path>
@@ -43,9 +44,17 @@ func addRun(topLevel *cobra.Command) {
   ko run foo --image=github.com/foo/bar/cmd/baz
 
   # This supports relative import paths as well.
-  ko run foo --image=./cmd/baz`,
+  ko run foo --image=./cmd/baz
+
+  # Load the --image into the local Docker daemon and run it
+  # there with "docker run" instead, passing any arguments
+  # following "--" to the container.
+  ko run foo --local --image=./cmd/baz -- --port=8080`,
 		Run: func(cmd *cobra.Command, args []string) {
-			builder, err := makeBuilder(bo)
+			if !lo.Push {
+				log.Fatal("--push=false leaves the images unpublished, which ko run can't deploy")
+			}
+			builder, err := makeBuilder(bo, lo, ta)
 			if err != nil {
 				log.Fatalf("error creating builder: %v", err)
 			}
@@ -58,25 +67,34 @@ func addRun(topLevel *cobra.Command) {
 				log.Fatalf("failed to publish images: %v", err)
 			}
 
+			// Images published to the daemon are run there directly.
+			local := lo.Local || isLocalDockerRepo()
+
 			// There's only one, but this is the simple way to access the
 			// reference since the import path may have been qualified.
 			for k, v := range imgs {
 				log.Printf("Running %q", k)
-				// Issue a "kubectl run" command with our same arguments,
-				// but supply a second --image to override the one we intercepted.
-				argv := append(os.Args[1:], "--image", v.String())
-				kubectlCmd := exec.Command("kubectl", argv...)
+				var runCmd *exec.Cmd
+				if local {
+					// Issue a "docker run" command for the image we loaded.
+					runCmd = exec.Command("docker", dockerRunArgs(v.String(), args, cmd.ArgsLenAtDash())...)
+				} else {
+					// Issue a "kubectl run" command with our same arguments,
+					// but supply a second --image to override the one we intercepted.
+					argv := append(os.Args[1:], "--image", v.String())
+					runCmd = exec.Command("kubectl", argv...)
+				}
 
 				// Pass through our environment
-				kubectlCmd.Env = os.Environ()
+				runCmd.Env = os.Environ()
 				// Pass through our std*
-				kubectlCmd.Stderr = os.Stderr
-				kubectlCmd.Stdout = os.Stdout
-				kubectlCmd.Stdin = os.Stdin
+				runCmd.Stderr = os.Stderr
+				runCmd.Stdout = os.Stdout
+				runCmd.Stdin = os.Stdin
 
 				// Run it.
-				if err := kubectlCmd.Run(); err != nil {
-					log.Fatalf("error executing \"kubectl run\": %v", err)
+				if err := runCmd.Run(); err != nil {
+					log.Fatalf("error executing %q: %v", strings.Join(runCmd.Args[:2], " "), err)
 				}
 			}
 		},
@@ -94,3 +112,19 @@ func addRun(topLevel *cobra.Command) {
 
 	topLevel.AddCommand(run)
 }
+
+// dockerRunArgs returns the argv for "docker run" of the given image, based
+// on the positional arguments to "ko run": an optional container name, and
+// then any arguments for the container following "--".
+func dockerRunArgs(image string, args []string, argsLenAtDash int) []string {
+	argv := []string{"run", "--rm", "-i"}
+	names, containerArgs := args, []string{}
+	if argsLenAtDash >= 0 {
+		names, containerArgs = args[:argsLenAtDash], args[argsLenAtDash:]
+	}
+	if len(names) > 0 {
+		argv = append(argv, "--name", names[0])
+	}
+	argv = append(argv, image)
+	return append(argv, containerArgs...)
+}
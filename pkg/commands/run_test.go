@@ -0,0 +1,59 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDockerRunArgs(t *testing.T) {
+	image := "ko.local/foo:deadbeef"
+	tests := []struct {
+		desc          string
+		args          []string
+		argsLenAtDash int
+		want          []string
+	}{{
+		desc:          "no arguments",
+		argsLenAtDash: -1,
+		want:          []string{"run", "--rm", "-i", image},
+	}, {
+		desc:          "container name",
+		args:          []string{"foo"},
+		argsLenAtDash: -1,
+		want:          []string{"run", "--rm", "-i", "--name", "foo", image},
+	}, {
+		desc:          "container args",
+		args:          []string{"--port=8080", "bar"},
+		argsLenAtDash: 0,
+		want:          []string{"run", "--rm", "-i", image, "--port=8080", "bar"},
+	}, {
+		desc:          "container name and args",
+		args:          []string{"foo", "--port=8080"},
+		argsLenAtDash: 1,
+		want:          []string{"run", "--rm", "-i", "--name", "foo", image, "--port=8080"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := dockerRunArgs(image, test.args, test.argsLenAtDash)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("dockerRunArgs(%v, %d); (-want +got) = %v", test.args, test.argsLenAtDash, diff)
+			}
+		})
+	}
+}
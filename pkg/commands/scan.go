@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/publish"
+)
+
+// scanCommand creates the command that runs the --scan-command.  It is a
+// variable so that tests can stand in for the shell.
+var scanCommand = func(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// scanningPublisher runs a scanner, such as trivy, over each image once it
+// has been published, failing the publish if the scanner fails unless
+// continueOnError is set.
+type scanningPublisher struct {
+	inner           publish.Interface
+	command         string
+	continueOnError bool
+}
+
+// scanningPublisher implements Tagger and IndexPublisher
+var _ publish.Tagger = (*scanningPublisher)(nil)
+var _ publish.IndexPublisher = (*scanningPublisher)(nil)
+
+// Publish implements publish.Interface
+func (sp *scanningPublisher) Publish(img v1.Image, s string) (name.Reference, error) {
+	ref, err := sp.inner.Publish(img, s)
+	if err != nil {
+		return nil, err
+	}
+	return ref, sp.scan(img.Digest, s, ref)
+}
+
+// PublishWithTags implements publish.Tagger
+func (sp *scanningPublisher) PublishWithTags(img v1.Image, s string, tags []string) (name.Reference, error) {
+	tagger, ok := sp.inner.(publish.Tagger)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing with tags", sp.inner)
+	}
+	ref, err := tagger.PublishWithTags(img, s, tags)
+	if err != nil {
+		return nil, err
+	}
+	return ref, sp.scan(img.Digest, s, ref)
+}
+
+// PublishIndex implements publish.IndexPublisher
+func (sp *scanningPublisher) PublishIndex(idx v1.ImageIndex, s string) (name.Reference, error) {
+	ip, ok := sp.inner.(publish.IndexPublisher)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing image indexes", sp.inner)
+	}
+	ref, err := ip.PublishIndex(idx, s)
+	if err != nil {
+		return nil, err
+	}
+	return ref, sp.scan(idx.Digest, s, ref)
+}
+
+// scan runs the scan command over the image or index published as ref,
+// passing it the reference, the digest that digest returns and the import
+// path in KO_IMAGE, KO_DIGEST and KO_IMPORT_PATH.
+func (sp *scanningPublisher) scan(digest func() (v1.Hash, error), s string, ref name.Reference) error {
+	h, err := digest()
+	if err != nil {
+		return err
+	}
+	cmd := scanCommand(sp.command)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		"KO_IMAGE="+ref.String(),
+		"KO_DIGEST="+h.String(),
+		"KO_IMPORT_PATH="+s)
+	// Our stdout is the resolved yaml, so the scanner reports to stderr.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	log.Printf("Scanning %v", ref)
+	if err := cmd.Run(); err != nil {
+		if sp.continueOnError {
+			log.Printf("WARNING: scanning %v failed, continuing: %v", ref, err)
+			return nil
+		}
+		return fmt.Errorf("scanning %v failed: %v", ref, err)
+	}
+	return nil
+}
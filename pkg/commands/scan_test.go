@@ -0,0 +1,146 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// TestScanHelper isn't a real test, but stands in for the scan command when
+// run by fakeScanner.  It exits with KO_TEST_SCAN_EXIT, or 3 if it wasn't
+// passed the image it expects.
+func TestScanHelper(t *testing.T) {
+	if os.Getenv("KO_TEST_SCAN") != "1" {
+		return
+	}
+	for _, v := range []string{"KO_IMAGE", "KO_DIGEST", "KO_IMPORT_PATH"} {
+		if got, want := os.Getenv(v), os.Getenv("KO_TEST_WANT_"+v); got != want {
+			fmt.Fprintf(os.Stderr, "%s = %q, want %q\n", v, got, want)
+			os.Exit(3)
+		}
+	}
+	code, _ := strconv.Atoi(os.Getenv("KO_TEST_SCAN_EXIT"))
+	os.Exit(code)
+}
+
+// fakeScanner returns a scanCommand that runs TestScanHelper, exiting with
+// code, and records the command it was passed in command.
+func fakeScanner(code int, want map[string]string, command *string) func(string) *exec.Cmd {
+	return func(c string) *exec.Cmd {
+		*command = c
+		cmd := exec.Command(os.Args[0], "-test.run=TestScanHelper")
+		cmd.Env = append(os.Environ(), "KO_TEST_SCAN=1", fmt.Sprintf("KO_TEST_SCAN_EXIT=%d", code))
+		for k, v := range want {
+			cmd.Env = append(cmd.Env, "KO_TEST_WANT_"+k+"="+v)
+		}
+		return cmd
+	}
+}
+
+func TestScanningPublisher(t *testing.T) {
+	defer func(orig func(string) *exec.Cmd) {
+		scanCommand = orig
+	}(scanCommand)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	importpath := "github.com/foo/app"
+	want := map[string]string{
+		"KO_IMAGE":       "gcr.io/fake/" + importpath + "@sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
+		"KO_DIGEST":      h.String(),
+		"KO_IMPORT_PATH": importpath,
+	}
+
+	for _, test := range []struct {
+		desc            string
+		code            int
+		continueOnError bool
+		wantErr         bool
+	}{{
+		desc: "clean",
+	}, {
+		desc:    "vulnerable",
+		code:    1,
+		wantErr: true,
+	}, {
+		desc:            "vulnerable, continuing",
+		code:            1,
+		continueOnError: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var command string
+			scanCommand = fakeScanner(test.code, want, &command)
+
+			sp := &scanningPublisher{
+				inner:           fakePublisher{},
+				command:         `trivy image --exit-code 1 "$KO_IMAGE"`,
+				continueOnError: test.continueOnError,
+			}
+			ref, err := sp.Publish(img, importpath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Publish() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && ref.String() != want["KO_IMAGE"] {
+				t.Errorf("Publish() = %v, want %v", ref, want["KO_IMAGE"])
+			}
+			if command != sp.command {
+				t.Errorf("ran %q, want %q", command, sp.command)
+			}
+		})
+	}
+
+	// A scanner that wasn't passed the image fails the publish.
+	var command string
+	scanCommand = fakeScanner(0, map[string]string{"KO_IMAGE": "gcr.io/other"}, &command)
+	sp := &scanningPublisher{inner: fakePublisher{}, command: "scan"}
+	if _, err := sp.Publish(img, importpath); err == nil {
+		t.Error("Publish() with the wrong image in the environment = nil, want error")
+	}
+}
+
+func TestScanSkippedWithoutPush(t *testing.T) {
+	defer func(orig func(string) *exec.Cmd) {
+		scanCommand = orig
+	}(scanCommand)
+	scanCommand = func(c string) *exec.Cmd {
+		t.Errorf("ran %q, want no scan of unpublished images", c)
+		return exec.Command("false")
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	pub, err := makePublisher(&options.NameOptions{}, &options.LocalOptions{ScanCommand: "trivy image \"$KO_IMAGE\""}, &options.TagsOptions{})
+	if err != nil {
+		t.Fatalf("makePublisher() = %v", err)
+	}
+	if _, err := pub.Publish(img, "github.com/foo/app"); err != nil {
+		t.Errorf("Publish() = %v", err)
+	}
+}
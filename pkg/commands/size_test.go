@@ -0,0 +1,44 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "512B", want: 512},
+		{in: "50MB", want: 50000000},
+		{in: "50mb", want: 50000000},
+		{in: "1.5GiB", want: 1610612736},
+		{in: "64 KiB", want: 65536},
+		{in: "MB", wantErr: true},
+		{in: "-1MB", wantErr: true},
+		{in: "50 megabytes", wantErr: true},
+	} {
+		got, err := parseSize(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSize(%q) = %v, wantErr %v", test.in, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSize(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/google/ko/pkg/build"
+)
+
+// summaryEntry is the JSON written by --summary for each built image.
+type summaryEntry struct {
+	ImportPath      string  `json:"importPath"`
+	Digest          string  `json:"digest"`
+	Size            int64   `json:"size"`
+	BaseImage       string  `json:"baseImage"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// buildSummary collects the results of the builds done while resolving
+// files.  An import path referenced from several files is built once, and
+// the other references are served from the cache, so only the first result
+// for each import path is kept.
+type buildSummary struct {
+	m       sync.Mutex
+	entries map[string]summaryEntry
+}
+
+func (bs *buildSummary) add(results []build.Result) {
+	bs.m.Lock()
+	defer bs.m.Unlock()
+	if bs.entries == nil {
+		bs.entries = make(map[string]summaryEntry)
+	}
+	for _, r := range results {
+		if _, ok := bs.entries[r.ImportPath]; ok {
+			continue
+		}
+		bs.entries[r.ImportPath] = summaryEntry{
+			ImportPath:      r.ImportPath,
+			Digest:          r.Digest.String(),
+			Size:            r.Size,
+			BaseImage:       baseImageRef(r.ImportPath).String(),
+			DurationSeconds: r.Duration.Seconds(),
+		}
+	}
+}
+
+// write writes the summary, sorted by import path, as a JSON array.
+func (bs *buildSummary) write(w io.Writer) error {
+	bs.m.Lock()
+	defer bs.m.Unlock()
+	entries := []summaryEntry{}
+	for _, e := range bs.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ImportPath < entries[j].ImportPath
+	})
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// writeFile writes the summary to the file named by --summary.
+func (bs *buildSummary) writeFile(path string) error {
+	if path == "-" {
+		return bs.write(os.Stderr)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := bs.write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+func TestSummary(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"foo.yaml":  "image: ko://github.com/foo/foo\n",
+		"both.yaml": "image: ko://github.com/foo/foo\n---\nimage: ko://github.com/foo/bar\n",
+	}
+	var filenames []string
+	for name, content := range files {
+		f := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		filenames = append(filenames, f)
+	}
+
+	builder, err := build.NewCaching(fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	summaryFile := filepath.Join(tmpDir, "summary.json")
+	resolveFilesToWriter(builder, fakePublisher{},
+		&options.FilenameOptions{Filenames: filenames},
+		&options.SelectorOptions{},
+		&options.StrictOptions{Strict: true},
+		&options.ResolveOptions{},
+		&options.OutputOptions{Summary: summaryFile},
+		nil,
+		&nopWriteCloser{})
+
+	b, err := ioutil.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+
+	var importPaths []string
+	for _, entry := range got {
+		keys := map[string]bool{}
+		for k := range entry {
+			keys[k] = true
+		}
+		want := map[string]bool{"importPath": true, "digest": true, "size": true, "baseImage": true, "durationSeconds": true}
+		if diff := cmp.Diff(want, keys); diff != "" {
+			t.Errorf("summary keys; (-want +got) = %v", diff)
+		}
+		importPaths = append(importPaths, entry["importPath"].(string))
+		if digest, _ := entry["digest"].(string); len(digest) != len("sha256:")+64 {
+			t.Errorf("digest = %q, want a sha256 digest", entry["digest"])
+		}
+		if size, _ := entry["size"].(float64); size <= 0 {
+			t.Errorf("size = %v, want positive", entry["size"])
+		}
+		if base := entry["baseImage"]; base != defaultBaseImage.String() {
+			t.Errorf("baseImage = %v, want %v", base, defaultBaseImage)
+		}
+	}
+	if diff := cmp.Diff([]string{"github.com/foo/bar", "github.com/foo/foo"}, importPaths); diff != "" {
+		t.Errorf("summary import paths; (-want +got) = %v", diff)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+)
+
+// writtenBodies remembers the resolved body last written for each file when
+// watching.  A change to a dependency of an import path that doesn't change
+// what it builds resolves to the same digests, and so to the same body,
+// which there is no need to apply again.
+type writtenBodies map[string][]byte
+
+// changed reports whether b differs from the body last written for the file
+// name, recording b as that body if so.
+func (w writtenBodies) changed(name string, b []byte) bool {
+	if last, ok := w[name]; ok && bytes.Equal(last, b) {
+		return false
+	}
+	w[name] = b
+	return true
+}
+
+// forget forgets the body last written for the file name, e.g. once it has
+// been deleted, so that it is written again if it is recreated.
+func (w writtenBodies) forget(name string) {
+	delete(w, name)
+}
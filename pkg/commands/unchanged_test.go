@@ -0,0 +1,112 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/google/ko/pkg/publish"
+)
+
+func TestWrittenBodies(t *testing.T) {
+	written := make(writtenBodies)
+	for _, step := range []struct {
+		desc string
+		name string
+		body string
+		want bool
+	}{
+		{desc: "first write", name: "a.yaml", body: "image: one", want: true},
+		{desc: "same body", name: "a.yaml", body: "image: one", want: false},
+		{desc: "other file", name: "b.yaml", body: "image: one", want: true},
+		{desc: "new body", name: "a.yaml", body: "image: two", want: true},
+		{desc: "back again", name: "a.yaml", body: "image: one", want: true},
+	} {
+		if got := written.changed(step.name, []byte(step.body)); got != step.want {
+			t.Errorf("%s: changed(%q, %q) = %v, want %v", step.desc, step.name, step.body, got, step.want)
+		}
+	}
+
+	written.forget("a.yaml")
+	if !written.changed("a.yaml", []byte("image: one")) {
+		t.Error("changed() after forget() = false, want true")
+	}
+}
+
+// sameBuilder builds the same image for every github.com import path, as
+// rebuilding after a change that doesn't affect the output does.
+type sameBuilder struct {
+	fakeBuilder
+	img v1.Image
+}
+
+func (b sameBuilder) Build(string) (v1.Image, error) {
+	return b.img, nil
+}
+
+func TestRebuildUnchangedNotRepublished(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	f := filepath.Join(tmpDir, "app.yaml")
+	if err := ioutil.WriteFile(f, []byte("image: ko://github.com/foo/app\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	builder, err := build.NewCaching(sameBuilder{img: img})
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	recorder := &recordingPublisher{}
+	publisher, err := publish.NewCaching(recorder)
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+
+	written := make(writtenBodies)
+	resolveAndWrite := func() bool {
+		b, err := resolveFile(f, &options.FilenameOptions{}, builder, publisher, &options.SelectorOptions{}, &options.StrictOptions{}, nil)
+		if err != nil {
+			t.Fatalf("resolveFile() = %v", err)
+		}
+		return written.changed(f, b)
+	}
+	if !resolveAndWrite() {
+		t.Error("first resolution unchanged, want it written")
+	}
+
+	// A dependency changed, as the watch reports, but the rebuild is the same.
+	builder.Invalidate("github.com/foo/app")
+	if resolveAndWrite() {
+		t.Error("resolution after a no-op change changed, want it not to be written again")
+	}
+	if diff := cmp.Diff([]string{"github.com/foo/app"}, recorder.importPaths); diff != "" {
+		t.Errorf("published import paths (-want +got) = %v", diff)
+	}
+}
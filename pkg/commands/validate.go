@@ -0,0 +1,45 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// validateCommand creates the kubeconform command run by validateManifests.
+// It is a variable so that tests can stand in for kubeconform.
+var validateCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("kubeconform", args...)
+}
+
+// validateManifests checks the resolved yaml in b against the Kubernetes
+// OpenAPI schemas with kubeconform, which works offline once its schemas
+// are cached.  Kinds it has no schema for, such as custom resources, are
+// let through.
+func validateManifests(b []byte) error {
+	cmd := validateCommand("-strict", "-ignore-missing-schemas", "-summary", "-")
+	cmd.Stdin = bytes.NewReader(b)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return fmt.Errorf("running kubeconform, which --validate requires: %v", err)
+	}
+	return fmt.Errorf("invalid manifests:\n%s", strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestValidateKubeconform isn't a real test, but stands in for kubeconform
+// when run by fakeKubeconform.  It rejects replicas that aren't integers.
+func TestValidateKubeconform(t *testing.T) {
+	if os.Getenv("KO_TEST_KUBECONFORM") != "1" {
+		return
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if bytes.Contains(b, []byte("replicas: three")) {
+		fmt.Println("stdin - Deployment foo is invalid: problem validating schema. Check JSON formatting: jsonschema: '/spec/replicas' does not validate: expected integer, but got string")
+		fmt.Println("Summary: 1 resource found parsing stdin - Valid: 0, Invalid: 1, Errors: 0, Skipped: 0")
+		os.Exit(1)
+	}
+	fmt.Println("Summary: 1 resource found parsing stdin - Valid: 1, Invalid: 0, Errors: 0, Skipped: 0")
+	os.Exit(0)
+}
+
+// fakeKubeconform returns a validateCommand that runs
+// TestValidateKubeconform, and records the arguments it was passed in args.
+func fakeKubeconform(args *[]string) func(...string) *exec.Cmd {
+	return func(argv ...string) *exec.Cmd {
+		*args = argv
+		cmd := exec.Command(os.Args[0], "-test.run=TestValidateKubeconform")
+		cmd.Env = append(os.Environ(), "KO_TEST_KUBECONFORM=1")
+		return cmd
+	}
+}
+
+func TestValidateManifests(t *testing.T) {
+	defer func(orig func(...string) *exec.Cmd) {
+		validateCommand = orig
+	}(validateCommand)
+
+	for _, test := range []struct {
+		desc    string
+		input   string
+		wantErr bool
+	}{{
+		desc: "valid",
+		input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  replicas: 3
+`,
+	}, {
+		desc: "invalid",
+		input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  replicas: three
+`,
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var args []string
+			validateCommand = fakeKubeconform(&args)
+
+			err := validateManifests([]byte(test.input))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateManifests() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "/spec/replicas") {
+				t.Errorf("validateManifests() = %v, want kubeconform's output", err)
+			}
+			want := []string{"-strict", "-ignore-missing-schemas", "-summary", "-"}
+			if diff := cmp.Diff(want, args); diff != "" {
+				t.Errorf("kubeconform args (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestValidateManifestsMissingKubeconform(t *testing.T) {
+	defer func(orig func(...string) *exec.Cmd) {
+		validateCommand = orig
+	}(validateCommand)
+	validateCommand = func(args ...string) *exec.Cmd {
+		return exec.Command("ko-test-no-such-kubeconform", args...)
+	}
+
+	err := validateManifests([]byte("kind: Namespace\n"))
+	if err == nil || !strings.Contains(err.Error(), "--validate requires") {
+		t.Errorf("validateManifests() = %v, want an error naming kubeconform", err)
+	}
+}
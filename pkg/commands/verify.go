@@ -0,0 +1,379 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// signatureAnnotation is the annotation on the layers of a cosign signature
+// image that holds the base64 signature of the layer's payload.
+const signatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// The annotations on the layers of keyless cosign signatures that hold the
+// PEM encoded certificate of the signing key, the chain of certificates that
+// issued it, and the bundle of its transparency log entry.
+const (
+	certificateAnnotation = "dev.sigstore.cosign/certificate"
+	chainAnnotation       = "dev.sigstore.cosign/chain"
+	bundleAnnotation      = "dev.sigstore.cosign/bundle"
+)
+
+// signatureVerifier verifies the cosign signatures of base images.  The
+// signatures of an image are published in its repository, tagged
+// sha256-<digest>.sig, where the digest is that of the base image's
+// reference, which is an index for multi-platform bases.
+type signatureVerifier struct {
+	// check checks that sig, with the annotations of the layer that it's on,
+	// is a trusted signature of payload.
+	check func(payload []byte, sig string, annotations map[string]string) error
+	// base returns the base image configured for an import path.
+	base func(string) name.Reference
+	// get fetches the descriptors of base images.
+	get func(name.Reference) (*remote.Descriptor, error)
+	// fetch fetches signature images.
+	fetch func(name.Reference) (v1.Image, error)
+}
+
+// newVerifier returns a verifier of signatures that check trusts, fetching
+// them with keys.
+func newVerifier(check func([]byte, string, map[string]string) error, keys authn.Keychain) *signatureVerifier {
+	return &signatureVerifier{
+		check: check,
+		base:  baseImageRef,
+		get: func(ref name.Reference) (*remote.Descriptor, error) {
+			return remote.Get(ref, remote.WithAuthFromKeychain(keys))
+		},
+		fetch: func(ref name.Reference) (v1.Image, error) {
+			return remote.Image(ref, remote.WithAuthFromKeychain(keys))
+		},
+	}
+}
+
+// newSignatureVerifier returns a verifier of signatures made with the private
+// key of the PEM encoded ECDSA public key in keyPath.
+func newSignatureVerifier(keyPath string, keys authn.Keychain) (*signatureVerifier, error) {
+	key, err := readPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return newVerifier(func(payload []byte, sig string, _ map[string]string) error {
+		return verifyECDSA(key, payload, sig)
+	}, keys), nil
+}
+
+// newKeylessVerifier returns a verifier of keyless signatures, made with keys
+// whose certificates are issued for identity by one of the PEM encoded root
+// certificates in rootsPath, and logged in the transparency log with the PEM
+// encoded ECDSA public key in rekorKeyPath while their certificate was valid.
+func newKeylessVerifier(rootsPath, identity, rekorKeyPath string, keys authn.Keychain) (*signatureVerifier, error) {
+	b, err := ioutil.ReadFile(rootsPath)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s holds no PEM encoded certificates", rootsPath)
+	}
+	if identity == "" {
+		return nil, errors.New("keyless verification requires the identity of the signer")
+	}
+	rekorKey, err := readPublicKey(rekorKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	kv := &keylessVerifier{roots: roots, identity: identity, rekorKey: rekorKey}
+	return newVerifier(kv.check, keys), nil
+}
+
+// readPublicKey reads the PEM encoded ECDSA public key in path.
+func readPublicKey(path string) (*ecdsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key in %s: %v", path, err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %T, only ECDSA public keys are supported", path, pub)
+	}
+	return key, nil
+}
+
+// Verify implements build.VerifyBase, checking that the base image for the
+// import path s is the image, or one of the images of the index, that its
+// reference resolves to, and that that has a trusted signature.
+func (sv *signatureVerifier) Verify(s string, base v1.Image) error {
+	ref := sv.base(s)
+	desc, err := sv.get(ref)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", ref, err)
+	}
+	h := desc.Digest
+	bh, err := base.Digest()
+	if err != nil {
+		return err
+	}
+	switch desc.MediaType {
+	case types.OCIImageIndex, types.DockerManifestList:
+		im, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, m := range im.Manifests {
+			found = found || m.Digest == bh
+		}
+		if !found {
+			return fmt.Errorf("base image %s is not in the index %s resolves to, %s", bh, ref, h)
+		}
+	default:
+		if h != bh {
+			return fmt.Errorf("base image %s is not the image %s resolves to, %s", bh, ref, h)
+		}
+	}
+
+	repo := ref.Context()
+	tag, err := name.NewTag(fmt.Sprintf("%s:%s-%s.sig", repo, h.Algorithm, h.Hex), name.WeakValidation)
+	if err != nil {
+		return err
+	}
+	sigs, err := sv.fetch(tag)
+	if err != nil {
+		return fmt.Errorf("fetching signatures of %s@%s: %v", repo, h, err)
+	}
+	m, err := sigs.Manifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range m.Layers {
+		sig, ok := desc.Annotations[signatureAnnotation]
+		if !ok {
+			continue
+		}
+		layer, err := sigs.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		payload, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := sv.verifySignature(payload, sig, desc.Annotations, h); err != nil {
+			log.Printf("Ignoring signature of %s@%s: %v", repo, h, err)
+			continue
+		}
+		log.Printf("Verified the signature of %s@%s", repo, h)
+		return nil
+	}
+	return fmt.Errorf("no trusted signature of %s@%s", repo, h)
+}
+
+// verifySignature checks that sig is a trusted signature of payload, and that
+// payload is a signature of the image with digest h.
+func (sv *signatureVerifier) verifySignature(payload []byte, sig string, annotations map[string]string, h v1.Hash) error {
+	if err := sv.check(payload, sig, annotations); err != nil {
+		return err
+	}
+
+	// The payload is a "simple signing" document naming what was signed.
+	var ss struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &ss); err != nil {
+		return err
+	}
+	if got := ss.Critical.Image.Digest; got != h.String() {
+		return fmt.Errorf("signature is of %s", got)
+	}
+	return nil
+}
+
+// verifyECDSA checks that the base64 ASN.1 signature sig is key's signature
+// of the SHA-256 digest of payload.
+func verifyECDSA(key *ecdsa.PublicKey, payload []byte, sig string) error {
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(raw, &rs); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	if !ecdsa.Verify(key, sum[:], rs.R, rs.S) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// keylessVerifier checks keyless signatures, which are made with short-lived
+// keys whose certificates name who signed.  As the certificates expire soon
+// after signing, when a signature was made is established by its entry in a
+// transparency log, whose bundle is signed by the log.
+type keylessVerifier struct {
+	roots    *x509.CertPool
+	identity string
+	rekorKey *ecdsa.PublicKey
+}
+
+// rekorBundle is the bundle of the transparency log entry of a signature.
+type rekorBundle struct {
+	SignedEntryTimestamp string
+	Payload              rekorPayload
+}
+
+// rekorPayload is what the transparency log signs.  Its fields are in the
+// order of their JSON keys, so that it marshals to canonical JSON.
+type rekorPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// hashedRekord is the body of the transparency log entry of a signature.
+type hashedRekord struct {
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content string `json:"content"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// check checks that sig is a signature of payload made with the key of a
+// certificate issued for our identity by one of our roots, while the
+// certificate was valid according to the transparency log.
+func (kv *keylessVerifier) check(payload []byte, sig string, annotations map[string]string) error {
+	block, _ := pem.Decode([]byte(annotations[certificateAnnotation]))
+	if block == nil {
+		return errors.New("signature has no certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate holds a %T, only ECDSA public keys are supported", cert.PublicKey)
+	}
+	if err := verifyECDSA(key, payload, sig); err != nil {
+		return err
+	}
+
+	signed, err := kv.checkBundle(payload, sig, annotations[bundleAnnotation])
+	if err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM([]byte(annotations[chainAnnotation]))
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         kv.roots,
+		Intermediates: intermediates,
+		CurrentTime:   signed,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return err
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == kv.identity {
+			return nil
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == kv.identity {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate is not issued for %s", kv.identity)
+}
+
+// checkBundle checks that the transparency log signed bundle, an entry of
+// the signature sig of payload, and returns when the entry was logged.
+func (kv *keylessVerifier) checkBundle(payload []byte, sig, bundle string) (time.Time, error) {
+	if bundle == "" {
+		return time.Time{}, errors.New("signature has no transparency log bundle")
+	}
+	var rb rekorBundle
+	if err := json.Unmarshal([]byte(bundle), &rb); err != nil {
+		return time.Time{}, err
+	}
+	canonical, err := json.Marshal(rb.Payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifyECDSA(kv.rekorKey, canonical, rb.SignedEntryTimestamp); err != nil {
+		return time.Time{}, fmt.Errorf("transparency log bundle: %v", err)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(rb.Payload.Body)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var entry hashedRekord
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, err
+	}
+	sum := sha256.Sum256(payload)
+	if entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(sum[:]) {
+		return time.Time{}, errors.New("transparency log entry is of another payload")
+	}
+	if entry.Spec.Signature.Content != sig {
+		return time.Time{}, errors.New("transparency log entry is of another signature")
+	}
+	return time.Unix(rb.Payload.IntegratedTime, 0), nil
+}
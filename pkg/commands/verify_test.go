@@ -0,0 +1,454 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// payloadLayer is a layer whose blob is a signature payload.
+type payloadLayer []byte
+
+func (pl payloadLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(pl))
+	return h, err
+}
+func (pl payloadLayer) DiffID() (v1.Hash, error) { return pl.Digest() }
+func (pl payloadLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(pl)), nil
+}
+func (pl payloadLayer) Uncompressed() (io.ReadCloser, error) { return pl.Compressed() }
+func (pl payloadLayer) Size() (int64, error)                 { return int64(len(pl)), nil }
+func (pl payloadLayer) MediaType() (types.MediaType, error) {
+	return "application/vnd.dev.cosign.simplesigning.v1+json", nil
+}
+
+// signature returns key's base64 signature of payload.
+func signature(t *testing.T, key *ecdsa.PrivateKey, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S interface{} }{r, s})
+	if err != nil {
+		t.Fatalf("asn1.Marshal() = %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// signedPayload returns the payload of a signature of the image with digest h.
+func signedPayload(h v1.Hash) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"gcr.io/base"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"}}`, h))
+}
+
+// sign returns key's signature of a payload naming the image with digest h.
+func sign(t *testing.T, key *ecdsa.PrivateKey, h v1.Hash) mutate.Addendum {
+	payload := signedPayload(h)
+	return mutate.Addendum{
+		Layer:       payloadLayer(payload),
+		Annotations: map[string]string{signatureAnnotation: signature(t, key, payload)},
+	}
+}
+
+// testVerifier sets up sv to verify the signatures in sigs of the base
+// gcr.io/base:latest, which resolves to desc.
+func testVerifier(t *testing.T, sv *signatureVerifier, desc *remote.Descriptor, sigs ...mutate.Addendum) {
+	img, err := mutate.Append(empty.Image, sigs...)
+	if err != nil {
+		t.Fatalf("mutate.Append() = %v", err)
+	}
+	sv.base = func(string) name.Reference {
+		ref, _ := name.ParseReference("gcr.io/base:latest")
+		return ref
+	}
+	sv.get = func(name.Reference) (*remote.Descriptor, error) {
+		return desc, nil
+	}
+	wantTag := fmt.Sprintf("gcr.io/base:sha256-%s.sig", desc.Digest.Hex)
+	sv.fetch = func(ref name.Reference) (v1.Image, error) {
+		if ref.String() != wantTag {
+			return nil, fmt.Errorf("fetched %v, want %v", ref, wantTag)
+		}
+		return img, nil
+	}
+}
+
+// imageDescriptor returns the descriptor of img, as the registry returns it.
+func imageDescriptor(t *testing.T, img interface {
+	Digest() (v1.Hash, error)
+	MediaType() (types.MediaType, error)
+	RawManifest() ([]byte, error)
+}) *remote.Descriptor {
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		t.Fatalf("MediaType() = %v", err)
+	}
+	b, err := img.RawManifest()
+	if err != nil {
+		t.Fatalf("RawManifest() = %v", err)
+	}
+	return &remote.Descriptor{
+		Descriptor: v1.Descriptor{MediaType: mt, Digest: h, Size: int64(len(b))},
+		Manifest:   b,
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-verify")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() = %v", err)
+	}
+	keyPath := filepath.Join(dir, "cosign.pub")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := base.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	unrelated := v1.Hash{Algorithm: "sha256", Hex: h.Hex[1:] + "0"}
+
+	tests := []struct {
+		desc    string
+		sigs    []mutate.Addendum
+		wantErr bool
+	}{{
+		desc: "signed",
+		sigs: []mutate.Addendum{sign(t, key, h)},
+	}, {
+		desc: "signed among others",
+		sigs: []mutate.Addendum{sign(t, other, h), sign(t, key, h)},
+	}, {
+		desc:    "unsigned",
+		wantErr: true,
+	}, {
+		desc:    "signed with another key",
+		sigs:    []mutate.Addendum{sign(t, other, h)},
+		wantErr: true,
+	}, {
+		desc:    "signature of another image",
+		sigs:    []mutate.Addendum{sign(t, key, unrelated)},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			sv, err := newSignatureVerifier(keyPath, authn.DefaultKeychain)
+			if err != nil {
+				t.Fatalf("newSignatureVerifier() = %v", err)
+			}
+			testVerifier(t, sv, imageDescriptor(t, base), test.sigs...)
+
+			if err := sv.Verify("github.com/foo/bar", base); (err != nil) != test.wantErr {
+				t.Errorf("Verify() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if _, err := newSignatureVerifier(filepath.Join(dir, "missing.pub"), authn.DefaultKeychain); err == nil {
+		t.Error("newSignatureVerifier(missing) = nil, want error")
+	}
+}
+
+func TestSignatureVerifierIndex(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := base.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	other, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	idx := imageDescriptor(t, mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: base}))
+	otherIdx := imageDescriptor(t, mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: other}))
+	check := func(payload []byte, sig string, _ map[string]string) error {
+		return verifyECDSA(&key.PublicKey, payload, sig)
+	}
+
+	tests := []struct {
+		desc    string
+		index   *remote.Descriptor
+		sigs    []mutate.Addendum
+		wantErr bool
+	}{{
+		desc:  "index signed",
+		index: idx,
+		sigs:  []mutate.Addendum{sign(t, key, idx.Digest)},
+	}, {
+		// Signatures are looked up by the digest of the index, so one of
+		// only the platform's image isn't found.
+		desc:    "only the image signed",
+		index:   idx,
+		sigs:    []mutate.Addendum{sign(t, key, h)},
+		wantErr: true,
+	}, {
+		desc:    "image not in the index",
+		index:   otherIdx,
+		sigs:    []mutate.Addendum{sign(t, key, otherIdx.Digest)},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			sv := newVerifier(check, authn.DefaultKeychain)
+			testVerifier(t, sv, test.index, test.sigs...)
+
+			if err := sv.Verify("github.com/foo/bar", base); (err != nil) != test.wantErr {
+				t.Errorf("Verify() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// keylessSigner makes keyless signatures, with certificates issued by its
+// root and logged in its transparency log.
+type keylessSigner struct {
+	t        *testing.T
+	root     *x509.Certificate
+	rootKey  *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newKeylessSigner(t *testing.T) *keylessSigner {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() = %v", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() = %v", err)
+	}
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	return &keylessSigner{t: t, root: root, rootKey: rootKey, rekorKey: rekorKey}
+}
+
+// sign returns a signature of a payload naming the image with digest h, made
+// by email, whose certificate is valid from notBefore for ten minutes, and
+// logged at logged.
+func (ks *keylessSigner) sign(h v1.Hash, email string, notBefore, logged time.Time) mutate.Addendum {
+	t := ks.t
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      notBefore,
+		NotAfter:       notBefore.Add(10 * time.Minute),
+		EmailAddresses: []string{email},
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ks.root, &key.PublicKey, ks.rootKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() = %v", err)
+	}
+
+	payload := signedPayload(h)
+	sig := signature(t, key, payload)
+	var entry hashedRekord
+	sum := sha256.Sum256(payload)
+	entry.Spec.Data.Hash.Algorithm = "sha256"
+	entry.Spec.Data.Hash.Value = hex.EncodeToString(sum[:])
+	entry.Spec.Signature.Content = sig
+	body, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	rb := rekorBundle{Payload: rekorPayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: logged.Unix(),
+		LogID:          "test",
+		LogIndex:       1,
+	}}
+	canonical, err := json.Marshal(rb.Payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	rb.SignedEntryTimestamp = signature(t, ks.rekorKey, canonical)
+	bundle, err := json.Marshal(rb)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+
+	return mutate.Addendum{
+		Layer: payloadLayer(payload),
+		Annotations: map[string]string{
+			signatureAnnotation:   sig,
+			certificateAnnotation: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			bundleAnnotation:      string(bundle),
+		},
+	}
+}
+
+func TestKeylessVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ko-verify")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := newKeylessSigner(t)
+	other := newKeylessSigner(t)
+	rootsPath := filepath.Join(dir, "roots.pem")
+	if err := ioutil.WriteFile(rootsPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ks.root.Raw}), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ks.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() = %v", err)
+	}
+	rekorKeyPath := filepath.Join(dir, "rekor.pub")
+	if err := ioutil.WriteFile(rekorKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("WriteFile() = %v", err)
+	}
+
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := base.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	// The certificate has long expired, but was valid when it was logged.
+	issued := time.Now().Add(-30 * time.Minute)
+	logged := issued.Add(time.Minute)
+	tampered := ks.sign(h, "release@example.com", issued, logged)
+	tampered.Annotations[bundleAnnotation] = strings.Replace(tampered.Annotations[bundleAnnotation], "\"logIndex\":1", "\"logIndex\":2", 1)
+	unlogged := ks.sign(h, "release@example.com", issued, logged)
+	delete(unlogged.Annotations, bundleAnnotation)
+
+	tests := []struct {
+		desc    string
+		sigs    []mutate.Addendum
+		wantErr bool
+	}{{
+		desc: "signed",
+		sigs: []mutate.Addendum{ks.sign(h, "release@example.com", issued, logged)},
+	}, {
+		desc:    "signed by another identity",
+		sigs:    []mutate.Addendum{ks.sign(h, "mallory@example.com", issued, logged)},
+		wantErr: true,
+	}, {
+		desc:    "certificate of another root",
+		sigs:    []mutate.Addendum{other.sign(h, "release@example.com", issued, logged)},
+		wantErr: true,
+	}, {
+		desc:    "logged after the certificate expired",
+		sigs:    []mutate.Addendum{ks.sign(h, "release@example.com", issued, time.Now())},
+		wantErr: true,
+	}, {
+		desc:    "not logged",
+		sigs:    []mutate.Addendum{unlogged},
+		wantErr: true,
+	}, {
+		desc:    "bundle not signed by the log",
+		sigs:    []mutate.Addendum{tampered},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			sv, err := newKeylessVerifier(rootsPath, "release@example.com", rekorKeyPath, authn.DefaultKeychain)
+			if err != nil {
+				t.Fatalf("newKeylessVerifier() = %v", err)
+			}
+			testVerifier(t, sv, imageDescriptor(t, base), test.sigs...)
+
+			if err := sv.Verify("github.com/foo/bar", base); (err != nil) != test.wantErr {
+				t.Errorf("Verify() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if _, err := newKeylessVerifier(rootsPath, "", rekorKeyPath, authn.DefaultKeychain); err == nil {
+		t.Error("newKeylessVerifier() without identity = nil, want error")
+	}
+}
@@ -36,13 +36,22 @@ func addVersion(topLevel *cobra.Command) {
 }
 
 func version() {
+	v := koVersion()
+	if v == "" {
+		fmt.Println("could not determine build information")
+		return
+	}
+	fmt.Println(v)
+}
+
+// koVersion returns the version of ko, or "" if it can't be determined.
+func koVersion() string {
 	if Version == "" {
 		i, ok := debug.ReadBuildInfo()
 		if !ok {
-			fmt.Println("could not determine build information")
-			return
+			return ""
 		}
 		Version = i.Main.Version
 	}
-	fmt.Println(Version)
+	return Version
 }
@@ -0,0 +1,86 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+	"github.com/google/ko/pkg/publish"
+	"github.com/spf13/cobra"
+)
+
+// addWarm augments our CLI surface with warm.
+func addWarm(topLevel *cobra.Command) {
+	lo := &options.LocalOptions{Push: true}
+	no := &options.NameOptions{}
+	fo := &options.FilenameOptions{}
+	ta := &options.TagsOptions{}
+	so := &options.SelectorOptions{}
+	sto := &options.StrictOptions{}
+	bo := &options.BuildOptions{}
+
+	warm := &cobra.Command{
+		Use:   "warm -f FILENAME",
+		Short: "Build and publish the images referenced by the input files, without printing them.",
+		Long:  `This sub-command finds import path references within the provided files, builds them into Go binaries, containerizes them, and publishes them, as resolve does, but discards the resolved yaml. This fills the caches of base images and the registry ahead of a first deploy.`,
+		Example: `
+  # Build and publish the import paths referenced in config/
+  # ahead of deploying it.
+  ko warm -f config/
+
+  # Build and publish them for the nodes they'll run on.
+  ko warm -f config/ --platform=linux/arm64`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if fo.Watch {
+				log.Fatal("--watch can't be used with warm")
+			}
+			builder, err := makeBuilder(bo, lo, ta)
+			if err != nil {
+				log.Fatalf("error creating builder: %v", err)
+			}
+			publisher, err := makePublisher(no, lo, ta)
+			if err != nil {
+				log.Fatalf("error creating publisher: %v", err)
+			}
+			warmFiles(builder, publisher, fo, so, sto)
+		},
+	}
+	options.AddLocalArg(warm, lo)
+	options.AddNamingArgs(warm, no)
+	options.AddFileArg(warm, fo)
+	options.AddTagsArg(warm, ta)
+	options.AddSelectorArg(warm, so)
+	options.AddStrictArg(warm, sto)
+	options.AddBuildOptions(warm, bo)
+	topLevel.AddCommand(warm)
+}
+
+// warmFiles builds and publishes the images referenced by the files in fo,
+// just as resolving them would, and discards the resolved files.
+func warmFiles(builder *build.Caching, publisher publish.Interface, fo *options.FilenameOptions, so *options.SelectorOptions, sto *options.StrictOptions) {
+	resolveFilesToWriter(builder, publisher, fo, so, sto, &options.ResolveOptions{}, &options.OutputOptions{}, nil, &nopWriteCloser{})
+}
+
+// nopWriteCloser is a bytes.Buffer that can be closed, to collect what is
+// written to an io.WriteCloser.
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (*nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,86 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/commands/options"
+)
+
+// recordingPublisher records the import paths that it publishes.
+type recordingPublisher struct {
+	fakePublisher
+
+	m           sync.Mutex
+	importPaths []string
+}
+
+func (rp *recordingPublisher) Publish(img v1.Image, s string) (name.Reference, error) {
+	rp.m.Lock()
+	rp.importPaths = append(rp.importPaths, s)
+	rp.m.Unlock()
+	return rp.fakePublisher.Publish(img, s)
+}
+
+func TestWarmFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ko")
+	if err != nil {
+		t.Fatalf("TempDir() = %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for f, content := range map[string]string{
+		"app.yaml": "image: ko://github.com/foo/app\n---\nimage: ko://github.com/foo/sidecar\n",
+		"db.yaml":  "image: ko://github.com/foo/db\n---\nimage: ko://github.com/foo/app\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, f), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+	}
+
+	recorder := &build.Recorder{Builder: fakeBuilder{}}
+	builder, err := build.NewCaching(recorder)
+	if err != nil {
+		t.Fatalf("NewCaching() = %v", err)
+	}
+	publisher := &recordingPublisher{}
+	warmFiles(builder, publisher,
+		&options.FilenameOptions{Filenames: []string{tmpDir}},
+		&options.SelectorOptions{},
+		&options.StrictOptions{})
+
+	want := []string{"github.com/foo/app", "github.com/foo/db", "github.com/foo/sidecar"}
+	built := recorder.ImportPaths
+	sort.Strings(built)
+	if diff := cmp.Diff(want, built); diff != "" {
+		t.Errorf("built import paths (-want +got) = %v", diff)
+	}
+	// Each file publishes what it references, even where the build is shared.
+	published := publisher.importPaths
+	sort.Strings(published)
+	if diff := cmp.Diff([]string{"github.com/foo/app", "github.com/foo/app", "github.com/foo/db", "github.com/foo/sidecar"}, published); diff != "" {
+		t.Errorf("published import paths (-want +got) = %v", diff)
+	}
+}
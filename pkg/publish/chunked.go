@@ -0,0 +1,331 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// maxChunkAttempts is the number of times we try to upload a chunk, resuming
+// from the offset the registry last acknowledged, before giving up.
+const maxChunkAttempts = 3
+
+// chunkedUploader uploads blobs to a repository as a series of fixed-size
+// chunks, as described by the registry API's chunked upload protocol.
+//
+// remote.Write streams each blob in a single request, which some registries
+// reject for large layers.  By uploading the layers ahead of remote.Write,
+// its existence checks find them and it is left to push only the manifest.
+type chunkedUploader struct {
+	repo      name.Repository
+	client    *http.Client
+	chunkSize int64
+}
+
+// newChunkedUploader returns a chunkedUploader that uploads to repo, with
+// the access to mount the blobs of img's layers from the repositories they
+// were pulled from.
+func newChunkedUploader(repo name.Repository, auth authn.Authenticator, t http.RoundTripper, chunkSize int64, img v1.Image) (*chunkedUploader, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	scopes := []string{repo.Scope(transport.PushScope)}
+	seen := make(map[string]bool)
+	for _, l := range layers {
+		if from, ok := mountSource(repo, l); ok && !seen[from.String()] {
+			seen[from.String()] = true
+			scopes = append(scopes, from.Scope(transport.PullScope))
+		}
+	}
+	tr, err := transport.New(repo.Registry, auth, t, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedUploader{
+		repo:      repo,
+		client:    &http.Client{Transport: tr},
+		chunkSize: chunkSize,
+	}, nil
+}
+
+// mountSource returns the repository that l can be mounted into repo from,
+// which is the one it was pulled from if that is on the same registry.
+func mountSource(repo name.Repository, l v1.Layer) (name.Repository, bool) {
+	ml, ok := l.(*remote.MountableLayer)
+	if !ok {
+		return name.Repository{}, false
+	}
+	from := ml.Reference.Context()
+	if from.RegistryStr() != repo.RegistryStr() || from.RepositoryStr() == repo.RepositoryStr() {
+		return name.Repository{}, false
+	}
+	return from, true
+}
+
+func (cu *chunkedUploader) url(path string) string {
+	u := url.URL{
+		Scheme: cu.repo.Registry.Scheme(),
+		Host:   cu.repo.RegistryStr(),
+		Path:   path,
+	}
+	return u.String()
+}
+
+// Upload uploads each of the image's layers and its config blob that the
+// repository doesn't already have.
+func (cu *chunkedUploader) Upload(img v1.Image) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	cl, err := partial.ConfigLayer(img)
+	if err != nil {
+		return err
+	}
+	for _, l := range append(layers, cl) {
+		if err := cu.uploadLayer(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cu *chunkedUploader) uploadLayer(l v1.Layer) error {
+	h, err := l.Digest()
+	if err != nil {
+		return err
+	}
+	if exists, err := cu.blobExists(h); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	from, _ := mountSource(cu.repo, l)
+	location, mounted, err := cu.initiate(from, h)
+	if err != nil {
+		return err
+	} else if mounted {
+		log.Printf("Mounted blob %v from %v", h, from)
+		return nil
+	}
+
+	rc, err := l.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	buf := make([]byte, cu.chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(rc, buf)
+		if n > 0 {
+			location, err = cu.uploadChunk(location, buf[:n], offset)
+			if err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := cu.commit(location, h); err != nil {
+		return err
+	}
+	log.Printf("Pushed blob %v in %d byte chunks", h, cu.chunkSize)
+	return nil
+}
+
+func (cu *chunkedUploader) blobExists(h v1.Hash) (bool, error) {
+	resp, err := cu.client.Head(cu.url(fmt.Sprintf("/v2/%s/blobs/%s", cu.repo.RepositoryStr(), h)))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusNotFound); err != nil {
+		return false, err
+	}
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// initiate starts an upload session, and returns the location to send the
+// first chunk to.  If from is set, we first ask the registry to mount the
+// blob h from it instead, and report whether it did.
+func (cu *chunkedUploader) initiate(from name.Repository, h v1.Hash) (string, bool, error) {
+	u := cu.url(fmt.Sprintf("/v2/%s/blobs/uploads/", cu.repo.RepositoryStr()))
+	if from.RepositoryStr() != "" {
+		u += "?" + url.Values{
+			"mount": []string{h.String()},
+			"from":  []string{from.RepositoryStr()},
+		}.Encode()
+	}
+	resp, err := cu.client.Post(u, "application/json", nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusCreated, http.StatusAccepted); err != nil {
+		return "", false, err
+	}
+	if resp.StatusCode == http.StatusCreated {
+		return "", true, nil
+	}
+	loc, err := nextLocation(resp)
+	return loc, false, err
+}
+
+// uploadChunk sends chunk, which starts at offset within the blob, to the
+// upload session at location, and returns the location to send the next
+// chunk to.  If sending the chunk fails, we ask the registry how much of the
+// blob it has received and resume from there.
+func (cu *chunkedUploader) uploadChunk(location string, chunk []byte, offset int64) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxChunkAttempts; attempt++ {
+		if attempt > 0 {
+			next, received, err := cu.status(location)
+			if err != nil {
+				return "", fmt.Errorf("resuming upload after %v: %v", lastErr, err)
+			}
+			if received < offset || received > offset+int64(len(chunk)) {
+				return "", fmt.Errorf("resuming upload after %v: registry has %d bytes, want between %d and %d", lastErr, received, offset, offset+int64(len(chunk)))
+			}
+			location = next
+			chunk, offset = chunk[received-offset:], received
+			if len(chunk) == 0 {
+				return location, nil
+			}
+		}
+
+		next, err := cu.patch(location, chunk, offset)
+		if err == nil {
+			return next, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func (cu *chunkedUploader) patch(location string, chunk []byte, offset int64) (string, error) {
+	req, err := http.NewRequest(http.MethodPatch, location, bytes.NewReader(chunk))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1))
+
+	resp, err := cu.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusAccepted, http.StatusNoContent, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return nextLocation(resp)
+}
+
+// status returns the location to continue the upload session at and the
+// number of bytes of the blob that the registry has received so far.
+func (cu *chunkedUploader) status(location string) (string, int64, error) {
+	resp, err := cu.client.Get(location)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusNoContent); err != nil {
+		return "", 0, err
+	}
+	next, err := nextLocation(resp)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// The Range header holds the inclusive range received, e.g. "0-1023".
+	rng := resp.Header.Get("Range")
+	if rng == "" {
+		return next, 0, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("malformed Range header %q", rng)
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed Range header %q: %v", rng, err)
+	}
+	return next, end + 1, nil
+}
+
+func (cu *chunkedUploader) commit(location string, h v1.Hash) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	v := u.Query()
+	v.Set("digest", h.String())
+	u.RawQuery = v.Encode()
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := cu.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return transport.CheckError(resp, http.StatusCreated)
+}
+
+// nextLocation resolves the Location header of resp, which may be relative,
+// against the URL of the request that produced it.
+func nextLocation(resp *http.Response) (string, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("missing Location header in %d response", resp.StatusCode)
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return "", err
+	}
+	return resp.Request.URL.ResolveReference(u).String(), nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// chunkedRegistry is a fake registry that only accepts blobs uploaded in
+// chunks of at most chunkSize bytes.  The first time a second chunk is sent,
+// it keeps only half of it and fails the request, to exercise resumption.
+type chunkedRegistry struct {
+	t         *testing.T
+	repo      string
+	chunkSize int
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	patches   int
+	failed    bool
+	manifests int
+}
+
+func (cr *chunkedRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	blobsPrefix := fmt.Sprintf("/v2/%s/blobs/", cr.repo)
+	uploadsPrefix := blobsPrefix + "uploads/"
+	manifestsPrefix := fmt.Sprintf("/v2/%s/manifests/", cr.repo)
+
+	switch p := r.URL.Path; {
+	case p == "/v2/":
+		w.WriteHeader(http.StatusOK)
+
+	case p == uploadsPrefix && r.Method == http.MethodPost:
+		id := fmt.Sprintf("upload-%d", len(cr.uploads))
+		cr.uploads[id] = nil
+		w.Header().Set("Location", uploadsPrefix+id)
+		w.WriteHeader(http.StatusAccepted)
+
+	case strings.HasPrefix(p, uploadsPrefix):
+		id := strings.TrimPrefix(p, uploadsPrefix)
+		data, ok := cr.uploads[id]
+		if !ok {
+			http.Error(w, "unknown upload", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			cr.accepted(w, id, http.StatusNoContent)
+
+		case http.MethodPatch:
+			cr.patches++
+			var start, end int
+			if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &end); err != nil {
+				http.Error(w, "chunked uploads only", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				cr.t.Errorf("ReadAll() = %v", err)
+			}
+			if start != len(data) || end-start+1 != len(body) || len(body) > cr.chunkSize {
+				http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if start > 0 && !cr.failed {
+				cr.failed = true
+				cr.uploads[id] = append(data, body[:len(body)/2]...)
+				http.Error(w, "connection reset", http.StatusInternalServerError)
+				return
+			}
+			cr.uploads[id] = append(data, body...)
+			cr.accepted(w, id, http.StatusAccepted)
+
+		case http.MethodPut:
+			sum := sha256.Sum256(data)
+			if got, want := r.URL.Query().Get("digest"), "sha256:"+hex.EncodeToString(sum[:]); got != want {
+				http.Error(w, fmt.Sprintf("digest %s, want %s", got, want), http.StatusBadRequest)
+				return
+			}
+			cr.blobs[r.URL.Query().Get("digest")] = data
+			delete(cr.uploads, id)
+			w.WriteHeader(http.StatusCreated)
+
+		default:
+			cr.t.Errorf("Unexpected %s %s", r.Method, p)
+		}
+
+	case strings.HasPrefix(p, blobsPrefix) && r.Method == http.MethodHead:
+		if _, ok := cr.blobs[strings.TrimPrefix(p, blobsPrefix)]; !ok {
+			http.Error(w, "NotFound", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+	case strings.HasPrefix(p, manifestsPrefix) && r.Method == http.MethodPut:
+		cr.manifests++
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		cr.t.Errorf("Unexpected %s %s", r.Method, p)
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (cr *chunkedRegistry) accepted(w http.ResponseWriter, id string, code int) {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", cr.repo, id))
+	if n := len(cr.uploads[id]); n > 0 {
+		w.Header().Set("Range", fmt.Sprintf("0-%d", n-1))
+	}
+	w.WriteHeader(code)
+}
+
+func TestDefaultWithChunkSize(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	base := "blah"
+	importpath := "github.com/Google/go-containerregistry/cmd/crane"
+
+	reg := &chunkedRegistry{
+		t:         t,
+		repo:      fmt.Sprintf("%s/%s", base, strings.ToLower(importpath)),
+		chunkSize: 100,
+		blobs:     make(map[string][]byte),
+		uploads:   make(map[string][]byte),
+	}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	repoName := fmt.Sprintf("%s/%s", u.Host, base)
+	def, err := NewDefault(repoName, WithChunkSize(int64(reg.chunkSize)))
+	if err != nil {
+		t.Fatalf("NewDefault() = %v", err)
+	}
+	if _, err := def.Publish(img, importpath); err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			t.Fatalf("Digest() = %v", err)
+		}
+		if _, ok := reg.blobs[h.String()]; !ok {
+			t.Errorf("layer %v was not uploaded", h)
+		}
+	}
+	if !reg.failed {
+		t.Error("upload was never interrupted")
+	}
+	if reg.patches < 2*1024/reg.chunkSize {
+		t.Errorf("got %d PATCH requests, want chunked uploads", reg.patches)
+	}
+	if reg.manifests != 1 {
+		t.Errorf("got %d manifest uploads, want 1", reg.manifests)
+	}
+}
+
+func TestDefaultWithNegativeChunkSize(t *testing.T) {
+	if _, err := NewDefault("gcr.io/blah", WithChunkSize(-1)); err == nil {
+		t.Error("NewDefault(WithChunkSize(-1)) = nil, want error")
+	}
+}
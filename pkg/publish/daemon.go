@@ -40,11 +40,23 @@ func NewDaemon(namer Namer, tags []string) Interface {
 	return &demon{namer, tags}
 }
 
+// demon implements Tagger
+var _ Tagger = (*demon)(nil)
+
 // Publish implements publish.Interface
 func (d *demon) Publish(img v1.Image, s string) (name.Reference, error) {
+	return d.PublishWithTags(img, s, d.tags)
+}
+
+// PublishWithTags implements publish.Tagger
+func (d *demon) PublishWithTags(img v1.Image, s string, tags []string) (name.Reference, error) {
 	// https://github.com/google/go-containerregistry/issues/212
 	s = strings.ToLower(s)
 
+	tags, err := expandTags(img, tags)
+	if err != nil {
+		return nil, err
+	}
 	h, err := img.Digest()
 	if err != nil {
 		return nil, err
@@ -61,7 +73,7 @@ func (d *demon) Publish(img v1.Image, s string) (name.Reference, error) {
 	}
 	log.Printf("Loaded %v", digestTag)
 
-	for _, tagName := range d.tags {
+	for _, tagName := range tags {
 		log.Printf("Adding tag %v", tagName)
 		tag, err := name.NewTag(fmt.Sprintf("%s/%s:%s", LocalDomain, d.namer(s), tagName))
 		if err != nil {
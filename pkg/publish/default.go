@@ -28,26 +28,37 @@ import (
 
 // defalt is intentionally misspelled to avoid keyword collision (and drive Jon nuts).
 type defalt struct {
-	base     string
-	t        http.RoundTripper
-	auth     authn.Authenticator
-	namer    Namer
-	tags     []string
-	insecure bool
+	base       string
+	t          http.RoundTripper
+	auth       authn.Authenticator
+	namer      Namer
+	tags       []string
+	insecure   bool
+	chunkSize  int64
+	provenance *BuildInfo
+	tagScheme  string
 }
 
 // Option is a functional option for NewDefault.
 type Option func(*defaultOpener) error
 
 type defaultOpener struct {
-	base     string
-	t        http.RoundTripper
-	auth     authn.Authenticator
-	namer    Namer
-	tags     []string
-	insecure bool
+	base       string
+	t          http.RoundTripper
+	auth       authn.Authenticator
+	namer      Namer
+	tags       []string
+	insecure   bool
+	chunkSize  int64
+	provenance *BuildInfo
+	scopes     []string
+	tagScheme  string
 }
 
+// defalt implements Tagger and IndexPublisher
+var _ Tagger = (*defalt)(nil)
+var _ IndexPublisher = (*defalt)(nil)
+
 // Namer is a function from a supported import path to the portion of the resulting
 // image name that follows the "base" repository name.
 type Namer func(string) string
@@ -63,13 +74,20 @@ func identity(in string) string { return in }
 var defaultTags = []string{"latest"}
 
 func (do *defaultOpener) Open() (Interface, error) {
+	t := do.t
+	if len(do.scopes) > 0 {
+		t = &scopeTransport{inner: t, scopes: do.scopes}
+	}
 	return &defalt{
-		base:     do.base,
-		t:        do.t,
-		auth:     do.auth,
-		namer:    do.namer,
-		tags:     do.tags,
-		insecure: do.insecure,
+		base:       do.base,
+		t:          t,
+		auth:       do.auth,
+		namer:      do.namer,
+		tags:       do.tags,
+		insecure:   do.insecure,
+		chunkSize:  do.chunkSize,
+		provenance: do.provenance,
+		tagScheme:  do.tagScheme,
 	}, nil
 }
 
@@ -94,10 +112,28 @@ func NewDefault(base string, options ...Option) (Interface, error) {
 
 // Publish implements publish.Interface
 func (d *defalt) Publish(img v1.Image, s string) (name.Reference, error) {
+	return d.PublishWithTags(img, s, d.tags)
+}
+
+// PublishWithTags implements publish.Tagger
+func (d *defalt) PublishWithTags(img v1.Image, s string, tags []string) (name.Reference, error) {
 	// https://github.com/google/go-containerregistry/issues/212
 	s = strings.ToLower(s)
 
-	for _, tagName := range d.tags {
+	tags, err := expandTags(img, tags)
+	if err != nil {
+		return nil, err
+	}
+	if d.tagScheme == DigestTagScheme {
+		h, err := img.Digest()
+		if err != nil {
+			return nil, err
+		}
+		// Copy, so as not to append to the caller's tags.
+		tags = append(append([]string{}, tags...), h.Hex[:12])
+	}
+
+	for _, tagName := range tags {
 
 		var os []name.Option
 		if d.insecure {
@@ -109,6 +145,15 @@ func (d *defalt) Publish(img v1.Image, s string) (name.Reference, error) {
 		}
 
 		log.Printf("Publishing %v", tag)
+		if d.chunkSize > 0 {
+			cu, err := newChunkedUploader(tag.Context(), d.auth, d.t, d.chunkSize, img)
+			if err != nil {
+				return nil, err
+			}
+			if err := cu.Upload(img); err != nil {
+				return nil, err
+			}
+		}
 		// TODO: This is slow because we have to load the image multiple times.
 		// Figure out some way to publish the manifest with another tag.
 		if err := remote.Write(tag, img, remote.WithAuth(d.auth), remote.WithTransport(d.t)); err != nil {
@@ -124,6 +169,68 @@ func (d *defalt) Publish(img v1.Image, s string) (name.Reference, error) {
 	if err != nil {
 		return nil, err
 	}
+	if d.provenance != nil {
+		if err := d.publishProvenance(s, dig); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Published %v", dig)
+	return &dig, nil
+}
+
+// PublishIndex implements publish.IndexPublisher
+func (d *defalt) PublishIndex(idx v1.ImageIndex, s string) (name.Reference, error) {
+	// https://github.com/google/go-containerregistry/issues/212
+	s = strings.ToLower(s)
+
+	var os []name.Option
+	if d.insecure {
+		os = []name.Option{name.Insecure}
+	}
+	tags, err := expandTags(nil, d.tags)
+	if err != nil {
+		return nil, err
+	}
+	h, err := idx.Digest()
+	if err != nil {
+		return nil, err
+	}
+	if d.tagScheme == DigestTagScheme {
+		tags = append(tags, h.Hex[:12])
+	}
+	for _, tagName := range tags {
+		tag, err := name.NewTag(fmt.Sprintf("%s/%s:%s", d.base, d.namer(s), tagName), os...)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Publishing %v", tag)
+		if err := remote.WriteIndex(tag, idx, remote.WithAuth(d.auth), remote.WithTransport(d.t)); err != nil {
+			return nil, err
+		}
+	}
+
+	dig, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", d.base, d.namer(s), h), os...)
+	if err != nil {
+		return nil, err
+	}
+	if d.provenance != nil {
+		// Each platform's image gets its own provenance, keyed to its
+		// digest, since that is what gets pulled.
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range im.Manifests {
+			pdig, err := name.NewDigest(fmt.Sprintf("%s@%s", dig.Context(), desc.Digest), os...)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.publishProvenance(s, pdig); err != nil {
+				return nil, err
+			}
+		}
+	}
 	log.Printf("Published %v", dig)
 	return &dig, nil
 }
@@ -25,7 +25,11 @@ import (
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/ko/pkg/build"
 )
 
 func TestDefault(t *testing.T) {
@@ -221,3 +225,245 @@ func TestDefaultWithTags(t *testing.T) {
 		t.Errorf("Tag v1.2.3 was not created.")
 	}
 }
+
+func TestDefaultMountsBaseLayers(t *testing.T) {
+	tests := []struct {
+		desc      string
+		chunkSize int64
+	}{{
+		desc: "streamed",
+	}, {
+		desc:      "chunked",
+		chunkSize: 512,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			reg := newMemoryRegistry()
+			server := httptest.NewServer(reg)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+			}
+
+			// Build on top of a base that is already in the registry.
+			baseRef, err := name.NewTag(fmt.Sprintf("%s/base:latest", u.Host))
+			if err != nil {
+				t.Fatalf("NewTag() = %v", err)
+			}
+			rnd, err := random.Image(1024, 2)
+			if err != nil {
+				t.Fatalf("random.Image() = %v", err)
+			}
+			if err := remote.Write(baseRef, rnd); err != nil {
+				t.Fatalf("remote.Write() = %v", err)
+			}
+			base, err := remote.Image(baseRef)
+			if err != nil {
+				t.Fatalf("remote.Image() = %v", err)
+			}
+			add, err := random.Layer(1024, types.DockerLayer)
+			if err != nil {
+				t.Fatalf("random.Layer() = %v", err)
+			}
+			img, err := mutate.AppendLayers(base, add)
+			if err != nil {
+				t.Fatalf("AppendLayers() = %v", err)
+			}
+
+			repoName := fmt.Sprintf("%s/apps", u.Host)
+			pub, err := NewDefault(repoName, WithChunkSize(test.chunkSize))
+			if err != nil {
+				t.Fatalf("NewDefault() = %v", err)
+			}
+			if _, err := pub.Publish(img, "app"); err != nil {
+				t.Fatalf("Publish() = %v", err)
+			}
+
+			baseLayers, err := base.Layers()
+			if err != nil {
+				t.Fatalf("Layers() = %v", err)
+			}
+			for _, l := range baseLayers {
+				h, err := l.Digest()
+				if err != nil {
+					t.Fatalf("Digest() = %v", err)
+				}
+				key := fmt.Sprintf("/v2/apps/app@%s", h)
+				if !contains(reg.mounted, key) {
+					t.Errorf("base layer %s was not mounted", h)
+				}
+				if contains(reg.pushed, key) {
+					t.Errorf("base layer %s was uploaded again", h)
+				}
+			}
+			h, err := add.Digest()
+			if err != nil {
+				t.Fatalf("Digest() = %v", err)
+			}
+			if key := fmt.Sprintf("/v2/apps/app@%s", h); !contains(reg.pushed, key) {
+				t.Errorf("new layer %s was not uploaded", h)
+			}
+		})
+	}
+}
+
+func TestDefaultWithDigestTagScheme(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	reg := newMemoryRegistry()
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	repoName := fmt.Sprintf("%s/repo", u.Host)
+	pub, err := NewDefault(repoName, WithTags([]string{"v1"}), WithTagScheme(DigestTagScheme))
+	if err != nil {
+		t.Fatalf("NewDefault() = %v", err)
+	}
+	ref, err := pub.Publish(img, "app")
+	if err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+	// The reference is still by the full digest.
+	if want := fmt.Sprintf("%s/app@%s", repoName, h); ref.String() != want {
+		t.Errorf("Publish() = %v, want %v", ref, want)
+	}
+	for _, tag := range []string{"v1", h.Hex[:12]} {
+		if _, ok := reg.manifests["/v2/repo/app:"+tag]; !ok {
+			t.Errorf("tag %q was not pushed", tag)
+		}
+	}
+
+	// Image indexes are tagged with their own digest too.
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index() = %v", err)
+	}
+	ih, err := idx.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if _, err := pub.(IndexPublisher).PublishIndex(idx, "index"); err != nil {
+		t.Fatalf("PublishIndex() = %v", err)
+	}
+	for _, tag := range []string{"v1", ih.Hex[:12]} {
+		if _, ok := reg.manifests["/v2/repo/index:"+tag]; !ok {
+			t.Errorf("tag %q of the index was not pushed", tag)
+		}
+	}
+
+	if _, err := NewDefault(repoName, WithTagScheme("digest7")); err == nil {
+		t.Error("NewDefault() with an unknown tag scheme = nil, want error")
+	}
+}
+
+func TestDefaultWithSourceHashTag(t *testing.T) {
+	reg := newMemoryRegistry()
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+	repoName := fmt.Sprintf("%s/repo", u.Host)
+	pub, err := NewDefault(repoName, WithTags([]string{"latest", "src-{{.SourceHash}}"}))
+	if err != nil {
+		t.Fatalf("NewDefault() = %v", err)
+	}
+
+	// Different images built from identical source get the same tag.
+	hash := strings.Repeat("ab", 32)
+	for i := 0; i < 2; i++ {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image() = %v", err)
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile() = %v", err)
+		}
+		cfg = cfg.DeepCopy()
+		cfg.Config.Labels = map[string]string{build.SourceHashLabel: hash}
+		img, err = mutate.ConfigFile(img, cfg)
+		if err != nil {
+			t.Fatalf("ConfigFile() = %v", err)
+		}
+		if _, err := pub.Publish(img, "app"); err != nil {
+			t.Fatalf("Publish() = %v", err)
+		}
+		if _, ok := reg.manifests["/v2/repo/app:src-"+hash]; !ok {
+			t.Errorf("tag %q was not pushed", "src-"+hash)
+		}
+	}
+
+	unlabeled, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	if _, err := pub.Publish(unlabeled, "app"); err == nil {
+		t.Error("Publish() of an image without a source hash = nil, want error")
+	}
+	if _, err := NewDefault(repoName, WithTags([]string{"{{.SourceHash"})); err == nil {
+		t.Error("NewDefault() with an unparseable tag = nil, want error")
+	}
+}
+
+// schemeTransport serves requests from a handler, recording the scheme of
+// each, so that registries can be faked under any host.
+type schemeTransport struct {
+	handler http.Handler
+	schemes map[string]bool
+}
+
+func (st *schemeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	st.schemes[r.URL.Scheme] = true
+	if r.Body == nil {
+		// Unlike client requests, server requests always have a body.
+		r.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	st.handler.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+func TestDefaultInsecure(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	for _, test := range []struct {
+		desc     string
+		insecure bool
+	}{
+		{"secure", false},
+		{"insecure", true},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			st := &schemeTransport{handler: newMemoryRegistry(), schemes: make(map[string]bool)}
+			pub, err := NewDefault("registry.internal:5000/repo", WithTransport(st), Insecure(test.insecure))
+			if err != nil {
+				t.Fatalf("NewDefault() = %v", err)
+			}
+			if _, err := pub.Publish(img, "app"); err != nil {
+				t.Fatalf("Publish() = %v", err)
+			}
+			// Insecure registries are still pinged over https first.
+			if st.schemes["http"] != test.insecure {
+				t.Errorf("used http = %v, want %v", st.schemes["http"], test.insecure)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+type multi struct {
+	primary   Interface
+	secondary []Interface
+}
+
+// NewMulti returns a new publish.Interface that publishes images with each of
+// the provided publishers in turn, e.g. to a registry and also the local
+// daemon, and returns the references that primary publishes them as.
+func NewMulti(primary Interface, secondary ...Interface) Interface {
+	return &multi{primary: primary, secondary: secondary}
+}
+
+// multi implements Interface and IndexPublisher
+var _ Interface = (*multi)(nil)
+var _ IndexPublisher = (*multi)(nil)
+
+// Publish implements publish.Interface
+func (m *multi) Publish(img v1.Image, s string) (name.Reference, error) {
+	ref, err := m.primary.Publish(img, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range m.secondary {
+		if _, err := p.Publish(img, s); err != nil {
+			return nil, err
+		}
+	}
+	return ref, nil
+}
+
+// PublishIndex implements publish.IndexPublisher.  Secondary publishers that
+// can't publish image indexes, such as the daemon, are skipped.
+func (m *multi) PublishIndex(idx v1.ImageIndex, s string) (name.Reference, error) {
+	primary, ok := m.primary.(IndexPublisher)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing image indexes", m.primary)
+	}
+	ref, err := primary.PublishIndex(idx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range m.secondary {
+		ip, ok := p.(IndexPublisher)
+		if !ok {
+			log.Printf("WARNING: not publishing the image index of %s with %T, which doesn't support them", s, p)
+			continue
+		}
+		if _, err := ip.PublishIndex(idx, s); err != nil {
+			return nil, err
+		}
+	}
+	return ref, nil
+}
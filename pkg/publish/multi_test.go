@@ -0,0 +1,70 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// recordingPublish records the import paths it publishes, and returns ref.
+type recordingPublish struct {
+	ref       string
+	err       error
+	published []string
+}
+
+// recordingPublish implements Interface
+var _ Interface = (*recordingPublish)(nil)
+
+func (rp *recordingPublish) Publish(img v1.Image, s string) (name.Reference, error) {
+	rp.published = append(rp.published, s)
+	if rp.err != nil {
+		return nil, rp.err
+	}
+	return name.ParseReference(rp.ref)
+}
+
+func TestMulti(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	importpath := "github.com/google/ko/cmd/ko"
+
+	registry := &recordingPublish{ref: "gcr.io/foo/ko:latest"}
+	daemon := &recordingPublish{ref: "ko.local/ko:latest"}
+	ref, err := NewMulti(registry, daemon).Publish(img, importpath)
+	if err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+	if got, want := ref.String(), registry.ref; got != want {
+		t.Errorf("Publish() = %v, want %v", got, want)
+	}
+	for _, rp := range []*recordingPublish{registry, daemon} {
+		if len(rp.published) != 1 || rp.published[0] != importpath {
+			t.Errorf("published %v to %s, want [%s]", rp.published, rp.ref, importpath)
+		}
+	}
+
+	failing := &recordingPublish{err: errors.New("daemon is not running")}
+	if _, err := NewMulti(registry, failing).Publish(img, importpath); err == nil {
+		t.Error("Publish() = nil, want error")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+type noop struct {
+	base  string
+	namer Namer
+}
+
+// NewNoop returns a new publish.Interface that doesn't publish images, but
+// returns the references they would be published as under the provided base
+// repository, so that builds can be checked without pushing anywhere.
+func NewNoop(base string, namer Namer) Interface {
+	return &noop{base: base, namer: namer}
+}
+
+// noop implements Interface
+var _ Interface = (*noop)(nil)
+
+// Publish implements publish.Interface
+func (n *noop) Publish(img v1.Image, s string) (name.Reference, error) {
+	// https://github.com/google/go-containerregistry/issues/212
+	s = strings.ToLower(s)
+
+	h, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	dig, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", n.base, n.namer(s), h))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Not publishing %v", dig)
+	return &dig, nil
+}
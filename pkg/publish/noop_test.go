@@ -0,0 +1,48 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestNoop(t *testing.T) {
+	importpath := "github.com/Google/ko/cmd/ko"
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+
+	noop := NewNoop("gcr.io/unused", md5Hash)
+	ref, err := noop.Publish(img, importpath)
+	if err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+	want := fmt.Sprintf("gcr.io/unused/%s@%s", md5Hash("github.com/google/ko/cmd/ko"), h)
+	if got := ref.String(); got != want {
+		t.Errorf("Publish() = %v, want %v", got, want)
+	}
+	if _, err := name.NewDigest(ref.String(), name.StrictValidation); err != nil {
+		t.Errorf("NewDigest(%v) = %v", ref, err)
+	}
+}
@@ -15,8 +15,10 @@
 package publish
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -78,17 +80,82 @@ func WithNamer(n Namer) Option {
 	}
 }
 
-// WithTags is a functional option for overriding the image tags
+// WithTags is a functional option for overriding the image tags.  Tags may
+// be templates, e.g. "src-{{.SourceHash}}", expanded for each image.
 func WithTags(tags []string) Option {
 	return func(i *defaultOpener) error {
+		for _, tag := range tags {
+			if isTagTemplate(tag) {
+				if _, err := parseTag(tag); err != nil {
+					return err
+				}
+			}
+		}
 		i.tags = tags
 		return nil
 	}
 }
 
+// DigestTagScheme is the tag scheme that tags each image with the first 12
+// hex characters of its digest.
+const DigestTagScheme = "digest12"
+
+// WithTagScheme is a functional option for tagging each image with a tag
+// derived from it, in addition to those passed to WithTags.  The only
+// scheme is DigestTagScheme, and "" adds no tag.
+func WithTagScheme(scheme string) Option {
+	return func(i *defaultOpener) error {
+		if scheme != "" && scheme != DigestTagScheme {
+			return fmt.Errorf("unknown tag scheme %q, want %q", scheme, DigestTagScheme)
+		}
+		i.tagScheme = scheme
+		return nil
+	}
+}
+
 func Insecure(b bool) Option {
 	return func(i *defaultOpener) error {
 		i.insecure = b
 		return nil
 	}
 }
+
+// WithChunkSize is a functional option for uploading layers to the registry
+// in chunks of at most chunkSize bytes, resuming interrupted chunks from the
+// last byte the registry acknowledged.  A chunkSize of zero streams each
+// layer in a single request.
+func WithChunkSize(chunkSize int64) Option {
+	return func(i *defaultOpener) error {
+		if chunkSize < 0 {
+			return fmt.Errorf("chunk size must not be negative, got %d", chunkSize)
+		}
+		i.chunkSize = chunkSize
+		return nil
+	}
+}
+
+// WithProvenance is a functional option for publishing a SLSA provenance
+// attestation of each image, describing how it was built with info, under
+// the tag "sha256-<digest>.att" in the image's repository.
+func WithProvenance(info BuildInfo) Option {
+	return func(i *defaultOpener) error {
+		i.provenance = &info
+		return nil
+	}
+}
+
+// WithScopes is a functional option for requesting scopes, such as
+// "repository:team/base:pull", in addition to those inferred from each
+// push, for registries that require them to mount blobs across
+// repositories.
+func WithScopes(scopes ...string) Option {
+	return func(i *defaultOpener) error {
+		for _, s := range scopes {
+			if len(strings.Split(s, ":")) < 3 {
+				return fmt.Errorf("scope %q is not of the form <type>:<name>:<actions>", s)
+			}
+		}
+		i.scopes = append(i.scopes, scopes...)
+		return nil
+	}
+}
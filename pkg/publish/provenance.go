@@ -0,0 +1,235 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// StatementType is the type of the in-toto statements we publish.
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	// ProvenanceType is the predicate type of SLSA provenance.
+	ProvenanceType = "https://slsa.dev/provenance/v0.2"
+	// BuildType identifies how ko builds images in their provenance.
+	BuildType = "https://github.com/google/ko/build@v1"
+
+	// StatementMediaType is the payload type of the envelope that holds
+	// the statement.
+	StatementMediaType = "application/vnd.in-toto+json"
+	// EnvelopeMediaType is the media type of the layer that holds the DSSE
+	// envelope of the statement in an attestation image, as cosign
+	// publishes attestations.
+	EnvelopeMediaType types.MediaType = "application/vnd.dsse.envelope.v1+json"
+
+	// The annotations of the layers of cosign attestations, naming the
+	// predicate type of the statement and holding the signature of the
+	// envelope, which is empty as the envelope itself holds its signatures.
+	predicateTypeAnnotation = "predicateType"
+	signatureAnnotation     = "dev.cosignproject.cosign/signature"
+)
+
+// BuildInfo describes how images are built, to record in their provenance.
+type BuildInfo struct {
+	// BuilderID identifies the version of ko that built the images.
+	BuilderID string
+	// Flags are the flags that ko was invoked with.
+	Flags []string
+	// Materials are the sources the images were built from.
+	Materials []Material
+}
+
+// Statement is an in-toto statement about the subject images.
+type Statement struct {
+	Type          string     `json:"_type"`
+	PredicateType string     `json:"predicateType"`
+	Subject       []Subject  `json:"subject"`
+	Predicate     Provenance `json:"predicate"`
+}
+
+// Envelope is a DSSE envelope, holding a statement as its payload.  The
+// statements ko publishes are unsigned, so their signatures are empty.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a signature of the payload of an envelope.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Subject is an image that a statement is about.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is a SLSA provenance predicate.
+type Provenance struct {
+	Builder    Builder    `json:"builder"`
+	BuildType  string     `json:"buildType"`
+	Invocation Invocation `json:"invocation"`
+	Materials  []Material `json:"materials,omitempty"`
+}
+
+// Builder identifies what built the subject.
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// Invocation describes what the subject was built from.
+type Invocation struct {
+	Parameters Parameters `json:"parameters"`
+}
+
+// Parameters are the inputs to building the subject.
+type Parameters struct {
+	ImportPath string   `json:"importPath"`
+	Flags      []string `json:"flags,omitempty"`
+}
+
+// Material is a source the subject was built from.
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// newProvenance returns the provenance of the image published as dig, built
+// from importpath.
+func newProvenance(info BuildInfo, importpath string, dig name.Digest) Statement {
+	h, _ := v1.NewHash(dig.DigestStr())
+	return Statement{
+		Type:          StatementType,
+		PredicateType: ProvenanceType,
+		Subject: []Subject{{
+			Name:   dig.Context().String(),
+			Digest: map[string]string{h.Algorithm: h.Hex},
+		}},
+		Predicate: Provenance{
+			Builder:   Builder{ID: info.BuilderID},
+			BuildType: BuildType,
+			Invocation: Invocation{
+				Parameters: Parameters{
+					ImportPath: importpath,
+					Flags:      info.Flags,
+				},
+			},
+			Materials: info.Materials,
+		},
+	}
+}
+
+// attestationTag returns the tag to publish the attestation of the image
+// published as dig under, which is derived from its digest so that it can
+// be found from the image.
+func attestationTag(dig name.Digest, opts ...name.Option) (name.Tag, error) {
+	h, err := v1.NewHash(dig.DigestStr())
+	if err != nil {
+		return name.Tag{}, err
+	}
+	return name.NewTag(fmt.Sprintf("%s:%s-%s.att", dig.Context(), h.Algorithm, h.Hex), opts...)
+}
+
+// publishProvenance publishes the provenance of the image published as dig,
+// built from importpath, as an attestation alongside it.
+func (d *defalt) publishProvenance(importpath string, dig name.Digest) error {
+	var opts []name.Option
+	if d.insecure {
+		opts = []name.Option{name.Insecure}
+	}
+	tag, err := attestationTag(dig, opts...)
+	if err != nil {
+		return err
+	}
+	att, err := attestationImage(newProvenance(*d.provenance, importpath, dig))
+	if err != nil {
+		return err
+	}
+	log.Printf("Publishing provenance of %v to %v", dig, tag)
+	return remote.Write(tag, att, remote.WithAuth(d.auth), remote.WithTransport(d.t))
+}
+
+// attestationImage returns an image with a single layer holding stmt, in a
+// DSSE envelope.
+func attestationImage(stmt Statement) (v1.Image, error) {
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(Envelope{
+		PayloadType: StatementMediaType,
+		Payload:     payload,
+		Signatures:  []Signature{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mutate.Append(empty.Image, mutate.Addendum{
+		Layer: &blobLayer{content: b, mediaType: EnvelopeMediaType},
+		Annotations: map[string]string{
+			predicateTypeAnnotation: stmt.PredicateType,
+			signatureAnnotation:     "",
+		},
+	})
+}
+
+// blobLayer is a layer holding an arbitrary blob, rather than a tarball.
+type blobLayer struct {
+	content   []byte
+	mediaType types.MediaType
+}
+
+// blobLayer implements v1.Layer
+var _ v1.Layer = (*blobLayer)(nil)
+
+func (bl *blobLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(bl.content))
+	return h, err
+}
+
+func (bl *blobLayer) DiffID() (v1.Hash, error) {
+	return bl.Digest()
+}
+
+func (bl *blobLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(bl.content)), nil
+}
+
+func (bl *blobLayer) Uncompressed() (io.ReadCloser, error) {
+	return bl.Compressed()
+}
+
+func (bl *blobLayer) Size() (int64, error) {
+	return int64(len(bl.content)), nil
+}
+
+func (bl *blobLayer) MediaType() (types.MediaType, error) {
+	return bl.mediaType, nil
+}
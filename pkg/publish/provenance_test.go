@@ -0,0 +1,330 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// memoryRegistry is a fake registry that keeps blobs and manifests in
+// memory, accepting blobs uploaded in any number of chunks or mounted from
+// another repository.
+type memoryRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	// pushed and mounted record the "<repo>@<digest>" of each blob that was
+	// uploaded or mounted.
+	pushed  []string
+	mounted []string
+}
+
+func newMemoryRegistry() *memoryRegistry {
+	return &memoryRegistry{
+		blobs:     make(map[string][]byte),
+		uploads:   make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+}
+
+func (mr *memoryRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Paths are /v2/<repo>/{blobs,manifests}/..., where <repo> may have
+	// slashes of its own.
+	p := r.URL.Path
+	if p == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var kind, rest string
+	for _, k := range []string{"/blobs/uploads/", "/blobs/", "/manifests/"} {
+		if i := strings.LastIndex(p, k); i >= 0 {
+			kind, rest = k, p[i+len(k):]
+			p = p[:i]
+			break
+		}
+	}
+
+	switch {
+	case kind == "/blobs/uploads/" && r.Method == http.MethodPost:
+		q := r.URL.Query()
+		if b, ok := mr.blobs["/v2/"+q.Get("from")+"@"+q.Get("mount")]; ok {
+			mr.blobs[p+"@"+q.Get("mount")] = b
+			mr.mounted = append(mr.mounted, p+"@"+q.Get("mount"))
+			w.Header().Set("Location", p+"/blobs/"+q.Get("mount"))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		id := fmt.Sprintf("upload-%d", len(mr.uploads))
+		mr.uploads[id] = nil
+		w.Header().Set("Location", p+kind+id)
+		w.WriteHeader(http.StatusAccepted)
+
+	case kind == "/blobs/uploads/":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr.uploads[rest] = append(mr.uploads[rest], body...)
+		if r.Method == http.MethodPut {
+			key := p + "@" + r.URL.Query().Get("digest")
+			mr.blobs[key] = mr.uploads[rest]
+			mr.pushed = append(mr.pushed, key)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", p+kind+rest)
+		w.WriteHeader(http.StatusAccepted)
+
+	case kind == "/blobs/":
+		b, ok := mr.blobs[p+"@"+rest]
+		if !ok {
+			http.Error(w, "unknown blob", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		w.Write(b)
+
+	case kind == "/manifests/" && r.Method == http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr.manifests[p+":"+rest] = body
+		mr.types[p+":"+rest] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusCreated)
+
+	case kind == "/manifests/":
+		b, ok := mr.manifests[p+":"+rest]
+		if !ok {
+			http.Error(w, "unknown manifest", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", mr.types[p+":"+rest])
+		w.Write(b)
+
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// readStatement reads the statement in the DSSE envelope held by layer.
+func readStatement(t *testing.T, layer v1.Layer) Statement {
+	rc, err := layer.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed() = %v", err)
+	}
+	defer rc.Close()
+	var env Envelope
+	if err := json.NewDecoder(rc).Decode(&env); err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	if env.PayloadType != StatementMediaType {
+		t.Errorf("PayloadType = %v, want %v", env.PayloadType, StatementMediaType)
+	}
+	var stmt Statement
+	if err := json.Unmarshal(env.Payload, &stmt); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	return stmt
+}
+
+func TestPublishProvenance(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random.Image() = %v", err)
+	}
+	server := httptest.NewServer(newMemoryRegistry())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	info := BuildInfo{
+		BuilderID: "https://github.com/google/ko@v0.1.0",
+		Flags:     []string{"publish", "--provenance", "./cmd/app"},
+		Materials: []Material{{
+			URI:    "git+https://github.com/foo/bar",
+			Digest: map[string]string{"sha1": "0123456789abcdef0123456789abcdef01234567"},
+		}},
+	}
+	importpath := "github.com/foo/bar/cmd/app"
+	repoName := fmt.Sprintf("%s/repo", u.Host)
+	pub, err := NewDefault(repoName, WithProvenance(info))
+	if err != nil {
+		t.Fatalf("NewDefault() = %v", err)
+	}
+	ref, err := pub.Publish(img, importpath)
+	if err != nil {
+		t.Fatalf("Publish() = %v", err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+
+	tag, err := name.NewTag(fmt.Sprintf("%s/%s:sha256-%s.att", repoName, importpath, h.Hex))
+	if err != nil {
+		t.Fatalf("NewTag() = %v", err)
+	}
+	att, err := remote.Image(tag)
+	if err != nil {
+		t.Fatalf("remote.Image(%v) = %v", tag, err)
+	}
+	layers, err := att.Layers()
+	if err != nil {
+		t.Fatalf("Layers() = %v", err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("len(Layers()) = %d, want 1", len(layers))
+	}
+	if mt, err := layers[0].MediaType(); err != nil {
+		t.Errorf("MediaType() = %v", err)
+	} else if mt != EnvelopeMediaType {
+		t.Errorf("MediaType() = %v, want %v", mt, EnvelopeMediaType)
+	}
+	m, err := att.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest() = %v", err)
+	}
+	if got, want := m.Layers[0].Annotations[predicateTypeAnnotation], ProvenanceType; got != want {
+		t.Errorf("%s annotation = %q, want %q", predicateTypeAnnotation, got, want)
+	}
+	got := readStatement(t, layers[0])
+
+	want := Statement{
+		Type:          StatementType,
+		PredicateType: ProvenanceType,
+		Subject: []Subject{{
+			Name:   ref.Context().String(),
+			Digest: map[string]string{"sha256": h.Hex},
+		}},
+		Predicate: Provenance{
+			Builder:   Builder{ID: info.BuilderID},
+			BuildType: BuildType,
+			Invocation: Invocation{
+				Parameters: Parameters{
+					ImportPath: importpath,
+					Flags:      info.Flags,
+				},
+			},
+			Materials: info.Materials,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("provenance (-want +got) = %v", diff)
+	}
+}
+
+func TestPublishIndexProvenance(t *testing.T) {
+	var adds []mutate.IndexAddendum
+	for _, arch := range []string{"amd64", "arm64"} {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("random.Image() = %v", err)
+		}
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{OS: "linux", Architecture: arch},
+			},
+		})
+	}
+	idx := mutate.AppendManifests(empty.Index, adds...)
+
+	server := httptest.NewServer(newMemoryRegistry())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	importpath := "github.com/foo/bar/cmd/app"
+	repoName := fmt.Sprintf("%s/repo", u.Host)
+	pub, err := NewDefault(repoName, WithProvenance(BuildInfo{BuilderID: "https://github.com/google/ko@v0.1.0"}))
+	if err != nil {
+		t.Fatalf("NewDefault() = %v", err)
+	}
+	ref, err := pub.(IndexPublisher).PublishIndex(idx, importpath)
+	if err != nil {
+		t.Fatalf("PublishIndex() = %v", err)
+	}
+	latest, err := name.NewTag(fmt.Sprintf("%s/%s:latest", repoName, importpath))
+	if err != nil {
+		t.Fatalf("NewTag() = %v", err)
+	}
+	if _, err := remote.Index(latest); err != nil {
+		t.Fatalf("remote.Index(%v) = %v", latest, err)
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest() = %v", err)
+	}
+	var want, got []Subject
+	for _, desc := range im.Manifests {
+		want = append(want, Subject{
+			Name:   ref.Context().String(),
+			Digest: map[string]string{"sha256": desc.Digest.Hex},
+		})
+
+		tag, err := name.NewTag(fmt.Sprintf("%s/%s:sha256-%s.att", repoName, importpath, desc.Digest.Hex))
+		if err != nil {
+			t.Fatalf("NewTag() = %v", err)
+		}
+		att, err := remote.Image(tag)
+		if err != nil {
+			t.Fatalf("remote.Image(%v) = %v", tag, err)
+		}
+		layers, err := att.Layers()
+		if err != nil {
+			t.Fatalf("Layers() = %v", err)
+		}
+		if len(layers) != 1 {
+			t.Fatalf("len(Layers()) = %d, want 1", len(layers))
+		}
+		got = append(got, readStatement(t, layers[0]).Subject...)
+	}
+	if len(want) != 2 {
+		t.Fatalf("len(Manifests) = %d, want 2", len(want))
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("attestation subjects (-want +got) = %v", diff)
+	}
+}
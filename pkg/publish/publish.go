@@ -26,3 +26,21 @@ type Interface interface {
 	// of the published image.
 	Publish(v1.Image, string) (name.Reference, error)
 }
+
+// Tagger is implemented by publishers that can publish an image under tags
+// other than those they were configured with.
+type Tagger interface {
+	Interface
+
+	// PublishWithTags is like Publish, but tags the published image with
+	// the provided tags instead of the configured ones.
+	PublishWithTags(v1.Image, string, []string) (name.Reference, error)
+}
+
+// IndexPublisher is implemented by publishers that can publish multi-platform
+// image indexes.
+type IndexPublisher interface {
+	// PublishIndex is like Publish, but for an index of images built for
+	// several platforms.  Returns the digest of the published index.
+	PublishIndex(v1.ImageIndex, string) (name.Reference, error)
+}
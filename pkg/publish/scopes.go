@@ -0,0 +1,90 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// scopeTransport adds scopes to the token requests that pass through it.
+//
+// remote.Write asks the registry's token server only for the scopes it can
+// infer from the image: push on the target repository, and pull on the
+// repositories its layers can be mounted from.  Registries that require
+// more than that to mount a blob across repositories instead fall back on
+// a full upload, so we ask for the extra scopes on every token request.
+type scopeTransport struct {
+	inner  http.RoundTripper
+	scopes []string
+}
+
+var _ http.RoundTripper = (*scopeTransport)(nil)
+
+// RoundTrip implements http.RoundTripper
+func (st *scopeTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	switch in.Method {
+	case http.MethodGet:
+		// The token request of the Docker token protocol.
+		q := in.URL.Query()
+		if _, ok := q["service"]; !ok {
+			break
+		}
+		out := *in
+		u := *in.URL
+		u.RawQuery = st.addScopes(q).Encode()
+		out.URL = &u
+		return st.inner.RoundTrip(&out)
+
+	case http.MethodPost:
+		// The token request of the OAuth2 protocol, when refreshing an
+		// identity token.
+		if in.Body == nil || !strings.HasPrefix(in.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			break
+		}
+		b, err := ioutil.ReadAll(in.Body)
+		in.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		form, err := url.ParseQuery(string(b))
+		if _, ok := form["service"]; ok && err == nil {
+			b = []byte(st.addScopes(form).Encode())
+		}
+		out := *in
+		out.Body = ioutil.NopCloser(bytes.NewReader(b))
+		out.ContentLength = int64(len(b))
+		return st.inner.RoundTrip(&out)
+	}
+	return st.inner.RoundTrip(in)
+}
+
+// addScopes adds the scopes that v doesn't already ask for to it.
+func (st *scopeTransport) addScopes(v url.Values) url.Values {
+	have := make(map[string]bool)
+	for _, s := range v["scope"] {
+		have[s] = true
+	}
+	for _, s := range st.scopes {
+		if !have[s] {
+			v.Add("scope", s)
+			have[s] = true
+		}
+	}
+	return v
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// mountScope is a scope that remote.Write doesn't infer on its own, which
+// scopedRegistry requires to mount blobs from shared/base.
+const mountScope = "repository:shared/base:*"
+
+// scopedRegistry is a fake registry that hands out bearer tokens for the
+// scopes they are requested with, and only mounts blobs across repositories
+// for tokens carrying mountScope.  Like real registries, it falls back on a
+// regular upload when it won't mount a blob.
+type scopedRegistry struct {
+	*memoryRegistry
+	realm string
+}
+
+func (sr *scopedRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		token := base64.URLEncoding.EncodeToString([]byte(strings.Join(r.URL.Query()["scope"], " ")))
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+		return
+	}
+
+	var scopes []string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		b, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(auth, "Bearer "))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scopes = strings.Fields(string(b))
+	} else {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q,service=%q", sr.realm, "fake"))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if q := r.URL.Query(); q.Get("mount") != "" && !contains(scopes, mountScope) {
+		q.Del("mount")
+		q.Del("from")
+		r.URL.RawQuery = q.Encode()
+	}
+	sr.memoryRegistry.ServeHTTP(w, r)
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPublishWithScopes(t *testing.T) {
+	tests := []struct {
+		desc        string
+		scopes      []string
+		wantMounted bool
+	}{{
+		desc: "inferred scopes",
+	}, {
+		desc:        "with mount scope",
+		scopes:      []string{mountScope},
+		wantMounted: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			reg := &scopedRegistry{memoryRegistry: newMemoryRegistry()}
+			server := httptest.NewServer(reg)
+			defer server.Close()
+			reg.realm = server.URL + "/token"
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+			}
+
+			// Seed the registry with a base image, and build on top of it.
+			baseRef, err := name.NewTag(fmt.Sprintf("%s/shared/base:latest", u.Host))
+			if err != nil {
+				t.Fatalf("NewTag() = %v", err)
+			}
+			rnd, err := random.Image(1024, 2)
+			if err != nil {
+				t.Fatalf("random.Image() = %v", err)
+			}
+			if err := remote.Write(baseRef, rnd); err != nil {
+				t.Fatalf("remote.Write() = %v", err)
+			}
+			base, err := remote.Image(baseRef)
+			if err != nil {
+				t.Fatalf("remote.Image() = %v", err)
+			}
+			add, err := random.Layer(1024, "application/vnd.docker.image.rootfs.diff.tar.gzip")
+			if err != nil {
+				t.Fatalf("random.Layer() = %v", err)
+			}
+			img, err := mutate.AppendLayers(base, add)
+			if err != nil {
+				t.Fatalf("AppendLayers() = %v", err)
+			}
+			baseLayers, err := base.Layers()
+			if err != nil {
+				t.Fatalf("Layers() = %v", err)
+			}
+
+			repoName := fmt.Sprintf("%s/apps", u.Host)
+			pub, err := NewDefault(repoName, WithScopes(test.scopes...))
+			if err != nil {
+				t.Fatalf("NewDefault() = %v", err)
+			}
+			if _, err := pub.Publish(img, "app"); err != nil {
+				t.Fatalf("Publish() = %v", err)
+			}
+
+			for _, l := range baseLayers {
+				h, err := l.Digest()
+				if err != nil {
+					t.Fatalf("Digest() = %v", err)
+				}
+				key := fmt.Sprintf("/v2/apps/app@%s", h)
+				if got := contains(reg.mounted, key); got != test.wantMounted {
+					t.Errorf("mounted %s = %v, want %v", h, got, test.wantMounted)
+				}
+				if got := contains(reg.pushed, key); got == test.wantMounted {
+					t.Errorf("pushed %s = %v, want %v", h, got, !test.wantMounted)
+				}
+			}
+		})
+	}
+}
+
+func TestWithScopesInvalid(t *testing.T) {
+	if _, err := NewDefault("gcr.io/foo", WithScopes("shared/base")); err == nil {
+		t.Error("NewDefault() with an invalid scope = nil, want error")
+	}
+}
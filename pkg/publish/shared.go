@@ -15,6 +15,9 @@
 package publish
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -27,50 +30,120 @@ type caching struct {
 	inner Interface
 
 	m       sync.Mutex
-	results map[string]*entry
+	results map[cacheKey]*future
+
+	// digests holds the digest of each image object we're asked to
+	// publish, computed once, since the same image may be published
+	// concurrently and images aren't safe to use concurrently until
+	// they've computed it.
+	digests sync.Map
+	// dm guards computing the digests of images that can't be keyed on.
+	dm sync.Mutex
+}
+
+// digestOnce is the digest of an image, computed once.
+type digestOnce struct {
+	once   sync.Once
+	digest v1.Hash
+	err    error
 }
 
-// entry holds the last image published and the result of publishing it for a
-// particular reference.
-type entry struct {
-	img v1.Image
-	f   *future
+// cacheKey identifies a publish result by the reference (and tags) an image
+// is published under, and by the image's digest, so that distinct images
+// for one reference, such as those built for different platforms, are each
+// published, while identical images are published once.
+type cacheKey struct {
+	ref    string
+	digest v1.Hash
 }
 
-// caching implements Interface
-var _ Interface = (*caching)(nil)
+// caching implements Tagger and IndexPublisher
+var _ Tagger = (*caching)(nil)
+var _ IndexPublisher = (*caching)(nil)
 
 // NewCaching wraps the provided publish.Interface in an implementation that
-// shares publish results for a given path until the passed image object changes.
+// shares publish results for a given path and image digest.
 func NewCaching(inner Interface) (Interface, error) {
 	return &caching{
 		inner:   inner,
-		results: make(map[string]*entry),
+		results: make(map[cacheKey]*future),
 	}, nil
 }
 
 // Publish implements Interface
 func (c *caching) Publish(img v1.Image, ref string) (name.Reference, error) {
+	return c.publish(img, ref, func() (name.Reference, error) {
+		return c.inner.Publish(img, ref)
+	})
+}
+
+// PublishWithTags implements Tagger
+func (c *caching) PublishWithTags(img v1.Image, ref string, tags []string) (name.Reference, error) {
+	tagger, ok := c.inner.(Tagger)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing with tags", c.inner)
+	}
+	// Publishing under different tags is a different result.
+	return c.publish(img, ref+":"+strings.Join(tags, ","), func() (name.Reference, error) {
+		return tagger.PublishWithTags(img, ref, tags)
+	})
+}
+
+// PublishIndex implements IndexPublisher
+func (c *caching) PublishIndex(idx v1.ImageIndex, ref string) (name.Reference, error) {
+	ip, ok := c.inner.(IndexPublisher)
+	if !ok {
+		return nil, fmt.Errorf("publisher %T does not support publishing image indexes", c.inner)
+	}
+	digest, err := idx.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return c.publishKey(cacheKey{ref: ref, digest: digest}, func() (name.Reference, error) {
+		return ip.PublishIndex(idx, ref)
+	})
+}
+
+func (c *caching) publish(img v1.Image, ref string, work func() (name.Reference, error)) (name.Reference, error) {
+	digest, err := c.digest(img)
+	if err != nil {
+		return nil, err
+	}
+	return c.publishKey(cacheKey{ref: ref, digest: digest}, work)
+}
+
+// publishKey shares the result of work among the publishes of key.
+func (c *caching) publishKey(key cacheKey, work func() (name.Reference, error)) (name.Reference, error) {
 	f := func() *future {
 		// Lock the map of futures.
 		c.m.Lock()
 		defer c.m.Unlock()
 
-		// If a future for "ref" exists, then return it.
-		ent, ok := c.results[ref]
-		if ok {
-			// If the image matches, then return the same future.
-			if ent.img == img {
-				return ent.f
-			}
+		// If a future for "key" exists, then return it.
+		if f, ok := c.results[key]; ok {
+			return f
 		}
-		// Otherwise create and record a future for publishing "img" to "ref".
-		f := newFuture(func() (name.Reference, error) {
-			return c.inner.Publish(img, ref)
-		})
-		c.results[ref] = &entry{img: img, f: f}
+		// Otherwise create and record a future for publishing "img".
+		f := newFuture(work)
+		c.results[key] = f
 		return f
 	}()
 
 	return f.Get()
 }
+
+// digest returns the digest of img, computing it once for each image object,
+// without holding up the publishing of other images.
+func (c *caching) digest(img v1.Image) (v1.Hash, error) {
+	if !reflect.TypeOf(img).Comparable() {
+		c.dm.Lock()
+		defer c.dm.Unlock()
+		return img.Digest()
+	}
+	v, _ := c.digests.LoadOrStore(img, &digestOnce{})
+	d := v.(*digestOnce)
+	d.once.Do(func() {
+		d.digest, d.err = img.Digest()
+	})
+	return d.digest, d.err
+}
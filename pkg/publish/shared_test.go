@@ -15,9 +15,12 @@
 package publish
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/random"
@@ -86,3 +89,212 @@ func TestCaching(t *testing.T) {
 		}
 	}
 }
+
+// countingTagger counts the publishes made with each set of tags.
+type countingTagger struct {
+	counts map[string]int
+}
+
+// countingTagger implements Tagger
+var _ Tagger = (*countingTagger)(nil)
+
+func (ct *countingTagger) Publish(img v1.Image, ref string) (name.Reference, error) {
+	return ct.PublishWithTags(img, ref, nil)
+}
+
+func (ct *countingTagger) PublishWithTags(img v1.Image, ref string, tags []string) (name.Reference, error) {
+	ct.counts[fmt.Sprint(tags)]++
+	return makeRef()
+}
+
+func TestCachingWithTags(t *testing.T) {
+	ct := &countingTagger{counts: make(map[string]int)}
+	cb, _ := NewCaching(ct)
+	tagger, ok := cb.(Tagger)
+	if !ok {
+		t.Fatalf("NewCaching() = %T, want a Tagger", cb)
+	}
+
+	img, _ := random.Image(256, 8)
+	for i := 0; i < 2; i++ {
+		if _, err := cb.Publish(img, "foo"); err != nil {
+			t.Errorf("Publish() = %v", err)
+		}
+		for _, tags := range [][]string{{"canary"}, {"edge"}} {
+			if _, err := tagger.PublishWithTags(img, "foo", tags); err != nil {
+				t.Errorf("PublishWithTags(%v) = %v", tags, err)
+			}
+		}
+	}
+
+	// Each set of tags is published once, and shared thereafter.
+	want := map[string]int{"[]": 1, "[canary]": 1, "[edge]": 1}
+	if diff := cmp.Diff(want, ct.counts); diff != "" {
+		t.Errorf("publishes; (-want +got) = %v", diff)
+	}
+
+	// Publishers that can't publish with tags say so.
+	cb, _ = NewCaching(&slowpublish{})
+	if _, err := cb.(Tagger).PublishWithTags(img, "foo", []string{"canary"}); err == nil {
+		t.Error("PublishWithTags() = nil, want error")
+	}
+}
+
+// countingPublish counts the publishes made of each image digest.
+type countingPublish struct {
+	m      sync.Mutex
+	counts map[string]int
+}
+
+// countingPublish implements Interface
+var _ Interface = (*countingPublish)(nil)
+
+func (cp *countingPublish) Publish(img v1.Image, ref string) (name.Reference, error) {
+	d, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	cp.m.Lock()
+	defer cp.m.Unlock()
+	cp.counts[d.String()]++
+	return makeRef()
+}
+
+// otherImage wraps an image so that it's a distinct object with the same
+// contents.
+type otherImage struct {
+	v1.Image
+}
+
+func TestCachingDistinctImages(t *testing.T) {
+	cp := &countingPublish{counts: make(map[string]int)}
+	cb, _ := NewCaching(cp)
+
+	// Variants of one reference, as built for different platforms.
+	amd64, _ := random.Image(256, 1)
+	arm64, _ := random.Image(256, 1)
+	// The wrappers share the state of the images they wrap, so settle it
+	// first, as the builder does before handing images out.
+	for _, img := range []v1.Image{amd64, arm64} {
+		if _, err := img.Digest(); err != nil {
+			t.Fatalf("Digest() = %v", err)
+		}
+	}
+	images := []v1.Image{amd64, arm64, amd64, otherImage{amd64}, arm64, otherImage{arm64}}
+
+	var wg sync.WaitGroup
+	for _, img := range images {
+		wg.Add(1)
+		go func(img v1.Image) {
+			defer wg.Done()
+			if _, err := cb.Publish(img, "foo"); err != nil {
+				t.Errorf("Publish() = %v", err)
+			}
+		}(img)
+	}
+	wg.Wait()
+
+	// Each distinct image is published once, however many objects hold it.
+	want := map[string]int{}
+	for _, img := range []v1.Image{amd64, arm64} {
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Digest() = %v", err)
+		}
+		want[d.String()] = 1
+	}
+	if diff := cmp.Diff(want, cp.counts); diff != "" {
+		t.Errorf("publishes; (-want +got) = %v", diff)
+	}
+}
+
+// slowDigestImage is an image whose digest isn't computed until it's let go.
+type slowDigestImage struct {
+	v1.Image
+	release chan struct{}
+}
+
+func (i *slowDigestImage) Digest() (v1.Hash, error) {
+	<-i.release
+	return i.Image.Digest()
+}
+
+func TestCachingDigestDoesNotBlock(t *testing.T) {
+	cp := &countingPublish{counts: make(map[string]int)}
+	cb, _ := NewCaching(cp)
+
+	base, _ := random.Image(256, 1)
+	slow := &slowDigestImage{Image: base, release: make(chan struct{})}
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		if _, err := cb.Publish(slow, "slow"); err != nil {
+			t.Errorf("Publish(slow) = %v", err)
+		}
+	}()
+
+	// Other images are published while the slow one's digest is computed.
+	fast, _ := random.Image(256, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cb.Publish(fast, "fast"); err != nil {
+			t.Errorf("Publish(fast) = %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Publish(fast) waited on the digest of another image")
+	}
+	close(slow.release)
+	<-slowDone
+}
+
+// countingIndexPublisher counts the publishes of image indexes.
+type countingIndexPublisher struct {
+	slowpublish
+	indexes int
+}
+
+// countingIndexPublisher implements IndexPublisher
+var _ IndexPublisher = (*countingIndexPublisher)(nil)
+
+func (cp *countingIndexPublisher) PublishIndex(idx v1.ImageIndex, ref string) (name.Reference, error) {
+	cp.indexes++
+	return makeRef()
+}
+
+func TestCachingIndex(t *testing.T) {
+	inner := &countingIndexPublisher{}
+	cb, _ := NewCaching(inner)
+	ip, ok := cb.(IndexPublisher)
+	if !ok {
+		t.Fatalf("NewCaching() = %T, want an IndexPublisher", cb)
+	}
+
+	idx, err := random.Index(256, 1, 2)
+	if err != nil {
+		t.Fatalf("random.Index() = %v", err)
+	}
+	ref1, err := ip.PublishIndex(idx, "foo")
+	if err != nil {
+		t.Fatalf("PublishIndex() = %v", err)
+	}
+	ref2, err := ip.PublishIndex(idx, "foo")
+	if err != nil {
+		t.Fatalf("PublishIndex() = %v", err)
+	}
+	if ref1.String() != ref2.String() {
+		t.Errorf("PublishIndex() = %v, then %v, wanted the same", ref1, ref2)
+	}
+	if inner.indexes != 1 {
+		t.Errorf("published the index %d times, want 1", inner.indexes)
+	}
+
+	// Publishers that can't publish indexes are an error, not a panic.
+	cb, _ = NewCaching(&slowpublish{})
+	if _, err := cb.(IndexPublisher).PublishIndex(idx, "foo"); err == nil {
+		t.Error("PublishIndex() with a publisher of images only = nil, want error")
+	}
+}
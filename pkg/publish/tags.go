@@ -0,0 +1,86 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+)
+
+// isTagTemplate reports whether tag is a template, e.g. "{{.SourceHash}}",
+// to be expanded for each image rather than used as is.
+func isTagTemplate(tag string) bool {
+	return strings.Contains(tag, "{{")
+}
+
+// parseTag parses the template tag, whose variables are the methods of
+// tagData.
+func parseTag(tag string) (*template.Template, error) {
+	t, err := template.New("tag").Option("missingkey=error").Parse(tag)
+	if err != nil {
+		return nil, fmt.Errorf("parsing tag %q: %v", tag, err)
+	}
+	return t, nil
+}
+
+// tagData is what tag templates are expanded with, for img.
+type tagData struct {
+	img v1.Image
+}
+
+// SourceHash returns the hash of the source that the image was built from,
+// as labeled by build.WithSourceHash.
+func (d tagData) SourceHash() (string, error) {
+	if d.img == nil {
+		return "", errors.New("image indexes have no source hash")
+	}
+	cfg, err := d.img.ConfigFile()
+	if err != nil {
+		return "", err
+	}
+	h := cfg.Config.Labels[build.SourceHashLabel]
+	if h == "" {
+		return "", fmt.Errorf("image has no %s label, see build.WithSourceHash", build.SourceHashLabel)
+	}
+	return h, nil
+}
+
+// expandTags returns tags with the templates among them expanded for img,
+// which is nil when publishing an image index.
+func expandTags(img v1.Image, tags []string) ([]string, error) {
+	expanded := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !isTagTemplate(tag) {
+			expanded = append(expanded, tag)
+			continue
+		}
+		t, err := parseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, tagData{img: img}); err != nil {
+			return nil, fmt.Errorf("expanding tag %q: %v", tag, err)
+		}
+		expanded = append(expanded, b.String())
+	}
+	return expanded, nil
+}
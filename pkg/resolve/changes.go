@@ -0,0 +1,101 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a string value of a document that resolution changed, e.g. an
+// image reference that was replaced with the image it resolved to.
+type Change struct {
+	// Resource is the kind and name of the document, e.g. Deployment/app,
+	// or "" if it has neither.
+	Resource string
+	// Path is the JSONPath-like path to the value within the document,
+	// e.g. spec.template.spec.containers[0].image.
+	Path string
+	// Old and New are the value before and after resolution.
+	Old, New string
+}
+
+// String returns the change as "path: old -> new", after the resource, if any.
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+	if c.Resource != "" {
+		s = c.Resource + ": " + s
+	}
+	return s
+}
+
+// resourceName returns the kind and name of the decoded document obj, e.g.
+// Deployment/app, or "" if it has neither.
+func resourceName(obj interface{}) string {
+	kind, _ := field(obj, "kind")
+	metadata, _ := field(obj, "metadata")
+	name, _ := field(metadata, "name")
+	k, _ := kind.(string)
+	n, _ := name.(string)
+	if k == "" && n == "" {
+		return ""
+	}
+	return k + "/" + n
+}
+
+// changes calls record with each string value that differs between the
+// decoded documents before and after, which are alike but for their string
+// values, in the order of their sorted keys.  at holds the keys and indexes
+// along which they were reached.
+func changes(resource string, before, after interface{}, at []string, record func(Change)) {
+	switch typed := before.(type) {
+	case map[interface{}]interface{}:
+		m2, ok := after.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		keys := make([]interface{}, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			changes(resource, typed[k], m2[k], append(at[:len(at):len(at)], fmt.Sprint(k)), record)
+		}
+
+	case []interface{}:
+		a2, ok := after.([]interface{})
+		if !ok || len(a2) != len(typed) {
+			return
+		}
+		for idx, v := range typed {
+			changes(resource, v, a2[idx], append(at[:len(at):len(at)], "["+strconv.Itoa(idx)+"]"), record)
+		}
+
+	case string:
+		if s, ok := after.(string); ok && s != typed {
+			record(Change{
+				Resource: resource,
+				Path:     strings.Replace(strings.Join(at, "."), ".[", "[", -1),
+				Old:      typed,
+				New:      s,
+			})
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChanges(t *testing.T) {
+	base := mustRepository("gcr.io/changes")
+	fooDigest := computeDigest(base, fooRef, fooHash)
+	barDigest := computeDigest(base, barRef, barHash)
+
+	input := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: ko://` + fooRef + `
+      - name: sidecar
+        image: busybox
+      initContainers:
+      - name: bar
+        image: ko://` + barRef + `
+---
+- ko://` + fooRef + `
+`)
+
+	var got []string
+	if _, err := ImageReferences(input, true, testBuilder, newFixedPublish(base, testHashes),
+		WithPullPolicy("IfNotPresent"),
+		WithChanges(func(c Change) { got = append(got, c.String()) })); err != nil {
+		t.Fatalf("ImageReferences() = %v", err)
+	}
+
+	// Setting the pull policy isn't a change that resolution made.
+	want := []string{
+		"Deployment/app: spec.template.spec.containers[0].image: ko://" + fooRef + " -> " + fooDigest,
+		"Deployment/app: spec.template.spec.initContainers[0].image: ko://" + barRef + " -> " + barDigest,
+		"[0]: ko://" + fooRef + " -> " + fooDigest,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("changes; (-want +got) = %v", diff)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import "strings"
+
+const (
+	// AllFields resolves references within any string value, which is the
+	// default.
+	AllFields = "all"
+	// ImageFields only resolves references within the values of fields
+	// named image, or ending in Image, such as sidecarImage.
+	ImageFields = "image"
+	// ImageAndEnvFields also resolves references within the values of the
+	// env of containers, e.g. for operators that create pods of their own.
+	ImageAndEnvFields = "image+env"
+)
+
+// matchFields returns a function reporting whether the node at the keys and
+// indexes in at is one of the fields that fields names.
+func matchFields(fields string) func(at []string) bool {
+	return func(at []string) bool {
+		return isImageField(at) || (fields == ImageAndEnvFields && isEnvValue(at))
+	}
+}
+
+// isImageField reports whether the node at at is the value of a field named
+// image, or ending in Image.
+func isImageField(at []string) bool {
+	if len(at) == 0 {
+		return false
+	}
+	key := at[len(at)-1]
+	return key == "image" || strings.HasSuffix(key, "Image")
+}
+
+// isEnvValue reports whether the node at at is the value of an environment
+// variable, as in env[*].value.
+func isEnvValue(at []string) bool {
+	n := len(at)
+	return n >= 3 && at[n-3] == "env" && strings.HasPrefix(at[n-2], "[") && at[n-1] == "value"
+}
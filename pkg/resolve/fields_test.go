@@ -0,0 +1,119 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestResolveFields(t *testing.T) {
+	base := mustRepository("gcr.io/fields")
+	fooDigest := computeDigest(base, fooRef, fooHash)
+	barDigest := computeDigest(base, barRef, barHash)
+	bazDigest := computeDigest(base, bazRef, bazHash)
+
+	input := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    example.com/image: ko://` + bazRef + `
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: ko://` + fooRef + `
+        env:
+        - name: BAR_IMAGE
+          value: ko://` + barRef + `
+      sidecarImage: ko://` + bazRef + `
+`)
+
+	tests := []struct {
+		desc           string
+		fields         string
+		wantEnv        string
+		wantAnnotation string
+	}{{
+		desc:           "all",
+		fields:         AllFields,
+		wantEnv:        barDigest,
+		wantAnnotation: bazDigest,
+	}, {
+		desc:           "images only",
+		fields:         ImageFields,
+		wantEnv:        "ko://" + barRef,
+		wantAnnotation: "ko://" + bazRef,
+	}, {
+		desc:           "images and env",
+		fields:         ImageAndEnvFields,
+		wantEnv:        barDigest,
+		wantAnnotation: "ko://" + bazRef,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			outYAML, err := ImageReferences(input, true, testBuilder, newFixedPublish(base, testHashes), WithFields(test.fields))
+			if err != nil {
+				t.Fatalf("ImageReferences() = %v", err)
+			}
+			var got struct {
+				Metadata struct {
+					Annotations map[string]string `yaml:"annotations"`
+				} `yaml:"metadata"`
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []struct {
+								Image string `yaml:"image"`
+								Env   []struct {
+									Value string `yaml:"value"`
+								} `yaml:"env"`
+							} `yaml:"containers"`
+							SidecarImage string `yaml:"sidecarImage"`
+						} `yaml:"spec"`
+					} `yaml:"template"`
+				} `yaml:"spec"`
+			}
+			if err := yaml.Unmarshal(outYAML, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+			spec := got.Spec.Template.Spec
+			// Image fields are resolved whichever fields are.
+			if c := spec.Containers[0]; c.Image != fooDigest {
+				t.Errorf("image = %q, want %q", c.Image, fooDigest)
+			}
+			if spec.SidecarImage != bazDigest {
+				t.Errorf("sidecarImage = %q, want %q", spec.SidecarImage, bazDigest)
+			}
+			if got := spec.Containers[0].Env[0].Value; got != test.wantEnv {
+				t.Errorf("env value = %q, want %q", got, test.wantEnv)
+			}
+			if got := got.Metadata.Annotations["example.com/image"]; got != test.wantAnnotation {
+				t.Errorf("annotation = %q, want %q", got, test.wantAnnotation)
+			}
+		})
+	}
+}
+
+func TestResolveFieldsErrors(t *testing.T) {
+	if _, err := makeOptions(WithFields("everything")); err == nil {
+		t.Error("WithFields(everything) = nil, want error")
+	}
+	if _, err := makeOptions(WithFields(ImageFields), WithPaths([]string{"spec.image"})); err == nil {
+		t.Error("makeOptions() with both fields and paths = nil, want error")
+	}
+}
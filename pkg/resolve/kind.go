@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// kindOrder is the order in which documents of each kind are sorted by
+// SortByKind, the order in which Helm installs them, so that resources are
+// created before those that depend on them.
+var kindOrder = []string{
+	"Namespace",
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"ServiceAccount",
+	"Secret",
+	"SecretList",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleList",
+	"ClusterRoleBinding",
+	"ClusterRoleBindingList",
+	"Role",
+	"RoleList",
+	"RoleBinding",
+	"RoleBindingList",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"IngressClass",
+	"Ingress",
+	"APIService",
+}
+
+// kindRank returns the position of the kind of doc in kindOrder, or the
+// length of kindOrder for other kinds and documents that aren't objects.
+func kindRank(doc []byte) int {
+	var obj struct {
+		Kind string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal(doc, &obj); err == nil {
+		for i, kind := range kindOrder {
+			if obj.Kind == kind {
+				return i
+			}
+		}
+	}
+	return len(kindOrder)
+}
+
+// SortByKind stably sorts the documents by their kind, in the order in which
+// Helm installs them, e.g. Namespaces before CustomResourceDefinitions before
+// Deployments.  Documents of other kinds are sorted last.
+func SortByKind(docs [][]byte) {
+	type rankedDoc struct {
+		rank int
+		doc  []byte
+	}
+	rds := make([]rankedDoc, 0, len(docs))
+	for _, doc := range docs {
+		rds = append(rds, rankedDoc{rank: kindRank(doc), doc: doc})
+	}
+
+	sort.SliceStable(rds, func(i, j int) bool {
+		return rds[i].rank < rds[j].rank
+	})
+	for i, rd := range rds {
+		docs[i] = rd.doc
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func kinded(kind, name string) []byte {
+	return []byte("kind: " + kind + "\nmetadata:\n  name: " + name + "\n")
+}
+
+func TestSortByKind(t *testing.T) {
+	docs := [][]byte{
+		kinded("Deployment", "app"),
+		kinded("Widget", "custom"),
+		[]byte("just a string\n"),
+		kinded("Service", "app"),
+		kinded("CustomResourceDefinition", "widgets.example.com"),
+		kinded("Deployment", "db"),
+		kinded("Namespace", "app"),
+	}
+	SortByKind(docs)
+
+	// Unknown kinds and documents that aren't objects go last, and the
+	// documents of each kind keep their order.
+	want := [][]byte{
+		kinded("Namespace", "app"),
+		kinded("CustomResourceDefinition", "widgets.example.com"),
+		kinded("Service", "app"),
+		kinded("Deployment", "app"),
+		kinded("Deployment", "db"),
+		kinded("Widget", "custom"),
+		[]byte("just a string\n"),
+	}
+	if diff := cmp.Diff(want, docs); diff != "" {
+		t.Errorf("SortByKind(); (-want +got) = %v", diff)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// KustomizeImage is an entry of the images transformer of a kustomization,
+// which overrides the image name with newName and digest.
+type KustomizeImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName"`
+	Digest  string `yaml:"digest,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+}
+
+// KustomizeImages returns a kustomization fragment with an images transformer
+// that overrides each reference in images, as written in the input yaml, with
+// the image it was resolved to.
+func KustomizeImages(images map[string]string) ([]byte, error) {
+	var k struct {
+		Images []KustomizeImage `yaml:"images"`
+	}
+	for ref, image := range images {
+		ki := KustomizeImage{Name: ref}
+		r, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			return nil, err
+		}
+		switch r := r.(type) {
+		case name.Digest:
+			ki.NewName, ki.Digest = r.Context().String(), r.DigestStr()
+		case name.Tag:
+			ki.NewName, ki.NewTag = r.Context().String(), r.TagStr()
+		}
+		k.Images = append(k.Images, ki)
+	}
+	sort.Slice(k.Images, func(i, j int) bool {
+		return k.Images[i].Name < k.Images[j].Name
+	})
+	return yaml.Marshal(k)
+}
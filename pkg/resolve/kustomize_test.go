@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestKustomizeImages(t *testing.T) {
+	base := mustRepository("gcr.io/kustomize")
+	input := []byte(`apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: foo
+    image: ko://` + fooRef + `
+  - name: foo-again
+    image: ko://` + fooRef + `
+  - name: bar
+    image: ko://` + barRef + `
+  - name: sidecar
+    image: gcr.io/sidecar:latest
+`)
+
+	var m sync.Mutex
+	images := make(map[string]string)
+	if _, err := ImageReferences(input, true, testBuilder, newFixedPublish(base, testHashes),
+		WithResolvedRefs(func(ref, image string) {
+			m.Lock()
+			defer m.Unlock()
+			images[ref] = image
+		})); err != nil {
+		t.Fatalf("ImageReferences() = %v", err)
+	}
+	// The daemon publishes images by tag.
+	images["ko://example.com/local"] = "ko.local/local:0123abcd"
+
+	b, err := KustomizeImages(images)
+	if err != nil {
+		t.Fatalf("KustomizeImages() = %v", err)
+	}
+	var got map[string][]map[string]string
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(b), err)
+	}
+	want := map[string][]map[string]string{
+		"images": {{
+			"name":    "ko://example.com/local",
+			"newName": "ko.local/local",
+			"newTag":  "0123abcd",
+		}, {
+			"name":    "ko://" + barRef,
+			"newName": base.String() + "/" + barRef,
+			"digest":  barHash.String(),
+		}, {
+			"name":    "ko://" + fooRef,
+			"newName": base.String() + "/" + fooRef,
+			"digest":  fooHash.String(),
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("KustomizeImages() (-want +got) = %v", diff)
+	}
+}
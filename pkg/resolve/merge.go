@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// resourceKey identifies the resource a document describes by its
+// apiVersion, kind, namespace and name, or is "" if it doesn't have a kind
+// and name.
+func resourceKey(obj interface{}) string {
+	kind, _ := field(obj, "kind")
+	metadata, _ := field(obj, "metadata")
+	name, _ := field(metadata, "name")
+	if kind == nil || name == nil {
+		return ""
+	}
+	apiVersion, _ := field(obj, "apiVersion")
+	namespace, _ := field(metadata, "namespace")
+	return fmt.Sprintf("%v/%v/%v/%v", apiVersion, kind, namespace, name)
+}
+
+// MergeDocuments merges the documents that describe the same resource, so
+// that later documents, e.g. from an environment's overlay, override earlier
+// ones, e.g. from a base.  Mappings are merged key by key, while sequences
+// and scalars from the later document replace those of the earlier one.
+// Each resource is kept where it first appears, and documents that don't
+// describe a resource are kept as they are.
+func MergeDocuments(docs [][]byte) ([][]byte, error) {
+	var objs []interface{}
+	var raw [][]byte
+	index := make(map[string]int)
+	for _, doc := range docs {
+		var obj interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, err
+		}
+		key := resourceKey(obj)
+		if key == "" {
+			objs = append(objs, nil)
+			raw = append(raw, doc)
+			continue
+		}
+		if i, ok := index[key]; ok {
+			objs[i] = mergeValues(objs[i], obj)
+			continue
+		}
+		index[key] = len(objs)
+		objs = append(objs, obj)
+		raw = append(raw, nil)
+	}
+
+	merged := make([][]byte, 0, len(objs))
+	for i, obj := range objs {
+		if obj == nil {
+			merged = append(merged, raw[i])
+			continue
+		}
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, b)
+	}
+	return merged, nil
+}
+
+// mergeValues merges override into base, returning the result.
+func mergeValues(base, override interface{}) interface{} {
+	bm, ok := base.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+	om, ok := override.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+	m := make(map[interface{}]interface{}, len(bm))
+	for k, v := range bm {
+		m[k] = v
+	}
+	for k, v := range om {
+		if bv, ok := m[k]; ok {
+			m[k] = mergeValues(bv, v)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
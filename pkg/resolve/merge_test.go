@@ -0,0 +1,91 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeDocuments(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		docs []string
+		want []string
+	}{{
+		desc: "distinct resources",
+		docs: []string{
+			"kind: Service\nmetadata:\n  name: app\n",
+			"kind: Deployment\nmetadata:\n  name: app\n",
+		},
+		want: []string{
+			"kind: Service\nmetadata:\n  name: app\n",
+			"kind: Deployment\nmetadata:\n  name: app\n",
+		},
+	}, {
+		desc: "override",
+		docs: []string{
+			"kind: Deployment\nmetadata:\n  name: app\nspec:\n  replicas: 1\n  template:\n    spec:\n      containers:\n      - image: gcr.io/app@sha256:deadbeef\n",
+			"kind: Service\nmetadata:\n  name: app\n",
+			"kind: Deployment\nmetadata:\n  labels:\n    env: prod\n  name: app\nspec:\n  replicas: 3\n",
+		},
+		want: []string{
+			"kind: Deployment\nmetadata:\n  labels:\n    env: prod\n  name: app\nspec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n      - image: gcr.io/app@sha256:deadbeef\n",
+			"kind: Service\nmetadata:\n  name: app\n",
+		},
+	}, {
+		desc: "sequences are replaced",
+		docs: []string{
+			"kind: ConfigMap\nmetadata:\n  name: app\nlist:\n- a\n- b\n",
+			"kind: ConfigMap\nmetadata:\n  name: app\nlist:\n- c\n",
+		},
+		want: []string{
+			"kind: ConfigMap\nlist:\n- c\nmetadata:\n  name: app\n",
+		},
+	}, {
+		desc: "namespaces differ",
+		docs: []string{
+			"kind: ConfigMap\nmetadata:\n  name: app\n  namespace: a\n",
+			"kind: ConfigMap\nmetadata:\n  name: app\n  namespace: b\n",
+		},
+		want: []string{
+			"kind: ConfigMap\nmetadata:\n  name: app\n  namespace: a\n",
+			"kind: ConfigMap\nmetadata:\n  name: app\n  namespace: b\n",
+		},
+	}, {
+		desc: "not resources",
+		docs: []string{"just a string\n", "foo: bar\n"},
+		want: []string{"just a string\n", "foo: bar\n"},
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			var docs [][]byte
+			for _, doc := range test.docs {
+				docs = append(docs, []byte(doc))
+			}
+			merged, err := MergeDocuments(docs)
+			if err != nil {
+				t.Fatalf("MergeDocuments() = %v", err)
+			}
+			var got []string
+			for _, doc := range merged {
+				got = append(got, string(doc))
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("MergeDocuments() (-want +got) = %v", diff)
+			}
+		})
+	}
+}
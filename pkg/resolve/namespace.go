@@ -0,0 +1,84 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"regexp"
+	"strings"
+)
+
+// namespaceRE matches the names that namespaces may have, which are DNS-1123
+// labels.
+var namespaceRE = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// clusterScopedKinds holds the kinds of the built-in resources that don't
+// live in a namespace.  Custom resources can't be told apart from their
+// manifests, so they are all treated as namespaced.
+var clusterScopedKinds = map[string]struct{}{
+	"APIService":                     {},
+	"CertificateSigningRequest":      {},
+	"ClusterRole":                    {},
+	"ClusterRoleBinding":             {},
+	"ComponentStatus":                {},
+	"CSIDriver":                      {},
+	"CSINode":                        {},
+	"CustomResourceDefinition":       {},
+	"IngressClass":                   {},
+	"MutatingWebhookConfiguration":   {},
+	"Namespace":                      {},
+	"Node":                           {},
+	"PersistentVolume":               {},
+	"PodSecurityPolicy":              {},
+	"PriorityClass":                  {},
+	"RuntimeClass":                   {},
+	"StorageClass":                   {},
+	"ValidatingWebhookConfiguration": {},
+	"VolumeAttachment":               {},
+}
+
+// setNamespace sets metadata.namespace to namespace on obj, if it is a
+// namespaced resource, or on each of the items of a List.  Unless replace
+// is set, resources that already have a namespace keep it.
+func setNamespace(obj interface{}, namespace string, replace bool) {
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return
+	}
+	kind, ok := m["kind"].(string)
+	if !ok || kind == "" {
+		// Not a resource.
+		return
+	}
+	if strings.HasSuffix(kind, "List") {
+		if items, ok := m["items"].([]interface{}); ok {
+			for _, item := range items {
+				setNamespace(item, namespace, replace)
+			}
+			return
+		}
+	}
+	if _, ok := clusterScopedKinds[kind]; ok {
+		return
+	}
+	switch metadata := m["metadata"].(type) {
+	case map[interface{}]interface{}:
+		if ns, ok := metadata["namespace"].(string); ok && ns != "" && !replace {
+			return
+		}
+		metadata["namespace"] = namespace
+	case nil:
+		m["metadata"] = map[interface{}]interface{}{"namespace": namespace}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// namespaceInput holds resources in, and not in, a namespace, some of which
+// are cluster-scoped.
+var namespaceInput = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+  namespace: other
+spec:
+  template:
+    spec:
+      containers:
+      - image: ko://` + fooRef + `
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: ConfigMap
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: foo
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: other
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: foo
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRoleBinding
+  metadata:
+    name: foo
+---
+just a string
+`)
+
+// resolvedNamespaces returns the namespace of each resource in out, or "" if
+// it has none.
+func resolvedNamespaces(t *testing.T, out []byte) []string {
+	t.Helper()
+	var got []string
+	var namespaces func(obj interface{})
+	namespaces = func(obj interface{}) {
+		if items, ok := field(obj, "items"); ok {
+			for _, item := range items.([]interface{}) {
+				namespaces(item)
+			}
+			return
+		}
+		metadata, _ := field(obj, "metadata")
+		ns, _ := field(metadata, "namespace")
+		s, _ := ns.(string)
+		got = append(got, s)
+	}
+	for _, doc := range SplitDocuments(out) {
+		var obj interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			t.Fatalf("yaml.Unmarshal() = %v", err)
+		}
+		if _, ok := field(obj, "kind"); ok {
+			namespaces(obj)
+		}
+	}
+	return got
+}
+
+func TestNamespace(t *testing.T) {
+	base := mustRepository("gcr.io/namespace")
+	out, err := ImageReferences(namespaceInput, true, testBuilder, newFixedPublish(base, testHashes), WithNamespace("target"))
+	if err != nil {
+		t.Fatalf("ImageReferences() = %v", err)
+	}
+
+	want := []string{
+		"target", // Deployment
+		"target", // Service
+		"target", // ConfigMap
+		"",       // ClusterRole
+		"",       // Namespace
+		"target", // ServiceAccount
+		"",       // ClusterRoleBinding
+	}
+	if diff := cmp.Diff(want, resolvedNamespaces(t, out)); diff != "" {
+		t.Errorf("namespaces (-want +got) = %v", diff)
+	}
+}
+
+func TestWithNamespaceInvalid(t *testing.T) {
+	for _, ns := range []string{"", "Target", "-target", "tar.get"} {
+		if _, err := makeOptions(WithNamespace(ns)); err == nil {
+			t.Errorf("WithNamespace(%q) = nil, want error", ns)
+		}
+	}
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	base := mustRepository("gcr.io/namespace")
+	out, err := ImageReferences(namespaceInput, true, testBuilder, newFixedPublish(base, testHashes), WithDefaultNamespace("target"))
+	if err != nil {
+		t.Fatalf("ImageReferences() = %v", err)
+	}
+
+	want := []string{
+		"other",  // Deployment, which already has a namespace.
+		"target", // Service
+		"target", // ConfigMap
+		"",       // ClusterRole
+		"",       // Namespace
+		"target", // ServiceAccount
+		"",       // ClusterRoleBinding
+	}
+	if diff := cmp.Diff(want, resolvedNamespaces(t, out)); diff != "" {
+		t.Errorf("namespaces (-want +got) = %v", diff)
+	}
+
+	if _, err := makeOptions(WithDefaultNamespace("Target")); err == nil {
+		t.Error("WithDefaultNamespace(Target) = nil, want error")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Option is a functional option for ImageReferences.
+type Option func(*resolveOptions) error
+
+type resolveOptions struct {
+	embedded         bool
+	filepaths        bool
+	interpolated     bool
+	pullPolicy       string
+	namespace        string
+	defaultNamespace string
+	reuse            func(string) (string, bool)
+	record           func(string, string)
+	paths            [][]string
+	fields           string
+	changes          func(Change)
+}
+
+func makeOptions(opts ...Option) (*resolveOptions, error) {
+	ro := &resolveOptions{}
+	for _, option := range opts {
+		if err := option(ro); err != nil {
+			return nil, err
+		}
+	}
+	if len(ro.paths) > 0 && ro.fields != "" && ro.fields != AllFields {
+		return nil, errors.New("references can't be limited to both paths and fields")
+	}
+	return ro, nil
+}
+
+// WithEmbeddedYAML is a functional option for resolving references within
+// multi-line string values that themselves hold yaml documents, such as
+// manifests embedded in a ConfigMap's data.
+func WithEmbeddedYAML() Option {
+	return func(ro *resolveOptions) error {
+		ro.embedded = true
+		return nil
+	}
+}
+
+// WithFilepathRefs is a functional option for replacing file:// references
+// with the sha256 digest of the named file's contents.  Relative paths are
+// relative to the current working directory.
+func WithFilepathRefs() Option {
+	return func(ro *resolveOptions) error {
+		ro.filepaths = true
+		return nil
+	}
+}
+
+// WithInterpolatedRefs is a functional option for also resolving references
+// written as ${ko://...} within larger string values, such as
+// "--image=${ko://github.com/foo/bar}".
+func WithInterpolatedRefs() Option {
+	return func(ro *resolveOptions) error {
+		ro.interpolated = true
+		return nil
+	}
+}
+
+// WithPullPolicy is a functional option for setting imagePullPolicy to policy
+// on the containers whose image references are resolved, as images referred
+// to by digest need not be pulled again.  Other containers are left alone.
+func WithPullPolicy(policy string) Option {
+	return func(ro *resolveOptions) error {
+		if _, ok := pullPolicies[policy]; !ok {
+			return fmt.Errorf("unknown image pull policy %q, want one of Always, IfNotPresent or Never", policy)
+		}
+		ro.pullPolicy = policy
+		return nil
+	}
+}
+
+// WithNamespace is a functional option for setting metadata.namespace to
+// namespace on each namespaced resource, whatever namespace it is in.
+// Cluster-scoped resources, such as ClusterRoles, are left alone.
+func WithNamespace(namespace string) Option {
+	return func(ro *resolveOptions) error {
+		if len(namespace) > 63 || !namespaceRE.MatchString(namespace) {
+			return fmt.Errorf("invalid namespace %q, it must be a DNS-1123 label", namespace)
+		}
+		ro.namespace = namespace
+		return nil
+	}
+}
+
+// WithDefaultNamespace is a functional option for setting metadata.namespace
+// to namespace on each namespaced resource that doesn't already have one, as
+// applying them to a cluster whose context defaults to namespace would.
+func WithDefaultNamespace(namespace string) Option {
+	return func(ro *resolveOptions) error {
+		if len(namespace) > 63 || !namespaceRE.MatchString(namespace) {
+			return fmt.Errorf("invalid namespace %q, it must be a DNS-1123 label", namespace)
+		}
+		ro.defaultNamespace = namespace
+		return nil
+	}
+}
+
+// WithResolvedRefs is a functional option for calling record with each
+// reference that is resolved, as written in the input, and the image it is
+// resolved to.  record may be called concurrently, and more than once for a
+// reference.
+func WithResolvedRefs(record func(ref, image string)) Option {
+	return func(ro *resolveOptions) error {
+		ro.record = record
+		return nil
+	}
+}
+
+// WithChanges is a functional option for calling record with each value of
+// a document that resolution changed, in the order of the documents.
+func WithChanges(record func(Change)) Option {
+	return func(ro *resolveOptions) error {
+		ro.changes = record
+		return nil
+	}
+}
+
+// WithPaths is a functional option for only resolving references at the given
+// JSONPath-like paths within each document, such as
+// "spec.template.spec.containers[*].image", rather than anywhere.  A "*" path
+// segment matches any key, and "[*]" any index.
+func WithPaths(paths []string) Option {
+	return func(ro *resolveOptions) error {
+		for _, path := range paths {
+			elems, err := parsePath(path)
+			if err != nil {
+				return err
+			}
+			ro.paths = append(ro.paths, elems)
+		}
+		return nil
+	}
+}
+
+// WithFields is a functional option for only resolving references within the
+// fields that fields names: AllFields, the default, ImageFields or
+// ImageAndEnvFields.
+func WithFields(fields string) Option {
+	return func(ro *resolveOptions) error {
+		switch fields {
+		case AllFields, ImageFields, ImageAndEnvFields:
+		default:
+			return fmt.Errorf("unknown fields %q, want one of %s, %s or %s", fields, AllFields, ImageFields, ImageAndEnvFields)
+		}
+		ro.fields = fields
+		return nil
+	}
+}
+
+// WithReusedDigests is a functional option for skipping the build and publish
+// of references for which reuse returns a previously published image, which
+// is substituted for the reference instead.
+func WithReusedDigests(reuse func(importpath string) (string, bool)) Option {
+	return func(ro *resolveOptions) error {
+		ro.reuse = reuse
+		return nil
+	}
+}
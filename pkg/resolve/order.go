@@ -0,0 +1,89 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ApplyOrderAnnotation is the annotation that sets the order in which a
+// document is applied, relative to the others.  Documents with lower values
+// are applied first, and documents without it have order 0, so for example
+// Namespaces and CustomResourceDefinitions may be given a negative order to
+// apply them before the resources that depend on them.
+const ApplyOrderAnnotation = "ko.build/apply-order"
+
+// applyOrder returns the value of the ApplyOrderAnnotation on doc, and
+// whether it has one.
+func applyOrder(doc []byte) (int, bool, error) {
+	var obj interface{}
+	if err := yaml.Unmarshal(doc, &obj); err != nil {
+		// Not an object, so it can't be annotated.
+		return 0, false, nil
+	}
+	metadata, ok := field(obj, "metadata")
+	if !ok {
+		return 0, false, nil
+	}
+	annotations, ok := field(metadata, "annotations")
+	if !ok {
+		return 0, false, nil
+	}
+	value, ok := field(annotations, ApplyOrderAnnotation)
+	if !ok {
+		return 0, false, nil
+	}
+	s, _ := value.(string)
+	order, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s annotation %q is not an integer", ApplyOrderAnnotation, s)
+	}
+	return order, true, nil
+}
+
+// SortByApplyOrder stably sorts the documents by their ApplyOrderAnnotation,
+// and reports whether any of them has one, since otherwise they are left as
+// they are.
+func SortByApplyOrder(docs [][]byte) (bool, error) {
+	type orderedDoc struct {
+		order int
+		doc   []byte
+	}
+	ods := make([]orderedDoc, 0, len(docs))
+	ordered := false
+	for _, doc := range docs {
+		order, ok, err := applyOrder(doc)
+		if err != nil {
+			return false, err
+		}
+		ods = append(ods, orderedDoc{order: order, doc: doc})
+		ordered = ordered || ok
+	}
+	if !ordered {
+		return false, nil
+	}
+
+	sort.SliceStable(ods, func(i, j int) bool {
+		return ods[i].order < ods[j].order
+	})
+	for i, od := range ods {
+		docs[i] = od.doc
+	}
+	return true, nil
+}
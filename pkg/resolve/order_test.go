@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func ordered(name, order string) []byte {
+	doc := "metadata:\n  name: " + name + "\n"
+	if order != "" {
+		doc += "  annotations:\n    ko.build/apply-order: \"" + order + "\"\n"
+	}
+	return []byte(doc)
+}
+
+func TestSortByApplyOrder(t *testing.T) {
+	for _, test := range []struct {
+		desc        string
+		docs        [][]byte
+		want        [][]byte
+		wantOrdered bool
+		wantErr     bool
+	}{{
+		desc: "no orders",
+		docs: [][]byte{ordered("b", ""), []byte("just a string\n"), ordered("a", "")},
+		want: [][]byte{ordered("b", ""), []byte("just a string\n"), ordered("a", "")},
+	}, {
+		desc:        "orders",
+		docs:        [][]byte{ordered("deployment", ""), ordered("late", "10"), ordered("service", ""), ordered("namespace", "-1")},
+		want:        [][]byte{ordered("namespace", "-1"), ordered("deployment", ""), ordered("service", ""), ordered("late", "10")},
+		wantOrdered: true,
+	}, {
+		desc:    "not a number",
+		docs:    [][]byte{ordered("namespace", "first")},
+		wantErr: true,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := SortByApplyOrder(test.docs)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("SortByApplyOrder() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got != test.wantOrdered {
+				t.Errorf("SortByApplyOrder() = %v, want %v", got, test.wantOrdered)
+			}
+			if diff := cmp.Diff(test.want, test.docs); diff != "" {
+				t.Errorf("SortByApplyOrder(); (-want +got) = %v", diff)
+			}
+		})
+	}
+}
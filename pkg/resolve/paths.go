@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// anyElement matches any key of a mapping or index of a sequence in a path.
+const anyElement = "*"
+
+// pathSegmentRegex matches a segment of a path: a key, optionally followed by
+// indexes such as [0] or [*].
+var pathSegmentRegex = regexp.MustCompile(`^([^.\[\]]*)((?:\[(?:\d+|\*)\])*)$`)
+
+// indexRegex matches the indexes that follow a key in a path segment.
+var indexRegex = regexp.MustCompile(`\[(\d+|\*)\]`)
+
+// parsePath parses a JSONPath-like path to nodes, e.g.
+// "spec.template.spec.containers[*].image", into the keys and indexes along
+// it.  "*" matches any key, and "[*]" any index.  A leading "$." is optional.
+func parsePath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("path %q is empty", path)
+	}
+	var elems []string
+	for _, segment := range strings.Split(p, ".") {
+		m := pathSegmentRegex.FindStringSubmatch(segment)
+		if m == nil || (m[1] == "" && m[2] == "") {
+			return nil, fmt.Errorf("path %q has an invalid segment %q", path, segment)
+		}
+		if m[1] != "" {
+			elems = append(elems, m[1])
+		}
+		for _, idx := range indexRegex.FindAllStringSubmatch(m[2], -1) {
+			elems = append(elems, "["+idx[1]+"]")
+		}
+	}
+	return elems, nil
+}
+
+// matchPath reports whether the node at the keys and indexes in at is one of
+// the nodes that path refers to.
+func matchPath(path, at []string) bool {
+	if len(path) != len(at) {
+		return false
+	}
+	for i, elem := range path {
+		switch {
+		case elem == at[i]:
+		case elem == anyElement && !strings.HasPrefix(at[i], "["):
+		case elem == "["+anyElement+"]" && strings.HasPrefix(at[i], "["):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// matchPaths returns a function reporting whether the node at the keys and
+// indexes in at is one of the nodes that any of paths refers to.
+func matchPaths(paths [][]string) func(at []string) bool {
+	return func(at []string) bool {
+		for _, path := range paths {
+			if matchPath(path, at) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// replaceMatching is like replaceRecursive, except that only the string leaves
+// for which match reports true are replaced, and keys are left alone.  at
+// holds the keys and indexes along which obj was reached.
+func replaceMatching(obj interface{}, match func(at []string) bool, at []string, rs replaceString) (interface{}, error) {
+	switch typed := obj.(type) {
+	case map[interface{}]interface{}:
+		m2 := make(map[interface{}]interface{}, len(typed))
+		for k, v := range typed {
+			v2, err := replaceMatching(v, match, append(at[:len(at):len(at)], fmt.Sprint(k)), rs)
+			if err != nil {
+				return nil, err
+			}
+			m2[k] = v2
+		}
+		return m2, nil
+
+	case []interface{}:
+		a2 := make([]interface{}, len(typed))
+		for idx, v := range typed {
+			v2, err := replaceMatching(v, match, append(at[:len(at):len(at)], "["+strconv.Itoa(idx)+"]"), rs)
+			if err != nil {
+				return nil, err
+			}
+			a2[idx] = v2
+		}
+		return a2, nil
+
+	case string:
+		if match(at) {
+			return rs(typed)
+		}
+		return typed, nil
+
+	default:
+		return typed, nil
+	}
+}
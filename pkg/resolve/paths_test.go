@@ -0,0 +1,148 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "spec.containers[*].image", want: []string{"spec", "containers", "[*]", "image"}},
+		{path: "$.spec.containers[0].image", want: []string{"spec", "containers", "[0]", "image"}},
+		{path: ".spec.*.image", want: []string{"spec", "*", "image"}},
+		{path: "matrix[*][1]", want: []string{"matrix", "[*]", "[1]"}},
+		{path: "", wantErr: true},
+		{path: "spec..image", wantErr: true},
+		{path: "spec.containers[x]", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := parsePath(test.path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parsePath() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("parsePath() (-want +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	base := mustRepository("gcr.io/paths")
+	fooDigest := computeDigest(base, fooRef, fooHash)
+
+	input := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    example.com/image: ko://` + barRef + `
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: ko://` + fooRef + `
+        env:
+        - name: BAR_IMAGE
+          value: ko://` + barRef + `
+`)
+
+	tests := []struct {
+		desc           string
+		paths          []string
+		wantImage      string
+		wantEnv        string
+		wantAnnotation string
+		wantErr        bool
+	}{{
+		desc:           "container images",
+		paths:          []string{"spec.template.spec.containers[*].image"},
+		wantImage:      fooDigest,
+		wantEnv:        "ko://" + barRef,
+		wantAnnotation: "ko://" + barRef,
+	}, {
+		desc:           "first container image",
+		paths:          []string{"$.spec.template.spec.containers[0].image"},
+		wantImage:      fooDigest,
+		wantEnv:        "ko://" + barRef,
+		wantAnnotation: "ko://" + barRef,
+	}, {
+		desc:           "wildcard key",
+		paths:          []string{"spec.template.spec.containers[*].image", "metadata.annotations.*"},
+		wantImage:      fooDigest,
+		wantEnv:        "ko://" + barRef,
+		wantAnnotation: computeDigest(base, barRef, barHash),
+	}, {
+		desc:           "no matching path",
+		paths:          []string{"spec.containers[*].image"},
+		wantImage:      "ko://" + fooRef,
+		wantEnv:        "ko://" + barRef,
+		wantAnnotation: "ko://" + barRef,
+	}, {
+		desc:    "invalid path",
+		paths:   []string{"spec.containers[x]"},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			outYAML, err := ImageReferences(input, true, testBuilder, newFixedPublish(base, testHashes), WithPaths(test.paths))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ImageReferences() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got struct {
+				Metadata struct {
+					Annotations map[string]string `yaml:"annotations"`
+				} `yaml:"metadata"`
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []struct {
+								Image string `yaml:"image"`
+								Env   []struct {
+									Value string `yaml:"value"`
+								} `yaml:"env"`
+							} `yaml:"containers"`
+						} `yaml:"spec"`
+					} `yaml:"template"`
+				} `yaml:"spec"`
+			}
+			if err := yaml.Unmarshal(outYAML, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+			c := got.Spec.Template.Spec.Containers[0]
+			if c.Image != test.wantImage {
+				t.Errorf("image = %q, want %q", c.Image, test.wantImage)
+			}
+			if c.Env[0].Value != test.wantEnv {
+				t.Errorf("env value = %q, want %q", c.Env[0].Value, test.wantEnv)
+			}
+			if got := got.Metadata.Annotations["example.com/image"]; got != test.wantAnnotation {
+				t.Errorf("annotation = %q, want %q", got, test.wantAnnotation)
+			}
+		})
+	}
+}
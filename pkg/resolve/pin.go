@@ -0,0 +1,74 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ImageAnnotation is the annotation that, when set on a document, pins the
+// references within the document to images by digest, which are used in
+// place of building them, e.g. to rebuild only some of the services of a
+// deployment.  Each image is pinned for an import path, as
+// IMPORTPATH=IMAGE, separated by commas.  A document that refers to a single
+// import path may give just the image.
+const ImageAnnotation = "ko.build/image"
+
+// pins maps import paths to the images that they are pinned to by the
+// ImageAnnotation of a document.  An image given without an import path is
+// keyed by "".
+type pins map[string]string
+
+// image returns the image that importpath is pinned to, or "" if it isn't.
+func (p pins) image(importpath string) string {
+	if image, ok := p[importpath]; ok {
+		return image
+	}
+	return p[""]
+}
+
+// imagePins returns the images that the references within the decoded
+// document obj are pinned to by its ImageAnnotation, if any.
+func imagePins(obj interface{}) (pins, error) {
+	value := annotation(obj, ImageAnnotation)
+	if value == "" {
+		return nil, nil
+	}
+	p := make(pins)
+	for _, pin := range strings.Split(value, ",") {
+		pin = strings.TrimSpace(pin)
+		importpath, image := "", pin
+		if i := strings.Index(pin, "="); i >= 0 {
+			importpath, image = pin[:i], pin[i+1:]
+			if importpath == "" {
+				return nil, fmt.Errorf("%s %q pins %q without an import path", ImageAnnotation, value, pin)
+			}
+		}
+		if _, ok := p[importpath]; ok {
+			return nil, fmt.Errorf("%s %q pins %s more than once", ImageAnnotation, value, importpath)
+		}
+		if _, err := name.NewDigest(image); err != nil {
+			return nil, fmt.Errorf("%s %q is not an image by digest: %v", ImageAnnotation, image, err)
+		}
+		p[importpath] = image
+	}
+	if _, ok := p[""]; ok && len(p) > 1 {
+		return nil, fmt.Errorf("%s %q mixes images with and without import paths", ImageAnnotation, value)
+	}
+	return p, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPinnedImages(t *testing.T) {
+	base := mustRepository("gcr.io/pinned")
+	pinned := computeDigest(mustRepository("gcr.io/released"), fooRef, fooHash)
+	inputYAML := []byte(`metadata:
+  name: foo
+  annotations:
+    ko.build/image: ` + pinned + `
+spec:
+  image: ko://` + fooRef + `
+---
+metadata:
+  name: bar
+spec:
+  image: ko://` + barRef + `
+`)
+
+	// Only bar may be built, foo is pinned.
+	builder := &supportAll{newFixedBuild(map[string]v1.Image{barRef: bar})}
+	var recorded []string
+	outYAML, err := ImageReferences(inputYAML, true, builder, newFixedPublish(base, testHashes),
+		WithResolvedRefs(func(ref, digest string) { recorded = append(recorded, digest) }))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+
+	var got []string
+	decoder := yaml.NewDecoder(bytes.NewBuffer(outYAML))
+	for {
+		var obj struct {
+			Spec struct {
+				Image string
+			}
+		}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+		got = append(got, obj.Spec.Image)
+	}
+	want := []string{pinned, computeDigest(base, barRef, barHash)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("images; (-want +got) = %v", diff)
+	}
+	if diff := cmp.Diff(want, recorded); diff != "" {
+		t.Errorf("recorded images; (-want +got) = %v", diff)
+	}
+}
+
+func TestPinnedImageNotByDigest(t *testing.T) {
+	inputYAML := []byte(`metadata:
+  annotations:
+    ko.build/image: gcr.io/released/foo:v1
+spec:
+  image: ko://` + fooRef + `
+`)
+	if _, err := ImageReferences(inputYAML, true, testBuilder, newFixedPublish(mustRepository("gcr.io/pinned"), testHashes)); err == nil {
+		t.Error("ImageReferences() with an image pinned by tag = nil, want error")
+	}
+}
+
+func TestPinnedImagesByImportPath(t *testing.T) {
+	base := mustRepository("gcr.io/pinned")
+	pinned := computeDigest(mustRepository("gcr.io/released"), fooRef, fooHash)
+	inputYAML := []byte(`metadata:
+  annotations:
+    ko.build/image: ` + fooRef + `=` + pinned + `
+spec:
+  containers:
+  - name: app
+    image: ko://` + fooRef + `
+  - name: sidecar
+    image: ko://` + barRef + `
+`)
+
+	// Only the sidecar may be built, the app is pinned.
+	builder := &supportAll{newFixedBuild(map[string]v1.Image{barRef: bar})}
+	outYAML, err := ImageReferences(inputYAML, true, builder, newFixedPublish(base, testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+
+	var obj struct {
+		Spec struct {
+			Containers []struct {
+				Image string
+			}
+		}
+	}
+	if err := yaml.Unmarshal(outYAML, &obj); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	var got []string
+	for _, c := range obj.Spec.Containers {
+		got = append(got, c.Image)
+	}
+	want := []string{pinned, computeDigest(base, barRef, barHash)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("images; (-want +got) = %v", diff)
+	}
+}
+
+func TestPinnedImageErrors(t *testing.T) {
+	pinned := computeDigest(mustRepository("gcr.io/released"), fooRef, fooHash)
+	tests := []struct {
+		desc   string
+		pin    string
+		images []string
+	}{{
+		desc:   "single image for two import paths",
+		pin:    pinned,
+		images: []string{fooRef, barRef},
+	}, {
+		desc:   "import path pinned twice",
+		pin:    fooRef + "=" + pinned + "," + fooRef + "=" + pinned,
+		images: []string{fooRef},
+	}, {
+		desc:   "images with and without import paths",
+		pin:    pinned + "," + barRef + "=" + pinned,
+		images: []string{fooRef, barRef},
+	}, {
+		desc:   "missing import path",
+		pin:    "=" + pinned,
+		images: []string{fooRef},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			inputYAML := "metadata:\n  annotations:\n    ko.build/image: " + test.pin + "\nspec:\n  containers:\n"
+			for _, image := range test.images {
+				inputYAML += "  - image: ko://" + image + "\n"
+			}
+			if _, err := ImageReferences([]byte(inputYAML), true, testBuilder, newFixedPublish(mustRepository("gcr.io/pinned"), testHashes)); err == nil {
+				t.Errorf("ImageReferences(%v) = nil, want error", inputYAML)
+			}
+		})
+	}
+}
+
+func TestPinnedImageSharedImportPath(t *testing.T) {
+	pinned := computeDigest(mustRepository("gcr.io/released"), fooRef, fooHash)
+	inputYAML := []byte(`metadata:
+  annotations:
+    ko.build/image: ` + pinned + `
+spec:
+  containers:
+  - image: ko://` + fooRef + `
+  initContainers:
+  - image: ko://` + fooRef + `
+`)
+	outYAML, err := ImageReferences(inputYAML, true, testBuilder, newFixedPublish(mustRepository("gcr.io/pinned"), testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	if got, want := bytes.Count(outYAML, []byte("- image: "+pinned)), 2; got != want {
+		t.Errorf("ImageReferences() pinned %d images, want %d:\n%s", got, want, outYAML)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/publish"
+)
+
+// platformParam is the query parameter that, when suffixed to a reference as
+// in ko://github.com/foo/bar?platform=linux/arm64, selects the platform to
+// build the import path for.  Several comma-separated platforms, as in
+// ?platform=linux/amd64,linux/arm64, build an image index of them.
+const platformParam = "platform"
+
+// splitPlatform splits a "?platform=" suffix off of ref, returning the rest of
+// ref and the platform it selects.  References without one are returned as
+// they are, with an empty platform.
+func splitPlatform(ref string) (string, string) {
+	i := strings.Index(ref, "?")
+	if i < 0 {
+		return ref, ""
+	}
+	query, err := url.ParseQuery(ref[i+1:])
+	if err != nil {
+		return ref, ""
+	}
+	platform := query.Get(platformParam)
+	if platform == "" {
+		return ref, ""
+	}
+	return ref[:i], platform
+}
+
+// parsePlatform parses a platform of the form os/arch[/variant].
+func parsePlatform(s string) (v1.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v1.Platform{}, fmt.Errorf("platform %q must be of the form os/arch[/variant]", s)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return v1.Platform{}, fmt.Errorf("platform %q must be of the form os/arch[/variant]", s)
+		}
+	}
+	platform := v1.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// parsePlatforms parses a comma-separated list of platforms of the form
+// os/arch[/variant].
+func parsePlatforms(s string) ([]v1.Platform, error) {
+	var platforms []v1.Platform
+	for _, p := range strings.Split(s, ",") {
+		platform, err := parsePlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// resolveTarget builds and publishes t, as an image index when it names
+// several platforms.
+func resolveTarget(builder build.Interface, publisher publish.Interface, t target) (name.Reference, error) {
+	if !strings.Contains(t.platform, ",") {
+		img, err := buildTarget(builder, t)
+		if err != nil {
+			return nil, err
+		}
+		return publishTarget(publisher, img, t)
+	}
+	idx, err := buildIndexTarget(builder, t)
+	if err != nil {
+		return nil, err
+	}
+	return publishIndexTarget(publisher, idx, t)
+}
+
+// buildIndexTarget builds t's import path for each of its platforms, into an
+// image index of them.
+func buildIndexTarget(builder build.Interface, t target) (v1.ImageIndex, error) {
+	platforms, err := parsePlatforms(t.platform)
+	if err != nil {
+		return nil, err
+	}
+	var adds []mutate.IndexAddendum
+	for _, platform := range platforms {
+		img, err := build.BuildPlatform(builder, t.importpath, platform)
+		if err != nil {
+			return nil, err
+		}
+		mt, err := img.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		platform := platform
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				MediaType: mt,
+				Platform:  &platform,
+			},
+		})
+	}
+	return mutate.AppendManifests(empty.Index, adds...), nil
+}
+
+// publishIndexTarget publishes the image index idx for t.  Indexes are
+// published under the publisher's own tags, as there is no way to choose
+// others for them.
+func publishIndexTarget(publisher publish.Interface, idx v1.ImageIndex, t target) (name.Reference, error) {
+	ip, ok := publisher.(publish.IndexPublisher)
+	if !ok {
+		return nil, fmt.Errorf("cannot publish %s for %s, the publisher doesn't support image indexes", t.importpath, t.platform)
+	}
+	if t.tag != "" {
+		log.Printf("WARNING: ignoring tag %q for %s, image indexes are published under the configured tags", t.tag, t.importpath)
+	}
+	return ip.PublishIndex(idx, t.importpath)
+}
+
+// buildTarget builds t's import path, for its platform if it has one.
+func buildTarget(builder build.Interface, t target) (v1.Image, error) {
+	if t.platform == "" {
+		return builder.Build(t.importpath)
+	}
+	platform, err := parsePlatform(t.platform)
+	if err != nil {
+		return nil, err
+	}
+	return build.BuildPlatform(builder, t.importpath, platform)
+}
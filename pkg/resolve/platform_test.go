@@ -0,0 +1,266 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/publish"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// platformBuild is a fixedBuild that can also build its import paths for a
+// platform, recording the platforms that it was asked for.
+type platformBuild struct {
+	build.Interface
+
+	images map[string]v1.Image
+
+	m         sync.Mutex
+	platforms []string
+}
+
+// BuildPlatform implements build.PlatformInterface
+func (pb *platformBuild) BuildPlatform(s string, platform v1.Platform) (v1.Image, error) {
+	p := platform.OS + "/" + platform.Architecture
+	pb.m.Lock()
+	pb.platforms = append(pb.platforms, s+"@"+p)
+	pb.m.Unlock()
+	if img, ok := pb.images[p]; ok {
+		return img, nil
+	}
+	return nil, fmt.Errorf("unsupported platform: %q", p)
+}
+
+// digestPublish publishes images by the import path and the digest of the
+// image, whichever image that is.
+type digestPublish struct {
+	base name.Repository
+
+	m         sync.Mutex
+	published []string
+}
+
+// Publish implements publish.Interface
+func (dp *digestPublish) Publish(img v1.Image, s string) (name.Reference, error) {
+	h, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	dp.m.Lock()
+	dp.published = append(dp.published, s)
+	dp.m.Unlock()
+	d, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", dp.base, s, h))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// PublishIndex implements publish.IndexPublisher
+func (dp *digestPublish) PublishIndex(idx v1.ImageIndex, s string) (name.Reference, error) {
+	h, err := idx.Digest()
+	if err != nil {
+		return nil, err
+	}
+	dp.m.Lock()
+	dp.published = append(dp.published, s)
+	dp.m.Unlock()
+	d, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", dp.base, s, h))
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func TestPlatformRefs(t *testing.T) {
+	arm64, amd64 := mustRandom(), mustRandom()
+	builder := &platformBuild{
+		Interface: testBuilder,
+		images: map[string]v1.Image{
+			"linux/arm64": arm64,
+			"linux/amd64": amd64,
+		},
+	}
+	base := mustRepository("gcr.io/platforms")
+	publisher := &digestPublish{base: base}
+
+	inputStructured := map[string]string{
+		"arm64":   "ko://" + fooRef + "?platform=linux/arm64",
+		"amd64":   "ko://" + fooRef + "?platform=linux/amd64",
+		"default": "ko://" + fooRef,
+	}
+	inputYAML, err := yaml.Marshal(inputStructured)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(%v) = %v", inputStructured, err)
+	}
+
+	outYAML, err := ImageReferences(inputYAML, true, builder, publisher)
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var outStructured map[string]string
+	if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+
+	// Each platform gets an image of its own, published to the import
+	// path's repository without the suffix.
+	want := map[string]string{
+		"arm64":   computeDigest(base, fooRef, mustDigest(arm64)),
+		"amd64":   computeDigest(base, fooRef, mustDigest(amd64)),
+		"default": computeDigest(base, fooRef, fooHash),
+	}
+	if diff := cmp.Diff(want, outStructured); diff != "" {
+		t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+	}
+
+	sort.Strings(builder.platforms)
+	if diff := cmp.Diff([]string{fooRef + "@linux/amd64", fooRef + "@linux/arm64"}, builder.platforms); diff != "" {
+		t.Errorf("platform builds; (-want +got) = %v", diff)
+	}
+	if diff := cmp.Diff([]string{fooRef, fooRef, fooRef}, publisher.published); diff != "" {
+		t.Errorf("published import paths; (-want +got) = %v", diff)
+	}
+}
+
+func TestPlatformIndexRefs(t *testing.T) {
+	arm64, amd64 := mustRandom(), mustRandom()
+	builder := &platformBuild{
+		Interface: testBuilder,
+		images: map[string]v1.Image{
+			"linux/arm64": arm64,
+			"linux/amd64": amd64,
+		},
+	}
+	base := mustRepository("gcr.io/platforms")
+	publisher := &digestPublish{base: base}
+
+	inputYAML := []byte("image: ko://" + fooRef + "?platform=linux/amd64,linux/arm64\n")
+	outYAML, err := ImageReferences(inputYAML, true, builder, publisher)
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var outStructured map[string]string
+	if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+
+	// The reference resolves to an index of the image built for each
+	// platform, in the order they were listed.
+	idx, err := buildIndexTarget(builder, target{importpath: fooRef, platform: "linux/amd64,linux/arm64"})
+	if err != nil {
+		t.Fatalf("buildIndexTarget() = %v", err)
+	}
+	h, err := idx.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if got, want := outStructured["image"], computeDigest(base, fooRef, h); got != want {
+		t.Errorf("ImageReferences(%v) = %v, want %v", string(inputYAML), got, want)
+	}
+	if diff := cmp.Diff([]string{fooRef}, publisher.published); diff != "" {
+		t.Errorf("published import paths; (-want +got) = %v", diff)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("IndexManifest() = %v", err)
+	}
+	var got []string
+	for _, desc := range im.Manifests {
+		got = append(got, desc.Platform.OS+"/"+desc.Platform.Architecture+"@"+desc.Digest.String())
+	}
+	want := []string{
+		"linux/amd64@" + mustDigest(amd64).String(),
+		"linux/arm64@" + mustDigest(arm64).String(),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("index manifests; (-want +got) = %v", diff)
+	}
+
+	// Publishers of images only can't publish it.
+	if _, err := ImageReferences(inputYAML, true, builder, struct{ publish.Interface }{publisher}); err == nil {
+		t.Errorf("ImageReferences(%v) without index support = nil, want error", string(inputYAML))
+	}
+}
+
+func TestPlatformRefsErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		builder build.Interface
+		ref     string
+	}{{
+		desc:    "builder without platform support",
+		builder: testBuilder,
+		ref:     "ko://" + fooRef + "?platform=linux/arm64",
+	}, {
+		desc:    "malformed platform",
+		builder: &platformBuild{Interface: testBuilder},
+		ref:     "ko://" + fooRef + "?platform=linux",
+	}, {
+		desc:    "malformed platform in a list",
+		builder: &platformBuild{Interface: testBuilder},
+		ref:     "ko://" + fooRef + "?platform=linux/amd64,linux",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			inputYAML := []byte("image: " + test.ref + "\n")
+			publisher := &digestPublish{base: mustRepository("gcr.io/platforms")}
+			if _, err := ImageReferences(inputYAML, true, test.builder, publisher); err == nil {
+				t.Errorf("ImageReferences(%v) = nil, want error", string(inputYAML))
+			}
+		})
+	}
+}
+
+func TestSplitPlatform(t *testing.T) {
+	tests := []struct {
+		ref          string
+		wantRef      string
+		wantPlatform string
+	}{{
+		ref:     fooRef,
+		wantRef: fooRef,
+	}, {
+		ref:          fooRef + "?platform=linux/arm64",
+		wantRef:      fooRef,
+		wantPlatform: "linux/arm64",
+	}, {
+		ref:          fooRef + "?platform=linux/arm/v7",
+		wantRef:      fooRef,
+		wantPlatform: "linux/arm/v7",
+	}, {
+		// Other queries aren't ours to strip.
+		ref:     "https://example.com/?q=ko",
+		wantRef: "https://example.com/?q=ko",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			ref, platform := splitPlatform(test.ref)
+			if ref != test.wantRef || platform != test.wantPlatform {
+				t.Errorf("splitPlatform(%q) = %q, %q, want %q, %q", test.ref, ref, platform, test.wantRef, test.wantPlatform)
+			}
+		})
+	}
+}
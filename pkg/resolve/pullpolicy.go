@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+// pullPolicies holds the values that imagePullPolicy may be set to.
+var pullPolicies = map[string]struct{}{
+	"Always":       {},
+	"IfNotPresent": {},
+	"Never":        {},
+}
+
+// setPullPolicy walks the resolved object obj2 alongside the object obj that
+// it was resolved from, and sets imagePullPolicy to policy on each mapping of
+// obj2 whose image was replaced, i.e. on each container whose reference was
+// resolved.  Containers that already referred to an image, even one that a
+// reference elsewhere resolved to, are left alone.
+func setPullPolicy(obj, obj2 interface{}, policy string) {
+	switch typed := obj.(type) {
+	case map[interface{}]interface{}:
+		typed2, ok := obj2.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		image, ok := typed["image"].(string)
+		image2, ok2 := typed2["image"].(string)
+		if ok && ok2 && image != image2 {
+			typed2["imagePullPolicy"] = policy
+		}
+		for k, v := range typed {
+			if v2, ok := typed2[k]; ok {
+				setPullPolicy(v, v2, policy)
+			}
+		}
+
+	case []interface{}:
+		typed2, ok := obj2.([]interface{})
+		if !ok || len(typed2) != len(typed) {
+			return
+		}
+		for i, v := range typed {
+			setPullPolicy(v, typed2[i], policy)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPullPolicy(t *testing.T) {
+	base := mustRepository("gcr.io/pullpolicy")
+	fooDigest := computeDigest(base, fooRef, fooHash)
+	barDigest := computeDigest(base, barRef, barHash)
+
+	input := []byte(`apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - name: foo
+    image: ko://` + fooRef + `
+  - name: sidecar
+    image: gcr.io/sidecar:latest
+    imagePullPolicy: Always
+  - name: pinned
+    image: ` + fooDigest + `
+    imagePullPolicy: Always
+  initContainers:
+  - name: bar
+    image: ko://` + barRef + `
+    imagePullPolicy: Always
+`)
+
+	type container struct {
+		Name            string `yaml:"name"`
+		Image           string `yaml:"image"`
+		ImagePullPolicy string `yaml:"imagePullPolicy,omitempty"`
+	}
+	type pod struct {
+		Spec struct {
+			Containers     []container `yaml:"containers"`
+			InitContainers []container `yaml:"initContainers"`
+		} `yaml:"spec"`
+	}
+
+	tests := []struct {
+		desc    string
+		opts    []Option
+		want    pod
+		wantErr bool
+	}{{
+		desc: "without pull policy",
+		want: func() pod {
+			var p pod
+			p.Spec.Containers = []container{
+				{Name: "foo", Image: fooDigest},
+				{Name: "sidecar", Image: "gcr.io/sidecar:latest", ImagePullPolicy: "Always"},
+				{Name: "pinned", Image: fooDigest, ImagePullPolicy: "Always"},
+			}
+			p.Spec.InitContainers = []container{
+				{Name: "bar", Image: barDigest, ImagePullPolicy: "Always"},
+			}
+			return p
+		}(),
+	}, {
+		// Only containers whose references were resolved get the policy,
+		// not those that already referred to the image.
+		desc: "IfNotPresent",
+		opts: []Option{WithPullPolicy("IfNotPresent")},
+		want: func() pod {
+			var p pod
+			p.Spec.Containers = []container{
+				{Name: "foo", Image: fooDigest, ImagePullPolicy: "IfNotPresent"},
+				{Name: "sidecar", Image: "gcr.io/sidecar:latest", ImagePullPolicy: "Always"},
+				{Name: "pinned", Image: fooDigest, ImagePullPolicy: "Always"},
+			}
+			p.Spec.InitContainers = []container{
+				{Name: "bar", Image: barDigest, ImagePullPolicy: "IfNotPresent"},
+			}
+			return p
+		}(),
+	}, {
+		desc:    "unknown policy",
+		opts:    []Option{WithPullPolicy("Sometimes")},
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			outYAML, err := ImageReferences(input, true, testBuilder, newFixedPublish(base, testHashes), test.opts...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ImageReferences() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got pod
+			if err := yaml.Unmarshal(outYAML, &got); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ImageReferences() (-want +got) = %v", diff)
+			}
+		})
+	}
+}
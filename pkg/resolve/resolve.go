@@ -18,9 +18,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log"
+	"os"
+	"regexp"
 	"strings"
 	"sync"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/ko/pkg/build"
 	"github.com/google/ko/pkg/publish"
 	"golang.org/x/sync/errgroup"
@@ -28,10 +32,20 @@ import (
 )
 
 // ImageReferences resolves supported references to images within the input yaml
-// to published image digests.
-func ImageReferences(input []byte, strict bool, builder build.Interface, publisher publish.Interface) ([]byte, error) {
+// to published image digests.  The documents are re-encoded with the keys of
+// their mappings sorted, while the items of sequences keep their order.
+// Aliases are expanded to the nodes they refer to, so references that are
+// anchored once and aliased elsewhere are resolved everywhere they appear.
+// References to import paths pinned by the ImageAnnotation of their document
+// are replaced with the pinned image without being built.
+func ImageReferences(input []byte, strict bool, builder build.Interface, publisher publish.Interface, opts ...Option) ([]byte, error) {
+	ro, err := makeOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	// First, walk the input objects and collect a list of supported references
-	refs := make(map[string]struct{})
+	refs := make(map[target]struct{})
 	// The loop is to support multi-document yaml files.
 	// This is handled by using a yaml.Decoder and reading objects until io.EOF, see:
 	// https://github.com/go-yaml/yaml/blob/v2.2.1/yaml.go#L124
@@ -44,39 +58,68 @@ func ImageReferences(input []byte, strict bool, builder build.Interface, publish
 			}
 			return nil, err
 		}
+		tag := tagHint(obj)
+		pinned, err := imagePins(obj)
+		if err != nil {
+			return nil, err
+		}
+		// The import paths that the document refers to, so that an image
+		// pinned without one isn't used for more than one of them.
+		importpaths := make(map[string]struct{})
 		// This simply returns the replaced object, which we discard during the gathering phase.
-		if _, err := replaceRecursive(obj, func(ref string) (string, error) {
+		if _, err := ro.replace(obj, ro.wrap(func(ref string) (string, error) {
 			strictRef := strings.HasPrefix(ref, "ko://")
 			if strict && !strictRef {
 				return ref, nil
 			}
-			tref := strings.TrimPrefix(ref, "ko://")
+			tref, platform := splitPlatform(strings.TrimPrefix(ref, "ko://"))
 			if builder.IsSupportedReference(tref) {
-				refs[tref] = struct{}{}
+				importpaths[tref] = struct{}{}
+				if image := pinned.image(tref); image != "" {
+					log.Printf("Using %s for %s, pinned by %s", image, ref, ImageAnnotation)
+					return ref, nil
+				}
+				if platform != "" {
+					if _, err := parsePlatforms(platform); err != nil {
+						return "", fmt.Errorf("reference %q: %v", ref, err)
+					}
+				}
+				refs[target{importpath: tref, tag: tag, platform: platform}] = struct{}{}
 			} else if strict && strictRef {
 				return "", fmt.Errorf("Found strict reference %q but %s is not a valid import path", ref, tref)
+			} else if strictRef {
+				// Outside of strict mode we don't fail, but an explicit reference
+				// that we can't build is almost certainly a mistake.
+				log.Printf("WARNING: ignoring reference %q, %s is not a supported import path", ref, tref)
 			}
 			return ref, nil
-		}); err != nil {
+		})); err != nil {
 			return nil, err
 		}
+		if _, ok := pinned[""]; ok && len(importpaths) > 1 {
+			return nil, fmt.Errorf("%s pins a single image, but the document refers to %d import paths; pin them as IMPORTPATH=IMAGE", ImageAnnotation, len(importpaths))
+		}
 	}
 
 	// Next, perform parallel builds for each of the supported references.
 	var sm sync.Map
 	var errg errgroup.Group
-	for ref := range refs {
-		ref := ref
+	for t := range refs {
+		t := t
 		errg.Go(func() error {
-			img, err := builder.Build(ref)
-			if err != nil {
-				return err
+			// Previously published images were built for the builder's own
+			// platform, so they can't stand in for a platform-qualified one.
+			if ro.reuse != nil && t.platform == "" {
+				if digest, ok := ro.reuse(t.importpath); ok {
+					sm.Store(t, digest)
+					return nil
+				}
 			}
-			digest, err := publisher.Publish(img, ref)
+			digest, err := resolveTarget(builder, publisher, t)
 			if err != nil {
 				return err
 			}
-			sm.Store(ref, digest.String())
+			sm.Store(t, digest.String())
 			return nil
 		})
 	}
@@ -96,20 +139,48 @@ func ImageReferences(input []byte, strict bool, builder build.Interface, publish
 			}
 			return nil, err
 		}
+		tag := tagHint(obj)
+		// Validated while gathering references.
+		pinned, _ := imagePins(obj)
 		// Recursively walk input, replacing supported reference with our computed digests.
-		obj2, err := replaceRecursive(obj, func(ref string) (string, error) {
-			if !builder.IsSupportedReference(ref) {
+		obj2, err := ro.replace(obj, ro.wrap(func(ref string) (string, error) {
+			if strict && !strings.HasPrefix(ref, "ko://") {
 				return ref, nil
 			}
-			ref = strings.TrimPrefix(ref, "ko://")
-			if val, ok := sm.Load(ref); ok {
-				return val.(string), nil
+			tref, platform := splitPlatform(strings.TrimPrefix(ref, "ko://"))
+			if !builder.IsSupportedReference(tref) {
+				return ref, nil
 			}
-			return "", fmt.Errorf("resolved reference to %q not found", ref)
-		})
+			digest := pinned.image(tref)
+			if digest == "" {
+				val, ok := sm.Load(target{importpath: tref, tag: tag, platform: platform})
+				if !ok {
+					return "", fmt.Errorf("resolved reference to %q not found", tref)
+				}
+				digest = val.(string)
+			}
+			if ro.record != nil {
+				ro.record(ref, digest)
+			}
+			return digest, nil
+		}))
 		if err != nil {
 			return nil, err
 		}
+		// Only the changes that resolution made are recorded, not those
+		// to the pull policy or namespace.
+		if ro.changes != nil {
+			changes(resourceName(obj2), obj, obj2, nil, ro.changes)
+		}
+		if ro.pullPolicy != "" {
+			setPullPolicy(obj, obj2, ro.pullPolicy)
+		}
+		if ro.namespace != "" {
+			setNamespace(obj2, ro.namespace, true)
+		}
+		if ro.defaultNamespace != "" {
+			setNamespace(obj2, ro.defaultNamespace, false)
+		}
 
 		if err := encoder.Encode(obj2); err != nil {
 			return nil, err
@@ -165,3 +236,151 @@ func replaceRecursive(obj interface{}, rs replaceString) (interface{}, error) {
 		return typed, nil
 	}
 }
+
+// replace walks obj with replaceRecursive, or only the configured paths or
+// fields within it, if any.
+func (ro *resolveOptions) replace(obj interface{}, rs replaceString) (interface{}, error) {
+	if len(ro.paths) > 0 {
+		return replaceMatching(obj, matchPaths(ro.paths), nil, rs)
+	}
+	if ro.fields != "" && ro.fields != AllFields {
+		return replaceMatching(obj, matchFields(ro.fields), nil, rs)
+	}
+	return replaceRecursive(obj, rs)
+}
+
+// wrap applies the configured options to how string leaves are replaced.
+func (ro *resolveOptions) wrap(rs replaceString) replaceString {
+	if ro.filepaths {
+		rs = replaceFilepaths(rs)
+	}
+	if ro.interpolated {
+		rs = replaceInterpolated(rs)
+	}
+	if ro.embedded {
+		rs = replaceEmbedded(rs)
+	}
+	return rs
+}
+
+// replaceFilepaths wraps the provided replaceString so that file:// references
+// are replaced with the sha256 digest of the named file's contents.
+func replaceFilepaths(rs replaceString) replaceString {
+	return func(s string) (string, error) {
+		if !strings.HasPrefix(s, "file://") {
+			return rs(s)
+		}
+		f, err := os.Open(strings.TrimPrefix(s, "file://"))
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		h, _, err := v1.SHA256(f)
+		if err != nil {
+			return "", err
+		}
+		return h.String(), nil
+	}
+}
+
+// interpolatedRegex matches the ${ko://...} references within a string.
+var interpolatedRegex = regexp.MustCompile(`\$\{(ko://[^}\s]+)\}`)
+
+// replaceInterpolated wraps the provided replaceString so that each
+// ${ko://...} reference within a string leaf is replaced on its own, leaving
+// the rest of the string as it is.  Strings without any are passed through.
+func replaceInterpolated(rs replaceString) replaceString {
+	return func(s string) (string, error) {
+		matches := interpolatedRegex.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			return rs(s)
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			ref := s[m[2]:m[3]]
+			ref2, err := rs(ref)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s[last:m[0]])
+			if ref2 == ref {
+				// Not something we resolve, so leave it as written.
+				b.WriteString(s[m[0]:m[1]])
+			} else {
+				b.WriteString(ref2)
+			}
+			last = m[1]
+		}
+		b.WriteString(s[last:])
+		return b.String(), nil
+	}
+}
+
+// replaceEmbedded wraps the provided replaceString so that multi-line string
+// leaves holding yaml documents are themselves walked recursively. When any
+// replacement is made within them, the documents are re-serialized back into
+// the string, otherwise the original string is left untouched.
+func replaceEmbedded(rs replaceString) replaceString {
+	var embedded replaceString
+	embedded = func(s string) (string, error) {
+		if !strings.Contains(s, "\n") {
+			return rs(s)
+		}
+		docs, ok := decodeEmbedded(s)
+		if !ok {
+			return rs(s)
+		}
+
+		changed := false
+		buf := bytes.NewBuffer(nil)
+		encoder := yaml.NewEncoder(buf)
+		for _, doc := range docs {
+			doc2, err := replaceRecursive(doc, func(ref string) (string, error) {
+				ref2, err := embedded(ref)
+				if ref2 != ref {
+					changed = true
+				}
+				return ref2, err
+			})
+			if err != nil {
+				return "", err
+			}
+			if err := encoder.Encode(doc2); err != nil {
+				return "", err
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			return "", err
+		}
+
+		if !changed {
+			return s, nil
+		}
+		return buf.String(), nil
+	}
+	return embedded
+}
+
+// decodeEmbedded parses the provided string as a stream of yaml documents,
+// and reports whether any of them are maps or arrays (as opposed to a plain
+// string that happens to span multiple lines).
+func decodeEmbedded(s string) ([]interface{}, bool) {
+	var docs []interface{}
+	structured := false
+	decoder := yaml.NewDecoder(strings.NewReader(s))
+	for {
+		var obj interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			if err == io.EOF {
+				return docs, structured
+			}
+			return nil, false
+		}
+		switch obj.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			structured = true
+		}
+		docs = append(docs, obj)
+	}
+}
@@ -16,7 +16,15 @@ package resolve
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -24,6 +32,8 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/ko/pkg/build"
+	"github.com/google/ko/pkg/publish"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -263,6 +273,181 @@ func TestStrict(t *testing.T) {
 	t.Log(string(outYAML))
 }
 
+// TestStrictKeys checks that ko:// references used as the keys of mappings,
+// as some custom resources do, are resolved like those used as values.
+func TestStrictKeys(t *testing.T) {
+	inputYAML := []byte(`apiVersion: example.com/v1
+kind: ImageSet
+spec:
+  images:
+    ko://` + fooRef + `:
+      replicas: 1
+    ko://` + barRef + `: ko://` + barRef + `
+    plain: value
+`)
+	base := mustRepository("gcr.io/keys")
+	outYAML, err := ImageReferences(inputYAML, true, testBuilder, newFixedPublish(base, testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var out struct {
+		Spec struct {
+			Images map[string]interface{}
+		}
+	}
+	if err := yaml.Unmarshal(outYAML, &out); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+
+	want := map[string]interface{}{
+		computeDigest(base, fooRef, fooHash): map[interface{}]interface{}{"replicas": 1},
+		computeDigest(base, barRef, barHash): computeDigest(base, barRef, barHash),
+		"plain":                              "value",
+	}
+	if diff := cmp.Diff(want, out.Spec.Images); diff != "" {
+		t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+	}
+}
+
+func TestUnsupportedStrictRefWarning(t *testing.T) {
+	typoRef := "ko://github.com/awesomesauce/fooo"
+	plainRef := "github.com/awesomesauce/not-a-ref"
+	inputYAML, err := yaml.Marshal([]string{"ko://" + fooRef, typoRef, plainRef})
+	if err != nil {
+		t.Fatalf("yaml.Marshal() = %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	base := mustRepository("gcr.io/typo")
+	outYAML, err := ImageReferences(inputYAML, false, testBuilder, newFixedPublish(base, testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var outStructured []string
+	if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+	expectedStructured := []string{computeDigest(base, fooRef, fooHash), typoRef, plainRef}
+	if diff := cmp.Diff(expectedStructured, outStructured); diff != "" {
+		t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+	}
+
+	if !strings.Contains(logs.String(), typoRef) {
+		t.Errorf("ImageReferences(%v) logged %q, want warning about %q", string(inputYAML), logs.String(), typoRef)
+	}
+	if strings.Contains(logs.String(), plainRef) {
+		t.Errorf("ImageReferences(%v) logged %q, want no warning about %q", string(inputYAML), logs.String(), plainRef)
+	}
+}
+
+func TestFilepathRefs(t *testing.T) {
+	f, err := ioutil.TempFile("", "ko")
+	if err != nil {
+		t.Fatalf("TempFile() = %v", err)
+	}
+	defer os.Remove(f.Name())
+	contents := []byte("some non-Go artifact")
+	if _, err := f.Write(contents); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	f.Close()
+	sum := sha256.Sum256(contents)
+	fileHash := "sha256:" + hex.EncodeToString(sum[:])
+
+	base := mustRepository("gcr.io/filepaths")
+	fileRef := "file://" + f.Name()
+	inputYAML, err := yaml.Marshal(map[string]string{
+		"checksum": fileRef,
+		"image":    fooRef,
+	})
+	if err != nil {
+		t.Fatalf("yaml.Marshal() = %v", err)
+	}
+
+	for _, test := range []struct {
+		desc     string
+		opts     []Option
+		expected string
+	}{{
+		desc:     "without filepath refs",
+		expected: fileRef,
+	}, {
+		desc:     "with filepath refs",
+		opts:     []Option{WithFilepathRefs()},
+		expected: fileHash,
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			outYAML, err := ImageReferences(inputYAML, false, testBuilder, newFixedPublish(base, testHashes), test.opts...)
+			if err != nil {
+				t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+			}
+			var outStructured map[string]string
+			if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+			expectedStructured := map[string]string{
+				"checksum": test.expected,
+				"image":    computeDigest(base, fooRef, fooHash),
+			}
+			if diff := cmp.Diff(expectedStructured, outStructured); diff != "" {
+				t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		inputYAML := []byte("checksum: file://" + f.Name() + "-missing\n")
+		if outYAML, err := ImageReferences(inputYAML, false, testBuilder, newFixedPublish(base, testHashes), WithFilepathRefs()); err == nil {
+			t.Errorf("ImageReferences(%v) = %v, want error", string(inputYAML), string(outYAML))
+		}
+	})
+}
+
+func TestReusedDigests(t *testing.T) {
+	base := mustRepository("gcr.io/reused")
+	reused := computeDigest(mustRepository("gcr.io/previous"), barRef, barHash)
+	inputYAML, err := yaml.Marshal([]string{fooRef, barRef})
+	if err != nil {
+		t.Fatalf("yaml.Marshal() = %v", err)
+	}
+
+	// Only foo may be built, bar must be reused.
+	builder := newFixedBuild(map[string]v1.Image{fooRef: foo})
+	reuse := func(ip string) (string, bool) {
+		if ip == barRef {
+			return reused, true
+		}
+		return "", false
+	}
+	supported := &supportAll{builder}
+
+	outYAML, err := ImageReferences(inputYAML, false, supported, newFixedPublish(base, testHashes), WithReusedDigests(reuse))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var outStructured []string
+	if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+	expectedStructured := []string{computeDigest(base, fooRef, fooHash), reused}
+	if diff := cmp.Diff(expectedStructured, outStructured); diff != "" {
+		t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+	}
+}
+
+// supportAll wraps a build.Interface, claiming to support every reference
+// that testBuilder does, whether or not the inner builder can build it.
+type supportAll struct {
+	build.Interface
+}
+
+func (s *supportAll) IsSupportedReference(ip string) bool {
+	return testBuilder.IsSupportedReference(ip)
+}
+
 func TestMultiDocumentYAMLs(t *testing.T) {
 	for _, test := range []struct {
 		desc   string
@@ -326,6 +511,326 @@ func TestMultiDocumentYAMLs(t *testing.T) {
 	}
 }
 
+func TestEmbeddedYAML(t *testing.T) {
+	base := mustRepository("gcr.io/embedded")
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: foo
+spec:
+  template:
+    spec:
+      containers:
+      - name: foo
+        image: ` + fooRef + `
+`
+	configMap := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"data": map[string]string{
+			"deployment.yaml": deployment,
+			"script.sh":       "#!/bin/sh\necho " + barRef + "\n",
+		},
+	}
+	inputYAML, err := yaml.Marshal(configMap)
+	if err != nil {
+		t.Fatalf("yaml.Marshal(%v) = %v", configMap, err)
+	}
+
+	for _, test := range []struct {
+		desc     string
+		opts     []Option
+		expected string
+	}{{
+		desc:     "without embedded resolution",
+		expected: fooRef,
+	}, {
+		desc:     "with embedded resolution",
+		opts:     []Option{WithEmbeddedYAML()},
+		expected: computeDigest(base, fooRef, fooHash),
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			outYAML, err := ImageReferences(inputYAML, false, testBuilder, newFixedPublish(base, testHashes), test.opts...)
+			if err != nil {
+				t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+			}
+			var outStructured struct {
+				Data map[string]string
+			}
+			if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+
+			// Plain multi-line strings should be left alone.
+			if got, want := outStructured.Data["script.sh"], configMap["data"].(map[string]string)["script.sh"]; got != want {
+				t.Errorf("script.sh = %q, want %q", got, want)
+			}
+
+			var embedded struct {
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []struct {
+								Image string
+							}
+						}
+					}
+				}
+			}
+			if err := yaml.Unmarshal([]byte(outStructured.Data["deployment.yaml"]), &embedded); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", outStructured.Data["deployment.yaml"], err)
+			}
+			containers := embedded.Spec.Template.Spec.Containers
+			if got, want := len(containers), 1; got != want {
+				t.Fatalf("len(containers) = %v, want %v", got, want)
+			}
+			if got, want := containers[0].Image, test.expected; got != want {
+				t.Errorf("image = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWorkloadKinds(t *testing.T) {
+	base := mustRepository("gcr.io/workloads")
+	podSpec := func(indent string) string {
+		return strings.Replace(`containers:
+- name: foo
+  image: ko://`+fooRef+`
+initContainers:
+- name: bar
+  image: ko://`+barRef+`
+`, "\n", "\n"+indent, -1)
+	}
+	tests := []struct {
+		kind  string
+		input string
+		path  []interface{}
+	}{{
+		kind: "Pod",
+		input: `apiVersion: v1
+kind: Pod
+spec:
+  ` + podSpec("  "),
+		path: []interface{}{"spec"},
+	}, {
+		kind: "Deployment",
+		input: `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      ` + podSpec("      "),
+		path: []interface{}{"spec", "template", "spec"},
+	}, {
+		kind: "StatefulSet",
+		input: `apiVersion: apps/v1
+kind: StatefulSet
+spec:
+  serviceName: foo
+  template:
+    spec:
+      ` + podSpec("      "),
+		path: []interface{}{"spec", "template", "spec"},
+	}, {
+		kind: "DaemonSet",
+		input: `apiVersion: apps/v1
+kind: DaemonSet
+spec:
+  selector:
+    matchLabels:
+      app: foo
+  template:
+    spec:
+      ` + podSpec("      "),
+		path: []interface{}{"spec", "template", "spec"},
+	}, {
+		kind: "Job",
+		input: `apiVersion: batch/v1
+kind: Job
+spec:
+  template:
+    spec:
+      ` + podSpec("      "),
+		path: []interface{}{"spec", "template", "spec"},
+	}, {
+		kind: "CronJob",
+		input: `apiVersion: batch/v1beta1
+kind: CronJob
+spec:
+  schedule: "*/1 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          ` + podSpec("          "),
+		path: []interface{}{"spec", "jobTemplate", "spec", "template", "spec"},
+	}, {
+		kind: "List",
+		input: `apiVersion: v1
+kind: List
+items:
+- apiVersion: batch/v1beta1
+  kind: CronJob
+  spec:
+    jobTemplate:
+      spec:
+        template:
+          spec:
+            ` + podSpec("            "),
+		path: []interface{}{"items", 0, "spec", "jobTemplate", "spec", "template", "spec"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			outYAML, err := ImageReferences([]byte(test.input), true, testBuilder, newFixedPublish(base, testHashes))
+			if err != nil {
+				t.Fatalf("ImageReferences(%v) = %v", test.input, err)
+			}
+			var outStructured interface{}
+			if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+
+			spec := outStructured
+			for _, p := range test.path {
+				switch p := p.(type) {
+				case string:
+					spec = spec.(map[interface{}]interface{})[p]
+				case int:
+					spec = spec.([]interface{})[p]
+				}
+			}
+			for field, want := range map[string]string{
+				"containers":     computeDigest(base, fooRef, fooHash),
+				"initContainers": computeDigest(base, barRef, barHash),
+			} {
+				containers := spec.(map[interface{}]interface{})[field].([]interface{})
+				got := containers[0].(map[interface{}]interface{})["image"]
+				if got != want {
+					t.Errorf("%s[0].image = %v, want %v", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomResourceKinds(t *testing.T) {
+	base := mustRepository("gcr.io/workloads")
+	foo := computeDigest(base, fooRef, fooHash)
+	bar := computeDigest(base, barRef, barHash)
+	type image struct {
+		path []interface{}
+		want string
+	}
+	tests := []struct {
+		kind   string
+		input  string
+		images []image
+	}{{
+		kind: "TaskRun",
+		input: `apiVersion: tekton.dev/v1beta1
+kind: TaskRun
+spec:
+  taskSpec:
+    steps:
+    - name: foo
+      image: ko://` + fooRef + `
+    - name: bar
+      image: ko://` + barRef + `
+    sidecars:
+    - name: foo
+      image: ko://` + fooRef + `
+`,
+		images: []image{
+			{[]interface{}{"spec", "taskSpec", "steps", 0, "image"}, foo},
+			{[]interface{}{"spec", "taskSpec", "steps", 1, "image"}, bar},
+			{[]interface{}{"spec", "taskSpec", "sidecars", 0, "image"}, foo},
+		},
+	}, {
+		kind: "Pipeline",
+		input: `apiVersion: tekton.dev/v1beta1
+kind: Pipeline
+spec:
+  tasks:
+  - name: build
+    taskSpec:
+      steps:
+      - name: foo
+        image: ko://` + fooRef + `
+`,
+		images: []image{
+			{[]interface{}{"spec", "tasks", 0, "taskSpec", "steps", 0, "image"}, foo},
+		},
+	}, {
+		kind: "Workflow",
+		input: `apiVersion: argoproj.io/v1alpha1
+kind: Workflow
+spec:
+  entrypoint: main
+  templates:
+  - name: main
+    steps:
+    - - name: foo
+        template: foo
+  - name: foo
+    container:
+      image: ko://` + fooRef + `
+  - name: bar
+    script:
+      image: ko://` + barRef + `
+      source: bar
+`,
+		images: []image{
+			{[]interface{}{"spec", "templates", 1, "container", "image"}, foo},
+			{[]interface{}{"spec", "templates", 2, "script", "image"}, bar},
+		},
+	}, {
+		kind: "CronWorkflow",
+		input: `apiVersion: argoproj.io/v1alpha1
+kind: CronWorkflow
+spec:
+  schedule: "*/1 * * * *"
+  workflowSpec:
+    templates:
+    - name: foo
+      container:
+        image: ko://` + fooRef + `
+`,
+		images: []image{
+			{[]interface{}{"spec", "workflowSpec", "templates", 0, "container", "image"}, foo},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			outYAML, err := ImageReferences([]byte(test.input), true, testBuilder, newFixedPublish(base, testHashes))
+			if err != nil {
+				t.Fatalf("ImageReferences(%v) = %v", test.input, err)
+			}
+			var outStructured interface{}
+			if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+
+			for _, img := range test.images {
+				got := outStructured
+				for _, p := range img.path {
+					switch p := p.(type) {
+					case string:
+						got = got.(map[interface{}]interface{})[p]
+					case int:
+						got = got.([]interface{})[p]
+					}
+				}
+				if got != img.want {
+					t.Errorf("%v = %v, want %v", img.path, got, img.want)
+				}
+			}
+		})
+	}
+}
+
 func mustRandom() v1.Image {
 	img, err := random.Image(1024, 5)
 	if err != nil {
@@ -357,3 +862,229 @@ func computeDigest(base name.Repository, ref string, h v1.Hash) string {
 	}
 	return d.String()
 }
+
+// taggingPublish wraps a publish.Interface, recording the tags that each
+// import path was published with.
+type taggingPublish struct {
+	publish.Interface
+
+	m    sync.Mutex
+	tags map[string][]string
+}
+
+func (tp *taggingPublish) PublishWithTags(img v1.Image, s string, tags []string) (name.Reference, error) {
+	tp.m.Lock()
+	tp.tags[s] = append(tp.tags[s], tags...)
+	tp.m.Unlock()
+	return tp.Publish(img, s)
+}
+
+func TestTagHints(t *testing.T) {
+	base := mustRepository("gcr.io/tagged")
+	inputYAML := []byte(`metadata:
+  name: stable
+spec:
+  image: ko://` + fooRef + `
+---
+metadata:
+  name: canary
+  annotations:
+    ko.build/tag: canary
+spec:
+  image: ko://` + fooRef + `
+---
+metadata:
+  name: edge
+  annotations:
+    ko.build/tag: edge
+spec:
+  image: ko://` + fooRef + `
+`)
+
+	publisher := &taggingPublish{
+		Interface: newFixedPublish(base, testHashes),
+		tags:      make(map[string][]string),
+	}
+	outYAML, err := ImageReferences(inputYAML, true, testBuilder, publisher)
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+
+	// Only the hinted references are published with tags of their own.
+	got := publisher.tags[fooRef]
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"canary", "edge"}, got); diff != "" {
+		t.Errorf("published tags; (-want +got) = %v", diff)
+	}
+
+	// Each reference is still replaced with the image's digest.
+	want := computeDigest(base, fooRef, fooHash)
+	decoder := yaml.NewDecoder(bytes.NewBuffer(outYAML))
+	for {
+		var obj struct {
+			Spec struct {
+				Image string
+			}
+		}
+		if err := decoder.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+		if obj.Spec.Image != want {
+			t.Errorf("image = %v, want %v", obj.Spec.Image, want)
+		}
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	base := mustRepository("gcr.io/sorted")
+	input := `spec:
+  template:
+    spec:
+      containers:
+      - name: zeta
+        image: ` + fooRef + `
+      - name: alpha
+        image: ` + barRef + `
+  replicas: 1
+metadata:
+  name: unsorted
+kind: Deployment
+`
+	want := `kind: Deployment
+metadata:
+  name: unsorted
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: ` + computeDigest(base, fooRef, fooHash) + `
+        name: zeta
+      - image: ` + computeDigest(base, barRef, barHash) + `
+        name: alpha
+`
+
+	got, err := ImageReferences([]byte(input), false, testBuilder, newFixedPublish(base, testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences() = %v", err)
+	}
+	// Mapping keys are sorted at every level, while the order of the
+	// items in sequences is kept.
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("ImageReferences(); (-want +got) = %v", diff)
+	}
+}
+
+func TestInterpolatedRefs(t *testing.T) {
+	base := mustRepository("gcr.io/interpolated")
+	fooDigest := computeDigest(base, fooRef, fooHash)
+	barDigest := computeDigest(base, barRef, barHash)
+
+	for _, test := range []struct {
+		desc     string
+		input    string
+		opts     []Option
+		expected string
+		wantErr  bool
+	}{{
+		desc:     "whole value",
+		input:    "ko://" + fooRef,
+		opts:     []Option{WithInterpolatedRefs()},
+		expected: fooDigest,
+	}, {
+		desc:     "whole value interpolated",
+		input:    "${ko://" + fooRef + "}",
+		opts:     []Option{WithInterpolatedRefs()},
+		expected: fooDigest,
+	}, {
+		desc:     "embedded",
+		input:    "--image=${ko://" + fooRef + "}",
+		opts:     []Option{WithInterpolatedRefs()},
+		expected: "--image=" + fooDigest,
+	}, {
+		desc:     "several embedded",
+		input:    "${ko://" + fooRef + "},${ko://" + barRef + "};${HOME}",
+		opts:     []Option{WithInterpolatedRefs()},
+		expected: fooDigest + "," + barDigest + ";${HOME}",
+	}, {
+		desc:    "unsupported import path",
+		input:   "--image=${ko://github.com/unknown/thing}",
+		opts:    []Option{WithInterpolatedRefs()},
+		wantErr: true,
+	}, {
+		desc:     "without interpolated refs",
+		input:    "--image=${ko://" + fooRef + "}",
+		expected: "--image=${ko://" + fooRef + "}",
+	}} {
+		t.Run(test.desc, func(t *testing.T) {
+			inputYAML, err := yaml.Marshal(map[string]string{"arg": test.input})
+			if err != nil {
+				t.Fatalf("yaml.Marshal() = %v", err)
+			}
+			outYAML, err := ImageReferences(inputYAML, true, testBuilder, newFixedPublish(base, testHashes), test.opts...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ImageReferences(%v) = %v, wantErr %v", string(inputYAML), err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var outStructured map[string]string
+			if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+				t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+			}
+			if diff := cmp.Diff(map[string]string{"arg": test.expected}, outStructured); diff != "" {
+				t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+			}
+		})
+	}
+}
+
+func TestAnchoredRefs(t *testing.T) {
+	base := mustRepository("gcr.io/anchored")
+	inputYAML := []byte(`images:
+  app: &app ko://` + fooRef + `
+defaults: &defaults
+  image: ko://` + barRef + `
+spec:
+  containers:
+  - name: first
+    image: *app
+  - name: second
+    image: *app
+  - <<: *defaults
+    name: third
+`)
+
+	outYAML, err := ImageReferences(inputYAML, true, testBuilder, newFixedPublish(base, testHashes))
+	if err != nil {
+		t.Fatalf("ImageReferences(%v) = %v", string(inputYAML), err)
+	}
+	var outStructured struct {
+		Images struct {
+			App string
+		}
+		Spec struct {
+			Containers []struct {
+				Name  string
+				Image string
+			}
+		}
+	}
+	if err := yaml.Unmarshal(outYAML, &outStructured); err != nil {
+		t.Fatalf("yaml.Unmarshal(%v) = %v", string(outYAML), err)
+	}
+
+	// The anchors and each of their aliases are resolved, including where
+	// they are merged into a mapping.
+	foo := computeDigest(base, fooRef, fooHash)
+	bar := computeDigest(base, barRef, barHash)
+	got := []string{outStructured.Images.App}
+	for _, c := range outStructured.Spec.Containers {
+		got = append(got, c.Image)
+	}
+	if diff := cmp.Diff([]string{foo, foo, foo, bar}, got); diff != "" {
+		t.Errorf("ImageReferences(%v); (-want +got) = %v", string(inputYAML), diff)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	yaml2json "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/yaml"
 )
@@ -35,7 +36,173 @@ func FilterBySelector(input []byte, selectorString string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return filterBy(input, func(obj *unstructured.Unstructured) bool {
+		return selector.Matches(labels.Set(obj.GetLabels()))
+	})
+}
+
+// FilterByAnnotationSelector filters out any resources
+// from the raw manifest bytes whose annotations
+// don't match the provided selector, which has
+// the syntax of a label selector
+func FilterByAnnotationSelector(input []byte, selectorString string) ([]byte, error) {
+	selector, err := parseAnnotationSelector(selectorString)
+	if err != nil {
+		return nil, err
+	}
+	return filterBy(input, func(obj *unstructured.Unstructured) bool {
+		return selector.matches(obj.GetAnnotations())
+	})
+}
+
+// annotationRequirement is a requirement of an annotation selector, e.g. the
+// key=value in key=value,other.
+type annotationRequirement struct {
+	key    string
+	op     selection.Operator
+	values []string
+}
+
+// annotationSelector matches annotations that meet all of its requirements.
+type annotationSelector []annotationRequirement
+
+// setBasedRE matches the set-based requirements of selectors, e.g.
+// "key in (a,b)" or "key notin (a,b)".
+var setBasedRE = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// parseAnnotationSelector parses a selector with the syntax of a label
+// selector.  labels.Parse can't parse it, as it only takes valid label
+// values, which annotations, e.g. URLs, often don't have: values here may be
+// anything but commas, and parentheses in set-based requirements, and are
+// taken with surrounding whitespace trimmed.
+func parseAnnotationSelector(s string) (annotationSelector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	terms, err := splitSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	var selector annotationSelector
+	for _, term := range terms {
+		r, err := parseAnnotationRequirement(strings.TrimSpace(term))
+		if err != nil {
+			return nil, fmt.Errorf("annotation selector %q: %v", s, err)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// splitSelector splits s into its requirements at the commas that aren't
+// within the parentheses of a set-based requirement.
+func splitSelector(s string) ([]string, error) {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return nil, fmt.Errorf("annotation selector %q has unbalanced parentheses", s)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("annotation selector %q has unbalanced parentheses", s)
+	}
+	return append(terms, s[start:]), nil
+}
+
+// parseAnnotationRequirement parses a single requirement of a selector.
+func parseAnnotationRequirement(term string) (annotationRequirement, error) {
+	if m := setBasedRE.FindStringSubmatch(term); m != nil {
+		r := annotationRequirement{key: m[1], op: selection.In}
+		if m[2] == "notin" {
+			r.op = selection.NotIn
+		}
+		for _, v := range strings.Split(m[3], ",") {
+			r.values = append(r.values, strings.TrimSpace(v))
+		}
+		return r, nil
+	}
+	for _, op := range []selection.Operator{selection.NotEquals, selection.DoubleEquals, selection.Equals} {
+		if i := strings.Index(term, string(op)); i >= 0 {
+			key := strings.TrimSpace(term[:i])
+			if !validSelectorKey(key) {
+				return annotationRequirement{}, fmt.Errorf("invalid key %q", key)
+			}
+			value := strings.TrimSpace(term[i+len(op):])
+			if op == selection.DoubleEquals {
+				op = selection.Equals
+			}
+			return annotationRequirement{key: key, op: op, values: []string{value}}, nil
+		}
+	}
+	if strings.HasPrefix(term, "!") {
+		key := strings.TrimSpace(term[1:])
+		if !validSelectorKey(key) {
+			return annotationRequirement{}, fmt.Errorf("invalid key %q", key)
+		}
+		return annotationRequirement{key: key, op: selection.DoesNotExist}, nil
+	}
+	if !validSelectorKey(term) {
+		return annotationRequirement{}, fmt.Errorf("invalid requirement %q", term)
+	}
+	return annotationRequirement{key: term, op: selection.Exists}, nil
+}
+
+// validSelectorKey reports whether key can be the key of a requirement.
+func validSelectorKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, " \t!=()")
+}
+
+// matches reports whether annotations meet all of the requirements of s.
+func (s annotationSelector) matches(annotations map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(annotations) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether annotations meet the requirement r.
+func (r annotationRequirement) matches(annotations map[string]string) bool {
+	v, ok := annotations[r.key]
+	switch r.op {
+	case selection.Exists:
+		return ok
+	case selection.DoesNotExist:
+		return !ok
+	case selection.Equals, selection.In:
+		return ok && containsValue(r.values, v)
+	case selection.NotEquals, selection.NotIn:
+		return !ok || !containsValue(r.values, v)
+	default:
+		return false
+	}
+}
+
+func containsValue(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
 
+// filterBy filters out any resources from the raw manifest bytes that
+// matches doesn't match.
+func filterBy(input []byte, matches func(*unstructured.Unstructured) bool) ([]byte, error) {
 	var outputObjectsYaml [][]byte
 
 	// parse runtime.Objects from the input yaml
@@ -49,15 +216,16 @@ func FilterBySelector(input []byte, selectorString string) ([]byte, error) {
 		// type *unstructured.Unstructured or *unstructured.UnstructuredList
 		switch unstructuredObj := object.obj.(type) {
 		case *unstructured.Unstructured:
-			// append the object if it matches the provided labels
-			if selector.Matches(labels.Set(unstructuredObj.GetLabels())) {
+			// append the object if it matches the provided selector
+			if matches(unstructuredObj) {
 				outputObjectsYaml = append(outputObjectsYaml, object.yaml)
 			}
 		case *unstructured.UnstructuredList:
-			// filter the list items based on label
+			// filter the list items based on the selector
 			var filteredItems []unstructured.Unstructured
-			for _, obj := range unstructuredObj.Items {
-				if selector.Matches(labels.Set(obj.GetLabels())) {
+			for i := range unstructuredObj.Items {
+				obj := unstructuredObj.Items[i]
+				if matches(&obj) {
 					filteredItems = append(filteredItems, obj)
 				}
 			}
@@ -149,3 +149,106 @@ func TestSelector(t *testing.T) {
 		})
 	}
 }
+
+const (
+	webAnnotatedPod = `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    docs: https://example.com/rss/site
+    team: web
+  name: rss-site
+`
+	dbAnnotatedPod = `apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    team: db
+  name: rss-db
+`
+	unannotatedPod = `apiVersion: v1
+kind: Pod
+metadata:
+  labels:
+    team: web
+  name: rss-cache
+`
+)
+
+func TestAnnotationSelector(t *testing.T) {
+	allPods := strings.Join([]string{webAnnotatedPod, dbAnnotatedPod, unannotatedPod}, "\n---\n")
+	tests := []struct {
+		desc     string
+		input    string
+		selector string
+		expected string
+	}{{
+		desc:     "equality",
+		input:    allPods,
+		selector: "team=web",
+		expected: webAnnotatedPod,
+	}, {
+		desc:     "inequality matches objects without the annotation",
+		input:    allPods,
+		selector: "team!=web",
+		expected: strings.Join([]string{dbAnnotatedPod, unannotatedPod}, "\n---\n"),
+	}, {
+		desc:     "set-based",
+		input:    allPods,
+		selector: "team in (db,infra)",
+		expected: dbAnnotatedPod,
+	}, {
+		desc:     "existence",
+		input:    allPods,
+		selector: "team",
+		expected: strings.Join([]string{webAnnotatedPod, dbAnnotatedPod}, "\n---\n"),
+	}, {
+		desc:     "double equality",
+		input:    allPods,
+		selector: "team==db",
+		expected: dbAnnotatedPod,
+	}, {
+		desc:     "values that aren't label values",
+		input:    allPods,
+		selector: "docs = https://example.com/rss/site",
+		expected: webAnnotatedPod,
+	}, {
+		desc:     "non-existence",
+		input:    allPods,
+		selector: "!team",
+		expected: unannotatedPod,
+	}, {
+		desc:     "set-based exclusion",
+		input:    allPods,
+		selector: "team notin (web, infra)",
+		expected: strings.Join([]string{dbAnnotatedPod, unannotatedPod}, "\n---\n"),
+	}, {
+		desc:     "multiple requirements",
+		input:    allPods,
+		selector: "team in (web,db),team!=db",
+		expected: webAnnotatedPod,
+	}, {
+		desc:     "labels are not annotations",
+		input:    unannotatedPod,
+		selector: "team=web",
+		expected: ``,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			filtered, err := FilterByAnnotationSelector([]byte(test.input), test.selector)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if strings.TrimSpace(string(filtered)) != strings.TrimSpace(test.expected) {
+				t.Errorf("expected \n%v\n to equal \n%v\n ", string(filtered), test.expected)
+			}
+		})
+	}
+
+	for _, selector := range []string{"team in (web", "team in ((web))", "=web", "team,", "!", "team web"} {
+		if _, err := FilterByAnnotationSelector([]byte(allPods), selector); err == nil {
+			t.Errorf("FilterByAnnotationSelector(%q) = nil, want error", selector)
+		}
+	}
+}
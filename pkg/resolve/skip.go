@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"bytes"
+	"regexp"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SkipAnnotation is the annotation that, when set to "true" on a document,
+// excludes it from resolution.
+const SkipAnnotation = "ko.build/skip"
+
+// ignoreCommentRegex matches a "# ko:ignore" comment on a line of its own,
+// which also excludes the document it appears in from resolution.
+var ignoreCommentRegex = regexp.MustCompile(`(?m)^\s*#\s*ko:ignore\s*$`)
+
+// separatorRegex matches the "---" lines that separate yaml documents.
+var separatorRegex = regexp.MustCompile(`^---(\s.*)?$`)
+
+// SplitDocuments splits a multi-document yaml stream into its documents,
+// without the "---" lines that separate them.
+func SplitDocuments(input []byte) [][]byte {
+	var docs [][]byte
+	var doc []byte
+	for _, line := range bytes.SplitAfter(input, []byte("\n")) {
+		if separatorRegex.Match(bytes.TrimRight(line, "\r\n")) {
+			docs = append(docs, doc)
+			doc = nil
+			continue
+		}
+		doc = append(doc, line...)
+	}
+	return append(docs, doc)
+}
+
+// Skipped reports whether the yaml document should be passed through
+// untouched instead of being resolved, because it carries the SkipAnnotation
+// or a "# ko:ignore" comment.
+func Skipped(doc []byte) bool {
+	if ignoreCommentRegex.Match(doc) {
+		return true
+	}
+	var obj struct {
+		Metadata struct {
+			Annotations map[string]string `yaml:"annotations"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal(doc, &obj); err != nil {
+		// Not an object, so it can't be annotated.
+		return false
+	}
+	return obj.Metadata.Annotations[SkipAnnotation] == "true"
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+	}{{
+		desc:  "single document",
+		input: "a: b\n",
+		want:  []string{"a: b\n"},
+	}, {
+		desc:  "leading separator",
+		input: "---\na: b\n",
+		want:  []string{"", "a: b\n"},
+	}, {
+		desc:  "separators with comments",
+		input: "a: b\n--- # second\nc: d\n---\ne: |\n  ---not a separator\n",
+		want:  []string{"a: b\n", "c: d\n", "e: |\n  ---not a separator\n"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var got []string
+			for _, doc := range SplitDocuments([]byte(test.input)) {
+				got = append(got, string(doc))
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("SplitDocuments(%q); (-want +got) = %v", test.input, diff)
+			}
+		})
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	tests := []struct {
+		desc string
+		doc  string
+		want bool
+	}{{
+		desc: "plain document",
+		doc:  "metadata:\n  name: foo\nimage: ko://github.com/foo/bar\n",
+	}, {
+		desc: "skip annotation",
+		doc:  "metadata:\n  annotations:\n    ko.build/skip: \"true\"\nimage: ko://github.com/foo/bar\n",
+		want: true,
+	}, {
+		desc: "skip annotation disabled",
+		doc:  "metadata:\n  annotations:\n    ko.build/skip: \"false\"\n",
+	}, {
+		desc: "ignore comment",
+		doc:  "# ko:ignore\nimage: ko://github.com/foo/bar\n",
+		want: true,
+	}, {
+		desc: "indented ignore comment",
+		doc:  "spec:\n  # ko:ignore\n  image: ko://github.com/foo/bar\n",
+		want: true,
+	}, {
+		desc: "ignore mentioned in a trailing comment",
+		doc:  "image: ko://github.com/foo/bar # not ko:ignore\n",
+	}, {
+		desc: "not an object",
+		doc:  "- ko://github.com/foo/bar\n",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := Skipped([]byte(test.doc)); got != test.want {
+				t.Errorf("Skipped(%q) = %v, want %v", test.doc, got, test.want)
+			}
+		})
+	}
+}
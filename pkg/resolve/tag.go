@@ -0,0 +1,84 @@
+// Copyright 2019 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"log"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/ko/pkg/publish"
+)
+
+// TagAnnotation is the annotation that, when set on a document, overrides
+// the tags that the images it references are published under.
+const TagAnnotation = "ko.build/tag"
+
+// target is an import path to publish, along with the tag it should be
+// published under in place of the publisher's own, if any, and the platform
+// it should be built for in place of the builder's own, if any.
+type target struct {
+	importpath string
+	tag        string
+	platform   string
+}
+
+// tagHint returns the value of the TagAnnotation on the decoded document obj,
+// or "" if it doesn't have one.
+func tagHint(obj interface{}) string {
+	return annotation(obj, TagAnnotation)
+}
+
+// annotation returns the value of the annotation key on the decoded document
+// obj, or "" if it doesn't have one.
+func annotation(obj interface{}, key string) string {
+	metadata, ok := field(obj, "metadata")
+	if !ok {
+		return ""
+	}
+	annotations, ok := field(metadata, "annotations")
+	if !ok {
+		return ""
+	}
+	value, ok := field(annotations, key)
+	if !ok {
+		return ""
+	}
+	s, _ := value.(string)
+	return s
+}
+
+// field returns the value of key within obj, if obj is a map.
+func field(obj interface{}, key string) (interface{}, bool) {
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, false
+	}
+	v, ok := m[key]
+	return v, ok
+}
+
+// publishTarget publishes img for t, under t's tag when it has one.
+func publishTarget(publisher publish.Interface, img v1.Image, t target) (name.Reference, error) {
+	if t.tag == "" {
+		return publisher.Publish(img, t.importpath)
+	}
+	tagger, ok := publisher.(publish.Tagger)
+	if !ok {
+		log.Printf("WARNING: ignoring tag %q for %s, the publisher doesn't support it", t.tag, t.importpath)
+		return publisher.Publish(img, t.importpath)
+	}
+	return tagger.PublishWithTags(img, t.importpath, []string{t.tag})
+}